@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codegangsta/aria/internal/frontend"
+	"github.com/codegangsta/aria/internal/local"
+)
+
+// ANSI sequences used when stdout is a terminal
+const (
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// runChat attaches to the running daemon and chats from the terminal
+// Lines are sent as messages; while buttons are shown, a number presses one
+func runChat(args []string, homeDir string) error {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	chatID := fs.Int64("chat", 0, "chat ID to attach to, e.g. a Telegram chat to continue (default: the local chat)")
+	socketPath := fs.String("socket", socketPath(homeDir), "daemon socket")
+	fs.Parse(args)
+
+	client, err := local.Dial(*socketPath, *chatID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	p := newChatPrinter(os.Stdout)
+	fmt.Fprintf(os.Stdout, "Attached to chat %d. Ctrl-D to detach.\n", client.ChatID)
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := client.Receive()
+			if err != nil {
+				done <- err
+				return
+			}
+			p.handle(msg)
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			p.userSent()
+			if data, ok := p.button(line); ok {
+				err = client.Press(data)
+			} else {
+				err = client.Send(line)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// socketPath is where the daemon listens for `aria chat`
+func socketPath(homeDir string) string {
+	return homeDir + "/.config/aria/aria.sock"
+}
+
+// chatPrinter renders daemon messages as terminal output
+// Edits to the last message rewrite it in place on a terminal
+type chatPrinter struct {
+	out       io.Writer
+	tty       bool
+	lastID    int64 // message printed last, 0 after user input
+	lastLines int
+	buttons   []frontend.Button // pending keyboard, flattened
+	keyboard  int64             // message the buttons belong to
+	mu        sync.Mutex
+}
+
+func newChatPrinter(out *os.File) *chatPrinter {
+	info, err := out.Stat()
+	return &chatPrinter{
+		out: out,
+		tty: err == nil && info.Mode()&os.ModeCharDevice != 0,
+	}
+}
+
+// handle prints one message from the daemon
+func (p *chatPrinter) handle(msg local.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch msg.Type {
+	case local.TypeMessage:
+		text := msg.Text
+		if msg.Keyboard != nil {
+			p.buttons = nil
+			p.keyboard = msg.ID
+			var labels []string
+			for _, row := range msg.Keyboard.Rows {
+				for _, b := range row {
+					p.buttons = append(p.buttons, b)
+					labels = append(labels, fmt.Sprintf("[%d] %s", len(p.buttons), b.Text))
+				}
+			}
+			text += "\n" + strings.Join(labels, "  ")
+		}
+		p.print(msg.ID, text, msg.Status)
+
+	case local.TypeEdit:
+		if msg.ID == p.keyboard {
+			p.buttons = nil
+		}
+		if p.tty && msg.ID == p.lastID {
+			p.erase()
+			p.print(msg.ID, msg.Text, msg.Status)
+		} else {
+			p.print(msg.ID, "✎ "+msg.Text, msg.Status)
+		}
+
+	case local.TypeDelete:
+		if msg.ID == p.keyboard {
+			p.buttons = nil
+		}
+		if p.tty && msg.ID == p.lastID {
+			p.erase()
+			p.lastID = 0
+		}
+
+	case local.TypeFile:
+		text := "📎 " + msg.Data
+		if msg.Text != "" {
+			text += "\n" + msg.Text
+		}
+		p.print(msg.ID, text, false)
+
+	case local.TypeAnswer:
+		if msg.Text != "" {
+			p.print(0, "→ "+msg.Text, true)
+		}
+	}
+}
+
+// print writes a message, dimmed if it's a status
+func (p *chatPrinter) print(id int64, text string, status bool) {
+	text = strings.TrimRight(text, "\n")
+	if status && p.tty {
+		text = ansiDim + text + ansiReset
+	}
+	fmt.Fprintln(p.out, text)
+	p.lastID = id
+	p.lastLines = strings.Count(text, "\n") + 1
+}
+
+// erase clears the last printed message
+func (p *chatPrinter) erase() {
+	fmt.Fprintf(p.out, "\x1b[%dA\r\x1b[J", p.lastLines)
+}
+
+// userSent notes that the user typed a line, so the last message is no
+// longer at the bottom of the screen
+func (p *chatPrinter) userSent() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastID = 0
+}
+
+// button returns the data of the pending keyboard button numbered by line
+func (p *chatPrinter) button(line string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(p.buttons) {
+		return "", false
+	}
+	data := p.buttons[n-1].Data
+	p.buttons = nil
+	return data, true
+}
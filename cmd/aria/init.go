@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codegangsta/aria/internal/skill"
+)
+
+// configTemplate is the starter config written by `aria init`
+const configTemplate = `# Aria configuration - see config.example.yaml for every option
+
+telegram:
+  # Bot token from @BotFather
+  token: ""
+
+claude:
+  # Prepended to every non-command message; "" sends messages as-is
+  message_prefix: "/aria"
+
+# Telegram user IDs allowed to use the bot (message @userinfobot to get yours)
+allowlist: []
+
+log_file: "/tmp/aria.log"
+`
+
+// runInit installs the bundled aria skill and a starter config
+// Existing files are kept unless -force is passed
+func runInit(args []string, homeDir string, configPath string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	force := fs.Bool("force", false, "overwrite the installed skill")
+	skillsDir := fs.String("skills-dir", filepath.Join(homeDir, ".claude", "skills"), "Claude skills directory")
+	fs.Parse(args)
+
+	path, installed, err := skill.Install(*skillsDir, *force)
+	if err != nil {
+		return err
+	}
+	if installed {
+		fmt.Printf("Installed aria skill: %s\n", path)
+	} else {
+		fmt.Printf("Skill already installed: %s (use -force to overwrite)\n", path)
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		fmt.Printf("Config already exists: %s\n", configPath)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	// Holds the bot token - keep it private
+	if err := os.WriteFile(configPath, []byte(configTemplate), 0600); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	fmt.Printf("Wrote config: %s\n", configPath)
+	fmt.Println("Add your bot token and Telegram user ID, then run aria.")
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,16 +10,24 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/codegangsta/aria/internal/claude"
 	"github.com/codegangsta/aria/internal/commands"
 	"github.com/codegangsta/aria/internal/config"
+	"github.com/codegangsta/aria/internal/frontend"
 	"github.com/codegangsta/aria/internal/handlers"
+	"github.com/codegangsta/aria/internal/inbox"
+	"github.com/codegangsta/aria/internal/local"
+	"github.com/codegangsta/aria/internal/matrix"
 	"github.com/codegangsta/aria/internal/mcp"
+	"github.com/codegangsta/aria/internal/permissions"
+	"github.com/codegangsta/aria/internal/slack"
 	"github.com/codegangsta/aria/internal/telegram"
 	"github.com/codegangsta/aria/internal/trackers"
+	"github.com/codegangsta/aria/internal/transcribe"
 )
 
 // Global vars for rebuild functionality
@@ -31,7 +40,7 @@ func main() {
 	configPath := flag.String("config", "", "path to config file")
 	claudePath := flag.String("claude", "claude", "path to claude binary")
 	sourceDirFlag := flag.String("source", "", "path to source directory (for /rebuild)")
-	mcpServer := flag.Bool("mcp-server", false, "run as MCP server (for Claude permission prompts)")
+	mcpServer := flag.Bool("mcp-server", false, "run as MCP server (for Claude permission prompts and send_file)")
 	flag.Parse()
 
 	// If running as MCP server, handle that and exit
@@ -72,6 +81,24 @@ func main() {
 		*configPath = homeDir + "/.config/aria/config.yaml"
 	}
 
+	// aria init - install the skill and a starter config, then exit
+	if flag.Arg(0) == "init" {
+		if err := runInit(flag.Args()[1:], homeDir, *configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "init failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// aria chat - attach to the running daemon from this terminal
+	if flag.Arg(0) == "chat" {
+		if err := runChat(flag.Args()[1:], homeDir); err != nil {
+			fmt.Fprintf(os.Stderr, "chat: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Println("Aria starting...")
 	fmt.Printf("Config: %s\n", *configPath)
 	fmt.Printf("Claude: %s\n", *claudePath)
@@ -89,37 +116,75 @@ func main() {
 		"allowlist_count", len(cfg.Allowlist),
 		"debug", cfg.Debug,
 		"skip_permissions", cfg.Claude.SkipPermissions,
+		"idle_timeout", cfg.Claude.IdleTimeout,
+		"max_processes", cfg.Claude.MaxProcesses,
+		"stream_partial", cfg.Claude.StreamPartial,
 	)
 
-	// Create components
-	manager := claude.NewManager(*claudePath, cfg.Debug, cfg.Claude.SkipPermissions, slog.Default())
-	sessionDiscovery := claude.NewSessionDiscovery(homeDir+"/.claude", slog.Default())
+	// Create context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Set up MCP callback server and bridge for permission prompts (if not skipping permissions)
-	var mcpBridge *mcp.BridgeManager
-	var callbackServer *mcp.CallbackServer
-	if !cfg.Claude.SkipPermissions {
-		// Start callback server first to get the port
-		var err error
-		callbackServer, err = mcp.NewCallbackServer(slog.Default())
-		if err != nil {
-			slog.Error("failed to create callback server", "error", err)
-			os.Exit(1)
-		}
-		callbackServer.Start()
-		defer callbackServer.Stop()
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		slog.Info("shutdown signal received", "signal", sig.String())
+		cancel()
+	}()
 
-		// Create bridge manager with callback port
-		mcpBridge, err = mcp.NewBridgeManager(executablePath, callbackServer.Port(), slog.Default())
-		if err != nil {
-			slog.Error("failed to create MCP bridge manager", "error", err)
-			os.Exit(1)
+	if err := run(ctx, cfg, *claudePath, homeDir); err != nil {
+		slog.Error("aria error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the daemon and blocks until ctx is cancelled
+// homeDir locates the persisted state (~/.config/aria) and Claude's sessions (~/.claude)
+func run(ctx context.Context, cfg *config.Config, claudePath string, homeDir string) error {
+	// Create components
+	manager := claude.NewManager(claudePath, cfg.Debug, cfg.Claude.SkipPermissions, slog.Default())
+	manager.SetIdlePolicy(cfg.Claude.IdleTimeout, cfg.Claude.MaxProcesses)
+	manager.SetStreamPartial(cfg.Claude.StreamPartial)
+	manager.SetModels(cfg.Claude.DefaultModel, cfg.Claude.FallbackModel)
+	manager.SetChatOptions(func(chatID int64) claude.ChatOptions {
+		opts := cfg.Claude.ForChat(chatID)
+		return claude.ChatOptions{
+			AllowedTools:       opts.AllowedTools,
+			DisallowedTools:    opts.DisallowedTools,
+			AppendSystemPrompt: opts.AppendSystemPrompt,
+			AddDirs:            opts.AddDirs,
+			ExtraArgs:          opts.ExtraArgs,
+			MessagePrefix:      opts.Prefix(),
 		}
-		defer mcpBridge.Cleanup()
+	})
+	sessionDiscovery := claude.NewSessionDiscovery(homeDir+"/.claude", slog.Default())
+
+	// Set up MCP callback server and bridge for send_file and permission prompts
+	// Start callback server first to get the port
+	callbackServer, err := mcp.NewCallbackServer(slog.Default())
+	if err != nil {
+		return fmt.Errorf("creating callback server: %w", err)
+	}
+	// Permission prompts can wait as long as permissions.timeout, or forever
+	if cfg.Permissions.Waits() {
+		callbackServer.SetPermissionTimeout(0)
+	} else {
+		callbackServer.SetPermissionTimeout(cfg.Permissions.TimeoutOrDefault())
+	}
+	callbackServer.Start()
+	defer callbackServer.Stop()
 
-		// We'll set the handler after trackerMgr is created (below)
-		slog.Info("MCP permission prompts enabled", "callback_port", callbackServer.Port())
+	// Create bridge manager with callback port
+	mcpBridge, err := mcp.NewBridgeManager(executablePath, callbackServer.Port(), slog.Default())
+	if err != nil {
+		return fmt.Errorf("creating MCP bridge manager: %w", err)
 	}
+	defer mcpBridge.Cleanup()
+
+	// We'll set the handlers after trackerMgr is created (below)
+	slog.Info("MCP server enabled", "callback_port", callbackServer.Port(), "permission_prompts", !cfg.Claude.SkipPermissions)
 
 	// Set up session persistence
 	sessionsPath := homeDir + "/.config/aria/sessions.yaml"
@@ -130,26 +195,74 @@ func main() {
 		slog.Info("loaded persisted sessions", "count", len(persistence.GetAll()))
 	}
 	manager.SetPersistence(persistence)
+	// Runs after the processes are shut down, so their sessions are saved
+	defer persistence.Flush()
+
+	// Token usage and cost accounting, stored next to sessions.yaml
+	usageStore := claude.NewUsageStore(homeDir + "/.config/aria/usage.yaml")
+	if err := usageStore.Load(); err != nil {
+		slog.Warn("failed to load usage", "error", err)
+	}
+	manager.SetUsageStore(usageStore)
+
+	// Which session each chat message belongs to, for replies to older messages
+	messageIndex := claude.NewMessageIndex(homeDir + "/.config/aria/messages.yaml")
+	// Matrix message IDs are assigned per run, so they can't be looked up after a restart
+	messageIndex.SetVolatile(matrix.IsChatID)
+	if err := messageIndex.Load(); err != nil {
+		slog.Warn("failed to load message index", "error", err)
+	}
+	// Tools the user has allowed permanently, consulted before prompting
+	permStore := permissions.NewStore(homeDir + "/.config/aria/permissions.yaml")
+	if err := permStore.Load(); err != nil {
+		slog.Warn("failed to load permission rules", "error", err)
+	}
+	manager.SetBudget(claude.Budget{
+		DailyUSD:        cfg.Budget.DailyUSD,
+		PerChatDailyUSD: cfg.Budget.PerChatDailyUSD,
+		ChatDailyUSD:    cfg.Budget.Chats,
+	})
+	// Runs after the processes are shut down, so their last turns are saved
+	defer usageStore.Flush()
 
-	bot, err := telegram.New(cfg.Telegram.Token, cfg.Allowlist, cfg.Debug, slog.Default())
+	fe, err := newFrontend(cfg, homeDir)
 	if err != nil {
-		slog.Error("failed to create telegram bot", "error", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Set up command router
 	cmdRouter := commands.NewRouter()
 	cmdRouter.Register(commands.NewClearCommand(manager))
 	cmdRouter.Register(commands.NewCdCommand(manager, homeDir))
-	cmdRouter.Register(commands.NewSessionsCommand(sessionDiscovery, bot))
-	cmdRouter.Register(commands.NewRebuildCommand(manager, bot, sourceDir, executablePath))
+	cmdRouter.Register(commands.NewSessionsCommand(sessionDiscovery, fe))
+	cmdRouter.Register(commands.NewRebuildCommand(manager, fe, sourceDir, executablePath))
 	cmdRouter.Register(commands.NewExitCommand())
+	cmdRouter.Register(commands.NewQueueCommand(manager))
+	cmdRouter.Register(commands.NewUsageCommand(manager, usageStore))
+	cmdRouter.Register(commands.NewModelCommand(manager, fe, cfg.Claude.Models))
+	cmdRouter.Register(commands.NewPermissionsCommand(permStore))
 
 	// Unified tracker manager for all chat-scoped state
-	trackerMgr := trackers.NewManager(bot)
+	trackerMgr := trackers.NewManager(fe)
+	cmdRouter.Register(commands.NewStopCommand(manager, trackerMgr))
+	// Keep processes with a question or permission prompt open for the answer
+	manager.SetWaiting(trackerMgr.Waiting)
+
+	// Claude sends files from the chat's working directory with send_file
+	callbackServer.SetSendFileHandler(func(ctx context.Context, req mcp.SendFileRequest) (string, error) {
+		path, err := chatFile(manager.GetCwd(req.ChatID), req.Path)
+		if err != nil {
+			return "", err
+		}
+		slog.Info("sending file", "chat_id", req.ChatID, "path", path)
+		if err := fe.SendFile(req.ChatID, path, req.Caption); err != nil {
+			return "", err
+		}
+		return path, nil
+	})
 
-	// Set up MCP callback handler now that we have trackerMgr and bot
-	if callbackServer != nil && mcpBridge != nil {
+	// Set up MCP callback handler now that we have trackerMgr and the frontend
+	if !cfg.Claude.SkipPermissions {
 		callbackServer.SetHandler(func(ctx context.Context, req mcp.PermissionRequest) (*mcp.PermissionResponse, error) {
 			chatID := req.ChatID
 			slog.Info("permission callback received",
@@ -157,90 +270,307 @@ func main() {
 				"tool", req.ToolName,
 			)
 
+			// send_file is confined to the chat's directory, so it needs no prompt
+			if req.ToolName == mcp.SendFileToolName {
+				return &mcp.PermissionResponse{Behavior: "allow", UpdatedInput: req.Input}, nil
+			}
+
+			// Tools covered by a saved rule run without asking
+			if rule := permStore.Match(chatID, manager.GetCwd(chatID), req.ToolName, req.Input); rule != nil {
+				slog.Info("permission allowed by rule", "chat_id", chatID, "tool", req.ToolName, "rule", rule.String())
+				return &mcp.PermissionResponse{Behavior: "allow", UpdatedInput: req.Input}, nil
+			}
+
 			// Create response channel
 			respChan := make(chan *trackers.PermissionResult, 1)
 
-			// Build and send permission keyboard
-			keyboard, text := telegram.BuildPermissionKeyboard("perm", req.ToolName, req.Input)
-			msgID, err := bot.SendPermissionKeyboard(chatID, text, keyboard)
+			// Store pending permission under a new request ID, so parallel
+			// requests (e.g. from subagents) each get their own prompt
+			cwd := manager.GetCwd(chatID)
+			if cwd == "" {
+				cwd, _ = os.Getwd()
+			}
+			pending := &trackers.PendingPermission{
+				ToolName: req.ToolName,
+				Input:    req.Input,
+				Cwd:      cwd,
+				Response: respChan,
+			}
+			id := trackerMgr.AddPermission(chatID, pending)
+
+			// Build and send permission keyboard, with "Allow all pending" if
+			// other requests are waiting too
+			allowAll := len(trackerMgr.Permissions(chatID)) > 1
+			keyboard, text := frontend.BuildPermissionKeyboard(id, req.ToolName, req.Input, cwd, false, allowAll)
+			msgID, err := fe.SendKeyboard(chatID, text, keyboard)
 			if err != nil {
+				trackerMgr.TakePermission(chatID, id)
 				return &mcp.PermissionResponse{
 					Behavior: "deny",
 					Message:  fmt.Sprintf("Failed to send keyboard: %v", err),
 				}, nil
 			}
+			if !trackerMgr.SetPermissionMessage(chatID, id, msgID) {
+				// Answered or expanded before the prompt's ID was recorded
+				fe.DeleteMessage(chatID, msgID)
+			}
 
-			// Store pending permission
-			trackerMgr.SetPermission(chatID, &trackers.PendingPermission{
-				ToolID:    "perm",
-				ToolName:  req.ToolName,
-				Input:     req.Input,
-				MessageID: msgID,
-				Response:  respChan,
-			})
+			// Remove the prompt, which "Show more" may have re-sent under a new ID
+			// Returns false if it was answered in the meantime
+			clearPrompt := func() bool {
+				p := trackerMgr.TakePermission(chatID, id)
+				if p == nil {
+					return false
+				}
+				if p.MessageID > 0 {
+					fe.DeleteMessage(chatID, p.MessageID)
+				}
+				return true
+			}
+
+			// remind re-sends the prompt with a note on top, so it notifies again
+			remind := func(note string) {
+				p := trackerMgr.GetPermission(chatID, id)
+				if p == nil {
+					return
+				}
+				allowAll := len(trackerMgr.Permissions(chatID)) > 1
+				keyboard, text := frontend.BuildPermissionKeyboard(id, p.ToolName, p.Input, p.Cwd, false, allowAll)
+				newID, err := fe.SendKeyboard(chatID, note+"\n\n"+text, keyboard)
+				if err != nil {
+					slog.Error("failed to send permission reminder", "error", err)
+					return
+				}
+				prevID, ok := trackerMgr.ReplacePermissionMessage(chatID, id, newID)
+				if !ok {
+					// Answered while the reminder was being sent
+					prevID = newID
+				}
+				if prevID > 0 {
+					fe.DeleteMessage(chatID, prevID)
+				}
+			}
 
-			// Wait for user response (with timeout)
-			select {
-			case result := <-respChan:
+			// answer passes the user's choice back to Claude
+			answer := func(result *trackers.PermissionResult) (*mcp.PermissionResponse, error) {
 				return &mcp.PermissionResponse{
 					Behavior:     result.Behavior,
 					UpdatedInput: result.UpdatedInput,
 					Message:      result.Message,
 				}, nil
-			case <-ctx.Done():
-				trackerMgr.ClearPermission(chatID)
-				bot.DeleteMessage(chatID, msgID)
-				return &mcp.PermissionResponse{
-					Behavior: "deny",
-					Message:  "Request cancelled",
-				}, nil
-			case <-time.After(2 * time.Minute):
-				trackerMgr.ClearPermission(chatID)
-				bot.DeleteMessage(chatID, msgID)
-				return &mcp.PermissionResponse{
-					Behavior: "deny",
-					Message:  "Permission request timed out",
-				}, nil
 			}
-		})
 
-		// Set up MCP config with per-chat config function
-		manager.SetMCPConfig(&claude.MCPConfig{
-			ToolName:   mcpBridge.GetToolName(),
-			ConfigFunc: mcpBridge.GetConfigPath,
+			// Wait for the user, reminding them halfway through the timeout
+			timeout := cfg.Permissions.TimeoutOrDefault()
+			onTimeout := cfg.Permissions.OnTimeoutFor(req.ToolName)
+			reminder := time.NewTimer(timeout / 2)
+			defer reminder.Stop()
+			expiry := time.NewTimer(timeout)
+			defer expiry.Stop()
+			expired := expiry.C
+
+			for {
+				select {
+				case result := <-respChan:
+					return answer(result)
+
+				case <-ctx.Done():
+					if !clearPrompt() {
+						return answer(<-respChan)
+					}
+					return &mcp.PermissionResponse{
+						Behavior: "deny",
+						Message:  "Request cancelled",
+					}, nil
+
+				case <-reminder.C:
+					switch onTimeout {
+					case config.OnTimeoutAllow:
+						remind(fmt.Sprintf("Still waiting - allowing in %s", shortDuration(timeout-timeout/2)))
+					case config.OnTimeoutWait:
+						remind("Still waiting for an answer")
+					default:
+						remind(fmt.Sprintf("Still waiting - denying in %s", shortDuration(timeout-timeout/2)))
+					}
+
+				case <-expired:
+					if onTimeout == config.OnTimeoutWait {
+						// Remind once more, then wait for as long as it takes
+						remind(fmt.Sprintf("Still waiting after %s", shortDuration(timeout)))
+						expired = nil
+						continue
+					}
+					if !clearPrompt() {
+						return answer(<-respChan)
+					}
+					slog.Info("permission request timed out", "chat_id", chatID, "tool", req.ToolName, "on_timeout", onTimeout)
+					if onTimeout == config.OnTimeoutAllow {
+						fe.SendMessage(chatID, fmt.Sprintf("No answer after %s, allowed %s", shortDuration(timeout), req.ToolName), true)
+						return &mcp.PermissionResponse{Behavior: "allow", UpdatedInput: req.Input}, nil
+					}
+					fe.SendMessage(chatID, fmt.Sprintf("No answer after %s, denied %s", shortDuration(timeout), req.ToolName), true)
+					return &mcp.PermissionResponse{
+						Behavior: "deny",
+						Message:  "Permission request timed out",
+					}, nil
+				}
+			}
 		})
+
 		slog.Info("MCP permission callback handler configured")
 	}
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Set up MCP config with per-chat config function
+	manager.SetMCPConfig(&claude.MCPConfig{
+		ToolName:   mcpBridge.GetToolName(),
+		ConfigFunc: mcpBridge.GetConfigPath,
+	})
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-sigChan
-		slog.Info("shutdown signal received", "signal", sig.String())
-		manager.Shutdown()
-		cancel()
-	}()
+	// Stop Claude processes once the frontend has stopped
+	defer manager.Shutdown()
+
+	// Close idle Claude processes in the background (they resume on next message)
+	manager.StartReaper(ctx)
+
+	// recordMessage notes the session a handled message went to
+	recordMessage := func(chatID int64, msgID int64) {
+		if messageIndex.Record(chatID, msgID, manager.SessionID(chatID)) {
+			if err := messageIndex.Save(); err != nil {
+				slog.Warn("failed to save message index", "error", err)
+			}
+		}
+	}
+
+	// sendTurn sends a message to Claude on behalf of a button press, with
+	// replies going straight to the frontend
+	sendTurn := func(ctx context.Context, chatID int64, msgID int64, text string, images []claude.Image) {
+		// Start typing indicator
+		stopTyping := fe.TypingLoop(chatID)
+		defer stopTyping()
+
+		// Build response callbacks using shared handler
+		cb := &handlers.CallbackBuilder{
+			ChatID:     chatID,
+			TrackerMgr: trackerMgr,
+			Frontend:   fe,
+			SendFn: func(text string, silent bool) {
+				fe.SendMessage(chatID, text, silent)
+			},
+			Logger:      slog.Default(),
+			UsageFooter: cfg.Claude.UsageFooter,
+		}
+
+		err := manager.Send(ctx, chatID, text, images, cb.Build())
+		if errors.Is(err, claude.ErrTurnDropped) {
+			return
+		}
+
+		if errors.Is(err, claude.ErrBudgetExceeded) {
+			fe.SendMessage(chatID, fmt.Sprintf("Not sent: %v. New messages resume tomorrow.", err), false)
+			return
+		}
+		if err != nil {
+			slog.Error("error sending callback response to claude", "error", err)
+			fe.SendMessage(chatID, "Sorry, something went wrong.", false)
+			return
+		}
+		recordMessage(chatID, msgID)
+	}
+
+	// resolvePermission answers a pending permission prompt and removes it
+	// Taking it first means a prompt is answered once, and its message is
+	// deleted under the latest ID (a prompt still being sent deletes itself)
+	resolvePermission := func(chatID int64, pending *trackers.PendingPermission, result *trackers.PermissionResult) {
+		p := trackerMgr.TakePermission(chatID, pending.ToolID)
+		if p == nil {
+			slog.Warn("permission already answered", "chat_id", chatID, "request_id", pending.ToolID)
+			return
+		}
+		p.Response <- result
+		// Delete the keyboard message
+		if p.MessageID > 0 {
+			fe.DeleteMessage(chatID, p.MessageID)
+		}
+	}
+
+	// repromptPermission sends a pending permission's prompt again in place of
+	// the last one, expanded by Show more or with an edited command or path
+	repromptPermission := func(chatID int64, p *trackers.PendingPermission, expanded bool) error {
+		allowAll := len(trackerMgr.Permissions(chatID)) > 1
+		keyboard, text := frontend.BuildPermissionKeyboard(p.ToolID, p.ToolName, p.Input, p.Cwd, expanded, allowAll)
+		msgID, err := fe.SendKeyboard(chatID, text, keyboard)
+		if err != nil {
+			return err
+		}
+		prevID, ok := trackerMgr.ReplacePermissionMessage(chatID, p.ToolID, msgID)
+		if !ok {
+			// Answered while the new prompt was being sent
+			prevID = msgID
+		}
+		if prevID > 0 {
+			fe.DeleteMessage(chatID, prevID)
+		}
+		return nil
+	}
 
 	// Set up message handler
-	bot.SetHandler(func(msgCtx context.Context, chatID int64, userID int64, msgID int64, text string, respond telegram.RespondFunc, replyHTML telegram.ReplyHTMLFunc) {
+	fe.SetHandler(func(msgCtx context.Context, chatID int64, userID int64, msgID int64, text string, attachments []frontend.Attachment, reply *frontend.Reply, respond frontend.RespondFunc) {
 		slog.Info("processing message",
 			"chat_id", chatID,
 			"user_id", userID,
 			"msg_id", msgID,
 			"text_length", len(text),
+			"attachments", len(attachments),
+			"reply", reply != nil,
 		)
 
+		// After Edit on a permission prompt, the next message replaces the
+		// command or path, and the prompt is sent again to approve it. Aria's
+		// own commands (/stop, /queue...) still run instead of being used
+		cmdName, _ := commands.ParseCommand(text)
+		routed := cmdName != "" && cmdRouter.Lookup(cmdName) != nil
+		if pending := trackerMgr.EditingPermission(chatID); pending != nil && len(attachments) == 0 && !routed {
+			updated, err := permissions.EditInput(pending.ToolName, pending.Input, text, pending.Cwd)
+			if err != nil {
+				respond(fmt.Sprintf("Can't use that: %v. Send it again, or tap Cancel.", err), false)
+				return
+			}
+			edited := trackerMgr.SetPermissionInput(chatID, pending.ToolID, updated)
+			if edited == nil {
+				return
+			}
+			slog.Info("permission input edited", "chat_id", chatID, "tool", pending.ToolName)
+			if err := repromptPermission(chatID, edited, false); err != nil {
+				slog.Error("failed to send edited permission prompt", "error", err)
+				respond("Couldn't show the edited request. Allow on the earlier prompt uses the edit.", false)
+			}
+			return
+		}
+
 		// Start typing indicator loop
-		stopTyping := bot.TypingLoop(chatID)
+		stopTyping := fe.TypingLoop(chatID)
 		defer stopTyping()
 
+		// Attachments are saved to the chat's inbox and referenced in the
+		// prompt; images are also sent inline so Claude sees them directly
+		var images []claude.Image
+		if len(attachments) > 0 {
+			paths, err := inbox.Save(manager.GetCwd(chatID), chatID, attachments, time.Now())
+			if err != nil {
+				slog.Error("failed to save attachments", "chat_id", chatID, "error", err)
+				respond(fmt.Sprintf("Couldn't save attachment: %v", err), false)
+				return
+			}
+			for _, a := range attachments {
+				if a.IsImage() {
+					images = append(images, claude.Image{MediaType: a.MimeType, Data: a.Data})
+				}
+			}
+			text = inbox.Prompt(text, paths)
+		}
+
 		// Check if this is a routed command (clear, rebuild, cd, sessions)
-		if cmdName, cmdArgs := commands.ParseCommand(text); cmdName != "" {
+		if cmdName, cmdArgs := commands.ParseCommand(text); cmdName != "" && len(attachments) == 0 {
 			if cmd := cmdRouter.Lookup(cmdName); cmd != nil {
 				resp, err := cmd.Execute(msgCtx, chatID, cmdArgs)
 				if err != nil {
@@ -261,6 +591,30 @@ func main() {
 			slog.Debug("handling silent command", "command", text)
 		}
 
+		// A reply carries the replied-to message as context. If that message
+		// is from another session, ask which session to send it to first
+		if reply != nil && !strings.HasPrefix(text, "/") {
+			text = reply.Prompt(text)
+
+			sessionID := messageIndex.Lookup(chatID, reply.MessageID)
+			if reply.MessageID != 0 && sessionID != "" && sessionID != manager.SessionID(chatID) {
+				slog.Info("reply to another session", "chat_id", chatID, "session_id", sessionID)
+				offer := fmt.Sprintf("That message is from an earlier session (%s). Switch to it before sending?", shortSessionID(sessionID))
+				keyboardID, err := fe.SendKeyboard(chatID, offer, frontend.BuildReplyKeyboard())
+				if err == nil {
+					trackerMgr.SetReply(chatID, &trackers.PendingReply{
+						Text:          text,
+						Images:        images,
+						SessionID:     sessionID,
+						MessageID:     keyboardID,
+						UserMessageID: msgID,
+					})
+					return
+				}
+				slog.Error("failed to send session switch offer", "error", err)
+			}
+		}
+
 		// Track if we got any response
 		gotResponse := false
 
@@ -268,20 +622,29 @@ func main() {
 		cb := &handlers.CallbackBuilder{
 			ChatID:     chatID,
 			TrackerMgr: trackerMgr,
-			Bot:        bot,
+			Frontend:   fe,
 			SendFn: func(text string, silent bool) {
 				gotResponse = true
 				respond(text, silent)
 			},
-			Logger: slog.Default(),
+			Logger:      slog.Default(),
+			UsageFooter: cfg.Claude.UsageFooter,
 		}
 
-		// Send message via persistent process manager
-		err := manager.Send(msgCtx, chatID, text, cb.Build())
+		// Send message via persistent process manager (waits in the chat's queue if busy)
+		err := manager.Send(msgCtx, chatID, text, images, cb.Build())
 
-		// Clear the trackers after response is complete
-		cb.ClearTrackers()
+		// Dropped from the queue via /queue - the running turn still owns the
+		// trackers, which Send clears through OnTurnEnd for turns that ran
+		if errors.Is(err, claude.ErrTurnDropped) {
+			slog.Info("queued message dropped", "chat_id", chatID, "msg_id", msgID)
+			return
+		}
 
+		if errors.Is(err, claude.ErrBudgetExceeded) {
+			respond(fmt.Sprintf("Not sent: %v. New messages resume tomorrow.", err), false)
+			return
+		}
 		if err != nil {
 			slog.Error("claude error",
 				"chat_id", chatID,
@@ -296,16 +659,20 @@ func main() {
 			respond(confirmation, false) // Play sound for confirmations
 		}
 
-		// Register slash commands with Telegram after first successful message
+		if err == nil {
+			recordMessage(chatID, msgID)
+		}
+
+		// Register slash commands with the frontend after first successful message
 		// (commands are discovered when Claude process starts)
 		if commands := manager.GetSlashCommands(); commands != nil {
-			bot.RegisterCommands(commands)
+			fe.RegisterCommands(commands)
 		}
 	})
 
-	// Set up callback handler for inline keyboard button presses
-	bot.SetCallbackHandler(func(cbCtx context.Context, chatID int64, userID int64, data string) string {
-		cb, err := telegram.ParseCallbackData(data)
+	// Set up callback handler for keyboard button presses
+	fe.SetCallbackHandler(func(cbCtx context.Context, chatID int64, userID int64, data string) string {
+		cb, err := frontend.ParseCallbackData(data)
 		if err != nil {
 			slog.Error("failed to parse callback data", "error", err, "data", data)
 			return "Error processing selection"
@@ -313,13 +680,73 @@ func main() {
 
 		// Handle permission callbacks
 		if cb.Type == "p" {
-			pending := trackerMgr.GetPermission(chatID)
+			pending := trackerMgr.GetPermission(chatID, cb.ToolID)
 			if pending == nil {
-				slog.Warn("no pending permission for chat", "chat_id", chatID)
+				slog.Warn("no pending permission for request", "chat_id", chatID, "request_id", cb.ToolID)
 				return "Permission request expired"
 			}
 
+			// Allow all pending answers every request waiting in the chat
+			if cb.Action == "all" {
+				all := trackerMgr.Permissions(chatID)
+				for _, p := range all {
+					resolvePermission(chatID, p, &trackers.PermissionResult{
+						Behavior:     "allow",
+						UpdatedInput: p.Input,
+					})
+				}
+				slog.Info("all pending permissions allowed", "chat_id", chatID, "count", len(all))
+				return fmt.Sprintf("Allowed %d pending request(s)", len(all))
+			}
+
+			// Show more re-sends the prompt with the full preview, sending it
+			// in parts first if it's too long for one message
+			if cb.Action == "m" {
+				for _, part := range frontend.PermissionPreview(pending.ToolName, pending.Input, pending.Cwd) {
+					if err := fe.SendMessage(chatID, part, true); err != nil {
+						slog.Error("failed to send permission preview", "error", err)
+						return "Error showing more"
+					}
+				}
+				if err := repromptPermission(chatID, pending, true); err != nil {
+					slog.Error("failed to expand permission prompt", "error", err)
+					return "Error showing more"
+				}
+				return ""
+			}
+
+			// Edit waits for the user's next message to replace the command or path
+			if cb.Action == "e" {
+				field := permissions.EditField(pending.ToolName)
+				if field == "" {
+					return "This request can't be edited"
+				}
+				trackerMgr.EditPermission(chatID, pending.ToolID)
+
+				noun := "path"
+				if field == "command" {
+					noun = "command"
+				}
+				current, _ := pending.Input[field].(string)
+				text := fmt.Sprintf("Send the edited %s, or tap Cancel to keep it:\n```\n%s\n```", noun, current)
+				if _, err := fe.SendKeyboard(chatID, text, frontend.BuildEditKeyboard(pending.ToolID)); err != nil {
+					slog.Error("failed to start permission edit", "error", err)
+					trackerMgr.StopEditing(chatID, pending.ToolID)
+					return "Error editing"
+				}
+				return ""
+			}
+
+			// Cancel leaves edit mode, so messages go to Claude again
+			if cb.Action == "c" {
+				if !trackerMgr.StopEditing(chatID, pending.ToolID) {
+					return "Not editing this request"
+				}
+				return "Edit cancelled"
+			}
+
 			var result *trackers.PermissionResult
+			answer := ""
 			switch cb.Action {
 			case "a": // allow
 				result = &trackers.PermissionResult{
@@ -327,12 +754,17 @@ func main() {
 					UpdatedInput: pending.Input,
 				}
 				slog.Info("permission allowed", "chat_id", chatID, "tool", pending.ToolName)
-			case "aa": // allow-always
+			case "aa": // allow-always: save a rule for this exact call, then allow it
+				rule := permissions.Suggest(pending.ToolName, pending.Input, pending.Cwd)
+				if _, err := permStore.Add(chatID, rule); err != nil {
+					slog.Error("failed to save permission rule", "error", err)
+				}
 				result = &trackers.PermissionResult{
-					Behavior:     "allow-always",
+					Behavior:     "allow",
 					UpdatedInput: pending.Input,
 				}
-				slog.Info("permission allowed always", "chat_id", chatID, "tool", pending.ToolName)
+				answer = "Always allowing " + rule.String()
+				slog.Info("permission allowed always", "chat_id", chatID, "tool", pending.ToolName, "rule", rule.String())
 			case "d": // deny
 				result = &trackers.PermissionResult{
 					Behavior: "deny",
@@ -343,18 +775,11 @@ func main() {
 				return "Invalid permission action"
 			}
 
-			// Send result back through the channel
-			select {
-			case pending.Response <- result:
-				// Delete the keyboard message
-				if pending.MessageID > 0 {
-					bot.DeleteMessage(chatID, pending.MessageID)
-				}
-				trackerMgr.ClearPermission(chatID)
-			default:
-				slog.Warn("permission response channel not ready", "chat_id", chatID)
-			}
+			resolvePermission(chatID, pending, result)
 
+			if answer != "" {
+				return answer
+			}
 			return "Permission: " + result.Behavior
 		}
 
@@ -386,11 +811,11 @@ func main() {
 
 				// Send last assistant message as context
 				if lastMsg != "" {
-					// Truncate if too long for Telegram
+					// Truncate if too long for a chat message
 					if len(lastMsg) > 500 {
 						lastMsg = lastMsg[:497] + "..."
 					}
-					go bot.SendMessage(chatID, "Last response:\n\n"+lastMsg, true)
+					go fe.SendMessage(chatID, "Last response:\n\n"+lastMsg, true)
 				}
 
 				summary := session.Summary
@@ -402,6 +827,43 @@ func main() {
 			return "Invalid session action"
 		}
 
+		// Handle reply session callbacks: switch to the replied-to session or
+		// stay, then send the held reply
+		if cb.Type == "r" {
+			pending := trackerMgr.TakeReply(chatID)
+			if pending == nil {
+				return "Reply expired"
+			}
+			if pending.MessageID > 0 {
+				fe.DeleteMessage(chatID, pending.MessageID)
+			}
+
+			answer := "Sending here"
+			if cb.Action == "s" {
+				slog.Info("switching to replied-to session", "chat_id", chatID, "session_id", pending.SessionID)
+				if _, err := manager.GetOrCreateWithSession(chatID, pending.SessionID); err != nil {
+					slog.Error("failed to resume session", "error", err)
+					return "Failed to switch session"
+				}
+				answer = "Switched to " + shortSessionID(pending.SessionID)
+			}
+			go sendTurn(cbCtx, chatID, pending.UserMessageID, pending.Text, pending.Images)
+			return answer
+		}
+
+		// Handle model selection callbacks
+		if cb.Type == "m" {
+			if cb.OptionIdx < 0 || cb.OptionIdx >= len(cfg.Claude.Models) {
+				return "Invalid model"
+			}
+			model := cfg.Claude.Models[cb.OptionIdx]
+			slog.Info("changing model", "chat_id", chatID, "model", model)
+			if err := manager.SetModel(chatID, model); errors.Is(err, claude.ErrBusy) {
+				return commands.ModelBusyText
+			}
+			return "Now using " + model
+		}
+
 		// Get the pending question for this chat
 		pending := trackerMgr.GetQuestion(chatID)
 		if pending == nil {
@@ -439,7 +901,7 @@ func main() {
 
 		// Delete the current keyboard message
 		if pending.MessageID > 0 {
-			bot.DeleteMessage(chatID, pending.MessageID)
+			fe.DeleteMessage(chatID, pending.MessageID)
 		}
 
 		// Store this answer
@@ -454,8 +916,8 @@ func main() {
 		if nextIdx < totalQuestions {
 			// Send next question keyboard
 			nextQ := pending.Questions[nextIdx]
-			keyboard, text := telegram.BuildQuestionKeyboard(pending.ToolID, nextIdx, nextQ)
-			msgID, err := bot.SendQuestionKeyboard(chatID, text, keyboard)
+			keyboard, text := frontend.BuildQuestionKeyboard(pending.ToolID, nextIdx, nextQ)
+			msgID, err := fe.SendKeyboard(chatID, text, keyboard)
 			if err != nil {
 				slog.Error("failed to send next question keyboard", "error", err)
 			}
@@ -477,64 +939,176 @@ func main() {
 		}
 
 		// Send the combined answers back to Claude
-		go func() {
-			// Start typing indicator
-			stopTyping := bot.TypingLoop(chatID)
-			defer stopTyping()
-
-			// Build response callbacks using shared handler
-			cb := &handlers.CallbackBuilder{
-				ChatID:     chatID,
-				TrackerMgr: trackerMgr,
-				Bot:        bot,
-				SendFn: func(text string, silent bool) {
-					bot.SendMessage(chatID, text, silent)
-				},
-				Logger: slog.Default(),
-			}
-
-			err := manager.Send(cbCtx, chatID, combinedAnswer, cb.Build())
-			cb.ClearTrackers()
-
-			if err != nil {
-				slog.Error("error sending callback response to claude", "error", err)
-				bot.SendMessage(chatID, "Sorry, something went wrong.", false)
-			}
-		}()
+		go sendTurn(cbCtx, chatID, 0, combinedAnswer, nil)
 
 		return "Selected: " + selectedOption.Label
 	})
 
-	slog.Info("aria started, connecting to telegram")
+	slog.Info("aria started, connecting to frontend")
 
 	// Notify users with persisted sessions that ARIA has restarted
-	// This runs in background after bot starts polling
+	// This runs in background after the frontend starts
 	go func() {
-		// Small delay to let bot initialize
+		// Small delay to let the frontend initialize
 		time.Sleep(500 * time.Millisecond)
 
 		sessions := persistence.GetAll()
 		if len(sessions) > 0 {
 			for chatID := range sessions {
 				slog.Info("notifying chat of restart", "chat_id", chatID)
-				bot.SendMessage(chatID, "ARIA restarted. Session will resume on next message.", true)
+				fe.SendMessage(chatID, "ARIA restarted. Session will resume on next message.", true)
 			}
 		}
 	}()
 
-	// Start the bot (blocks until context is cancelled)
-	if err := bot.Start(ctx); err != nil {
+	// Start the frontend (blocks until context is cancelled)
+	if err := fe.Start(ctx); err != nil {
 		if ctx.Err() == context.Canceled {
 			slog.Info("aria stopped")
-			return
+			return nil
 		}
-		slog.Error("telegram bot error", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("frontend: %w", err)
+	}
+	return nil
+}
+
+// newFrontend creates the chat frontends from the config, plus the socket
+// `aria chat` attaches to. Chats with a terminal attached go to the terminal,
+// Slack and Matrix chat IDs to their frontends and everything else to Telegram
+func newFrontend(cfg *config.Config, homeDir string) (frontend.Frontend, error) {
+	terminal := local.New(socketPath(homeDir), slog.Default())
+	routes := []frontend.Route{{Frontend: terminal, Owns: terminal.Owns}}
+
+	if cfg.Telegram.Token != "" {
+		bot, err := telegram.New(cfg.Telegram.Token, cfg.Telegram.APIURL, cfg.Allowlist, cfg.Debug, slog.Default())
+		if err != nil {
+			return nil, fmt.Errorf("creating telegram bot: %w", err)
+		}
+		if hook := cfg.Telegram.Webhook; hook.URL != "" {
+			bot.SetWebhook(telegram.Webhook{
+				URL:         hook.URL,
+				Listen:      hook.Listen,
+				Path:        hook.Path,
+				SecretToken: hook.SecretToken,
+				CertFile:    hook.CertFile,
+				KeyFile:     hook.KeyFile,
+				UploadCert:  hook.UploadCert,
+			})
+		}
+		bot.SetTranscriber(newTranscriber(cfg.Transcription, homeDir))
+		routes = append(routes, frontend.Route{Frontend: bot})
+	}
+
+	if cfg.Slack.Enabled() {
+		bot, err := slack.New(slack.Options{
+			BotToken:  cfg.Slack.BotToken,
+			AppToken:  cfg.Slack.AppToken,
+			APIURL:    cfg.Slack.APIURL,
+			Allowlist: cfg.Slack.Allowlist,
+			ChatsPath: homeDir + "/.config/aria/slack_chats.yaml",
+		}, cfg.Debug, slog.Default())
+		if err != nil {
+			return nil, fmt.Errorf("creating slack bot: %w", err)
+		}
+		routes = append(routes, frontend.Route{Frontend: bot, Owns: slack.IsChatID})
+	}
+
+	if cfg.Matrix.Enabled() {
+		bot, err := matrix.New(matrix.Options{
+			Homeserver:  cfg.Matrix.Homeserver,
+			AccessToken: cfg.Matrix.AccessToken,
+			Allowlist:   cfg.Matrix.Allowlist,
+			RoomsPath:   homeDir + "/.config/aria/matrix_rooms.yaml",
+		}, slog.Default())
+		if err != nil {
+			return nil, fmt.Errorf("creating matrix bot: %w", err)
+		}
+		routes = append(routes, frontend.Route{Frontend: bot, Owns: matrix.IsChatID})
+	}
+
+	return frontend.NewMux(routes...), nil
+}
+
+// newTranscriber creates the voice message transcriber from the config:
+// the configured command, or whisper.cpp with the default model
+func newTranscriber(cfg config.TranscriptionConfig, homeDir string) transcribe.Transcriber {
+	if len(cfg.Command) > 0 {
+		return transcribe.Command{Args: cfg.Command}
+	}
+	w := transcribe.Whisper{
+		Binary:   cfg.WhisperBinary,
+		Model:    cfg.WhisperModel,
+		Language: cfg.Language,
+	}
+	if w.Binary == "" {
+		w.Binary = "whisper-cli"
+	}
+	if w.Model == "" {
+		w.Model = homeDir + "/.config/aria/ggml-base.en.bin"
+	}
+	return w
+}
+
+// shortSessionID returns the first 8 characters of a session ID, as /sessions shows them
+func shortSessionID(sessionID string) string {
+	if len(sessionID) > 8 {
+		return sessionID[:8]
+	}
+	return sessionID
+}
+
+// shortDuration formats a duration to the second, without zero units
+// ("2m" rather than "2m0s")
+func shortDuration(d time.Duration) string {
+	if d >= time.Second {
+		d = d.Round(time.Second)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
 	}
+	return s
 }
 
-// runMCPServer runs Aria as an MCP server for permission prompts
-// This is invoked by Claude when it needs to ask for permission
+// chatFile resolves a send_file path against a chat's working directory (empty
+// = the current directory), rejecting anything outside it, symlinks included
+func chatFile(cwd, path string) (string, error) {
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+	root, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory %s", path, cwd)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return resolved, nil
+}
+
+// runMCPServer runs Aria as an MCP server for send_file and permission prompts
+// This is invoked by Claude when it needs to ask for permission or send a file
 func runMCPServer() {
 	// Set up minimal logging to stderr (stdout is for MCP protocol)
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
@@ -554,8 +1128,13 @@ func runMCPServer() {
 		return client.RequestPermission(ctx, toolName, input)
 	}
 
+	sendFile := func(ctx context.Context, chatID int64, path string, caption string) (string, error) {
+		logger.Info("sending file, calling parent", "path", path)
+		return client.SendFile(ctx, path, caption)
+	}
+
 	// Chat ID comes from env, passed to handler via closure
-	if err := mcp.RunMCPServer(0, handler, logger); err != nil {
+	if err := mcp.RunMCPServer(0, handler, sendFile, logger); err != nil {
 		logger.Error("mcp server error", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,1322 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/aria/internal/claude"
+	"github.com/codegangsta/aria/internal/claude/claudetest"
+	"github.com/codegangsta/aria/internal/config"
+	"github.com/codegangsta/aria/internal/local"
+	"github.com/codegangsta/aria/internal/matrix/matrixtest"
+	"github.com/codegangsta/aria/internal/slack/slacktest"
+	"github.com/codegangsta/aria/internal/telegram/telegramtest"
+)
+
+// envFakeClaude makes the test binary act as the claude CLI
+const envFakeClaude = "ARIA_TEST_FAKE_CLAUDE"
+
+const (
+	testChat = 100
+	testUser = 200
+	waitTime = 10 * time.Second
+)
+
+// TestMain lets the test binary stand in for both claude and the aria MCP
+// server that claude spawns for permission prompts
+func TestMain(m *testing.M) {
+	if slices.Contains(os.Args[1:], "--mcp-server") {
+		runMCPServer()
+		os.Exit(0)
+	}
+	if os.Getenv(envFakeClaude) == "1" {
+		claudetest.Main()
+	}
+	os.Exit(m.Run())
+}
+
+// daemon is a running aria wired to a fake claude and a fake Telegram
+type daemon struct {
+	tg      *telegramtest.Server
+	home    string
+	logPath string
+}
+
+// startDaemon runs aria against the fake claude script until the test ends
+// configure may adjust the config before start
+func startDaemon(t *testing.T, script string, configure func(*config.Config, string)) *daemon {
+	t.Helper()
+
+	tg := telegramtest.NewServer()
+	d := &daemon{
+		tg:      tg,
+		home:    t.TempDir(),
+		logPath: filepath.Join(t.TempDir(), "claude.log"),
+	}
+
+	scriptPath := filepath.Join(t.TempDir(), "script.jsonl")
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sessionsDir := t.TempDir()
+	t.Setenv(envFakeClaude, "1")
+	t.Setenv(claudetest.EnvScript, scriptPath)
+	t.Setenv(claudetest.EnvSessions, sessionsDir)
+	t.Setenv(claudetest.EnvLog, d.logPath)
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	executablePath = exe
+
+	cfg := &config.Config{
+		Telegram:  config.TelegramConfig{Token: "test-token", APIURL: tg.URL},
+		Allowlist: []int64{testUser},
+	}
+	cfg.Claude.SkipPermissions = true
+	cfg.Claude.Models = config.DefaultModels
+	if configure != nil {
+		configure(cfg, d.home)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, cfg, exe, d.home)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("run() error = %v", err)
+			}
+		case <-time.After(waitTime):
+			t.Error("daemon did not stop")
+		}
+		tg.Close()
+	})
+	return d
+}
+
+// send delivers a user message and waits for a reply containing want
+func (d *daemon) send(t *testing.T, text string, want string) telegramtest.Message {
+	t.Helper()
+	return d.wait(t, d.tg.SendText(testChat, testUser, text), want)
+}
+
+// wait waits for a bot message newer than after containing want
+func (d *daemon) wait(t *testing.T, after int64, want string) telegramtest.Message {
+	t.Helper()
+	msg, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > after && strings.Contains(m.Text, want)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// press presses a keyboard button on a bot message
+// The keyboard shows up a moment before the daemon stores the pending prompt,
+// so an "expired" answer is retried
+func (d *daemon) press(t *testing.T, msg telegramtest.Message, text string) {
+	t.Helper()
+	button := msg.Button(text)
+	if button == nil {
+		t.Fatalf("message %d has no %q button", msg.ID, text)
+	}
+
+	deadline := time.Now().Add(waitTime)
+	for {
+		answered := len(d.tg.CallbackAnswers())
+		d.tg.PressButton(testChat, testUser, msg.ID, button.Data)
+		for len(d.tg.CallbackAnswers()) == answered {
+			if time.Now().After(deadline) {
+				t.Fatalf("button %q was never answered", text)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if answer := d.tg.CallbackAnswers()[answered]; !strings.HasSuffix(answer, "expired") {
+			return
+		}
+	}
+}
+
+// claudeLog returns the fake claude log entries
+func (d *daemon) claudeLog(t *testing.T) []claudetest.LogEntry {
+	t.Helper()
+	entries, err := claudetest.ReadLog(d.logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// waitTurn waits until the fake claude has received a message containing
+// text, so its turn is in flight
+func (d *daemon) waitTurn(t *testing.T, text string) {
+	t.Helper()
+	deadline := time.Now().Add(waitTime)
+	for {
+		// The log doesn't exist until claude has started
+		entries, _ := claudetest.ReadLog(d.logPath)
+		for _, entry := range entries {
+			if strings.Contains(entry.Message, text) {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("claude never received %q", text)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// untilIdle repeats a model switch while it's refused as mid-turn; a turn
+// only hands the chat back a moment after its final reply is delivered
+// send delivers the switch and returns the answer
+func untilIdle(t *testing.T, send func() string) string {
+	t.Helper()
+	deadline := time.Now().Add(waitTime)
+	for {
+		answer := send()
+		if !strings.Contains(answer, "switch models") {
+			return answer
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("model switch was still refused as mid-turn")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// switchModel switches models once the last turn is over
+func (d *daemon) switchModel(t *testing.T, model string) {
+	t.Helper()
+	answer := untilIdle(t, func() string {
+		sent := d.tg.SendText(testChat, testUser, "/model "+model)
+		msg, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+			return m.ID > sent && (strings.Contains(m.Text, "Now using") || strings.Contains(m.Text, "switch models"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Text
+	})
+	if !strings.Contains(answer, "Now using "+model) {
+		t.Fatalf("/model %s = %q", model, answer)
+	}
+}
+
+// argValue returns the value of a flag in a logged claude invocation
+func argValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestDaemonReply(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+`, nil)
+
+	d.send(t, "hello", "echo /aria hello")
+
+	// Slash commands from init are registered once the first turn completes
+	deadline := time.Now().Add(waitTime)
+	for !slices.Contains(d.tg.Commands(), "commit") {
+		if time.Now().After(deadline) {
+			t.Fatalf("commands = %v, want commit registered", d.tg.Commands())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonResume(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"session {{session_id}}"}
+`, nil)
+
+	first := d.send(t, "one", "session ")
+
+	// Unknown models are refused before restarting anything
+	d.send(t, "/model opsu", "Unknown model opsu")
+
+	// Switching models restarts claude on the same session
+	d.switchModel(t, "opus")
+	d.send(t, "two", first.Text)
+
+	var invocations [][]string
+	for _, entry := range d.claudeLog(t) {
+		if entry.Args != nil {
+			invocations = append(invocations, entry.Args)
+		}
+	}
+	if len(invocations) != 2 {
+		t.Fatalf("claude started %d times, want 2", len(invocations))
+	}
+	if got := argValue(invocations[1], "--resume"); got == "" || !strings.Contains(first.Text, strings.ReplaceAll(got, "-", `\-`)) {
+		t.Errorf("second start --resume = %q, want the first session (%s)", got, first.Text)
+	}
+	if got := argValue(invocations[1], "--model"); got != "opus" {
+		t.Errorf("second start --model = %q, want opus", got)
+	}
+}
+
+func TestDaemonModelBusy(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"sleep","ms":500}
+{"fake":"reply","text":"done {{message}}"}
+`, nil)
+
+	// Switching models restarts claude, so it's refused mid-turn
+	sent := d.tg.SendText(testChat, testUser, "slow one")
+	d.waitTurn(t, "slow one")
+	d.send(t, "/model opus", "switch models")
+	d.wait(t, sent, "done /aria slow one")
+
+	starts := 0
+	for _, entry := range d.claudeLog(t) {
+		if entry.Args != nil {
+			starts++
+		}
+	}
+	if starts != 1 {
+		t.Errorf("claude started %d times, want the turn left running", starts)
+	}
+	d.switchModel(t, "opus")
+}
+
+func TestDaemonStop(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"sleep","ms":5000}
+{"fake":"reply","text":"too slow"}
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+`, nil)
+
+	d.send(t, "/stop", "Nothing is running")
+
+	sent := d.tg.SendText(testChat, testUser, "long job")
+	d.waitTurn(t, "long job")
+	d.send(t, "/stop", "Stopping")
+
+	// The same process carries on with the next message
+	d.send(t, "next", "echo /aria next")
+
+	var starts, interrupts int
+	for _, entry := range d.claudeLog(t) {
+		if entry.Args != nil {
+			starts++
+		}
+		if entry.Control == "interrupt" {
+			interrupts++
+		}
+	}
+	if starts != 1 || interrupts != 1 {
+		t.Errorf("claude started %d times and got %d interrupts, want 1 and 1", starts, interrupts)
+	}
+	for _, m := range d.tg.Messages(testChat) {
+		if m.ID > sent && (strings.Contains(m.Text, "too slow") || strings.Contains(m.Text, "went wrong")) {
+			t.Errorf("interrupted turn sent %q", m.Text)
+		}
+	}
+}
+
+func TestDaemonStaleSession(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"fresh start"}
+`, func(cfg *config.Config, home string) {
+		// A persisted session the CLI no longer knows about
+		persistence := claude.NewSessionPersistence(filepath.Join(home, ".config", "aria", "sessions.yaml"))
+		persistence.Set(testChat, "missing-session")
+		if err := persistence.Save(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	d.send(t, "hi", "fresh start")
+
+	var resumed []string
+	for _, entry := range d.claudeLog(t) {
+		if entry.Args != nil {
+			resumed = append(resumed, argValue(entry.Args, "--resume"))
+		}
+	}
+	if len(resumed) != 2 || resumed[0] != "missing-session" || resumed[1] != "" {
+		t.Errorf("--resume per start = %q, want the stale session then a fresh start", resumed)
+	}
+}
+
+func TestDaemonPermission(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"ls"},"tool_use_id":"toolu_1"}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"rm -rf /"},"tool_use_id":"toolu_2"}
+{"fake":"reply","text":"permission {{permission}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+	})
+
+	for _, tt := range []struct {
+		message, button, want string
+	}{
+		{"list files", "Allow", "permission allow"},
+		{"delete everything", "Deny", "permission deny"},
+	} {
+		sent := d.tg.SendText(testChat, testUser, tt.message)
+		prompt, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+			return m.ID > sent && m.Button(tt.button) != nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.press(t, prompt, tt.button)
+		d.wait(t, prompt.ID, tt.want)
+
+		for _, m := range d.tg.Messages(testChat) {
+			if m.ID == prompt.ID && !m.Deleted {
+				t.Errorf("%s: permission prompt was not deleted", tt.message)
+			}
+		}
+	}
+}
+
+func TestDaemonPermissionParallel(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"parallel","calls":[{"tool_name":"Bash","input":{"command":"echo one"},"tool_use_id":"toolu_1"},{"tool_name":"Bash","input":{"command":"echo two"},"tool_use_id":"toolu_2"}]}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"parallel","calls":[{"tool_name":"Bash","input":{"command":"echo a"},"tool_use_id":"toolu_3"},{"tool_name":"Bash","input":{"command":"echo b"},"tool_use_id":"toolu_4"},{"tool_name":"Bash","input":{"command":"echo c"},"tool_use_id":"toolu_5"}]}
+{"fake":"reply","text":"permission {{permission}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+	})
+
+	// prompts waits for n open permission prompts sent after a message
+	prompts := func(after int64, n int) []telegramtest.Message {
+		t.Helper()
+		deadline := time.Now().Add(waitTime)
+		for {
+			var open []telegramtest.Message
+			for _, m := range d.tg.Messages(testChat) {
+				if m.ID > after && !m.Deleted && m.Button("Allow") != nil {
+					open = append(open, m)
+				}
+			}
+			if len(open) == n {
+				return open
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got %d permission prompts, want %d", len(open), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	find := func(open []telegramtest.Message, text string) telegramtest.Message {
+		t.Helper()
+		for _, m := range open {
+			if strings.Contains(m.Text, text) {
+				return m
+			}
+		}
+		t.Fatalf("no permission prompt for %q", text)
+		return telegramtest.Message{}
+	}
+
+	// Each prompt answers its own request, whatever order they're answered in
+	sent := d.tg.SendText(testChat, testUser, "echo twice")
+	open := prompts(sent, 2)
+	d.press(t, find(open, "echo two"), "Deny")
+	d.press(t, find(open, "echo one"), "Allow")
+	d.wait(t, sent, "permission allow,deny")
+
+	// Allow all pending answers every open prompt at once
+	sent = d.tg.SendText(testChat, testUser, "echo thrice")
+	open = prompts(sent, 3)
+	var all *telegramtest.Message
+	for i := range open {
+		if open[i].Button("Allow all pending") != nil {
+			all = &open[i]
+		}
+	}
+	if all == nil {
+		t.Fatal("no prompt offers Allow all pending")
+	}
+	d.press(t, *all, "Allow all pending")
+	d.wait(t, sent, "permission allow,allow,allow")
+	prompts(sent, 0)
+}
+
+func TestDaemonPermissionPreview(t *testing.T) {
+	long := strings.Repeat("echo step && ", 100) + "echo done"
+	huge := strings.Repeat("echo step && ", 400) + "echo end"
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Edit","input":{"file_path":"/work/main.go","old_string":"x := 1\n","new_string":"x := 2\n"},"tool_use_id":"toolu_1"}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"`+long+`"},"tool_use_id":"toolu_2"}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"`+huge+`"},"tool_use_id":"toolu_3"}
+{"fake":"reply","text":"permission {{permission}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+	})
+
+	// Edits show a diff
+	sent := d.tg.SendText(testChat, testUser, "bump x")
+	prompt, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Allow") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt.Text, "-x := 1\n+x := 2") || prompt.Button("Show more") != nil {
+		t.Errorf("Edit prompt = %q, want a diff without Show more", prompt.Text)
+	}
+	d.press(t, prompt, "Allow")
+	d.wait(t, prompt.ID, "permission allow")
+
+	// Long commands are cut short until Show more replaces the prompt
+	sent = d.tg.SendText(testChat, testUser, "run the steps")
+	prompt, err = d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Show more") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(prompt.Text, "echo done") {
+		t.Errorf("long command wasn't cut short: %q", prompt.Text)
+	}
+	d.press(t, prompt, "Show more")
+	full, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > prompt.ID && m.Button("Allow") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(full.Text, "echo done") || full.Button("Show more") != nil {
+		t.Errorf("expanded prompt = %q, want the whole command", full.Text)
+	}
+	d.press(t, full, "Allow")
+	d.wait(t, full.ID, "permission allow")
+
+	for _, m := range d.tg.Messages(testChat) {
+		if (m.ID == prompt.ID || m.ID == full.ID) && !m.Deleted {
+			t.Errorf("permission prompt %d was not deleted", m.ID)
+		}
+	}
+
+	// Commands too long for one message are sent in parts above the prompt
+	sent = d.tg.SendText(testChat, testUser, "run more steps")
+	prompt, err = d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Show more") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.press(t, prompt, "Show more")
+	full, err = d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > prompt.ID && m.Button("Allow") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var preview string
+	for _, m := range d.tg.Messages(testChat) {
+		if m.ID > prompt.ID && m.ID < full.ID {
+			preview += strings.Trim(m.Text, "`\n")
+		}
+	}
+	if preview != huge || full.Button("Show more") != nil {
+		t.Errorf("Show more sent %d of %d characters, want the whole command", len(preview), len(huge))
+	}
+	d.press(t, full, "Allow")
+	d.wait(t, full.ID, "permission allow")
+}
+
+func TestDaemonPermissionEdit(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"go test ./..."},"tool_use_id":"toolu_1"}
+{"fake":"reply","text":"ran {{input}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Write","input":{"file_path":"/tmp/notes.md","content":"hi"},"tool_use_id":"toolu_2"}
+{"fake":"reply","text":"wrote {{input}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"make build"},"tool_use_id":"toolu_3"}
+{"fake":"reply","text":"ran {{input}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"make deploy"},"tool_use_id":"toolu_4"}
+{"fake":"reply","text":"ran {{input}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+	})
+	cwd := t.TempDir()
+	d.send(t, "/cd "+cwd, filepath.Base(cwd))
+
+	// edit presses Edit on the prompt for message and returns the prompt and
+	// the message asking for the edit
+	edit := func(message string) (telegramtest.Message, telegramtest.Message) {
+		t.Helper()
+		sent := d.tg.SendText(testChat, testUser, message)
+		prompt, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+			return m.ID > sent && m.Button("Edit") != nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.press(t, prompt, "Edit")
+		return prompt, d.wait(t, prompt.ID, "Send the edited")
+	}
+
+	// confirm waits for the prompt showing the edited input and allows it
+	confirm := func(after int64, want string) telegramtest.Message {
+		t.Helper()
+		prompt, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+			return m.ID > after && m.Button("Allow") != nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(strings.ReplaceAll(prompt.Text, "\\", ""), want) {
+			t.Errorf("edited prompt = %q, want %q", prompt.Text, want)
+		}
+		d.press(t, prompt, "Allow")
+		return prompt
+	}
+
+	for _, tt := range []struct {
+		message, edit, shown, reply, want string
+	}{
+		{"run the tests", "go test -race ./...", "go test -race", "ran", "-race"},
+		{"write notes", "docs/notes.md", "File: docs/notes.md", "wrote", filepath.Join(cwd, "docs", "notes")},
+	} {
+		// The edit is shown again to be allowed, rather than run straight away
+		edit(tt.message)
+		prompt := confirm(d.tg.SendText(testChat, testUser, tt.edit), tt.shown)
+
+		// The reply is MarkdownV2, so drop its escapes before comparing
+		reply := d.wait(t, prompt.ID, tt.reply)
+		if !strings.Contains(strings.ReplaceAll(reply.Text, "\\", ""), tt.want) {
+			t.Errorf("%s: tool ran with %q, want %q", tt.message, reply.Text, tt.want)
+		}
+	}
+
+	// Cancel leaves the command as it was
+	prompt, asked := edit("build it")
+	d.press(t, asked, "Cancel")
+	if answers := d.tg.CallbackAnswers(); answers[len(answers)-1] != "Edit cancelled" {
+		t.Errorf("Cancel answered %q", answers[len(answers)-1])
+	}
+	d.press(t, prompt, "Allow")
+	if reply := d.wait(t, asked.ID, "ran"); !strings.Contains(reply.Text, "make build") {
+		t.Errorf("tool ran with %q after Cancel, want make build", reply.Text)
+	}
+
+	// Aria's commands still work mid-edit, and aren't taken for the command
+	edit("deploy it")
+	d.send(t, "/stop", "Stopping")
+	reply := d.wait(t, confirm(d.tg.SendText(testChat, testUser, "make deploy-dry-run"), "make deploy-dry-run").ID, "ran")
+	if text := strings.ReplaceAll(reply.Text, "\\", ""); strings.Contains(text, "/stop") || !strings.Contains(text, "deploy-dry-run") {
+		t.Errorf("tool ran with %q, want the edit sent after /stop", reply.Text)
+	}
+}
+
+func TestDaemonPermissionTimeout(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Write","input":{"file_path":"/tmp/notes.md","content":"hi"},"tool_use_id":"toolu_1"}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Read","input":{"file_path":"/tmp/notes.md"},"tool_use_id":"toolu_2"}
+{"fake":"reply","text":"permission {{permission}}"}
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"make deploy"},"tool_use_id":"toolu_3"}
+{"fake":"reply","text":"permission {{permission}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+		cfg.Permissions = config.PermissionsConfig{
+			Timeout: 600 * time.Millisecond,
+			Tools:   map[string]string{"Read": config.OnTimeoutAllow, "Bash": config.OnTimeoutWait},
+		}
+	})
+
+	// reminded reports whether a reminder containing text was sent after a
+	// message, deleted or not
+	reminded := func(after int64, text string) bool {
+		for _, m := range d.tg.Messages(testChat) {
+			if m.ID > after && m.Button("Allow") != nil && strings.Contains(m.Text, text) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Write denies by default, Read is allowed, each after a reminder
+	for _, tt := range []struct{ message, reminder, notice, want string }{
+		{"write notes", "denying in 300ms", "denied Write", "permission deny"},
+		{"read notes", "allowing in 300ms", "allowed Read", "permission allow"},
+	} {
+		sent := d.tg.SendText(testChat, testUser, tt.message)
+		d.wait(t, sent, "No answer after 600ms, "+tt.notice)
+		d.wait(t, sent, tt.want)
+		if !reminded(sent, tt.reminder) {
+			t.Errorf("%s: no %q reminder", tt.message, tt.reminder)
+		}
+	}
+
+	// Bash waits past the timeout until it's answered
+	sent := d.tg.SendText(testChat, testUser, "deploy")
+	prompt := d.wait(t, sent, "Still waiting after 600ms")
+	d.press(t, prompt, "Allow")
+	d.wait(t, sent, "permission allow")
+	if !reminded(sent, "Still waiting for an answer") {
+		t.Error("no halfway reminder for Bash")
+	}
+}
+
+func TestDaemonQuestion(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_q","name":"AskUserQuestion","input":{"questions":[{"question":"Which color?","header":"Color","multiSelect":false,"options":[{"label":"Red","description":"warm"},{"label":"Blue","description":"cool"}]}]}}]},"parent_tool_use_id":null,"session_id":"{{session_id}}"}
+{"type":"input_request","tool_use_id":"toolu_q"}
+{"fake":"turn"}
+{"fake":"reply","text":"picked {{message}}"}
+`, nil)
+
+	sent := d.tg.SendText(testChat, testUser, "pick a color")
+	question, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Blue") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.press(t, question, "Blue")
+	d.wait(t, question.ID, "picked /aria Blue")
+}
+
+func TestDaemonSlack(t *testing.T) {
+	const (
+		slackUser = "U123"
+		dm        = "D123"
+		channel   = "C123"
+	)
+	sl := slacktest.NewServer()
+	t.Cleanup(sl.Close)
+
+	// Runs alongside Telegram, so chats are routed by ID
+	startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+{"fake":"turn"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_q","name":"AskUserQuestion","input":{"questions":[{"question":"Which color?","header":"Color","multiSelect":false,"options":[{"label":"Red","description":"warm"},{"label":"Blue","description":"cool"}]}]}}]},"parent_tool_use_id":null,"session_id":"{{session_id}}"}
+{"type":"input_request","tool_use_id":"toolu_q"}
+{"fake":"turn"}
+{"fake":"reply","text":"picked {{message}}"}
+{"fake":"turn"}
+{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{"path":"notes.txt","caption":"your notes"}}
+{"fake":"reply","text":"result: {{tool_result}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Slack = config.SlackConfig{
+			BotToken:  "xoxb-test",
+			AppToken:  "xapp-test",
+			APIURL:    sl.APIURL(),
+			Allowlist: []string{slackUser},
+		}
+	})
+
+	waitSlack := func(channel, thread, after, want string) slacktest.Message {
+		t.Helper()
+		msg, err := sl.WaitFor(channel, thread, waitTime, func(m slacktest.Message) bool {
+			return m.TS > after && strings.Contains(m.Text, want)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	// Work in a directory send_file can read from (changing it restarts claude)
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "notes.txt"), []byte("notes"), 0644)
+	sent := sl.SendText(dm, "im", slackUser, "/cd "+cwd, "")
+	waitSlack(dm, "", sent, filepath.Base(cwd))
+
+	// A DM is its own chat, replies go to the top level
+	sent = sl.SendText(dm, "im", slackUser, "hello", "")
+	waitSlack(dm, "", sent, "echo /aria hello")
+
+	// A mention in a channel starts a chat in the mention's thread
+	mention := sl.SendText(channel, "channel", slackUser, "<@"+slacktest.BotUserID+"> hi there", "")
+	waitSlack(channel, mention, mention, "echo /aria hi there")
+
+	// Questions are Block Kit buttons; the answer is sent as the next turn
+	sent = sl.SendText(dm, "im", slackUser, "pick a color", "")
+	question, err := sl.WaitFor(dm, "", waitTime, func(m slacktest.Message) bool {
+		return m.TS > sent && m.Button("Blue") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(waitTime)
+	for {
+		answered := len(sl.Ephemerals())
+		sl.PressButton(slackUser, question, *question.Button("Blue"))
+		for len(sl.Ephemerals()) == answered {
+			if time.Now().After(deadline) {
+				t.Fatal("button press was never answered")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if answer := sl.Ephemerals()[answered]; !strings.HasSuffix(answer, "expired") {
+			break
+		}
+	}
+	waitSlack(dm, "", question.TS, "picked /aria Blue")
+
+	// send_file uploads to the chat
+	sent = sl.SendText(dm, "im", slackUser, "send my notes", "")
+	file := waitSlack(dm, "", sent, "your notes")
+	if file.File != "notes.txt" || string(file.FileData) != "notes" {
+		t.Errorf("send_file uploaded %q with %q, want notes.txt", file.File, file.FileData)
+	}
+	waitSlack(dm, "", file.TS, "result: Sent")
+
+	// An empty /aria lists the commands
+	help, err := sl.SlashCommand(dm, slackUser, "/aria", "", waitTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(help, "/aria model") {
+		t.Errorf("/aria help = %q, want /aria model listed", help)
+	}
+
+	// In a channel, slash commands go to the user's thread there
+	if _, err := sl.SlashCommand(channel, slackUser, "/aria", "stop", waitTime); err != nil {
+		t.Fatal(err)
+	}
+	waitSlack(channel, mention, mention, "Nothing is running")
+	help, err = sl.SlashCommand("C999", slackUser, "/aria", "stop", waitTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(help, "mentioned me") {
+		t.Errorf("/aria stop without a thread = %q, want a hint to mention the bot", help)
+	}
+
+	// Other users are ignored
+	sl.SendText(dm, "im", "U999", "let me in", "")
+	answer := untilIdle(t, func() string {
+		sent := sl.SendText(dm, "im", slackUser, "/model opus", "")
+		msg, err := sl.WaitFor(dm, "", waitTime, func(m slacktest.Message) bool {
+			return m.TS > sent && (strings.Contains(m.Text, "Now using") || strings.Contains(m.Text, "switch models"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Text
+	})
+	if !strings.Contains(answer, "Now using opus") {
+		t.Errorf("/model opus = %q", answer)
+	}
+	for _, m := range sl.Messages(dm, "") {
+		if m.FromBot && strings.Contains(m.Text, "let me in") {
+			t.Errorf("bot replied to a user outside the allowlist: %q", m.Text)
+		}
+	}
+}
+
+func TestDaemonMatrix(t *testing.T) {
+	const (
+		matrixUser = "@me:test"
+		room       = "!room:test"
+	)
+	mx := matrixtest.NewServer()
+	t.Cleanup(mx.Close)
+
+	startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+{"fake":"turn"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_q","name":"AskUserQuestion","input":{"questions":[{"question":"Which color?","header":"Color","multiSelect":false,"options":[{"label":"Red","description":"warm"},{"label":"Blue","description":"cool"}]}]}}]},"parent_tool_use_id":null,"session_id":"{{session_id}}"}
+{"type":"input_request","tool_use_id":"toolu_q"}
+{"fake":"turn"}
+{"fake":"reply","text":"picked {{message}}"}
+{"fake":"turn"}
+{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{"path":"chart.png","caption":"your chart"}}
+{"fake":"reply","text":"result: {{tool_result}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Matrix = config.MatrixConfig{
+			Homeserver:  mx.URL,
+			AccessToken: "syt_test",
+			Allowlist:   []string{matrixUser},
+		}
+	})
+
+	waitMatrix := func(after, want string) matrixtest.Message {
+		t.Helper()
+		msg, err := mx.WaitFor(room, waitTime, func(m matrixtest.Message) bool {
+			return eventNumber(m.EventID) > eventNumber(after) && strings.Contains(m.Text, want)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	// Invites from allowed users are accepted
+	mx.Invite(room, matrixUser)
+	deadline := time.Now().Add(waitTime)
+	for !mx.Joined(room) {
+		if time.Now().After(deadline) {
+			t.Fatal("bot never joined the room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Work in a directory send_file can read from (changing it restarts claude)
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "chart.png"), []byte("png bytes"), 0644)
+	sent := mx.SendText(room, matrixUser, "!cd "+cwd)
+	waitMatrix(sent, filepath.Base(cwd))
+
+	sent = mx.SendText(room, matrixUser, "hello")
+	waitMatrix(sent, "echo /aria hello")
+
+	// Questions list their options; reacting with one answers
+	sent = mx.SendText(room, matrixUser, "pick a color")
+	question, err := mx.WaitFor(room, waitTime, func(m matrixtest.Message) bool {
+		return eventNumber(m.EventID) > eventNumber(sent) && m.Option("Blue") != ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		react := mx.React(room, matrixUser, question.EventID, question.Option("Blue"))
+		answer := waitMatrix(react, "")
+		if !strings.HasSuffix(answer.Text, "expired") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reaction was never answered")
+		}
+	}
+	waitMatrix(question.EventID, "picked /aria Blue")
+
+	// send_file uploads to the media repository; images are m.image
+	sent = mx.SendText(room, matrixUser, "draw a chart")
+	file := waitMatrix(sent, "your chart")
+	if file.File != "chart.png" || !file.Image || string(file.FileData) != "png bytes" {
+		t.Errorf("send_file sent %q image=%v with %q, want chart.png as an image", file.File, file.Image, file.FileData)
+	}
+	waitMatrix(file.EventID, "result: Sent")
+
+	// Commands can be sent with ! since clients keep / for themselves
+	answer := untilIdle(t, func() string {
+		sent := mx.SendText(room, matrixUser, "!model opus")
+		msg, err := mx.WaitFor(room, waitTime, func(m matrixtest.Message) bool {
+			return eventNumber(m.EventID) > eventNumber(sent) && (strings.Contains(m.Text, "Now using") || strings.Contains(m.Text, "switch models"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Text
+	})
+	if !strings.Contains(answer, "Now using opus") {
+		t.Errorf("!model opus = %q", answer)
+	}
+}
+
+// eventNumber orders matrixtest event IDs ("$event12")
+func eventNumber(eventID string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(eventID, "$event"))
+	return n
+}
+
+// dialChat attaches a terminal client to a chat once the daemon's socket is up
+func dialChat(t *testing.T, d *daemon, chatID int64) *local.Client {
+	t.Helper()
+	deadline := time.Now().Add(waitTime)
+	for {
+		client, err := local.Dial(socketPath(d.home), chatID)
+		if err == nil {
+			t.Cleanup(func() { client.Close() })
+			return client
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receiveChat reads messages from a terminal client until one contains want
+func receiveChat(t *testing.T, client *local.Client, want string) local.Message {
+	t.Helper()
+	got := make(chan local.Message, 1)
+	go func() {
+		for {
+			msg, err := client.Receive()
+			if err != nil {
+				close(got)
+				return
+			}
+			if msg.Type == local.TypeMessage && strings.Contains(msg.Text, want) {
+				got <- msg
+				return
+			}
+		}
+	}()
+	select {
+	case msg, ok := <-got:
+		if !ok {
+			t.Fatalf("connection closed waiting for %q", want)
+		}
+		return msg
+	case <-time.After(waitTime):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+	return local.Message{}
+}
+
+func TestDaemonChat(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"session {{session_id}}"}
+{"fake":"turn"}
+{"fake":"reply","text":"session {{session_id}}"}
+`, nil)
+
+	// The local chat is its own conversation
+	client := dialChat(t, d, 0)
+	if client.ChatID != local.ChatID {
+		t.Fatalf("attached to chat %d, want the local chat", client.ChatID)
+	}
+	client.Send("hi")
+	receiveChat(t, client, "session ")
+
+	// Attaching to a Telegram chat continues it from the terminal
+	phone := d.send(t, "from my phone", "session ")
+	desk := dialChat(t, d, testChat)
+	desk.Send("at my desk")
+	reply := receiveChat(t, desk, "session ")
+	if reply.Text != strings.ReplaceAll(phone.Text, `\-`, "-") {
+		t.Errorf("terminal reply %q, want the phone's session (%s)", reply.Text, phone.Text)
+	}
+	for _, m := range d.tg.Messages(testChat) {
+		if m.ID > phone.ID && m.FromBot {
+			t.Errorf("reply went to Telegram while a terminal was attached: %q", m.Text)
+		}
+	}
+}
+
+func TestDaemonWebhook(t *testing.T) {
+	addr := freeAddr(t)
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Telegram.Webhook = config.WebhookConfig{
+			URL:    "http://" + addr + "/telegram",
+			Listen: addr,
+		}
+	})
+
+	d.send(t, "hello", "echo /aria hello")
+
+	url, secret := d.tg.Webhook()
+	if url != "http://"+addr+"/telegram" || secret == "" {
+		t.Fatalf("webhook = %q with secret %q, want the configured url and a random secret", url, secret)
+	}
+
+	// Updates without the secret token are rejected
+	for _, token := range []string{"", "wrong"} {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"update_id":999}`))
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("POST with token %q: status %d, want 401", token, resp.StatusCode)
+		}
+	}
+}
+
+func TestDaemonWebhookFallback(t *testing.T) {
+	// Something else holds the port, so the webhook can't listen
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+`, func(cfg *config.Config, home string) {
+		cfg.Telegram.Webhook = config.WebhookConfig{
+			URL:    "http://" + busy.Addr().String() + "/telegram",
+			Listen: busy.Addr().String(),
+		}
+	})
+
+	d.send(t, "hello", "echo /aria hello")
+	if url, _ := d.tg.Webhook(); url != "" {
+		t.Errorf("webhook = %q, want long polling", url)
+	}
+}
+
+// freeAddr returns a local address nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestDaemonVoice(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"echo {{message}}"}
+`, func(cfg *config.Config, home string) {
+		// The "audio" is the transcript itself
+		cfg.Transcription.Command = []string{"cat", "{file}"}
+	})
+
+	voice := d.tg.SendVoice(testChat, testUser, []byte("buy milk\n"))
+	quote := d.wait(t, voice, "buy milk")
+	if quote.ReplyTo != voice || !strings.HasPrefix(quote.Text, ">") {
+		t.Errorf("transcript = %q replying to %d, want a quote of voice message %d", quote.Text, quote.ReplyTo, voice)
+	}
+	d.wait(t, quote.ID, "echo /aria buy milk")
+}
+
+func TestDaemonAttachments(t *testing.T) {
+	d := startDaemon(t, `
+{"fake":"turn"}
+{"fake":"reply","text":"got it"}
+{"fake":"turn"}
+{"fake":"reply","text":"got that too"}
+`, nil)
+
+	cwd := t.TempDir()
+	d.send(t, "/cd "+cwd, filepath.Base(cwd))
+
+	photo := d.tg.SendPhoto(testChat, testUser, []byte("jpeg bytes"), "what's this error?")
+	d.wait(t, photo, "got it")
+	doc := d.tg.SendDocument(testChat, testUser, "report.pdf", "application/pdf", []byte("%PDF"), "")
+	d.wait(t, doc, "got that too")
+
+	var messages []claudetest.LogEntry
+	for _, e := range d.claudeLog(t) {
+		if e.Message != "" {
+			messages = append(messages, e)
+		}
+	}
+	if len(messages) != 2 {
+		t.Fatalf("claude got %d messages, want 2: %+v", len(messages), messages)
+	}
+
+	// The photo is inline and in the inbox, with the caption as the prompt
+	if !slices.Equal(messages[0].Images, []string{"image/jpeg"}) {
+		t.Errorf("photo message images = %v, want one jpeg", messages[0].Images)
+	}
+	if !strings.Contains(messages[0].Message, "what's this error?") {
+		t.Errorf("photo message %q doesn't carry the caption", messages[0].Message)
+	}
+
+	// The document is only referenced by path
+	if len(messages[1].Images) != 0 {
+		t.Errorf("document message images = %v, want none", messages[1].Images)
+	}
+	for i, want := range []string{"jpeg bytes", "%PDF"} {
+		line := messages[i].Message[strings.LastIndex(messages[i].Message, "- ")+2:]
+		data, err := os.ReadFile(filepath.Join(cwd, line))
+		if err != nil || string(data) != want || !strings.HasPrefix(line, filepath.Join(".aria", "inbox", strconv.Itoa(testChat))) {
+			t.Errorf("attachment %d saved at %q with %q (%v), want %q in the chat's inbox", i, line, data, err, want)
+		}
+	}
+}
+
+func TestDaemonSendFile(t *testing.T) {
+	script := `
+{"fake":"turn"}
+{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{"path":"out/chart.png","caption":"the chart"}}
+{"fake":"reply","text":"result: {{tool_result}}"}
+{"fake":"turn"}
+{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{"path":"notes.txt"}}
+{"fake":"reply","text":"result: {{tool_result}}"}
+{"fake":"turn"}
+{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{"path":"../secret.txt"}}
+{"fake":"reply","text":"result: {{tool_result}}"}
+`
+	// send_file works with permissions skipped, and needs no prompt without
+	for _, skip := range []bool{true, false} {
+		t.Run("skip_permissions="+strconv.FormatBool(skip), func(t *testing.T) {
+			d := startDaemon(t, script, func(cfg *config.Config, home string) {
+				cfg.Claude.SkipPermissions = skip
+			})
+
+			parent := t.TempDir()
+			cwd := filepath.Join(parent, "project")
+			os.MkdirAll(filepath.Join(cwd, "out"), 0755)
+			os.WriteFile(filepath.Join(cwd, "out", "chart.png"), []byte("png bytes"), 0644)
+			os.WriteFile(filepath.Join(cwd, "notes.txt"), []byte("notes"), 0644)
+			os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644)
+			d.send(t, "/cd "+cwd, "project")
+
+			sent := d.tg.SendText(testChat, testUser, "draw a chart")
+			d.wait(t, sent, "result: Sent")
+			sent = d.tg.SendText(testChat, testUser, "send the notes")
+			d.wait(t, sent, "result: Sent")
+			sent = d.tg.SendText(testChat, testUser, "send the secret")
+			d.wait(t, sent, "outside the working directory")
+
+			var files []telegramtest.Message
+			for _, m := range d.tg.Messages(testChat) {
+				if m.File != "" {
+					files = append(files, m)
+				}
+				if m.Button("Allow") != nil {
+					t.Errorf("send_file asked for permission: %q", m.Text)
+				}
+			}
+			if len(files) != 2 {
+				t.Fatalf("bot sent %d files, want 2: %+v", len(files), files)
+			}
+			if f := files[0]; f.File != "chart.png" || !f.Photo || f.Text != "the chart" || string(f.FileData) != "png bytes" {
+				t.Errorf("image sent as %q photo=%v caption=%q data=%q, want a captioned photo", f.File, f.Photo, f.Text, f.FileData)
+			}
+			if f := files[1]; f.File != "notes.txt" || f.Photo || string(f.FileData) != "notes" {
+				t.Errorf("text file sent as %q photo=%v data=%q, want a document", f.File, f.Photo, f.FileData)
+			}
+		})
+	}
+}
+
+func TestDaemonReplyContext(t *testing.T) {
+	d := startDaemon(t, strings.Repeat(`
+{"fake":"turn"}
+{"fake":"reply","text":"session {{session_id}}"}
+`, 4), nil)
+
+	first := d.send(t, "first question", "session ")
+
+	// Replying quotes the replied-to message to Claude
+	sent := d.tg.SendReply(testChat, testUser, first.ID, "tell me more")
+	d.wait(t, sent, "session ")
+	var last string
+	for _, e := range d.claudeLog(t) {
+		if e.Message != "" {
+			last = e.Message
+		}
+	}
+	if !strings.Contains(last, "Replying to your earlier message:\n> "+first.Text) || !strings.HasSuffix(last, "tell me more") {
+		t.Errorf("reply sent to claude as %q, want the quoted message then the reply", last)
+	}
+
+	// Replying to a message from an earlier session offers to switch back
+	d.send(t, "/clear", "")
+	second := d.send(t, "new topic", "session ")
+	if second.Text == first.Text {
+		t.Fatalf("/clear kept the session: %q", second.Text)
+	}
+	sent = d.tg.SendReply(testChat, testUser, first.ID, "back to this")
+	offer, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Switch") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.press(t, offer, "Switch")
+	d.wait(t, offer.ID, first.Text)
+}
+
+func TestDaemonPermissionRules(t *testing.T) {
+	turn := `
+{"fake":"turn"}
+{"fake":"permission","tool_name":"Bash","input":{"command":"go test ./..."},"tool_use_id":"toolu_1"}
+{"fake":"reply","text":"permission {{permission}}"}`
+	d := startDaemon(t, turn+turn+turn, func(cfg *config.Config, home string) {
+		cfg.Claude.SkipPermissions = false
+	})
+
+	prompted := func(after int64) int {
+		n := 0
+		for _, m := range d.tg.Messages(testChat) {
+			if m.ID > after && m.Button("Always") != nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Always saves a rule for the command
+	sent := d.tg.SendText(testChat, testUser, "run the tests")
+	prompt, err := d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Always") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.press(t, prompt, "Always")
+	d.wait(t, prompt.ID, "permission allow")
+
+	// so the same command runs without asking
+	sent = d.tg.SendText(testChat, testUser, "run them again")
+	d.wait(t, sent, "permission allow")
+	if n := prompted(sent); n != 0 {
+		t.Errorf("allowed command prompted %d time(s)", n)
+	}
+	data, err := os.ReadFile(filepath.Join(d.home, ".config", "aria", "permissions.yaml"))
+	if err != nil || !strings.Contains(string(data), "go test ./...") {
+		t.Errorf("permissions.yaml = %q, %v; want the saved rule", data, err)
+	}
+
+	if list := d.send(t, "/permissions", "Permission rules"); !strings.Contains(list.Text, "go test") {
+		t.Errorf("/permissions = %q, want the saved rule", list.Text)
+	}
+	d.send(t, "/permissions revoke 1", "Revoked Bash")
+
+	// Once revoked, it asks again
+	sent = d.tg.SendText(testChat, testUser, "and once more")
+	prompt, err = d.tg.WaitFor(testChat, waitTime, func(m telegramtest.Message) bool {
+		return m.ID > sent && m.Button("Allow") != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.press(t, prompt, "Allow")
+	d.wait(t, prompt.ID, "permission allow")
+}
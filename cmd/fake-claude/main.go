@@ -0,0 +1,10 @@
+// Command fake-claude is a scriptable stand-in for the claude CLI
+// Run aria with -claude pointing at it to try changes without a real Claude session;
+// see the claudetest package for the script format
+package main
+
+import "github.com/codegangsta/aria/internal/claude/claudetest"
+
+func main() {
+	claudetest.Main()
+}
@@ -4,5 +4,7 @@ go 1.25.5
 
 require (
 	github.com/PaulSonOfLars/gotgbot/v2 v2.0.0-rc.33
+	github.com/gorilla/websocket v1.5.3
+	github.com/slack-go/slack v0.17.3
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,85 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExceeded is returned by Send when a chat or global daily budget is used up
+var ErrBudgetExceeded = errors.New("daily budget exceeded")
+
+// budgetWarnFraction is the share of a budget at which a warning is sent
+const budgetWarnFraction = 0.8
+
+// Budget holds daily USD spending limits (0 = no limit)
+type Budget struct {
+	DailyUSD        float64           // Across all chats
+	PerChatDailyUSD float64           // Default limit for each chat
+	ChatDailyUSD    map[int64]float64 // Per-chat overrides
+}
+
+// ChatLimit returns the daily limit for a chat (0 = no limit)
+func (b Budget) ChatLimit(chatID int64) float64 {
+	if limit, ok := b.ChatDailyUSD[chatID]; ok {
+		return limit
+	}
+	return b.PerChatDailyUSD
+}
+
+// SetBudget sets daily spending limits, enforced from the usage store
+func (m *ProcessManager) SetBudget(b Budget) {
+	m.budget = &b
+}
+
+// checkBudget returns ErrBudgetExceeded if the chat or global budget is spent for today
+func (m *ProcessManager) checkBudget(chatID int64) error {
+	if m.budget == nil || m.usage == nil {
+		return nil
+	}
+
+	today := StartOfDay(time.Now())
+
+	if limit := m.budget.ChatLimit(chatID); limit > 0 {
+		if spent := m.usage.ChatTotals(chatID, today).CostUSD; spent >= limit {
+			return fmt.Errorf("%w: this chat spent $%.2f of its $%.2f daily budget", ErrBudgetExceeded, spent, limit)
+		}
+	}
+
+	if limit := m.budget.DailyUSD; limit > 0 {
+		if spent := m.usage.AllTotals(today).CostUSD; spent >= limit {
+			return fmt.Errorf("%w: all chats spent $%.2f of the $%.2f daily budget", ErrBudgetExceeded, spent, limit)
+		}
+	}
+
+	return nil
+}
+
+// budgetWarnings returns warnings for budgets that just crossed the warning threshold
+// Each budget warns at most once per day, tracked in the usage store
+func (m *ProcessManager) budgetWarnings(chatID int64) []string {
+	if m.budget == nil || m.usage == nil {
+		return nil
+	}
+
+	now := time.Now()
+	today := StartOfDay(now)
+	day := now.Format(dayFormat)
+	var warnings []string
+
+	if limit := m.budget.ChatLimit(chatID); limit > 0 {
+		spent := m.usage.ChatTotals(chatID, today).CostUSD
+		if spent >= limit*budgetWarnFraction && m.usage.MarkWarned(fmt.Sprintf("chat:%d", chatID), day) {
+			warnings = append(warnings, fmt.Sprintf("Budget warning: this chat has spent $%.2f of its $%.2f daily budget.", spent, limit))
+		}
+	}
+
+	if limit := m.budget.DailyUSD; limit > 0 {
+		spent := m.usage.AllTotals(today).CostUSD
+		if spent >= limit*budgetWarnFraction && m.usage.MarkWarned("global", day) {
+			warnings = append(warnings, fmt.Sprintf("Budget warning: all chats have spent $%.2f of the $%.2f daily budget.", spent, limit))
+		}
+	}
+
+	return warnings
+}
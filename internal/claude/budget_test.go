@@ -0,0 +1,121 @@
+package claude
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/aria/internal/types"
+)
+
+// newBudgetManager returns a manager enforcing b from an empty usage store
+func newBudgetManager(t *testing.T, b Budget) (*ProcessManager, *UsageStore) {
+	t.Helper()
+	m := NewManager("", false, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	usage := NewUsageStore(filepath.Join(t.TempDir(), "usage.yaml"))
+	t.Cleanup(usage.Flush)
+	m.SetUsageStore(usage)
+	m.SetBudget(b)
+	return m, usage
+}
+
+// spend records a turn costing cost for a chat
+func spend(usage *UsageStore, chatID int64, cost float64, at time.Time) {
+	usage.Record(chatID, "session", types.Usage{CostUSD: cost}, at)
+}
+
+func TestCheckBudgetChatLimit(t *testing.T) {
+	m, usage := newBudgetManager(t, Budget{
+		PerChatDailyUSD: 1,
+		ChatDailyUSD:    map[int64]float64{2: 5},
+	})
+	now := time.Now()
+
+	spend(usage, 1, 0.6, now)
+	if err := m.checkBudget(1); err != nil {
+		t.Fatalf("checkBudget() under the limit = %v", err)
+	}
+
+	spend(usage, 1, 0.5, now)
+	err := m.checkBudget(1)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("checkBudget() over the limit = %v, want ErrBudgetExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "$1.10 of its $1.00") {
+		t.Errorf("error = %q, want the spend and limit", err)
+	}
+
+	// Chat 2 has a higher limit, and chat 3 hasn't spent anything
+	spend(usage, 2, 1.1, now)
+	if err := m.checkBudget(2); err != nil {
+		t.Errorf("checkBudget(2) with an override = %v", err)
+	}
+	if err := m.checkBudget(3); err != nil {
+		t.Errorf("checkBudget(3) = %v", err)
+	}
+}
+
+func TestCheckBudgetGlobalLimit(t *testing.T) {
+	m, usage := newBudgetManager(t, Budget{DailyUSD: 2})
+	now := time.Now()
+
+	spend(usage, 1, 1.5, now)
+	if err := m.checkBudget(3); err != nil {
+		t.Fatalf("checkBudget() under the limit = %v", err)
+	}
+
+	spend(usage, 2, 0.6, now)
+	if err := m.checkBudget(3); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("checkBudget() over the global limit = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestCheckBudgetRollover(t *testing.T) {
+	m, usage := newBudgetManager(t, Budget{DailyUSD: 2, PerChatDailyUSD: 1})
+
+	// Yesterday's spending doesn't count against today
+	spend(usage, 1, 10, time.Now().AddDate(0, 0, -1))
+	if err := m.checkBudget(1); err != nil {
+		t.Errorf("checkBudget() after yesterday's spending = %v", err)
+	}
+}
+
+func TestBudgetWarnings(t *testing.T) {
+	m, usage := newBudgetManager(t, Budget{DailyUSD: 10, PerChatDailyUSD: 1})
+	now := time.Now()
+
+	spend(usage, 1, 0.5, now)
+	if warnings := m.budgetWarnings(1); len(warnings) != 0 {
+		t.Fatalf("warnings at 50%% = %q, want none", warnings)
+	}
+
+	spend(usage, 1, 0.35, now)
+	warnings := m.budgetWarnings(1)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "this chat has spent $0.85 of its $1.00") {
+		t.Fatalf("warnings at 85%% = %q, want the chat warning", warnings)
+	}
+
+	// Each budget warns once a day
+	spend(usage, 1, 0.1, now)
+	if warnings := m.budgetWarnings(1); len(warnings) != 0 {
+		t.Errorf("warnings after warning = %q, want none", warnings)
+	}
+
+	spend(usage, 2, 7.5, now)
+	warnings = m.budgetWarnings(2)
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "all chats have spent $8.45 of the $10.00") {
+		t.Errorf("warnings = %q, want chat 2's and the global warning", warnings)
+	}
+
+	// A warning sent yesterday doesn't hold back today's
+	yesterday := now.AddDate(0, 0, -1).Format(dayFormat)
+	usage.MarkWarned("chat:3", yesterday)
+	spend(usage, 3, 0.9, now)
+	if warnings := m.budgetWarnings(3); len(warnings) != 1 {
+		t.Errorf("warnings after yesterday's = %q, want today's", warnings)
+	}
+}
@@ -3,7 +3,6 @@ package claude
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -13,27 +12,6 @@ import (
 // Default timeout for Claude commands
 const DefaultTimeout = 5 * time.Minute
 
-// ContentBlock represents a content block in a Claude message
-// Can be either "text" or "tool_use" type
-type ContentBlock struct {
-	Type  string                 `json:"type"`
-	Text  string                 `json:"text,omitempty"`
-	ID    string                 `json:"id,omitempty"`    // tool_use: unique ID
-	Name  string                 `json:"name,omitempty"`  // tool_use: tool name
-	Input map[string]interface{} `json:"input,omitempty"` // tool_use: parameters
-}
-
-// MessageContent represents the message in an assistant event
-type MessageContent struct {
-	Content []ContentBlock `json:"content"`
-}
-
-// Event represents a stream-json event from Claude
-type Event struct {
-	Type    string         `json:"type"`
-	Message MessageContent `json:"message,omitempty"`
-}
-
 // Client handles communication with Claude Code CLI
 type Client struct {
 	claudePath string
@@ -104,15 +82,11 @@ func (c *Client) StreamRun(ctx context.Context, sessionID, userMessage string, o
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		var event Event
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
-			// Skip non-JSON lines
-			continue
-		}
+		event, _ := DecodeEvent([]byte(line))
 
-		// Only process assistant messages
-		if event.Type == "assistant" {
-			for _, content := range event.Message.Content {
+		// Only process assistant messages (non-JSON lines have no type)
+		if event.Assistant != nil {
+			for _, content := range event.Assistant.Message.Content {
 				if content.Type == "text" && content.Text != "" {
 					onMessage(content.Text)
 				}
@@ -0,0 +1,793 @@
+// Package claudetest is a scriptable fake of the claude CLI for end-to-end tests
+//
+// The fake speaks the same stream-json protocol as `claude -p --input-format
+// stream-json --output-format stream-json`. It replays the JSONL script named
+// by FAKE_CLAUDE_SCRIPT, one line at a time. A line is either a raw event,
+// written to stdout as-is, or a directive with a "fake" key:
+//
+//	{"fake":"turn"}                  wait for the next user message, then emit system/init
+//	{"fake":"reply","text":"..."}    emit an assistant text message and a success result
+//	{"fake":"permission","tool_name":"Bash","input":{...},"tool_use_id":"..."}
+//	                                 emit a tool_use, ask the --permission-prompt-tool
+//	                                 and emit the tool_result (denials as errors)
+//	{"fake":"mcp","tool_name":"mcp__aria__send_file","input":{...},"tool_use_id":"..."}
+//	                                 as permission, then call the tool on its --mcp-config
+//	                                 server and emit its result as the tool_result
+//	{"fake":"parallel","calls":[{"tool_name":...,"input":...,"tool_use_id":...},...]}
+//	                                 as permission for several tools at once, the way
+//	                                 parallel tool calls are; the prompts are all open
+//	                                 together and {{permission}} lists the behaviors
+//	{"fake":"sleep","ms":100}        pause before the next line; an interrupt control
+//	                                 request ends the turn there with an error result
+//	{"fake":"exit","code":1,"stderr":"..."}
+//	                                 write stderr and exit
+//
+// Raw events and reply text may use {{session_id}}, {{message}} (the last
+// user message), {{permission}} (the last permission behavior), {{input}} (the
+// input the last allowed tool ran with, as JSON, honoring the permission
+// tool's updatedInput) and {{tool_result}} (the text of the last tool_result). In raw
+// events the values are JSON-escaped so they can sit inside a JSON string.
+// Without a script the fake echoes every message back.
+//
+// --resume is honored: the resumed ID is reported in init, and when
+// FAKE_CLAUDE_SESSIONS names a directory, IDs without a file there fail the
+// way the CLI does ("No conversation found with session ID").
+// FAKE_CLAUDE_LOG, if set, records the arguments, every user message and
+// every control request.
+package claudetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables read by the fake
+const (
+	EnvScript   = "FAKE_CLAUDE_SCRIPT"   // Path to the JSONL script
+	EnvSessions = "FAKE_CLAUDE_SESSIONS" // Directory of known session IDs
+	EnvLog      = "FAKE_CLAUDE_LOG"      // Path to append LogEntry lines to
+)
+
+// SlashCommands are the commands reported in every init event
+var SlashCommands = []string{"compact", "commit"}
+
+// LogEntry is one line of the FAKE_CLAUDE_LOG file
+// Each process logs its arguments first, then each user message and control
+// request it receives
+type LogEntry struct {
+	PID     int      `json:"pid"`
+	Args    []string `json:"args,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Images  []string `json:"images,omitempty"`  // media types of the message's image blocks
+	Control string   `json:"control,omitempty"` // subtype of a control request, e.g. "interrupt"
+}
+
+// ReadLog reads the entries written to a FAKE_CLAUDE_LOG file
+func ReadLog(path string) ([]LogEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LogEntry
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("parsing log line: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// directive is a script line with a "fake" key
+type directive struct {
+	Fake      string                 `json:"fake"`
+	Text      string                 `json:"text"`
+	ToolName  string                 `json:"tool_name"`
+	Input     map[string]interface{} `json:"input"`
+	ToolUseID string                 `json:"tool_use_id"`
+	Ms        int                    `json:"ms"`
+	Code      int                    `json:"code"`
+	Stderr    string                 `json:"stderr"`
+	Calls     []directive            `json:"calls"`
+}
+
+// fake holds the state of one fake claude process
+type fake struct {
+	args       []string
+	sessionID  string
+	model      string
+	mcpConfig  string
+	permTool   string // --permission-prompt-tool, empty when permissions are skipped
+	messages   chan userMessage
+	message    string // Last user message
+	permission string // Last permission behavior
+	input      string // Input the last allowed tool ran with, as JSON
+	toolResult string // Text of the last tool_result
+	msgSeq     int
+	costUSD    float64 // Running total_cost_usd, which the CLI reports per process
+	interrupts chan struct{}
+	mcp        *mcpClient
+	out        io.Writer
+	outMu      sync.Mutex
+	logPath    string
+}
+
+// Main runs the fake with os.Args and exits
+// Call it from a main package, or from TestMain to re-exec the test binary as claude
+func Main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the fake and returns the exit code
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	f := &fake{
+		args:      args,
+		model:     flagValue(args, "--model"),
+		mcpConfig: flagValue(args, "--mcp-config"),
+		permTool:  flagValue(args, "--permission-prompt-tool"),
+		out:       stdout,
+		logPath:   os.Getenv(EnvLog),
+	}
+	f.log(LogEntry{Args: args})
+
+	if resume := flagValue(args, "--resume"); resume != "" {
+		if dir := os.Getenv(EnvSessions); dir != "" {
+			if _, err := os.Stat(filepath.Join(dir, resume)); err != nil {
+				fmt.Fprintf(stderr, "No conversation found with session ID: %s\n", resume)
+				return 1
+			}
+		}
+		f.sessionID = resume
+	} else {
+		f.sessionID = newSessionID()
+		if dir := os.Getenv(EnvSessions); dir != "" {
+			os.WriteFile(filepath.Join(dir, f.sessionID), nil, 0644)
+		}
+	}
+
+	defer func() {
+		if f.mcp != nil {
+			f.mcp.close()
+		}
+	}()
+
+	script, err := loadScript(os.Getenv(EnvScript))
+	if err != nil {
+		fmt.Fprintf(stderr, "fake claude: %v\n", err)
+		return 2
+	}
+
+	f.messages = make(chan userMessage)
+	f.interrupts = make(chan struct{}, 1)
+	go f.readStdin(stdin)
+
+	interrupted := false
+	for _, line := range script {
+		var d directive
+		json.Unmarshal(line, &d)
+
+		// An interrupted turn skips the rest of its lines
+		if interrupted && d.Fake != "turn" {
+			continue
+		}
+		interrupted = false
+
+		switch d.Fake {
+		case "":
+			f.emitRaw(line)
+		case "turn":
+			if !f.turn() {
+				return 0
+			}
+		case "reply":
+			f.reply(f.expand(d.Text, false))
+		case "permission":
+			f.askPermissions([]directive{d}, false)
+		case "mcp":
+			f.askPermissions([]directive{d}, true)
+		case "parallel":
+			f.askPermissions(d.Calls, false)
+		case "sleep":
+			select {
+			case <-time.After(time.Duration(d.Ms) * time.Millisecond):
+			case <-f.interrupts:
+				f.result("error_during_execution", "")
+				interrupted = true
+			}
+		case "exit":
+			if d.Stderr != "" {
+				fmt.Fprintln(stderr, d.Stderr)
+			}
+			return d.Code
+		default:
+			fmt.Fprintf(stderr, "fake claude: unknown directive %q\n", d.Fake)
+			return 2
+		}
+	}
+
+	// Script done - echo anything else until stdin closes
+	for f.turn() {
+		f.reply(f.message)
+	}
+	return 0
+}
+
+// loadScript reads the script lines, or returns nil for no script
+func loadScript(path string) ([][]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading script: %w", err)
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("invalid script line: %s", line)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// userMessage is a user message read from stdin
+type userMessage struct {
+	text   string
+	images []string // media types of image blocks
+}
+
+// readStdin forwards user messages to f.messages and answers control requests
+func (f *fake) readStdin(stdin io.Reader) {
+	defer close(f.messages)
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Type      string `json:"type"`
+			RequestID string `json:"request_id"`
+			Request   struct {
+				Subtype string `json:"subtype"`
+			} `json:"request"`
+			Message struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "user":
+			f.messages <- parseContent(msg.Message.Content)
+		case "control_request":
+			f.log(LogEntry{Control: msg.Request.Subtype})
+			f.emit(map[string]interface{}{
+				"type": "control_response",
+				"response": map[string]interface{}{
+					"subtype":    "success",
+					"request_id": msg.RequestID,
+				},
+			})
+			if msg.Request.Subtype == "interrupt" {
+				select {
+				case f.interrupts <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// parseContent returns the text and images of a message content, either a
+// string or content blocks
+func parseContent(content json.RawMessage) userMessage {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return userMessage{text: text}
+	}
+
+	var blocks []struct {
+		Type   string `json:"type"`
+		Text   string `json:"text"`
+		Source struct {
+			MediaType string `json:"media_type"`
+		} `json:"source"`
+	}
+	json.Unmarshal(content, &blocks)
+	var msg userMessage
+	var parts []string
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, block.Text)
+		case "image":
+			msg.images = append(msg.images, block.Source.MediaType)
+		}
+	}
+	msg.text = strings.Join(parts, "\n")
+	return msg
+}
+
+// turn waits for the next user message and emits init
+// Returns false once stdin is closed
+func (f *fake) turn() bool {
+	msg, ok := <-f.messages
+	if !ok {
+		return false
+	}
+	// An interrupt that came between turns doesn't carry over
+	select {
+	case <-f.interrupts:
+	default:
+	}
+	f.message = msg.text
+	f.log(LogEntry{Message: msg.text, Images: msg.images})
+
+	cwd, _ := os.Getwd()
+	model := f.model
+	if model == "" {
+		model = "fake"
+	}
+	f.emit(map[string]interface{}{
+		"type":           "system",
+		"subtype":        "init",
+		"session_id":     f.sessionID,
+		"cwd":            cwd,
+		"model":          model,
+		"permissionMode": "default",
+		"tools":          []string{"Bash", "Read", "Edit"},
+		"slash_commands": SlashCommands,
+	})
+	return true
+}
+
+// reply emits an assistant text message followed by a success result
+func (f *fake) reply(text string) {
+	f.emitAssistant(map[string]interface{}{"type": "text", "text": text})
+	f.result("success", text)
+}
+
+// result emits the result event ending a turn
+func (f *fake) result(subtype, text string) {
+	f.costUSD += 0.001
+	f.emit(map[string]interface{}{
+		"type":           "result",
+		"subtype":        subtype,
+		"is_error":       subtype != "success",
+		"result":         text,
+		"session_id":     f.sessionID,
+		"total_cost_usd": f.costUSD,
+		"duration_ms":    10,
+		"num_turns":      1,
+		"usage": map[string]int{
+			"input_tokens":  10,
+			"output_tokens": 5,
+		},
+	})
+}
+
+// askPermissions emits a tool_use for each call, asks the MCP permission tool
+// about all of them at once and emits their tool_results in order
+// Without --permission-prompt-tool the tools are allowed, as with --dangerously-skip-permissions
+// If call is set, allowed tools are then called on their MCP server
+func (f *fake) askPermissions(calls []directive, call bool) {
+	type answer struct {
+		behavior, message string
+		input             map[string]interface{}
+	}
+	answers := make([]answer, len(calls))
+	for i := range calls {
+		if calls[i].ToolUseID == "" {
+			calls[i].ToolUseID = "toolu_fake"
+		}
+		f.emitAssistant(map[string]interface{}{
+			"type":  "tool_use",
+			"id":    calls[i].ToolUseID,
+			"name":  calls[i].ToolName,
+			"input": calls[i].Input,
+		})
+		answers[i] = answer{behavior: "allow", input: calls[i].Input}
+	}
+
+	if f.permTool != "" {
+		if err := f.startMCP(); err != nil {
+			for i := range answers {
+				answers[i] = answer{behavior: "deny", message: err.Error()}
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i, d := range calls {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					a := &answers[i]
+					var err error
+					a.behavior, a.message, a.input, err = f.callPermissionTool(d.ToolName, d.Input, d.ToolUseID)
+					if err != nil {
+						a.behavior, a.message = "deny", err.Error()
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	}
+
+	var behaviors []string
+	for i, d := range calls {
+		a := answers[i]
+		behaviors = append(behaviors, a.behavior)
+		if a.behavior != "deny" {
+			data, _ := json.Marshal(a.input)
+			f.input = string(data)
+		}
+
+		content, isError := "ok", false
+		switch {
+		case a.behavior == "deny":
+			content, isError = a.message, true
+		case call:
+			var err error
+			content, isError, err = f.callMCPTool(d.ToolName, a.input)
+			if err != nil {
+				content, isError = err.Error(), true
+			}
+		}
+		f.toolResult = content
+
+		result := map[string]interface{}{
+			"type":        "tool_result",
+			"tool_use_id": d.ToolUseID,
+			"content":     content,
+		}
+		if isError {
+			result["is_error"] = true
+		}
+		f.emit(map[string]interface{}{
+			"type":               "user",
+			"message":            map[string]interface{}{"role": "user", "content": []interface{}{result}},
+			"parent_tool_use_id": nil,
+			"session_id":         f.sessionID,
+		})
+	}
+	f.permission = strings.Join(behaviors, ",")
+}
+
+// startMCP starts the MCP server from --mcp-config on first use
+func (f *fake) startMCP() error {
+	if f.mcp != nil {
+		return nil
+	}
+	if f.mcpConfig == "" {
+		return fmt.Errorf("no --mcp-config")
+	}
+	client, err := startMCP(f.mcpConfig)
+	if err != nil {
+		return err
+	}
+	f.mcp = client
+	return nil
+}
+
+// callMCPTool calls an mcp__<server>__<tool> tool on the MCP server from --mcp-config
+func (f *fake) callMCPTool(toolName string, input map[string]interface{}) (string, bool, error) {
+	parts := strings.SplitN(toolName, "__", 3)
+	if len(parts) != 3 || parts[0] != "mcp" {
+		return "", false, fmt.Errorf("not an MCP tool: %s", toolName)
+	}
+	if err := f.startMCP(); err != nil {
+		return "", false, err
+	}
+	return f.mcp.callTool(parts[2], input)
+}
+
+// callPermissionTool calls prompt_permission on the MCP server from --mcp-config
+// Returns the behavior, the denial message and the input to run the tool with
+func (f *fake) callPermissionTool(toolName string, input map[string]interface{}, toolUseID string) (string, string, map[string]interface{}, error) {
+	if err := f.startMCP(); err != nil {
+		return "", "", nil, err
+	}
+
+	text, _, err := f.mcp.callTool("prompt_permission", map[string]interface{}{
+		"tool_name":   toolName,
+		"input":       input,
+		"tool_use_id": toolUseID,
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var resp struct {
+		Behavior     string                 `json:"behavior"`
+		Message      string                 `json:"message"`
+		UpdatedInput map[string]interface{} `json:"updatedInput"`
+	}
+	if err := json.Unmarshal([]byte(text), &resp); err != nil {
+		return "", "", nil, fmt.Errorf("parsing permission response %q: %w", text, err)
+	}
+	if resp.UpdatedInput != nil {
+		input = resp.UpdatedInput
+	}
+	return resp.Behavior, resp.Message, input, nil
+}
+
+// emitAssistant emits an assistant message with a single content block
+func (f *fake) emitAssistant(block map[string]interface{}) {
+	f.msgSeq++
+	f.emit(map[string]interface{}{
+		"type": "assistant",
+		"message": map[string]interface{}{
+			"id":      fmt.Sprintf("msg_fake_%d", f.msgSeq),
+			"role":    "assistant",
+			"model":   f.model,
+			"content": []interface{}{block},
+		},
+		"parent_tool_use_id": nil,
+		"session_id":         f.sessionID,
+	})
+}
+
+// emit writes an event as a JSON line
+func (f *fake) emit(event map[string]interface{}) {
+	data, _ := json.Marshal(event)
+	f.write(data)
+}
+
+// emitRaw writes a raw script line with its placeholders expanded
+func (f *fake) emitRaw(line []byte) {
+	f.write([]byte(f.expand(string(line), true)))
+}
+
+// write writes a line to stdout; control responses are written from the
+// stdin reader, so lines are written whole
+func (f *fake) write(line []byte) {
+	f.outMu.Lock()
+	defer f.outMu.Unlock()
+	f.out.Write(append(line, '\n'))
+}
+
+// expand replaces the script placeholders, JSON-escaping the values if escape is set
+func (f *fake) expand(text string, escape bool) string {
+	value := func(s string) string {
+		if !escape {
+			return s
+		}
+		quoted, _ := json.Marshal(s)
+		return string(quoted[1 : len(quoted)-1])
+	}
+	return strings.NewReplacer(
+		"{{session_id}}", value(f.sessionID),
+		"{{message}}", value(f.message),
+		"{{permission}}", value(f.permission),
+		"{{input}}", value(f.input),
+		"{{tool_result}}", value(f.toolResult),
+	).Replace(text)
+}
+
+// log appends an entry to the FAKE_CLAUDE_LOG file
+func (f *fake) log(entry LogEntry) {
+	if f.logPath == "" {
+		return
+	}
+	entry.PID = os.Getpid()
+	data, _ := json.Marshal(entry)
+
+	file, err := os.OpenFile(f.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
+
+// flagValue returns the value following name in args, or ""
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// newSessionID returns a random UUID-formatted session ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// mcpClient talks JSON-RPC to an MCP server subprocess over stdio
+// Calls may run concurrently; responses are matched to them by ID
+type mcpClient struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	nextID  int
+	pending map[int]chan rpcResponse // Calls waiting for a response, by ID
+	closed  error                    // Set once the server's stdout ends
+	mu      sync.Mutex
+}
+
+// rpcResponse is a JSON-RPC response from the MCP server
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// startMCP starts the first server in an MCP config file and initializes it
+func startMCP(configPath string) (*mcpClient, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading mcp config: %w", err)
+	}
+
+	var config struct {
+		MCPServers map[string]struct {
+			Command string            `json:"command"`
+			Args    []string          `json:"args"`
+			Env     map[string]string `json:"env"`
+		} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing mcp config: %w", err)
+	}
+
+	for _, server := range config.MCPServers {
+		cmd := exec.Command(server.Command, server.Args...)
+		cmd.Env = os.Environ()
+		for k, v := range server.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		cmd.Stderr = os.Stderr
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("starting mcp server: %w", err)
+		}
+
+		client := &mcpClient{cmd: cmd, stdin: stdin, pending: make(map[int]chan rpcResponse)}
+		go client.read(stdout)
+
+		if _, err := client.call("initialize", map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"clientInfo":      map[string]string{"name": "fake-claude", "version": "0"},
+		}); err != nil {
+			client.close()
+			return nil, err
+		}
+		return client, nil
+	}
+
+	return nil, fmt.Errorf("no servers in mcp config")
+}
+
+// callTool calls an MCP tool and returns the text of its first content block
+// and whether the tool reported an error
+func (c *mcpClient) callTool(name string, arguments map[string]interface{}) (string, bool, error) {
+	result, err := c.call("tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": arguments,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	var parsed struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(result, &parsed); err != nil {
+		return "", false, fmt.Errorf("parsing tool result: %w", err)
+	}
+	if len(parsed.Content) == 0 {
+		return "", false, fmt.Errorf("empty tool result")
+	}
+	return parsed.Content[0].Text, parsed.IsError, nil
+}
+
+// call sends a JSON-RPC request and waits for the response with its ID
+func (c *mcpClient) call(method string, params interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	if c.closed != nil {
+		c.mu.Unlock()
+		return nil, c.closed
+	}
+	c.nextID++
+	id := c.nextID
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	respCh := make(chan rpcResponse, 1)
+	c.pending[id] = respCh
+	_, err = c.stdin.Write(append(data, '\n'))
+	c.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("writing to mcp server: %w", err)
+	}
+
+	resp, ok := <-respCh
+	if !ok {
+		return nil, c.closed
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("mcp %s: %s", method, resp.Error.Message)
+	}
+	return resp.Result, nil
+}
+
+// read hands responses to the calls waiting for them until stdout closes
+func (c *mcpClient) read(stdout io.Reader) {
+	reader := bufio.NewScanner(stdout)
+	reader.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for reader.Scan() {
+		var resp rpcResponse
+		if json.Unmarshal(reader.Bytes(), &resp) != nil {
+			continue
+		}
+		c.mu.Lock()
+		if respCh, ok := c.pending[resp.ID]; ok {
+			delete(c.pending, resp.ID)
+			respCh <- resp
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = fmt.Errorf("mcp server closed: %v", reader.Err())
+	for id, respCh := range c.pending {
+		delete(c.pending, id)
+		close(respCh)
+	}
+}
+
+// close stops the MCP server
+func (c *mcpClient) close() {
+	c.stdin.Close()
+	c.cmd.Wait()
+}
@@ -0,0 +1,265 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/codegangsta/aria/internal/types"
+)
+
+// StreamEvent is one decoded line of the CLI's stream-json output
+// Type and Subtype are always set; at most one of the typed fields is set,
+// matching the event type (unknown types only carry Type and Raw)
+type StreamEvent struct {
+	Type    string `json:"type"`              // system, assistant, user, result, stream_event, input_request
+	Subtype string `json:"subtype,omitempty"` // e.g. init, compact_boundary, success
+
+	// Top-level tool reference, present on some events regardless of type
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+
+	Init         *InitEvent            `json:"init,omitempty"`          // system/init
+	Compact      *CompactBoundaryEvent `json:"compact,omitempty"`       // system/compact_boundary
+	Assistant    *AssistantEvent       `json:"assistant,omitempty"`     // assistant
+	User         *UserEvent            `json:"user,omitempty"`          // user
+	Result       *ResultEvent          `json:"result,omitempty"`        // result
+	Partial      *PartialEvent         `json:"partial,omitempty"`       // stream_event
+	InputRequest *InputRequestEvent    `json:"input_request,omitempty"` // input_request
+
+	Raw []byte `json:"-"` // The original line
+}
+
+// DecodeEvent decodes a single stream-json line into a typed StreamEvent
+// Returns an error with a zero Type for lines that aren't JSON events
+// If the typed payload fails to decode, the event is returned along with the
+// error and the typed field holds whatever could be decoded
+func DecodeEvent(line []byte) (StreamEvent, error) {
+	var envelope struct {
+		Type      string `json:"type"`
+		Subtype   string `json:"subtype"`
+		ToolUseID string `json:"tool_use_id"`
+		IsError   bool   `json:"is_error"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return StreamEvent{}, fmt.Errorf("decoding event: %w", err)
+	}
+	if envelope.Type == "" {
+		return StreamEvent{}, fmt.Errorf("decoding event: missing type")
+	}
+
+	event := StreamEvent{
+		Type:      envelope.Type,
+		Subtype:   envelope.Subtype,
+		ToolUseID: envelope.ToolUseID,
+		IsError:   envelope.IsError,
+		Raw:       line,
+	}
+
+	var payload interface{}
+	switch envelope.Type {
+	case "system":
+		switch envelope.Subtype {
+		case "init":
+			event.Init = &InitEvent{}
+			payload = event.Init
+		case "compact_boundary":
+			event.Compact = &CompactBoundaryEvent{}
+			payload = event.Compact
+		}
+	case "assistant":
+		event.Assistant = &AssistantEvent{}
+		payload = event.Assistant
+	case "user":
+		event.User = &UserEvent{}
+		payload = event.User
+	case "result":
+		event.Result = &ResultEvent{}
+		payload = event.Result
+	case "stream_event":
+		event.Partial = &PartialEvent{}
+		payload = event.Partial
+	case "input_request":
+		event.InputRequest = &InputRequestEvent{}
+		payload = event.InputRequest
+	}
+
+	if payload != nil {
+		if err := json.Unmarshal(line, payload); err != nil {
+			return event, fmt.Errorf("decoding %s event: %w", envelope.Type, err)
+		}
+	}
+
+	return event, nil
+}
+
+// ContentBlock represents a content block in a Claude message
+// Covers text, thinking, tool_use, tool_result and image blocks
+type ContentBlock struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text,omitempty"`
+	Thinking  string                 `json:"thinking,omitempty"`    // thinking: reasoning text
+	ID        string                 `json:"id,omitempty"`          // tool_use: unique ID
+	Name      string                 `json:"name,omitempty"`        // tool_use: tool name
+	Input     map[string]interface{} `json:"input,omitempty"`       // tool_use: parameters
+	ToolUseID string                 `json:"tool_use_id,omitempty"` // tool_result: the tool_use it answers
+	Content   Contents               `json:"content,omitempty"`     // tool_result: output (string or blocks)
+	IsError   bool                   `json:"is_error,omitempty"`    // tool_result: true if the tool failed
+	Source    *ImageSource           `json:"source,omitempty"`      // image: the image data
+}
+
+// Contents is a list of content blocks that also accepts a plain string,
+// which the CLI uses for simple user messages and tool results
+type Contents []ContentBlock
+
+// UnmarshalJSON decodes either a string (as a single text block) or an array of blocks
+func (c *Contents) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Contents{{Type: "text", Text: text}}
+		return nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// Text joins the text of all text blocks
+func (c Contents) Text() string {
+	var parts []string
+	for _, block := range c {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Message represents the message in an assistant or user event
+type Message struct {
+	ID      string   `json:"id,omitempty"`
+	Role    string   `json:"role,omitempty"`
+	Model   string   `json:"model,omitempty"`
+	Content Contents `json:"content"`
+}
+
+// InitEvent represents the system init event from Claude
+type InitEvent struct {
+	Type           string   `json:"type"`
+	Subtype        string   `json:"subtype"`
+	SessionID      string   `json:"session_id"`
+	Cwd            string   `json:"cwd,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	PermissionMode string   `json:"permissionMode,omitempty"`
+	Tools          []string `json:"tools,omitempty"`
+	SlashCommands  []string `json:"slash_commands"`
+}
+
+// CompactBoundaryEvent marks where the conversation was compacted
+type CompactBoundaryEvent struct {
+	Type            string `json:"type"`
+	Subtype         string `json:"subtype"`
+	SessionID       string `json:"session_id"`
+	CompactMetadata struct {
+		Trigger   string `json:"trigger"` // "manual" (/compact) or "auto"
+		PreTokens int    `json:"pre_tokens"`
+	} `json:"compact_metadata"`
+}
+
+// AssistantEvent represents an assistant message (text, thinking or tool_use blocks)
+type AssistantEvent struct {
+	Type            string  `json:"type"`
+	Message         Message `json:"message"`
+	ParentToolUseID *string `json:"parent_tool_use_id"` // Set for subagent messages
+	SessionID       string  `json:"session_id,omitempty"`
+}
+
+// UserEvent represents a user event, usually carrying tool results
+type UserEvent struct {
+	Type            string          `json:"type"`
+	Message         Message         `json:"message"`
+	ParentToolUseID *string         `json:"parent_tool_use_id"`
+	SessionID       string          `json:"session_id,omitempty"`
+	ToolUseResult   json.RawMessage `json:"tool_use_result,omitempty"` // Error text, or structured tool output
+}
+
+// ToolUseResultText returns tool_use_result when it's a plain string (the CLI's error text)
+func (u UserEvent) ToolUseResultText() string {
+	var text string
+	if len(u.ToolUseResult) > 0 && json.Unmarshal(u.ToolUseResult, &text) == nil {
+		return text
+	}
+	return ""
+}
+
+// PartialEvent represents a stream_event line wrapping a raw API streaming event
+// (only emitted with --include-partial-messages)
+type PartialEvent struct {
+	Type            string      `json:"type"`
+	ParentToolUseID *string     `json:"parent_tool_use_id"`
+	SessionID       string      `json:"session_id,omitempty"`
+	Event           StreamDelta `json:"event"`
+}
+
+// StreamDelta represents the API streaming event inside a stream_event
+type StreamDelta struct {
+	Type         string        `json:"type"` // message_start, content_block_start, content_block_delta, content_block_stop, ...
+	Index        int           `json:"index"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"` // content_block_start: the block being started
+	Delta        struct {
+		Type string `json:"type,omitempty"` // text_delta, input_json_delta, thinking_delta
+		Text string `json:"text,omitempty"`
+	} `json:"delta"`
+}
+
+// ResultEvent represents the final result event from Claude
+type ResultEvent struct {
+	Type              string             `json:"type"`
+	Subtype           string             `json:"subtype,omitempty"`
+	IsError           bool               `json:"is_error,omitempty"`
+	Result            string             `json:"result,omitempty"` // Final response text
+	SessionID         string             `json:"session_id,omitempty"`
+	TotalCostUSD      float64            `json:"total_cost_usd,omitempty"`
+	DurationMs        int64              `json:"duration_ms,omitempty"`
+	NumTurns          int                `json:"num_turns,omitempty"`
+	Usage             ResultUsage        `json:"usage,omitempty"`
+	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
+}
+
+// ResultUsage represents the token counts in a result event
+type ResultUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// PermissionDenial represents a tool call that was denied during the turn
+type PermissionDenial struct {
+	ToolName  string                 `json:"tool_name"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+	ToolInput map[string]interface{} `json:"tool_input,omitempty"`
+}
+
+// ToUsage converts the result's cost and token fields to a types.Usage
+func (r ResultEvent) ToUsage() types.Usage {
+	return types.Usage{
+		InputTokens:              r.Usage.InputTokens,
+		OutputTokens:             r.Usage.OutputTokens,
+		CacheCreationInputTokens: r.Usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     r.Usage.CacheReadInputTokens,
+		CostUSD:                  r.TotalCostUSD,
+		DurationMs:               r.DurationMs,
+		NumTurns:                 r.NumTurns,
+	}
+}
+
+// InputRequestEvent represents an input_request event from Claude
+type InputRequestEvent struct {
+	Type   string `json:"type"`
+	ToolID string `json:"tool_use_id"`
+}
@@ -0,0 +1,177 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/aria/internal/types"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// transcripts returns the recorded stream-json transcripts in testdata
+func transcripts(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no transcripts in testdata")
+	}
+	return paths
+}
+
+// checkGolden compares got against the golden file, rewriting it with -update
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch (run with -update to accept)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestDecodeEventGolden(t *testing.T) {
+	for _, path := range transcripts(t) {
+		name := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				event, err := DecodeEvent([]byte(line))
+				if err != nil {
+					fmt.Fprintf(&out, "# line %d: %v\n", i+1, err)
+					if event.Type == "" {
+						continue
+					}
+				}
+				encoded, err := json.MarshalIndent(event, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				fmt.Fprintf(&out, "# line %d\n%s\n", i+1, encoded)
+			}
+
+			checkGolden(t, strings.TrimSuffix(path, ".jsonl")+".events.golden", out.Bytes())
+		})
+	}
+}
+
+func TestReadResponsesGolden(t *testing.T) {
+	for _, path := range transcripts(t) {
+		name := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			// A process whose output is the transcript and which has already exited
+			done := make(chan struct{})
+			close(done)
+			proc := &ClaudeProcess{
+				scanner: bufio.NewScanner(f),
+				chatID:  1,
+				logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+				done:    done,
+			}
+
+			var out bytes.Buffer
+			callbacks := ResponseCallbacks{
+				OnMessage: func(text string, isFinal bool) {
+					fmt.Fprintf(&out, "message final=%v: %q\n", isFinal, text)
+				},
+				OnToolUse: func(tool types.ToolUse) {
+					fmt.Fprintf(&out, "tool_use %s %s\n", tool.ID, tool.Name)
+				},
+				OnToolResult: func(result types.ToolResult) {
+					fmt.Fprintf(&out, "tool_result %s error=%v\n", result.ToolID, result.IsError)
+				},
+				OnToolError: func(toolID string, errorMsg string) {
+					fmt.Fprintf(&out, "tool_error %s: %q\n", toolID, errorMsg)
+				},
+				OnInputRequest: func(toolID string) {
+					fmt.Fprintf(&out, "input_request %s\n", toolID)
+				},
+				OnTodoUpdate: func(todos []types.Todo) {
+					for _, todo := range todos {
+						fmt.Fprintf(&out, "todo [%s] %s\n", todo.Status, todo.Content)
+					}
+				},
+				OnPermissionDenial: func(denials []string) {
+					fmt.Fprintf(&out, "permission_denial %v\n", denials)
+				},
+				OnResult: func(usage types.Usage) {
+					fmt.Fprintf(&out, "result $%.4f in=%d out=%d cache=%d/%d turns=%d\n",
+						usage.CostUSD, usage.InputTokens, usage.OutputTokens,
+						usage.CacheCreationInputTokens, usage.CacheReadInputTokens, usage.NumTurns)
+				},
+				OnPartialText: func(text string) {
+					fmt.Fprintf(&out, "partial %q\n", text)
+				},
+			}
+
+			// Read turn by turn until the transcript runs out
+			for turn := 1; turn < 10; turn++ {
+				err := proc.ReadResponses(context.Background(), callbacks)
+				if err != nil {
+					fmt.Fprintf(&out, "-- end: %v\n", err)
+					break
+				}
+				fmt.Fprintf(&out, "-- turn %d complete\n", turn)
+			}
+			fmt.Fprintf(&out, "session=%s commands=%v\n", proc.SessionID(), proc.SlashCommands())
+
+			checkGolden(t, strings.TrimSuffix(path, ".jsonl")+".callbacks.golden", out.Bytes())
+		})
+	}
+}
+
+func TestContentsUnmarshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"string", `"plain text"`, "plain text"},
+		{"blocks", `[{"type":"text","text":"a"},{"type":"image"},{"type":"text","text":"b"}]`, "a\nb"},
+		{"empty", `[]`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Contents
+			if err := json.Unmarshal([]byte(tt.input), &c); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got := c.Text(); got != tt.want {
+				t.Errorf("Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
+
+	"github.com/codegangsta/aria/internal/types"
 )
 
-// MCPConfig holds MCP-related configuration for permission prompts
+// MCPConfig holds MCP-related configuration for the aria tools and permission prompts
 type MCPConfig struct {
 	ConfigPath  string                             // Path to MCP config file (or empty if using ConfigFunc)
 	ToolName    string                             // Name of the permission prompt tool
@@ -19,11 +22,22 @@ type ProcessManager struct {
 	claudePath      string
 	debug           bool
 	skipPermissions bool
-	mcpConfig       *MCPConfig // MCP config for permission prompts (nil if skip_permissions)
+	mcpConfig       *MCPConfig // MCP config for the aria tools and permission prompts
 	processes       map[int64]*ClaudeProcess
 	mu              sync.RWMutex
 	logger          *slog.Logger
 	persistence     *SessionPersistence
+	queues          map[int64]*turnQueue // Per-chat turn queues (guarded by queueMu)
+	queueMu         sync.Mutex
+	usage           *UsageStore   // Token usage and cost accounting (nil if disabled)
+	budget          *Budget       // Daily spending limits (nil if unlimited)
+	idleTimeout     time.Duration // Close processes idle longer than this (0 = never)
+	maxProcesses    int           // Cap on live processes, least recently used evicted first (0 = no cap)
+	streamPartial   bool          // Stream partial assistant text (--include-partial-messages)
+	defaultModel    string        // Model for chats without a /model choice ("" = CLI default)
+	fallbackModel   string        // Passed as --fallback-model to every process
+	chatOptions     func(chatID int64) ChatOptions // Extra CLI flags per chat (nil = none)
+	waiting         func(chatID int64) bool        // Chats waiting on the user, never reaped (nil = none)
 }
 
 // NewManager creates a new ProcessManager
@@ -34,15 +48,53 @@ func NewManager(claudePath string, debug bool, skipPermissions bool, logger *slo
 		skipPermissions: skipPermissions,
 		processes:       make(map[int64]*ClaudeProcess),
 		logger:          logger,
+		queues:          make(map[int64]*turnQueue),
 	}
 }
 
-// SetMCPConfig sets the MCP configuration for permission prompts
-// Only used when skipPermissions is false
+// SetMCPConfig sets the MCP configuration for the aria tools and permission prompts
+// The permission prompt tool is only used when skipPermissions is false
 func (m *ProcessManager) SetMCPConfig(cfg *MCPConfig) {
 	m.mcpConfig = cfg
 }
 
+// SetUsageStore sets the store that accumulates token usage and cost per chat and session
+func (m *ProcessManager) SetUsageStore(s *UsageStore) {
+	m.usage = s
+}
+
+// SetIdlePolicy configures when idle processes are closed
+// idleTimeout of 0 disables the TTL, maxProcesses of 0 disables the cap
+// Closed chats resume their persisted session on the next message
+func (m *ProcessManager) SetIdlePolicy(idleTimeout time.Duration, maxProcesses int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idleTimeout = idleTimeout
+	m.maxProcesses = maxProcesses
+}
+
+// SetStreamPartial enables streaming of partial assistant text for new processes
+func (m *ProcessManager) SetStreamPartial(enabled bool) {
+	m.streamPartial = enabled
+}
+
+// SetModels sets the default model and fallback model for new processes
+func (m *ProcessManager) SetModels(defaultModel, fallbackModel string) {
+	m.defaultModel = defaultModel
+	m.fallbackModel = fallbackModel
+}
+
+// SetChatOptions sets the function that resolves extra CLI flags for a chat
+func (m *ProcessManager) SetChatOptions(fn func(chatID int64) ChatOptions) {
+	m.chatOptions = fn
+}
+
+// SetWaiting sets the function that reports whether a chat is waiting on the
+// user (a question or permission prompt), so its process isn't reaped
+func (m *ProcessManager) SetWaiting(fn func(chatID int64) bool) {
+	m.waiting = fn
+}
+
 // SetPersistence sets the session persistence handler
 func (m *ProcessManager) SetPersistence(p *SessionPersistence) {
 	m.persistence = p
@@ -61,6 +113,8 @@ func (m *ProcessManager) GetOrCreate(chatID int64) (*ClaudeProcess, error) {
 	}
 
 	// Need to create a new process
+	var evicted []*ClaudeProcess
+	defer func() { closeProcesses(evicted) }() // Runs after the unlock
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -75,6 +129,9 @@ func (m *ProcessManager) GetOrCreate(chatID int64) (*ClaudeProcess, error) {
 		delete(m.processes, chatID)
 	}
 
+	// Make room if we're at the process cap
+	evicted = m.evictLRULocked()
+
 	// Check for persisted session ID and cwd to resume
 	var resumeSessionID string
 	var cwd string
@@ -95,8 +152,14 @@ func (m *ProcessManager) GetOrCreate(chatID int64) (*ClaudeProcess, error) {
 		SkipPermissions: m.skipPermissions,
 		ResumeSessionID: resumeSessionID,
 		Cwd:             cwd,
+		StreamPartial:   m.streamPartial,
+		Model:           m.Model(chatID),
+		FallbackModel:   m.fallbackModel,
 		Logger:          m.logger,
 	}
+	if m.chatOptions != nil {
+		opts.ChatOptions = m.chatOptions(chatID)
+	}
 	if m.mcpConfig != nil {
 		// Get per-chat config if function provided, otherwise use static path
 		if m.mcpConfig.ConfigFunc != nil {
@@ -128,6 +191,8 @@ func (m *ProcessManager) GetOrCreateWithSession(chatID int64, sessionID string)
 		return m.GetOrCreate(chatID)
 	}
 
+	var evicted []*ClaudeProcess
+	defer func() { closeProcesses(evicted) }() // Runs after the unlock
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -138,6 +203,9 @@ func (m *ProcessManager) GetOrCreateWithSession(chatID int64, sessionID string)
 		delete(m.processes, chatID)
 	}
 
+	// Make room if we're at the process cap
+	evicted = m.evictLRULocked()
+
 	// Get cwd from persistence (preserve across session switches)
 	var cwd string
 	if m.persistence != nil {
@@ -153,8 +221,14 @@ func (m *ProcessManager) GetOrCreateWithSession(chatID int64, sessionID string)
 		SkipPermissions: m.skipPermissions,
 		ResumeSessionID: sessionID,
 		Cwd:             cwd,
+		StreamPartial:   m.streamPartial,
+		Model:           m.Model(chatID),
+		FallbackModel:   m.fallbackModel,
 		Logger:          m.logger,
 	}
+	if m.chatOptions != nil {
+		opts.ChatOptions = m.chatOptions(chatID)
+	}
 	if m.mcpConfig != nil {
 		// Get per-chat config if function provided, otherwise use static path
 		if m.mcpConfig.ConfigFunc != nil {
@@ -185,20 +259,41 @@ func (m *ProcessManager) GetOrCreateWithSession(chatID int64, sessionID string)
 
 // Send sends a message to the Claude process for a chat and reads the responses
 // The callbacks struct contains handlers for text messages and tool use events
+// Messages for the same chat are serialized: if a turn is already in flight, the
+// message waits in the chat's queue (OnQueued is called) until it's its turn
+// OnTurnEnd is called once the turn is over, unless it never got one
 // If the process dies mid-conversation, it will automatically retry by resuming the session
-func (m *ProcessManager) Send(ctx context.Context, chatID int64, message string, callbacks ResponseCallbacks) error {
-	return m.sendWithRetry(ctx, chatID, message, callbacks, 1)
+func (m *ProcessManager) Send(ctx context.Context, chatID int64, message string, images []Image, callbacks ResponseCallbacks) error {
+	release, err := m.acquireTurn(ctx, chatID, message, callbacks.OnQueued)
+	if err != nil {
+		return err
+	}
+	// Wrap up the turn before the next queued message can start its own
+	defer func() {
+		if callbacks.OnTurnEnd != nil {
+			callbacks.OnTurnEnd()
+		}
+		release()
+	}()
+
+	// Refuse new turns once today's budget is spent
+	if err := m.checkBudget(chatID); err != nil {
+		m.logger.Warn("refusing message over budget", "chat_id", chatID, "error", err)
+		return err
+	}
+
+	return m.sendWithRetry(ctx, chatID, message, images, callbacks, 1)
 }
 
 // sendWithRetry attempts to send a message, retrying once if the process dies
-func (m *ProcessManager) sendWithRetry(ctx context.Context, chatID int64, message string, callbacks ResponseCallbacks, retriesLeft int) error {
+func (m *ProcessManager) sendWithRetry(ctx context.Context, chatID int64, message string, images []Image, callbacks ResponseCallbacks, retriesLeft int) error {
 	proc, err := m.GetOrCreate(chatID)
 	if err != nil {
 		return err
 	}
 
 	// Send the message
-	if err := proc.Send(message); err != nil {
+	if err := proc.Send(message, images); err != nil {
 		// Process may have died, remove it
 		m.mu.Lock()
 		delete(m.processes, chatID)
@@ -210,13 +305,30 @@ func (m *ProcessManager) sendWithRetry(ctx context.Context, chatID int64, messag
 				"chat_id", chatID,
 				"error", err,
 			)
-			return m.sendWithRetry(ctx, chatID, message, callbacks, retriesLeft-1)
+			return m.sendWithRetry(ctx, chatID, message, images, callbacks, retriesLeft-1)
 		}
 		return fmt.Errorf("sending message: %w", err)
 	}
 
+	// Record usage from the result event before handing it to the caller
+	readCallbacks := callbacks
+	readCallbacks.OnResult = func(usage types.Usage) {
+		if m.usage != nil {
+			m.usage.Record(chatID, proc.SessionID(), usage, time.Now())
+		}
+		if callbacks.OnResult != nil {
+			callbacks.OnResult(usage)
+		}
+		for _, warning := range m.budgetWarnings(chatID) {
+			m.logger.Warn("budget warning", "chat_id", chatID, "warning", warning)
+			if callbacks.OnBudgetWarning != nil {
+				callbacks.OnBudgetWarning(warning)
+			}
+		}
+	}
+
 	// Read responses
-	if err := proc.ReadResponses(ctx, callbacks); err != nil {
+	if err := proc.ReadResponses(ctx, readCallbacks); err != nil {
 		// Process may have died
 		m.mu.Lock()
 		delete(m.processes, chatID)
@@ -236,7 +348,7 @@ func (m *ProcessManager) sendWithRetry(ctx context.Context, chatID int64, messag
 				"chat_id", chatID,
 				"error", err,
 			)
-			return m.sendWithRetry(ctx, chatID, message, callbacks, retriesLeft-1)
+			return m.sendWithRetry(ctx, chatID, message, images, callbacks, retriesLeft-1)
 		}
 		return fmt.Errorf("reading responses: %w", err)
 	}
@@ -251,6 +363,165 @@ func (m *ProcessManager) sendWithRetry(ctx context.Context, chatID int64, messag
 	return nil
 }
 
+// Interrupt stops the in-flight turn for a chat, keeping the process and session
+// Returns false if there is no turn running
+func (m *ProcessManager) Interrupt(chatID int64) (bool, error) {
+	if !m.Busy(chatID) {
+		return false, nil
+	}
+
+	m.mu.RLock()
+	proc, exists := m.processes[chatID]
+	m.mu.RUnlock()
+
+	if !exists || !proc.Alive() {
+		return false, nil
+	}
+
+	if err := proc.Interrupt(); err != nil {
+		return false, fmt.Errorf("interrupting chat %d: %w", chatID, err)
+	}
+	return true, nil
+}
+
+// StartReaper starts a background loop that closes idle processes
+// Does nothing if neither an idle timeout nor a process cap is configured
+func (m *ProcessManager) StartReaper(ctx context.Context) {
+	m.mu.RLock()
+	idleTimeout := m.idleTimeout
+	maxProcesses := m.maxProcesses
+	m.mu.RUnlock()
+
+	if idleTimeout <= 0 && maxProcesses <= 0 {
+		return
+	}
+
+	// Check often enough that processes don't outlive the TTL by much
+	interval := time.Minute
+	if idleTimeout > 0 && idleTimeout/2 < interval {
+		interval = max(idleTimeout/2, time.Second)
+	}
+
+	m.logger.Info("process reaper started",
+		"idle_timeout", idleTimeout,
+		"max_processes", maxProcesses,
+		"interval", interval,
+	)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.reapIdle()
+			}
+		}
+	}()
+}
+
+// reapIdle closes dead processes and processes idle past the TTL, then enforces the cap
+func (m *ProcessManager) reapIdle() {
+	var closing []*ClaudeProcess
+
+	m.mu.Lock()
+	now := time.Now()
+	for chatID, proc := range m.processes {
+		// Never reap a process in the middle of a turn or waiting on the user
+		if !m.reapable(chatID) {
+			continue
+		}
+
+		if !proc.Alive() {
+			delete(m.processes, chatID)
+			continue
+		}
+
+		idle := now.Sub(proc.LastActive())
+		if m.idleTimeout > 0 && idle > m.idleTimeout {
+			m.logger.Info("closing idle claude process", "chat_id", chatID, "idle", idle.Round(time.Second))
+			closing = append(closing, proc)
+			delete(m.processes, chatID)
+		}
+	}
+
+	for m.maxProcesses > 0 && len(m.processes) > m.maxProcesses {
+		proc := m.evictOneLocked()
+		if proc == nil {
+			break
+		}
+		closing = append(closing, proc)
+	}
+	m.mu.Unlock()
+
+	closeProcesses(closing)
+}
+
+// reapable reports whether a chat's process may be closed to save resources
+// Busy takes queueMu, so this may be called with m.mu held
+func (m *ProcessManager) reapable(chatID int64) bool {
+	if m.Busy(chatID) {
+		return false
+	}
+	return m.waiting == nil || !m.waiting(chatID)
+}
+
+// evictLRULocked removes idle processes until there's room for one more (must hold write lock)
+// Returns the removed processes for the caller to close once the lock is released
+func (m *ProcessManager) evictLRULocked() []*ClaudeProcess {
+	var evicted []*ClaudeProcess
+	for m.maxProcesses > 0 && len(m.processes) >= m.maxProcesses {
+		proc := m.evictOneLocked()
+		if proc == nil {
+			m.logger.Warn("process cap reached but all processes are busy",
+				"max_processes", m.maxProcesses,
+			)
+			break
+		}
+		evicted = append(evicted, proc)
+	}
+	return evicted
+}
+
+// evictOneLocked removes the least recently used idle process (must hold write lock)
+// Returns nil if every process is busy
+func (m *ProcessManager) evictOneLocked() *ClaudeProcess {
+	var oldestChat int64
+	var oldest *ClaudeProcess
+	for chatID, proc := range m.processes {
+		if !m.reapable(chatID) {
+			continue
+		}
+		if oldest == nil || proc.LastActive().Before(oldest.LastActive()) {
+			oldestChat = chatID
+			oldest = proc
+		}
+	}
+
+	if oldest == nil {
+		return nil
+	}
+
+	m.logger.Info("evicting least recently used claude process",
+		"chat_id", oldestChat,
+		"max_processes", m.maxProcesses,
+	)
+	delete(m.processes, oldestChat)
+	return oldest
+}
+
+// closeProcesses closes processes already removed from the pool
+// Close can wait several seconds for a process to exit, so it's called
+// without m.mu held to keep other chats from waiting on it
+func closeProcesses(procs []*ClaudeProcess) {
+	for _, proc := range procs {
+		proc.Close()
+	}
+}
+
 // Shutdown gracefully closes all Claude processes
 func (m *ProcessManager) Shutdown() {
 	m.mu.Lock()
@@ -288,7 +559,8 @@ func (m *ProcessManager) GetSlashCommands() []string {
 }
 
 // Reset kills the Claude process for a chat, forcing a fresh one on next message
-// Also clears any persisted session so the next message starts fresh
+// Also clears any persisted session so the next message starts fresh, on the
+// same model
 func (m *ProcessManager) Reset(chatID int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -324,6 +596,50 @@ func (m *ProcessManager) SetCwd(chatID int64, cwd string) {
 	}
 }
 
+// SetModel changes the model for a chat ("" reverts to the default model)
+// This kills the current process but preserves the session for resume
+// Returns ErrBusy rather than kill a running turn
+func (m *ProcessManager) SetModel(chatID int64, model string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A turn takes the chat before it gets its process, so one that starts
+	// after this check runs on the new model
+	if m.Busy(chatID) {
+		return ErrBusy
+	}
+
+	// Kill existing process
+	if proc, exists := m.processes[chatID]; exists {
+		m.logger.Info("killing process for model change", "chat_id", chatID, "model", model)
+		proc.Close()
+		delete(m.processes, chatID)
+	}
+
+	if m.persistence != nil {
+		m.persistence.SetModel(chatID, model)
+	}
+	return nil
+}
+
+// Model returns the model used for a chat: its /model choice or the default
+func (m *ProcessManager) Model(chatID int64) string {
+	if m.persistence != nil {
+		if model := m.persistence.GetModel(chatID); model != "" {
+			return model
+		}
+	}
+	return m.defaultModel
+}
+
+// SessionID returns the persisted session ID for a chat, or empty string if none
+func (m *ProcessManager) SessionID(chatID int64) string {
+	if m.persistence != nil {
+		return m.persistence.Get(chatID)
+	}
+	return ""
+}
+
 // GetCwd returns the current working directory for a chat
 func (m *ProcessManager) GetCwd(chatID int64) string {
 	if m.persistence != nil {
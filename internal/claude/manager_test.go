@@ -0,0 +1,194 @@
+package claude
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeStdin stands in for a process's stdin: closing it makes the process
+// exit, once release is closed if it's set
+type fakeStdin struct {
+	done    chan struct{}
+	closing chan struct{} // Closed when Close is called
+	release chan struct{}
+}
+
+func (f *fakeStdin) Write(b []byte) (int, error) { return len(b), nil }
+
+func (f *fakeStdin) Close() error {
+	close(f.closing)
+	if f.release != nil {
+		<-f.release
+	}
+	close(f.done)
+	return nil
+}
+
+// addProcess puts a live fake process in the pool, last active at lastActive
+func addProcess(m *ProcessManager, chatID int64, lastActive time.Time) (*ClaudeProcess, *fakeStdin) {
+	stdin := &fakeStdin{done: make(chan struct{}), closing: make(chan struct{})}
+	proc := &ClaudeProcess{
+		cmd:        &exec.Cmd{Process: &os.Process{Pid: -1}},
+		stdin:      stdin,
+		done:       stdin.done,
+		chatID:     chatID,
+		lastActive: lastActive,
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	m.processes[chatID] = proc
+	return proc, stdin
+}
+
+// pooled reports whether a chat has a process in the pool
+func pooled(m *ProcessManager, chatID int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.processes[chatID]
+	return ok
+}
+
+func TestReapIdle(t *testing.T) {
+	m := newQueueManager()
+	m.SetIdlePolicy(time.Minute, 0)
+	m.SetWaiting(func(chatID int64) bool { return chatID == 4 })
+	stale := time.Now().Add(-2 * time.Minute)
+
+	idle, _ := addProcess(m, 1, stale)
+	fresh, _ := addProcess(m, 2, time.Now())
+	busy, _ := addProcess(m, queueChat, stale)
+	waiting, _ := addProcess(m, 4, stale)
+	dead, deadStdin := addProcess(m, 5, time.Now())
+	close(deadStdin.done)
+
+	release, err := m.acquireTurn(context.Background(), queueChat, "running", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	m.reapIdle()
+
+	for _, tt := range []struct {
+		name   string
+		chatID int64
+		proc   *ClaudeProcess
+		kept   bool
+	}{
+		{"idle past the TTL", 1, idle, false},
+		{"recently active", 2, fresh, true},
+		{"mid-turn", queueChat, busy, true},
+		{"waiting on the user", 4, waiting, true},
+		{"dead", 5, dead, false},
+	} {
+		if got := pooled(m, tt.chatID); got != tt.kept {
+			t.Errorf("%s: in the pool = %v, want %v", tt.name, got, tt.kept)
+		}
+		if tt.kept && !tt.proc.Alive() {
+			t.Errorf("%s: process was closed", tt.name)
+		}
+	}
+	if idle.Alive() {
+		t.Error("idle process is still running")
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	m := newQueueManager()
+	m.SetIdlePolicy(0, 2)
+	m.SetWaiting(func(chatID int64) bool { return chatID == 2 })
+	now := time.Now()
+
+	// The reaper brings the pool back under the cap, least recent first, but
+	// never evicts a chat that's waiting on the user
+	oldest, _ := addProcess(m, 1, now.Add(-3*time.Minute))
+	addProcess(m, 2, now.Add(-2*time.Minute))
+	addProcess(m, 3, now.Add(-time.Minute))
+	addProcess(m, 4, now)
+	m.reapIdle()
+	if pooled(m, 1) || pooled(m, 3) || !pooled(m, 2) || !pooled(m, 4) {
+		t.Errorf("pool after reaping = %v, want chats 2 and 4", m.processes)
+	}
+	if oldest.Alive() {
+		t.Error("evicted process is still running")
+	}
+
+	// Making room for a new process skips busy chats
+	release, err := m.acquireTurn(context.Background(), 4, "running", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	m.mu.Lock()
+	evicted := m.evictLRULocked()
+	m.mu.Unlock()
+	if len(evicted) != 0 {
+		t.Errorf("evicted %d processes with every chat busy or waiting, want 0", len(evicted))
+	}
+	if m.ProcessCount() != 2 {
+		t.Errorf("%d processes after a failed eviction, want 2", m.ProcessCount())
+	}
+}
+
+func TestReapClosesOutsideLock(t *testing.T) {
+	m := newQueueManager()
+	m.SetIdlePolicy(time.Minute, 0)
+	_, stdin := addProcess(m, 1, time.Now().Add(-2*time.Minute))
+	stdin.release = make(chan struct{})
+
+	reaped := make(chan struct{})
+	go func() {
+		m.reapIdle()
+		close(reaped)
+	}()
+	<-stdin.closing
+
+	// Other chats can use the pool while the process takes its time to exit
+	counted := make(chan int, 1)
+	go func() { counted <- m.ProcessCount() }()
+	select {
+	case n := <-counted:
+		if n != 0 {
+			t.Errorf("ProcessCount() = %d while closing, want 0", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("the pool stayed locked while a process was closing")
+	}
+
+	close(stdin.release)
+	<-reaped
+}
+
+func TestResetKeepsModel(t *testing.T) {
+	persistence := NewSessionPersistence(filepath.Join(t.TempDir(), "sessions.yaml"))
+	t.Cleanup(persistence.Flush)
+	m := newQueueManager()
+	m.SetPersistence(persistence)
+
+	persistence.Set(1, "session-1")
+	persistence.SetCwd(1, "/work")
+	if err := m.SetModel(1, "opus"); err != nil {
+		t.Fatal(err)
+	}
+	persistence.Set(2, "session-2")
+
+	m.Reset(1)
+	m.Reset(2)
+	if got := m.SessionID(1); got != "" {
+		t.Errorf("session after /clear = %q, want none", got)
+	}
+	if got := m.GetCwd(1); got != "" {
+		t.Errorf("cwd after /clear = %q, want none", got)
+	}
+	if got := m.Model(1); got != "opus" {
+		t.Errorf("model after /clear = %q, want opus", got)
+	}
+	if sessions := persistence.GetAll(); len(sessions) != 0 {
+		t.Errorf("GetAll() = %v, want no sessions left to resume", sessions)
+	}
+}
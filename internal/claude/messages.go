@@ -0,0 +1,170 @@
+package claude
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxIndexEntries caps how many session changes are remembered per chat
+const maxIndexEntries = 200
+
+// MessageEntry records that a chat's messages belong to a session from MessageID on
+type MessageEntry struct {
+	ChatID    int64  `yaml:"chat_id"`
+	MessageID int64  `yaml:"message_id"`
+	SessionID string `yaml:"session_id"`
+}
+
+// PersistedMessages holds all persisted message index entries
+type PersistedMessages struct {
+	Entries []MessageEntry `yaml:"entries"`
+}
+
+// MessageIndex maps message IDs to the session that was active in the chat
+// Only session changes are stored: a message belongs to the session of the
+// latest entry at or before its ID, which covers Claude's replies sent after
+// the user's message without tracking every message ID
+type MessageIndex struct {
+	path     string
+	chats    map[int64][]MessageEntry // Sorted by MessageID
+	volatile func(chatID int64) bool  // Chats whose message IDs don't outlive the process (nil = none)
+	mu       sync.RWMutex
+	saveMu   sync.Mutex // Serializes background saves
+}
+
+// NewMessageIndex creates a new message index
+// path should be ~/.config/aria/messages.yaml
+func NewMessageIndex(path string) *MessageIndex {
+	return &MessageIndex{
+		path:  path,
+		chats: make(map[int64][]MessageEntry),
+	}
+}
+
+// SetVolatile marks chats whose frontend numbers messages from 1 on every start
+// Their entries are only kept in memory, since after a restart the same IDs
+// refer to different messages
+func (x *MessageIndex) SetVolatile(fn func(chatID int64) bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.volatile = fn
+}
+
+// persisted reports whether a chat's entries are saved to disk
+// Callers must hold x.mu
+func (x *MessageIndex) persisted(chatID int64) bool {
+	return x.volatile == nil || !x.volatile(chatID)
+}
+
+// Load reads the index from disk
+func (x *MessageIndex) Load() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	data, err := os.ReadFile(x.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading message index: %w", err)
+	}
+
+	var persisted PersistedMessages
+	if err := yaml.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("parsing message index: %w", err)
+	}
+
+	x.chats = make(map[int64][]MessageEntry)
+	for _, e := range persisted.Entries {
+		if x.persisted(e.ChatID) {
+			x.chats[e.ChatID] = append(x.chats[e.ChatID], e)
+		}
+	}
+	for _, entries := range x.chats {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].MessageID < entries[j].MessageID })
+	}
+	return nil
+}
+
+// Save writes the index to disk
+func (x *MessageIndex) Save() error {
+	x.saveMu.Lock()
+	defer x.saveMu.Unlock()
+
+	x.mu.RLock()
+	var persisted PersistedMessages
+	for chatID, entries := range x.chats {
+		if x.persisted(chatID) {
+			persisted.Entries = append(persisted.Entries, entries...)
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(persisted.Entries, func(i, j int) bool {
+		a, b := persisted.Entries[i], persisted.Entries[j]
+		if a.ChatID != b.ChatID {
+			return a.ChatID < b.ChatID
+		}
+		return a.MessageID < b.MessageID
+	})
+
+	data, err := yaml.Marshal(&persisted)
+	if err != nil {
+		return fmt.Errorf("marshaling message index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return fmt.Errorf("creating message index directory: %w", err)
+	}
+	if err := os.WriteFile(x.path, data, 0644); err != nil {
+		return fmt.Errorf("writing message index: %w", err)
+	}
+	return nil
+}
+
+// Record notes that msgID was handled in sessionID
+// Returns true if this changed the index (and it should be saved)
+func (x *MessageIndex) Record(chatID, msgID int64, sessionID string) bool {
+	if msgID == 0 || sessionID == "" {
+		return false
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entries := x.chats[chatID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].MessageID > msgID })
+	if i > 0 && entries[i-1].SessionID == sessionID {
+		return false
+	}
+	if i > 0 && entries[i-1].MessageID == msgID {
+		entries[i-1].SessionID = sessionID
+		return true
+	}
+
+	entries = append(entries, MessageEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = MessageEntry{ChatID: chatID, MessageID: msgID, SessionID: sessionID}
+	if len(entries) > maxIndexEntries {
+		entries = entries[len(entries)-maxIndexEntries:]
+	}
+	x.chats[chatID] = entries
+	return true
+}
+
+// Lookup returns the session msgID belongs to, or empty if it predates the index
+func (x *MessageIndex) Lookup(chatID, msgID int64) string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	entries := x.chats[chatID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].MessageID > msgID })
+	if i == 0 {
+		return ""
+	}
+	return entries[i-1].SessionID
+}
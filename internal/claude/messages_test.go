@@ -0,0 +1,50 @@
+package claude
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageIndexVolatile(t *testing.T) {
+	const stable, volatile = 1, 2
+	path := filepath.Join(t.TempDir(), "messages.yaml")
+
+	// An index saved before volatile chats were left out
+	old := NewMessageIndex(path)
+	old.Record(stable, 10, "session-a")
+	old.Record(volatile, 3, "session-b")
+	if err := old.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	x := NewMessageIndex(path)
+	x.SetVolatile(func(chatID int64) bool { return chatID == volatile })
+	if err := x.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := x.Lookup(stable, 11); got != "session-a" {
+		t.Errorf("stable chat after restart = %q, want session-a", got)
+	}
+	if got := x.Lookup(volatile, 3); got != "" {
+		t.Errorf("volatile chat after restart = %q, want no session", got)
+	}
+
+	// Volatile chats are still indexed while running, but never saved
+	x.Record(volatile, 1, "session-c")
+	if got := x.Lookup(volatile, 2); got != "session-c" {
+		t.Errorf("volatile chat = %q, want session-c", got)
+	}
+	if err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewMessageIndex(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Lookup(volatile, 2); got != "" {
+		t.Errorf("saved volatile chat = %q, want no session", got)
+	}
+	if got := reloaded.Lookup(stable, 10); got != "session-a" {
+		t.Errorf("saved stable chat = %q, want session-a", got)
+	}
+}
@@ -15,6 +15,7 @@ type SessionMapping struct {
 	ChatID     int64     `yaml:"chat_id"`
 	SessionID  string    `yaml:"session_id"`
 	Cwd        string    `yaml:"cwd,omitempty"`
+	Model      string    `yaml:"model,omitempty"` // Chosen via /model ("" = default model)
 	LastActive time.Time `yaml:"last_active"`
 }
 
@@ -28,6 +29,7 @@ type SessionPersistence struct {
 	path     string
 	sessions map[int64]SessionMapping // chat_id -> mapping
 	mu       sync.RWMutex
+	saving   sync.WaitGroup // Background saves in flight
 }
 
 // NewSessionPersistence creates a new persistence handler
@@ -98,6 +100,20 @@ func (p *SessionPersistence) Save() error {
 	return nil
 }
 
+// saveAsync saves in the background
+func (p *SessionPersistence) saveAsync() {
+	p.saving.Add(1)
+	go func() {
+		defer p.saving.Done()
+		p.Save()
+	}()
+}
+
+// Flush waits for background saves to finish
+func (p *SessionPersistence) Flush() {
+	p.saving.Wait()
+}
+
 // Set stores a session mapping for a chat (preserves existing cwd)
 func (p *SessionPersistence) Set(chatID int64, sessionID string) {
 	p.mu.Lock()
@@ -106,12 +122,13 @@ func (p *SessionPersistence) Set(chatID int64, sessionID string) {
 		ChatID:     chatID,
 		SessionID:  sessionID,
 		Cwd:        existing.Cwd, // Preserve existing cwd
+		Model:      existing.Model,
 		LastActive: time.Now(),
 	}
 	p.mu.Unlock()
 
 	// Save in background (don't block)
-	go p.Save()
+	p.saveAsync()
 }
 
 // SetCwd stores the working directory for a chat (preserves existing session)
@@ -122,11 +139,36 @@ func (p *SessionPersistence) SetCwd(chatID int64, cwd string) {
 		ChatID:     chatID,
 		SessionID:  existing.SessionID, // Preserve existing session
 		Cwd:        cwd,
+		Model:      existing.Model,
 		LastActive: time.Now(),
 	}
 	p.mu.Unlock()
 
-	go p.Save()
+	p.saveAsync()
+}
+
+// SetModel stores the model for a chat (preserves existing session and cwd)
+func (p *SessionPersistence) SetModel(chatID int64, model string) {
+	p.mu.Lock()
+	existing := p.sessions[chatID]
+	existing.ChatID = chatID
+	existing.Model = model
+	existing.LastActive = time.Now()
+	p.sessions[chatID] = existing
+	p.mu.Unlock()
+
+	p.saveAsync()
+}
+
+// GetModel returns the model chosen for a chat, or empty string if none
+func (p *SessionPersistence) GetModel(chatID int64) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if mapping, ok := p.sessions[chatID]; ok {
+		return mapping.Model
+	}
+	return ""
 }
 
 // GetCwd returns the working directory for a chat, or empty string if none
@@ -151,13 +193,17 @@ func (p *SessionPersistence) Get(chatID int64) string {
 	return ""
 }
 
-// Delete removes the session mapping for a chat
+// Delete forgets the session and cwd for a chat, keeping its /model choice
 func (p *SessionPersistence) Delete(chatID int64) {
 	p.mu.Lock()
-	delete(p.sessions, chatID)
+	if model := p.sessions[chatID].Model; model != "" {
+		p.sessions[chatID] = SessionMapping{ChatID: chatID, Model: model, LastActive: time.Now()}
+	} else {
+		delete(p.sessions, chatID)
+	}
 	p.mu.Unlock()
 
-	go p.Save()
+	p.saveAsync()
 }
 
 // SetCwdPreserveSession sets the cwd while preserving the existing session
@@ -168,21 +214,24 @@ func (p *SessionPersistence) SetCwdPreserveSession(chatID int64, cwd string) {
 		ChatID:     chatID,
 		SessionID:  existing.SessionID, // Preserve session for resume
 		Cwd:        cwd,
+		Model:      existing.Model,
 		LastActive: time.Now(),
 	}
 	p.mu.Unlock()
 
-	go p.Save()
+	p.saveAsync()
 }
 
-// GetAll returns all session mappings (for debugging)
+// GetAll returns the session ID of every chat that has one
 func (p *SessionPersistence) GetAll() map[int64]string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
 	result := make(map[int64]string)
 	for chatID, mapping := range p.sessions {
-		result[chatID] = mapping.SessionID
+		if mapping.SessionID != "" {
+			result[chatID] = mapping.SessionID
+		}
 	}
 	return result
 }
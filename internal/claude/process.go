@@ -2,14 +2,18 @@ package claude
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/codegangsta/aria/internal/types"
 )
@@ -21,9 +25,23 @@ type UserMessage struct {
 }
 
 // UserContent represents the content of a user message
+// Content is the prompt string, or content blocks when images are attached
 type UserContent struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// ImageSource holds a base64-encoded image
+type ImageSource struct {
+	Type      string `json:"type"` // always "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// Image is an image sent to Claude with a message
+type Image struct {
+	MediaType string // e.g. "image/png"
+	Data      []byte
 }
 
 // ClaudeProcess represents a persistent Claude CLI process
@@ -39,28 +57,58 @@ type ClaudeProcess struct {
 	slashCommands    []string      // Commands discovered from init event
 	sessionID        string        // Session ID from init event
 	done             chan struct{} // Closed when process exits
+	waitErr          error         // Exit error from cmd.Wait, valid once done is closed
 	sessionNotFound  bool          // True if resume failed due to missing session
 	closing          bool          // True when Close() has been called
+	requestSeq       int           // Counter for control request IDs
+	lastActive       time.Time     // Last time a message was sent or a response finished
+	messagePrefix    string        // Prepended to non-command messages ("" = none)
+	reportedCostUSD  float64       // total_cost_usd of the last result, a running total for the process
 }
 
-// InitEvent represents the system init event from Claude
-type InitEvent struct {
-	Type          string   `json:"type"`
-	Subtype       string   `json:"subtype"`
-	SessionID     string   `json:"session_id"`
-	SlashCommands []string `json:"slash_commands"`
+// ChatOptions holds per-chat process settings: extra claude CLI flags and the message prefix
+type ChatOptions struct {
+	AllowedTools       []string // --allowedTools, e.g. "Bash(git status:*)", "Read"
+	DisallowedTools    []string // --disallowedTools
+	AppendSystemPrompt string   // --append-system-prompt
+	AddDirs            []string // --add-dir, extra directories the tools may access
+	ExtraArgs          []string // Passed to claude verbatim, after all other flags
+	MessagePrefix      string   // Prepended to non-command messages, e.g. "/aria" ("" = none)
+}
+
+// args returns the CLI flags for these options
+func (o ChatOptions) args() []string {
+	var args []string
+	if len(o.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(o.AllowedTools, ","))
+	}
+	if len(o.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(o.DisallowedTools, ","))
+	}
+	if o.AppendSystemPrompt != "" {
+		args = append(args, "--append-system-prompt", o.AppendSystemPrompt)
+	}
+	for _, dir := range o.AddDirs {
+		args = append(args, "--add-dir", dir)
+	}
+	return append(args, o.ExtraArgs...)
 }
 
 // ProcessOptions contains options for creating a Claude process
 type ProcessOptions struct {
+	ChatOptions
+
 	ClaudePath         string
 	ChatID             int64
 	Debug              bool
 	SkipPermissions    bool
 	ResumeSessionID    string
 	Cwd                string
-	MCPConfigPath      string // Path to MCP config file for permission prompts
+	MCPConfigPath      string // Path to MCP config file for the aria tools and permission prompts
 	PermissionToolName string // Name of the permission prompt tool (e.g., "mcp__aria__prompt_permission")
+	StreamPartial      bool   // Pass --include-partial-messages to stream text as it's generated
+	Model              string // Model alias or name for --model ("" = CLI default)
+	FallbackModel      string // Model for --fallback-model when the main model is overloaded
 	Logger             *slog.Logger
 }
 
@@ -76,6 +124,7 @@ func NewProcess(claudePath string, chatID int64, debug bool, skipPermissions boo
 		ResumeSessionID: resumeSessionID,
 		Cwd:             cwd,
 		Logger:          logger,
+		ChatOptions:     ChatOptions{MessagePrefix: "/aria"},
 	})
 }
 
@@ -88,11 +137,15 @@ func NewProcessWithOptions(opts ProcessOptions) (*ClaudeProcess, error) {
 		"--output-format", "stream-json",
 	}
 
+	// The aria MCP server provides send_file, and permission prompts unless skipped
+	if opts.MCPConfigPath != "" {
+		args = append(args, "--mcp-config", opts.MCPConfigPath)
+	}
+
 	if opts.SkipPermissions {
 		args = append(args, "--dangerously-skip-permissions")
 	} else if opts.MCPConfigPath != "" && opts.PermissionToolName != "" {
 		// Use MCP-based permission prompts
-		args = append(args, "--mcp-config", opts.MCPConfigPath)
 		args = append(args, "--permission-prompt-tool", opts.PermissionToolName)
 	}
 
@@ -100,6 +153,20 @@ func NewProcessWithOptions(opts ProcessOptions) (*ClaudeProcess, error) {
 		args = append(args, "--resume", opts.ResumeSessionID)
 	}
 
+	if opts.Model != "" {
+		args = append(args, "--model", opts.Model)
+	}
+
+	if opts.FallbackModel != "" && opts.FallbackModel != opts.Model {
+		args = append(args, "--fallback-model", opts.FallbackModel)
+	}
+
+	if opts.StreamPartial {
+		args = append(args, "--include-partial-messages")
+	}
+
+	args = append(args, opts.ChatOptions.args()...)
+
 	cmd := exec.Command(opts.ClaudePath, args...)
 
 	// Set working directory if specified
@@ -118,21 +185,6 @@ func NewProcessWithOptions(opts ProcessOptions) (*ClaudeProcess, error) {
 		return nil, fmt.Errorf("creating stdout pipe: %w", err)
 	}
 
-	// Capture stderr to detect session resume failures
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, fmt.Errorf("creating stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return nil, fmt.Errorf("starting claude: %w", err)
-	}
-
 	scanner := bufio.NewScanner(stdout)
 	// Increase buffer size for potentially large JSON responses
 	buf := make([]byte, 0, 64*1024)
@@ -140,38 +192,48 @@ func NewProcessWithOptions(opts ProcessOptions) (*ClaudeProcess, error) {
 
 	done := make(chan struct{})
 	proc := &ClaudeProcess{
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  stdout,
-		scanner: scanner,
-		chatID:  opts.ChatID,
-		debug:   opts.Debug,
-		logger:  opts.Logger,
-		done:    done,
+		cmd:           cmd,
+		stdin:         stdin,
+		stdout:        stdout,
+		scanner:       scanner,
+		chatID:        opts.ChatID,
+		debug:         opts.Debug,
+		logger:        opts.Logger,
+		done:          done,
+		lastActive:    time.Now(),
+		messagePrefix: opts.MessagePrefix,
 	}
 
-	// Monitor stderr for session not found warning and process exit
-	go func() {
-		stderrScanner := bufio.NewScanner(stderr)
-		for stderrScanner.Scan() {
-			line := stderrScanner.Text()
-			if strings.Contains(line, "No conversation found with session ID") {
-				proc.mu.Lock()
-				proc.sessionNotFound = true
-				proc.mu.Unlock()
-				opts.Logger.Warn("session not found, will use new session",
-					"chat_id", opts.ChatID,
-					"stderr", line,
-				)
-			} else if line != "" {
-				opts.Logger.Debug("claude stderr", "chat_id", opts.ChatID, "line", line)
-			}
+	// Capture stderr to detect session resume failures
+	// Lines are handled as they're written; Wait returns once stderr is drained
+	// (or WaitDelay passes, if a child process holds it open)
+	stderr := &lineWriter{fn: func(line string) {
+		if strings.Contains(line, "No conversation found with session ID") {
+			proc.mu.Lock()
+			proc.sessionNotFound = true
+			proc.mu.Unlock()
+			opts.Logger.Warn("session not found, will use new session",
+				"chat_id", opts.ChatID,
+				"stderr", line,
+			)
+		} else if line != "" {
+			opts.Logger.Debug("claude stderr", "chat_id", opts.ChatID, "line", line)
 		}
-	}()
+	}}
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("starting claude: %w", err)
+	}
 
 	// Monitor process exit and close done channel
+	// stderr has been handled by then, so sessionNotFound is final once done closes
 	go func() {
-		cmd.Wait()
+		proc.waitErr = cmd.Wait()
+		stderr.Flush()
 		close(done)
 	}()
 
@@ -204,13 +266,17 @@ func IsSilentCommand(message string) (bool, string) {
 }
 
 // Send writes a user message to Claude's stdin in stream-json format
-func (p *ClaudeProcess) Send(message string) error {
+// Images are sent as image blocks ahead of the prompt
+func (p *ClaudeProcess) Send(message string, images []Image) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.lastActive = time.Now()
+
 	// Determine the prompt to send
 	var prompt string
-	if strings.HasPrefix(message, "/") && !strings.HasPrefix(message, "/aria") {
+	prefix := p.messagePrefix
+	if strings.HasPrefix(message, "/") && (prefix == "" || !strings.HasPrefix(message, prefix)) {
 		// Forward slash commands directly to Claude (e.g., /commit, /calendar)
 		// Convert underscores to hyphens (Telegram uses underscores, Claude uses hyphens)
 		prompt = convertTelegramCommand(message)
@@ -219,19 +285,41 @@ func (p *ClaudeProcess) Send(message string) error {
 			"original", message,
 			"chat_id", p.chatID,
 		)
+	} else if prefix != "" {
+		// Prepend the prefix (e.g. /aria skill to load iMessage mode) for regular messages
+		prompt = fmt.Sprintf("%s %s", prefix, message)
+		p.logger.Debug("sending message with prefix",
+			"prefix", prefix,
+			"chat_id", p.chatID,
+		)
 	} else {
-		// Prepend /aria skill to load iMessage mode for regular messages
-		prompt = fmt.Sprintf("/aria %s", message)
-		p.logger.Debug("sending message with /aria prefix",
+		prompt = message
+		p.logger.Debug("sending message",
 			"chat_id", p.chatID,
 		)
 	}
 
+	var content interface{} = prompt
+	if len(images) > 0 {
+		blocks := make([]ContentBlock, 0, len(images)+1)
+		for _, img := range images {
+			blocks = append(blocks, ContentBlock{
+				Type: "image",
+				Source: &ImageSource{
+					Type:      "base64",
+					MediaType: img.MediaType,
+					Data:      base64.StdEncoding.EncodeToString(img.Data),
+				},
+			})
+		}
+		content = append(blocks, ContentBlock{Type: "text", Text: prompt})
+	}
+
 	msg := UserMessage{
 		Type: "user",
 		Message: UserContent{
 			Role:    "user",
-			Content: prompt,
+			Content: content,
 		},
 	}
 
@@ -248,16 +336,51 @@ func (p *ClaudeProcess) Send(message string) error {
 	return nil
 }
 
-// InputRequestEvent represents an input_request event from Claude
-type InputRequestEvent struct {
-	Type   string `json:"type"`
-	ToolID string `json:"tool_use_id"`
+// ControlRequest represents a stream-json control request written to Claude's stdin
+type ControlRequest struct {
+	Type      string             `json:"type"`
+	RequestID string             `json:"request_id"`
+	Request   ControlRequestBody `json:"request"`
 }
 
-// TodoEvent represents a todo update event from Claude
-type TodoEvent struct {
-	Type  string       `json:"type"`
-	Todos []types.Todo `json:"todos"`
+// ControlRequestBody holds the control action (e.g., "interrupt")
+type ControlRequestBody struct {
+	Subtype string `json:"subtype"`
+}
+
+// Interrupt asks Claude to abort the in-flight turn without ending the session
+// Claude finishes the turn with a result event, so ReadResponses drains normally
+// Falls back to SIGINT if the control request can't be written
+func (p *ClaudeProcess) Interrupt() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requestSeq++
+	req := ControlRequest{
+		Type:      "control_request",
+		RequestID: fmt.Sprintf("aria_%d_%d", p.chatID, p.requestSeq),
+		Request: ControlRequestBody{
+			Subtype: "interrupt",
+		},
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshaling control request: %w", err)
+	}
+
+	p.logger.Info("interrupting claude turn", "chat_id", p.chatID, "request_id", req.RequestID)
+	if _, err := p.stdin.Write(append(data, '\n')); err != nil {
+		p.logger.Warn("control request failed, sending SIGINT", "chat_id", p.chatID, "error", err)
+		if p.cmd == nil || p.cmd.Process == nil {
+			return fmt.Errorf("writing control request: %w", err)
+		}
+		if sigErr := p.cmd.Process.Signal(os.Interrupt); sigErr != nil {
+			return fmt.Errorf("sending interrupt: %w", sigErr)
+		}
+	}
+
+	return nil
 }
 
 // ResponseCallbacks holds callbacks for different response types
@@ -269,54 +392,49 @@ type ResponseCallbacks struct {
 	OnTodoUpdate       func(todos []types.Todo)      // Called when Claude updates todos via TodoWrite
 	OnToolError        func(toolName string, errorMsg string) // Called when a tool returns an error
 	OnPermissionDenial func(denials []string)        // Called when permissions are denied
+	OnQueued           func(ahead int)               // Called when the message has to wait behind other turns
+	OnResult           func(usage types.Usage)       // Called with the turn's usage and cost, before the final message
+	OnBudgetWarning    func(warning string)          // Called when spending crosses the budget warning threshold
+	OnPartialText      func(text string)             // Called with the text streamed so far for the current block
+	OnTurnEnd          func()                        // Called once the turn is over, before the next queued message starts
 }
 
-// ToolResultEvent represents an event containing tool result information
-type ToolResultEvent struct {
-	Type      string `json:"type"`
-	Subtype   string `json:"subtype,omitempty"`
-	ToolUseID string `json:"tool_use_id,omitempty"`
-	IsError   bool   `json:"is_error,omitempty"`
-}
-
-// UserEvent represents a user event that may contain tool results
-type UserEvent struct {
-	Type          string       `json:"type"`
-	Message       UserEventMsg `json:"message,omitempty"`
-	ToolUseResult string       `json:"tool_use_result,omitempty"` // Error message if tool failed
-}
+// turnCost returns the cost of the turn that reported total_cost_usd total
+// The CLI's total covers every turn since the process started, so each turn
+// costs the difference from the previous result
+func (p *ClaudeProcess) turnCost(total float64) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-// UserEventMsg represents the message content in a user event
-type UserEventMsg struct {
-	Role    string            `json:"role"`
-	Content []UserEventContent `json:"content,omitempty"`
+	cost := total - p.reportedCostUSD
+	if cost < 0 {
+		// The count started over
+		cost = total
+	}
+	p.reportedCostUSD = total
+	return cost
 }
 
-// UserEventContent represents content in a user event message
-type UserEventContent struct {
-	Type      string `json:"type"`
-	ToolUseID string `json:"tool_use_id,omitempty"`
-	Content   string `json:"content,omitempty"`
-	IsError   bool   `json:"is_error,omitempty"`
-}
+// closeTimeout is how long Close waits for the process to exit after closing stdin
+const closeTimeout = 5 * time.Second
 
-// ResultEvent represents the final result event from Claude
-type ResultEvent struct {
-	Type              string   `json:"type"`
-	Subtype           string   `json:"subtype,omitempty"`
-	IsError           bool     `json:"is_error,omitempty"`
-	PermissionDenials []string `json:"permission_denials,omitempty"`
-}
+// exitGracePeriod is how long ReadResponses waits for the process to exit once its output ends
+const exitGracePeriod = 2 * time.Second
 
 // ReadResponses reads stream-json responses and calls callbacks for assistant text and tool use
 // This blocks until the current response is complete (receives result event)
 // Also captures slash commands from the init event if not already captured
 // The isFinal parameter indicates whether this is the last message before the result
 func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCallbacks) error {
+	defer p.touch()
+
 	// Buffer to hold the last message so we can mark it as final
 	var lastMessage string
 	var hasMessage bool
 
+	// Text streamed so far for the current content block (partial messages)
+	var partialText string
+
 	// Track pending tool IDs to detect completion
 	pendingTools := make(map[string]bool)
 
@@ -362,11 +480,40 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 
 		line := p.scanner.Text()
 
-		var event Event
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
+		event, err := DecodeEvent([]byte(line))
+		if event.Type == "" {
 			// Skip non-JSON lines
 			continue
 		}
+		if err != nil {
+			// Keep going with whatever decoded - one odd field shouldn't stall the turn
+			p.logger.Warn("partially decoded claude event",
+				"type", event.Type,
+				"chat_id", p.chatID,
+				"error", err,
+			)
+		}
+
+		// Partial message deltas (only emitted with --include-partial-messages)
+		// Handled before the debug log since there's one per token chunk
+		if partial := event.Partial; partial != nil {
+			// Ignore subagent streams - only the main conversation is shown live
+			if callbacks.OnPartialText == nil || partial.ParentToolUseID != nil {
+				continue
+			}
+			switch partial.Event.Type {
+			case "content_block_start":
+				// A new block means the buffered text block wasn't the last one
+				flushBuffer()
+				partialText = ""
+			case "content_block_delta":
+				if partial.Event.Delta.Type == "text_delta" && partial.Event.Delta.Text != "" {
+					partialText += partial.Event.Delta.Text
+					callbacks.OnPartialText(partialText)
+				}
+			}
+			continue
+		}
 
 		// Log all JSON events from Claude for debugging and future feature development
 		p.logger.Debug("claude event",
@@ -375,63 +522,63 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 			"json", line,
 		)
 
-		// Check for tool result events (success or error)
-		var toolResultEvent ToolResultEvent
-		if json.Unmarshal([]byte(line), &toolResultEvent) == nil {
-			if toolResultEvent.ToolUseID != "" {
-				// This event references a tool - check if it indicates error
-				completeTool(toolResultEvent.ToolUseID, toolResultEvent.IsError)
-			}
+		// Events that reference a tool at the top level indicate its completion
+		if event.ToolUseID != "" {
+			completeTool(event.ToolUseID, event.IsError)
 		}
 
-		// Capture slash commands and session ID from init event (only once)
-		if event.Type == "system" && p.slashCommands == nil {
-			var initEvent InitEvent
-			if json.Unmarshal([]byte(line), &initEvent) == nil && initEvent.Subtype == "init" {
-				p.slashCommands = initEvent.SlashCommands
-				p.sessionID = initEvent.SessionID
+		switch {
+		case event.Init != nil:
+			// Capture slash commands and session ID from init event (only once)
+			p.mu.Lock()
+			if p.slashCommands == nil {
+				p.slashCommands = event.Init.SlashCommands
+				p.sessionID = event.Init.SessionID
 				p.logger.Debug("captured init data",
 					"session_id", p.sessionID,
 					"commands_count", len(p.slashCommands),
 				)
 			}
-		}
+			p.mu.Unlock()
 
-		// Check for tool errors in user events (tool_result with is_error: true)
-		if event.Type == "user" {
-			var userEvent UserEvent
-			if json.Unmarshal([]byte(line), &userEvent) == nil {
-				for _, content := range userEvent.Message.Content {
-					if content.Type == "tool_result" && content.IsError {
-						// Mark tool as failed in tracker
-						completeTool(content.ToolUseID, true)
-
-						// Extract error message - prefer content field, fall back to top-level
-						errorMsg := content.Content
-						if errorMsg == "" && userEvent.ToolUseResult != "" {
-							errorMsg = userEvent.ToolUseResult
-						}
-						if errorMsg != "" && callbacks.OnToolError != nil {
-							p.logger.Debug("tool error detected",
-								"tool_id", content.ToolUseID,
-								"error", errorMsg,
-								"chat_id", p.chatID,
-							)
-							callbacks.OnToolError(content.ToolUseID, errorMsg)
-						}
-					}
+		case event.Compact != nil:
+			p.logger.Info("conversation compacted",
+				"chat_id", p.chatID,
+				"trigger", event.Compact.CompactMetadata.Trigger,
+				"pre_tokens", event.Compact.CompactMetadata.PreTokens,
+			)
+
+		case event.User != nil:
+			// Check for tool errors (tool_result with is_error: true)
+			for _, content := range event.User.Message.Content {
+				if content.Type != "tool_result" || !content.IsError {
+					continue
+				}
+				// Mark tool as failed in tracker
+				completeTool(content.ToolUseID, true)
+
+				// Extract error message - prefer content field, fall back to top-level
+				errorMsg := content.Content.Text()
+				if errorMsg == "" {
+					errorMsg = event.User.ToolUseResultText()
+				}
+				if errorMsg != "" && callbacks.OnToolError != nil {
+					p.logger.Debug("tool error detected",
+						"tool_id", content.ToolUseID,
+						"error", errorMsg,
+						"chat_id", p.chatID,
+					)
+					callbacks.OnToolError(content.ToolUseID, errorMsg)
 				}
 			}
-		}
 
-		// Process assistant messages
-		if event.Type == "assistant" {
+		case event.Assistant != nil:
 			// Collect all text and tool_use from this event first
 			// so we can emit them in the correct order (text before tools)
 			var textBlocks []string
 			var toolBlocks []ContentBlock
 
-			for _, content := range event.Message.Content {
+			for _, content := range event.Assistant.Message.Content {
 				if content.Type == "text" && content.Text != "" {
 					textBlocks = append(textBlocks, content.Text)
 				}
@@ -463,26 +610,8 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 
 				// Special handling for TodoWrite - extract and emit todos
 				if content.Name == "TodoWrite" && callbacks.OnTodoUpdate != nil {
-					if todosRaw, ok := content.Input["todos"]; ok {
-						if todosSlice, ok := todosRaw.([]interface{}); ok {
-							todos := make([]types.Todo, 0, len(todosSlice))
-							for _, t := range todosSlice {
-								if todoMap, ok := t.(map[string]interface{}); ok {
-									todo := types.Todo{}
-									if c, ok := todoMap["content"].(string); ok {
-										todo.Content = c
-									}
-									if s, ok := todoMap["status"].(string); ok {
-										todo.Status = s
-									}
-									if a, ok := todoMap["activeForm"].(string); ok {
-										todo.ActiveForm = a
-									}
-									todos = append(todos, todo)
-								}
-							}
-							callbacks.OnTodoUpdate(todos)
-						}
+					if todos, ok := parseTodos(content.Input); ok {
+						callbacks.OnTodoUpdate(todos)
 					}
 				}
 
@@ -500,23 +629,38 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 					"chat_id", p.chatID,
 				)
 			}
-		}
 
-		// Result event indicates end of response
-		if event.Type == "result" {
+		case event.Result != nil:
+			// Result event indicates end of response
+			result := event.Result
+
 			// Complete any remaining pending tools
 			completeAllPending()
 
 			// Check for permission denials
-			var resultEvent ResultEvent
-			if json.Unmarshal([]byte(line), &resultEvent) == nil {
-				if len(resultEvent.PermissionDenials) > 0 && callbacks.OnPermissionDenial != nil {
-					p.logger.Info("permission denials in result",
-						"chat_id", p.chatID,
-						"denials", resultEvent.PermissionDenials,
-					)
-					callbacks.OnPermissionDenial(resultEvent.PermissionDenials)
+			if len(result.PermissionDenials) > 0 && callbacks.OnPermissionDenial != nil {
+				denials := make([]string, 0, len(result.PermissionDenials))
+				for _, d := range result.PermissionDenials {
+					denials = append(denials, d.ToolName)
 				}
+				p.logger.Info("permission denials in result",
+					"chat_id", p.chatID,
+					"denials", denials,
+				)
+				callbacks.OnPermissionDenial(denials)
+			}
+
+			p.logger.Debug("turn usage",
+				"chat_id", p.chatID,
+				"total_cost_usd", result.TotalCostUSD,
+				"input_tokens", result.Usage.InputTokens,
+				"output_tokens", result.Usage.OutputTokens,
+				"num_turns", result.NumTurns,
+			)
+			if callbacks.OnResult != nil {
+				usage := result.ToUsage()
+				usage.CostUSD = p.turnCost(result.TotalCostUSD)
+				callbacks.OnResult(usage)
 			}
 
 			p.logger.Debug("result received, response complete",
@@ -528,33 +672,30 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 				callbacks.OnMessage(lastMessage, true)
 			}
 			return nil
-		}
 
-		// Input request event indicates Claude is waiting for user input (e.g., AskUserQuestion)
-		if event.Type == "input_request" {
-			var inputReq InputRequestEvent
-			if err := json.Unmarshal([]byte(line), &inputReq); err == nil {
-				p.logger.Debug("input_request received, waiting for user input",
-					"chat_id", p.chatID,
-					"tool_id", inputReq.ToolID,
-				)
-				// Complete any pending tools (except the one waiting for input)
-				for toolID := range pendingTools {
-					if toolID != inputReq.ToolID && callbacks.OnToolResult != nil {
-						callbacks.OnToolResult(types.ToolResult{
-							ToolID:  toolID,
-							IsError: false,
-						})
-						delete(pendingTools, toolID)
-					}
-				}
-				// Flush any pending message (not final, since we're waiting for input)
-				flushBuffer()
-				if callbacks.OnInputRequest != nil {
-					callbacks.OnInputRequest(inputReq.ToolID)
+		case event.InputRequest != nil:
+			// Input request event indicates Claude is waiting for user input (e.g., AskUserQuestion)
+			toolID := event.InputRequest.ToolID
+			p.logger.Debug("input_request received, waiting for user input",
+				"chat_id", p.chatID,
+				"tool_id", toolID,
+			)
+			// Complete any pending tools (except the one waiting for input)
+			for pendingID := range pendingTools {
+				if pendingID != toolID && callbacks.OnToolResult != nil {
+					callbacks.OnToolResult(types.ToolResult{
+						ToolID:  pendingID,
+						IsError: false,
+					})
+					delete(pendingTools, pendingID)
 				}
-				return nil
 			}
+			// Flush any pending message (not final, since we're waiting for input)
+			flushBuffer()
+			if callbacks.OnInputRequest != nil {
+				callbacks.OnInputRequest(toolID)
+			}
+			return nil
 		}
 	}
 
@@ -567,6 +708,7 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 	}
 
 	// Scanner finished without result event - process likely died
+	// stdout closes as the process exits, so give the exit a moment to register
 	select {
 	case <-p.done:
 		// Process exited - check if it was intentional
@@ -578,7 +720,7 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 			return fmt.Errorf("session not found, needs fresh start")
 		}
 		return fmt.Errorf("claude process exited unexpectedly")
-	default:
+	case <-time.After(exitGracePeriod):
 		// Process still running but no more output - unusual
 		if p.isClosing() {
 			return nil
@@ -587,22 +729,59 @@ func (p *ClaudeProcess) ReadResponses(ctx context.Context, callbacks ResponseCal
 	}
 }
 
+// parseTodos extracts the todo list from a TodoWrite tool input
+func parseTodos(input map[string]interface{}) ([]types.Todo, bool) {
+	todosSlice, ok := input["todos"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	todos := make([]types.Todo, 0, len(todosSlice))
+	for _, t := range todosSlice {
+		todoMap, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		todo := types.Todo{}
+		if c, ok := todoMap["content"].(string); ok {
+			todo.Content = c
+		}
+		if s, ok := todoMap["status"].(string); ok {
+			todo.Status = s
+		}
+		if a, ok := todoMap["activeForm"].(string); ok {
+			todo.ActiveForm = a
+		}
+		todos = append(todos, todo)
+	}
+	return todos, true
+}
+
 // Alive checks if the process is still running
 func (p *ClaudeProcess) Alive() bool {
 	if p.cmd == nil || p.cmd.Process == nil {
 		return false
 	}
-	// ProcessState is nil if process hasn't exited
-	return p.cmd.ProcessState == nil
+	// done closes once the process has exited (reading ProcessState would race with Wait)
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
 }
 
 // SlashCommands returns the slash commands discovered from the init event
 func (p *ClaudeProcess) SlashCommands() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.slashCommands
 }
 
 // SessionID returns the session ID from the init event
 func (p *ClaudeProcess) SessionID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.sessionID
 }
 
@@ -613,6 +792,20 @@ func (p *ClaudeProcess) SessionNotFound() bool {
 	return p.sessionNotFound
 }
 
+// LastActive returns when the process last sent a message or finished a response
+func (p *ClaudeProcess) LastActive() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastActive
+}
+
+// touch records activity on the process
+func (p *ClaudeProcess) touch() {
+	p.mu.Lock()
+	p.lastActive = time.Now()
+	p.mu.Unlock()
+}
+
 // Done returns a channel that's closed when the process exits
 func (p *ClaudeProcess) Done() <-chan struct{} {
 	return p.done
@@ -650,9 +843,16 @@ func (p *ClaudeProcess) Close() error {
 		}
 	}
 
-	// Wait for process to exit
+	// Wait for process to exit (the monitor goroutine owns cmd.Wait), killing
+	// it if it's stuck, e.g. waiting on a permission prompt
 	if p.cmd != nil && p.cmd.Process != nil {
-		if err := p.cmd.Wait(); err != nil {
+		select {
+		case <-p.done:
+		case <-time.After(closeTimeout):
+			p.cmd.Process.Kill()
+			<-p.done
+		}
+		if err := p.waitErr; err != nil {
 			// Don't report error if process was already killed
 			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != -1 {
 				errs = append(errs, fmt.Errorf("waiting for process: %w", err))
@@ -672,3 +872,32 @@ func (p *ClaudeProcess) isClosing() bool {
 	defer p.mu.Unlock()
 	return p.closing
 }
+
+// lineWriter calls fn for each complete line written to it
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if w.fn != nil {
+			w.fn(string(w.buf[:i]))
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes any unterminated last line to fn
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 && w.fn != nil {
+		w.fn(string(w.buf))
+	}
+	w.buf = nil
+}
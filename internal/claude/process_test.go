@@ -0,0 +1,77 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nopWriteCloser records what's written to a process's stdin
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (*nopWriteCloser) Close() error { return nil }
+
+func TestInterruptControlRequest(t *testing.T) {
+	stdin := &nopWriteCloser{}
+	p := &ClaudeProcess{
+		stdin:  stdin,
+		chatID: 1,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	for _, want := range []string{"aria_1_1", "aria_1_2"} {
+		stdin.Reset()
+		if err := p.Interrupt(); err != nil {
+			t.Fatal(err)
+		}
+		var req ControlRequest
+		if err := json.Unmarshal(stdin.Bytes(), &req); err != nil {
+			t.Fatalf("stdin = %q: %v", stdin.String(), err)
+		}
+		if req.Type != "control_request" || req.Request.Subtype != "interrupt" || req.RequestID != want {
+			t.Errorf("request = %+v, want an interrupt control_request with ID %s", req, want)
+		}
+		if !strings.HasSuffix(stdin.String(), "\n") {
+			t.Errorf("stdin = %q, want a JSON line", stdin.String())
+		}
+	}
+}
+
+func TestInterruptFallsBackToSIGINT(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't run sleep: %v", err)
+	}
+
+	// Closing the read side makes writes to stdin fail
+	r, w := io.Pipe()
+	r.Close()
+	p := &ClaudeProcess{
+		cmd:    cmd,
+		stdin:  w,
+		chatID: 1,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if err := p.Interrupt(); err != nil {
+		t.Fatal(err)
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	select {
+	case err := <-waited:
+		if err == nil || err.Error() != "signal: interrupt" {
+			t.Errorf("sleep exited with %v, want signal: interrupt", err)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("sleep is still running after the interrupt")
+	}
+}
@@ -0,0 +1,196 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTurnDropped is returned by Send when a queued message is dropped before it runs
+var ErrTurnDropped = errors.New("queued message dropped")
+
+// ErrBusy is returned by changes that restart a chat's process while a turn is running
+var ErrBusy = errors.New("a turn is running")
+
+// QueuedMessage describes a message waiting for its turn in a chat's queue
+type QueuedMessage struct {
+	ID       int       // Stable ID within the chat (used by /queue drop)
+	Text     string    // Message text as sent by the user
+	QueuedAt time.Time // When the message was queued
+}
+
+// queuedTurn is a message waiting for the chat to become free
+type queuedTurn struct {
+	QueuedMessage
+	ready   chan struct{} // Closed when it's this message's turn
+	dropped chan struct{} // Closed when the message is removed from the queue
+}
+
+// turnQueue serializes turns for a single chat so only one message
+// talks to the Claude process at a time
+type turnQueue struct {
+	busy    bool          // True while a turn is in flight
+	pending []*queuedTurn // Messages waiting behind the in-flight turn
+	nextID  int
+}
+
+// remove takes a turn out of the pending list, returning false if it isn't there
+func (q *turnQueue) remove(id int) (*queuedTurn, bool) {
+	for i, turn := range q.pending {
+		if turn.ID == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return turn, true
+		}
+	}
+	return nil, false
+}
+
+// queueFor gets or creates the turn queue for a chat (must hold queueMu)
+func (m *ProcessManager) queueFor(chatID int64) *turnQueue {
+	q, ok := m.queues[chatID]
+	if !ok {
+		q = &turnQueue{}
+		m.queues[chatID] = q
+	}
+	return q
+}
+
+// acquireTurn blocks until the chat is free to start a new turn
+// onQueued is called with the number of turns ahead if the message has to wait
+// The returned release function must be called once the turn completes
+func (m *ProcessManager) acquireTurn(ctx context.Context, chatID int64, message string, onQueued func(ahead int)) (func(), error) {
+	release := func() { m.releaseTurn(chatID) }
+
+	m.queueMu.Lock()
+	q := m.queueFor(chatID)
+	if !q.busy {
+		q.busy = true
+		m.queueMu.Unlock()
+		return release, nil
+	}
+
+	q.nextID++
+	turn := &queuedTurn{
+		QueuedMessage: QueuedMessage{
+			ID:       q.nextID,
+			Text:     message,
+			QueuedAt: time.Now(),
+		},
+		ready:   make(chan struct{}),
+		dropped: make(chan struct{}),
+	}
+	q.pending = append(q.pending, turn)
+	// Everything pending ahead of us plus the in-flight turn
+	ahead := len(q.pending)
+	m.queueMu.Unlock()
+
+	m.logger.Info("message queued", "chat_id", chatID, "queue_id", turn.ID, "ahead", ahead)
+	if onQueued != nil {
+		onQueued(ahead)
+	}
+
+	select {
+	case <-turn.ready:
+		return release, nil
+	case <-turn.dropped:
+		return nil, ErrTurnDropped
+	case <-ctx.Done():
+		m.queueMu.Lock()
+		_, stillQueued := q.remove(turn.ID)
+		m.queueMu.Unlock()
+		if !stillQueued {
+			// We were handed the turn while giving up - pass it on
+			select {
+			case <-turn.ready:
+				release()
+			default:
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaseTurn hands the chat to the next queued message, or marks it idle
+func (m *ProcessManager) releaseTurn(chatID int64) {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q := m.queueFor(chatID)
+	if len(q.pending) == 0 {
+		q.busy = false
+		return
+	}
+
+	next := q.pending[0]
+	q.pending = q.pending[1:]
+	close(next.ready)
+}
+
+// Busy returns true if a turn is currently in flight for the chat
+func (m *ProcessManager) Busy(chatID int64) bool {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	if q, ok := m.queues[chatID]; ok {
+		return q.busy
+	}
+	return false
+}
+
+// Queue returns the messages waiting behind the in-flight turn, oldest first
+func (m *ProcessManager) Queue(chatID int64) []QueuedMessage {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q, ok := m.queues[chatID]
+	if !ok {
+		return nil
+	}
+
+	result := make([]QueuedMessage, 0, len(q.pending))
+	for _, turn := range q.pending {
+		result = append(result, turn.QueuedMessage)
+	}
+	return result
+}
+
+// DropQueued removes a queued message by ID
+// Returns false if no such message is waiting
+func (m *ProcessManager) DropQueued(chatID int64, id int) bool {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q, ok := m.queues[chatID]
+	if !ok {
+		return false
+	}
+
+	turn, ok := q.remove(id)
+	if !ok {
+		return false
+	}
+	close(turn.dropped)
+	m.logger.Info("dropped queued message", "chat_id", chatID, "queue_id", id)
+	return true
+}
+
+// ClearQueue drops every queued message for a chat and returns how many were dropped
+func (m *ProcessManager) ClearQueue(chatID int64) int {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q, ok := m.queues[chatID]
+	if !ok {
+		return 0
+	}
+
+	count := len(q.pending)
+	for _, turn := range q.pending {
+		close(turn.dropped)
+	}
+	q.pending = nil
+	if count > 0 {
+		m.logger.Info("cleared message queue", "chat_id", chatID, "count", count)
+	}
+	return count
+}
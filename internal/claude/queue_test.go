@@ -0,0 +1,189 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const queueChat = 7
+
+// newQueueManager returns a manager for exercising the turn queue alone
+func newQueueManager() *ProcessManager {
+	return NewManager("", false, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// queuedTurnResult is what acquireTurn returned to a waiting message
+type queuedTurnResult struct {
+	name    string
+	release func()
+	err     error
+}
+
+// enqueue starts acquiring a turn in the background and waits until the
+// message is queued, returning how many were ahead of it
+func enqueue(t *testing.T, m *ProcessManager, ctx context.Context, name string, results chan<- queuedTurnResult) int {
+	t.Helper()
+	aheadCh := make(chan int, 1)
+	go func() {
+		release, err := m.acquireTurn(ctx, queueChat, name, func(ahead int) { aheadCh <- ahead })
+		results <- queuedTurnResult{name, release, err}
+	}()
+	select {
+	case ahead := <-aheadCh:
+		return ahead
+	case <-time.After(time.Second):
+		t.Fatalf("%s was never queued", name)
+		return 0
+	}
+}
+
+// next waits for the next queued message to get its turn or give up
+func next(t *testing.T, results <-chan queuedTurnResult) queuedTurnResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no queued message finished waiting")
+		return queuedTurnResult{}
+	}
+}
+
+func TestTurnQueueFIFO(t *testing.T) {
+	m := newQueueManager()
+	release, err := m.acquireTurn(context.Background(), queueChat, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Busy(queueChat) {
+		t.Fatal("Busy() = false during a turn")
+	}
+
+	results := make(chan queuedTurnResult, 2)
+	for i, name := range []string{"second", "third"} {
+		if ahead := enqueue(t, m, context.Background(), name, results); ahead != i+1 {
+			t.Errorf("%s: %d ahead, want %d", name, ahead, i+1)
+		}
+	}
+	if q := m.Queue(queueChat); len(q) != 2 || q[0].Text != "second" || q[1].Text != "third" {
+		t.Fatalf("Queue() = %+v, want second then third", q)
+	}
+
+	release()
+	for _, want := range []string{"second", "third"} {
+		r := next(t, results)
+		if r.err != nil || r.name != want {
+			t.Fatalf("got turn %q (err %v), want %q", r.name, r.err, want)
+		}
+		r.release()
+	}
+	if m.Busy(queueChat) {
+		t.Error("Busy() = true once every turn was released")
+	}
+}
+
+func TestTurnQueueCancelled(t *testing.T) {
+	m := newQueueManager()
+	release, err := m.acquireTurn(context.Background(), queueChat, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan queuedTurnResult, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	enqueue(t, m, ctx, "cancelled", results)
+	enqueue(t, m, context.Background(), "waiting", results)
+
+	cancel()
+	if r := next(t, results); r.name != "cancelled" || !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("got %q (err %v), want cancelled with context.Canceled", r.name, r.err)
+	}
+	if q := m.Queue(queueChat); len(q) != 1 || q[0].Text != "waiting" {
+		t.Fatalf("Queue() = %+v, want only waiting", q)
+	}
+
+	release()
+	r := next(t, results)
+	if r.name != "waiting" || r.err != nil {
+		t.Fatalf("got %q (err %v), want waiting to get the turn", r.name, r.err)
+	}
+	r.release()
+}
+
+func TestTurnQueueCancelledWhileHandedOver(t *testing.T) {
+	m := newQueueManager()
+
+	// Cancel just as the turn is handed over, so either side of the race can
+	// win; the turn must never be lost
+	for i := 0; i < 100; i++ {
+		release, err := m.acquireTurn(context.Background(), queueChat, "first", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := make(chan queuedTurnResult, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		enqueue(t, m, ctx, "racing", results)
+
+		go cancel()
+		release()
+		if r := next(t, results); r.err == nil {
+			r.release()
+		}
+
+		ctx, cancelWait := context.WithTimeout(context.Background(), time.Second)
+		release, err = m.acquireTurn(ctx, queueChat, "after", nil)
+		cancelWait()
+		if err != nil {
+			t.Fatalf("iteration %d: the chat stayed busy: %v", i, err)
+		}
+		release()
+	}
+}
+
+func TestTurnQueueDrop(t *testing.T) {
+	m := newQueueManager()
+	release, err := m.acquireTurn(context.Background(), queueChat, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	results := make(chan queuedTurnResult, 3)
+	enqueue(t, m, context.Background(), "second", results)
+	enqueue(t, m, context.Background(), "third", results)
+
+	id := m.Queue(queueChat)[0].ID
+	if !m.DropQueued(queueChat, id) {
+		t.Fatalf("DropQueued(%d) = false", id)
+	}
+	if r := next(t, results); r.name != "second" || !errors.Is(r.err, ErrTurnDropped) {
+		t.Fatalf("got %q (err %v), want second dropped", r.name, r.err)
+	}
+	if m.DropQueued(queueChat, id) {
+		t.Error("DropQueued() = true for a message already dropped")
+	}
+	if q := m.Queue(queueChat); len(q) != 1 || q[0].Text != "third" {
+		t.Fatalf("Queue() = %+v, want only third", q)
+	}
+
+	// Dropped messages don't count toward the ones ahead
+	if ahead := enqueue(t, m, context.Background(), "fourth", results); ahead != 2 {
+		t.Errorf("fourth: %d ahead, want 2", ahead)
+	}
+
+	if n := m.ClearQueue(queueChat); n != 2 {
+		t.Errorf("ClearQueue() = %d, want 2", n)
+	}
+	for i := 0; i < 2; i++ {
+		if r := next(t, results); !errors.Is(r.err, ErrTurnDropped) {
+			t.Errorf("%s: err = %v, want ErrTurnDropped", r.name, r.err)
+		}
+	}
+	if !m.Busy(queueChat) {
+		t.Error("Busy() = false, want the running turn kept")
+	}
+}
@@ -0,0 +1,353 @@
+package claude
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codegangsta/aria/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// usageRetention is how long daily usage records are kept on disk
+const usageRetention = 90 * 24 * time.Hour
+
+// dayFormat is the layout used for the day of a usage record (local time)
+const dayFormat = "2006-01-02"
+
+// UsageTotals holds accumulated token counts and cost
+type UsageTotals struct {
+	InputTokens         int     `yaml:"input_tokens"`
+	OutputTokens        int     `yaml:"output_tokens"`
+	CacheCreationTokens int     `yaml:"cache_creation_tokens"`
+	CacheReadTokens     int     `yaml:"cache_read_tokens"`
+	CostUSD             float64 `yaml:"cost_usd"`
+	DurationMs          int64   `yaml:"duration_ms"`
+	Turns               int     `yaml:"turns"`    // Agentic turns reported by Claude (num_turns)
+	Messages            int     `yaml:"messages"` // Completed responses (result events)
+}
+
+// Add accumulates a single turn's usage
+func (t *UsageTotals) Add(u types.Usage) {
+	t.InputTokens += u.InputTokens
+	t.OutputTokens += u.OutputTokens
+	t.CacheCreationTokens += u.CacheCreationInputTokens
+	t.CacheReadTokens += u.CacheReadInputTokens
+	t.CostUSD += u.CostUSD
+	t.DurationMs += u.DurationMs
+	t.Turns += u.NumTurns
+	t.Messages++
+}
+
+// Merge accumulates another set of totals
+func (t *UsageTotals) Merge(o UsageTotals) {
+	t.InputTokens += o.InputTokens
+	t.OutputTokens += o.OutputTokens
+	t.CacheCreationTokens += o.CacheCreationTokens
+	t.CacheReadTokens += o.CacheReadTokens
+	t.CostUSD += o.CostUSD
+	t.DurationMs += o.DurationMs
+	t.Turns += o.Turns
+	t.Messages += o.Messages
+}
+
+// String formats the totals for display, e.g. "$1.23 · 45.6k in / 7.8k out · 12 messages"
+func (t UsageTotals) String() string {
+	return fmt.Sprintf("$%.2f · %s in / %s out · %d messages",
+		t.CostUSD,
+		FormatTokens(t.InputTokens+t.CacheCreationTokens+t.CacheReadTokens),
+		FormatTokens(t.OutputTokens),
+		t.Messages,
+	)
+}
+
+// UsageRecord holds accumulated usage for one chat, session and day
+type UsageRecord struct {
+	ChatID      int64  `yaml:"chat_id"`
+	SessionID   string `yaml:"session_id"`
+	Day         string `yaml:"day"` // YYYY-MM-DD in local time
+	UsageTotals `yaml:",inline"`
+}
+
+// SessionUsage holds the totals for a single session
+type SessionUsage struct {
+	SessionID string
+	Totals    UsageTotals
+}
+
+// BudgetWarning records that a budget warning was sent on a given day
+type BudgetWarning struct {
+	Scope string `yaml:"scope"` // "global" or "chat:<id>"
+	Day   string `yaml:"day"`
+}
+
+// PersistedUsage holds all persisted usage records
+type PersistedUsage struct {
+	Records  []UsageRecord   `yaml:"records"`
+	Warnings []BudgetWarning `yaml:"warnings,omitempty"`
+}
+
+// usageKey identifies a usage record
+type usageKey struct {
+	chatID    int64
+	sessionID string
+	day       string
+}
+
+// UsageStore accumulates token usage and cost per chat, session and day
+type UsageStore struct {
+	path    string
+	records map[usageKey]*UsageRecord
+	warned  map[string]string // Budget scope -> day the warning was last sent
+	mu      sync.RWMutex
+	saveMu  sync.Mutex     // Serializes background saves
+	saving  sync.WaitGroup // Background saves in flight
+}
+
+// NewUsageStore creates a new usage store
+// path should be ~/.config/aria/usage.yaml
+func NewUsageStore(path string) *UsageStore {
+	return &UsageStore{
+		path:    path,
+		records: make(map[usageKey]*UsageRecord),
+		warned:  make(map[string]string),
+	}
+}
+
+// Load reads usage records from disk, dropping records past the retention window
+func (s *UsageStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading usage file: %w", err)
+	}
+
+	var persisted PersistedUsage
+	if err := yaml.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("parsing usage file: %w", err)
+	}
+
+	cutoff := time.Now().Add(-usageRetention).Format(dayFormat)
+	s.records = make(map[usageKey]*UsageRecord)
+	for _, r := range persisted.Records {
+		if r.Day < cutoff {
+			continue
+		}
+		rec := r
+		s.records[usageKey{r.ChatID, r.SessionID, r.Day}] = &rec
+	}
+
+	s.warned = make(map[string]string)
+	for _, w := range persisted.Warnings {
+		s.warned[w.Scope] = w.Day
+	}
+
+	return nil
+}
+
+// Save writes usage records to disk
+func (s *UsageStore) Save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.RLock()
+	persisted := PersistedUsage{
+		Records: make([]UsageRecord, 0, len(s.records)),
+	}
+	for _, r := range s.records {
+		persisted.Records = append(persisted.Records, *r)
+	}
+	for scope, day := range s.warned {
+		persisted.Warnings = append(persisted.Warnings, BudgetWarning{Scope: scope, Day: day})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(persisted.Warnings, func(i, j int) bool {
+		return persisted.Warnings[i].Scope < persisted.Warnings[j].Scope
+	})
+
+	// Stable order keeps the file diffable
+	sort.Slice(persisted.Records, func(i, j int) bool {
+		a, b := persisted.Records[i], persisted.Records[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.ChatID != b.ChatID {
+			return a.ChatID < b.ChatID
+		}
+		return a.SessionID < b.SessionID
+	})
+
+	data, err := yaml.Marshal(&persisted)
+	if err != nil {
+		return fmt.Errorf("marshaling usage: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating usage directory: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("writing usage file: %w", err)
+	}
+
+	return nil
+}
+
+// Record adds a turn's usage to the chat/session totals for the given time's day
+func (s *UsageStore) Record(chatID int64, sessionID string, u types.Usage, at time.Time) {
+	key := usageKey{chatID, sessionID, at.Format(dayFormat)}
+
+	s.mu.Lock()
+	rec, ok := s.records[key]
+	if !ok {
+		rec = &UsageRecord{ChatID: chatID, SessionID: sessionID, Day: key.day}
+		s.records[key] = rec
+	}
+	rec.Add(u)
+	s.mu.Unlock()
+
+	// Save in background (don't block)
+	s.saveAsync()
+}
+
+// saveAsync saves in the background
+func (s *UsageStore) saveAsync() {
+	s.saving.Add(1)
+	go func() {
+		defer s.saving.Done()
+		s.Save()
+	}()
+}
+
+// Flush waits for background saves to finish
+func (s *UsageStore) Flush() {
+	s.saving.Wait()
+}
+
+// MarkWarned records a budget warning for the day
+// Returns false if the scope was already warned that day
+func (s *UsageStore) MarkWarned(scope, day string) bool {
+	s.mu.Lock()
+	if s.warned[scope] == day {
+		s.mu.Unlock()
+		return false
+	}
+	s.warned[scope] = day
+	s.mu.Unlock()
+
+	s.saveAsync()
+	return true
+}
+
+// ChatTotals returns a chat's totals for the days from since (inclusive) to now
+func (s *UsageStore) ChatTotals(chatID int64, since time.Time) UsageTotals {
+	return s.sum(func(r *UsageRecord) bool {
+		return r.ChatID == chatID && r.Day >= since.Format(dayFormat)
+	})
+}
+
+// AllTotals returns totals across every chat for the days from since (inclusive) to now
+func (s *UsageStore) AllTotals(since time.Time) UsageTotals {
+	return s.sum(func(r *UsageRecord) bool {
+		return r.Day >= since.Format(dayFormat)
+	})
+}
+
+// SessionTotals returns all recorded usage for a session
+func (s *UsageStore) SessionTotals(sessionID string) UsageTotals {
+	return s.sum(func(r *UsageRecord) bool {
+		return r.SessionID == sessionID
+	})
+}
+
+// TopSessions returns a chat's sessions since the given day, most expensive first
+func (s *UsageStore) TopSessions(chatID int64, since time.Time, limit int) []SessionUsage {
+	day := since.Format(dayFormat)
+
+	s.mu.RLock()
+	bySession := make(map[string]*UsageTotals)
+	for _, r := range s.records {
+		if r.ChatID != chatID || r.Day < day {
+			continue
+		}
+		t, ok := bySession[r.SessionID]
+		if !ok {
+			t = &UsageTotals{}
+			bySession[r.SessionID] = t
+		}
+		t.Merge(r.UsageTotals)
+	}
+	s.mu.RUnlock()
+
+	result := make([]SessionUsage, 0, len(bySession))
+	for id, t := range bySession {
+		result = append(result, SessionUsage{SessionID: id, Totals: *t})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Totals.CostUSD > result[j].Totals.CostUSD
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// sum totals every record matching the filter
+func (s *UsageStore) sum(match func(r *UsageRecord) bool) UsageTotals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total UsageTotals
+	for _, r := range s.records {
+		if match(r) {
+			total.Merge(r.UsageTotals)
+		}
+	}
+	return total
+}
+
+// StartOfDay returns midnight (local time) of the given time's day
+func StartOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// FormatTokens formats a token count compactly, e.g. 950, 12.3k, 1.2M
+func FormatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// FormatUsageFooter formats a single turn's usage as a one-line footer
+// e.g. "$0.04 · 12.3k tokens · 3 turns · 42s"
+func FormatUsageFooter(u types.Usage) string {
+	tokens := u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	parts := []string{
+		fmt.Sprintf("$%.2f", u.CostUSD),
+		FormatTokens(tokens) + " tokens",
+	}
+	if u.NumTurns > 0 {
+		parts = append(parts, fmt.Sprintf("%d turns", u.NumTurns))
+	}
+	if u.DurationMs > 0 {
+		parts = append(parts, (time.Duration(u.DurationMs) * time.Millisecond).Round(time.Second).String())
+	}
+	return strings.Join(parts, " · ")
+}
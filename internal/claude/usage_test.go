@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/aria/internal/types"
+)
+
+// newUsageStore returns an empty usage store saving to a temporary directory
+func newUsageStore(t *testing.T) *UsageStore {
+	t.Helper()
+	s := NewUsageStore(filepath.Join(t.TempDir(), "usage.yaml"))
+	t.Cleanup(s.Flush)
+	return s
+}
+
+// turn is a turn's usage costing cost
+func turn(cost float64) types.Usage {
+	return types.Usage{CostUSD: cost, InputTokens: 100, OutputTokens: 10, NumTurns: 2}
+}
+
+// sameCost compares costs, which are sums of floats
+func sameCost(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUsageStoreRecord(t *testing.T) {
+	s := newUsageStore(t)
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+
+	s.Record(1, "a", turn(0.10), now)
+	s.Record(1, "a", turn(0.20), now)
+	s.Record(1, "b", turn(0.50), now)
+	s.Record(1, "a", turn(1.00), yesterday)
+	s.Record(2, "c", turn(0.05), now)
+
+	today := s.ChatTotals(1, StartOfDay(now))
+	if !sameCost(today.CostUSD, 0.80) || today.Messages != 3 || today.InputTokens != 300 || today.Turns != 6 {
+		t.Errorf("chat 1 today = %+v, want $0.80 over 3 messages", today)
+	}
+	if got := s.ChatTotals(1, StartOfDay(yesterday)); !sameCost(got.CostUSD, 1.80) || got.Messages != 4 {
+		t.Errorf("chat 1 since yesterday = %+v, want $1.80 over 4 messages", got)
+	}
+	if got := s.AllTotals(StartOfDay(now)); !sameCost(got.CostUSD, 0.85) {
+		t.Errorf("all chats today = $%.2f, want $0.85", got.CostUSD)
+	}
+	if got := s.SessionTotals("a"); !sameCost(got.CostUSD, 1.30) || got.Messages != 3 {
+		t.Errorf("session a = %+v, want $1.30 over 3 messages across both days", got)
+	}
+
+	top := s.TopSessions(1, StartOfDay(yesterday), 1)
+	if len(top) != 1 || top[0].SessionID != "a" || !sameCost(top[0].Totals.CostUSD, 1.30) {
+		t.Errorf("top session = %+v, want a at $1.30", top)
+	}
+	top = s.TopSessions(1, StartOfDay(now), 0)
+	if len(top) != 2 || top[0].SessionID != "b" || top[1].SessionID != "a" {
+		t.Errorf("top sessions today = %+v, want b then a", top)
+	}
+}
+
+func TestUsageStorePersistence(t *testing.T) {
+	s := newUsageStore(t)
+	now := time.Now()
+	day := now.Format(dayFormat)
+
+	s.Record(1, "a", turn(0.25), now)
+	s.Record(1, "a", turn(0.50), now.AddDate(0, 0, -2))
+	if !s.MarkWarned("chat:1", day) {
+		t.Fatal("MarkWarned() = false for the first warning")
+	}
+	s.Flush()
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewUsageStore(s.path)
+	t.Cleanup(loaded.Flush)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.ChatTotals(1, StartOfDay(now)); !sameCost(got.CostUSD, 0.25) || got.InputTokens != 100 || got.Turns != 2 {
+		t.Errorf("loaded today = %+v, want the $0.25 turn", got)
+	}
+	if got := loaded.SessionTotals("a"); !sameCost(got.CostUSD, 0.75) || got.Messages != 2 {
+		t.Errorf("loaded session = %+v, want $0.75 over 2 messages", got)
+	}
+	if loaded.MarkWarned("chat:1", day) {
+		t.Error("MarkWarned() = true for a warning already sent today")
+	}
+}
+
+func TestUsageStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.yaml")
+	old := time.Now().Add(-usageRetention - 48*time.Hour).Format(dayFormat)
+	recent := time.Now().Format(dayFormat)
+	data := "records:\n" +
+		"  - {chat_id: 1, session_id: a, day: \"" + old + "\", cost_usd: 5}\n" +
+		"  - {chat_id: 1, session_id: a, day: \"" + recent + "\", cost_usd: 1}\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewUsageStore(path)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.SessionTotals("a"); !sameCost(got.CostUSD, 1) {
+		t.Errorf("session total = $%.2f, want $1.00 without the expired record", got.CostUSD)
+	}
+}
+
+func TestTurnCost(t *testing.T) {
+	p := &ClaudeProcess{}
+
+	// total_cost_usd is a running total for the process
+	for _, tt := range []struct{ total, want float64 }{
+		{0.010, 0.010},
+		{0.025, 0.015},
+		{0.025, 0},
+		{0.004, 0.004}, // started over
+	} {
+		if got := p.turnCost(tt.total); !sameCost(got, tt.want) {
+			t.Errorf("turnCost(%v) = %v, want %v", tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/codegangsta/aria/internal/claude"
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// ModelBusyText is the reply to a model change while a turn is running
+const ModelBusyText = "Can't switch models mid-turn. Try again when it's done, or /stop it first."
+
+// modelAliases are the model aliases the claude CLI accepts for --model
+var modelAliases = []string{"sonnet", "opus", "haiku", "opusplan", "sonnet[1m]"}
+
+// ModelCommand handles /model - shows a model picker or switches models directly
+type ModelCommand struct {
+	manager *claude.ProcessManager
+	fe      frontend.Frontend
+	models  []string
+}
+
+// NewModelCommand creates a new model command
+// models are the choices offered in the picker
+func NewModelCommand(manager *claude.ProcessManager, fe frontend.Frontend, models []string) *ModelCommand {
+	return &ModelCommand{
+		manager: manager,
+		fe:      fe,
+		models:  models,
+	}
+}
+
+func (c *ModelCommand) Name() string {
+	return "model"
+}
+
+func (c *ModelCommand) Execute(ctx context.Context, chatID int64, args string) (*Response, error) {
+	model := strings.TrimSpace(args)
+
+	// No args - show the picker
+	if model == "" {
+		current := c.manager.Model(chatID)
+		display := current
+		if display == "" {
+			display = "default"
+		}
+
+		keyboard := frontend.BuildModelKeyboard(c.models, current)
+		text := "**Model:** " + display
+		if _, err := c.fe.SendKeyboard(chatID, text, keyboard); err != nil {
+			slog.Error("failed to send model keyboard", "error", err)
+		}
+
+		// Return nil response since we handle the keyboard ourselves
+		return nil, nil
+	}
+
+	// "/model default" reverts to the configured default
+	if model == "default" {
+		model = ""
+	} else if !slices.Contains(c.models, model) && !slices.Contains(modelAliases, model) {
+		// The CLI would only reject it after the process restarts
+		return &Response{
+			Text:   fmt.Sprintf("Unknown model %s. Choose one of: %s, or add it to claude.models.", model, strings.Join(c.models, ", ")),
+			Silent: true,
+		}, nil
+	}
+
+	// Change the model (kills process, preserves session)
+	slog.Info("changing model", "chat_id", chatID, "model", model)
+	if err := c.manager.SetModel(chatID, model); errors.Is(err, claude.ErrBusy) {
+		return &Response{
+			Text:   ModelBusyText,
+			Silent: true,
+		}, nil
+	}
+
+	display := c.manager.Model(chatID)
+	if display == "" {
+		display = "default"
+	}
+	return &Response{
+		Text:   fmt.Sprintf("Now using %s", display),
+		Silent: true,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/aria/internal/permissions"
+)
+
+// PermissionsCommand handles /permissions - lists, adds and revokes permission rules
+type PermissionsCommand struct {
+	store *permissions.Store
+}
+
+// NewPermissionsCommand creates a new permissions command
+func NewPermissionsCommand(store *permissions.Store) *PermissionsCommand {
+	return &PermissionsCommand{store: store}
+}
+
+func (c *PermissionsCommand) Name() string {
+	return "permissions"
+}
+
+func (c *PermissionsCommand) Execute(ctx context.Context, chatID int64, args string) (*Response, error) {
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+
+	switch {
+	case action == "":
+		return c.list(chatID), nil
+
+	case (action == "allow" || action == "global") && rest != "":
+		rule, err := permissions.ParseRule(rest)
+		if err != nil {
+			return &Response{Text: err.Error(), Silent: true}, nil
+		}
+		target, scope := chatID, "this chat"
+		if action == "global" {
+			target, scope = 0, "all chats"
+		}
+		added, err := c.store.Add(target, rule)
+		if err != nil {
+			return nil, fmt.Errorf("saving permission rule: %w", err)
+		}
+		if !added {
+			return &Response{
+				Text:   fmt.Sprintf("%s is already allowed in %s.", rule, scope),
+				Silent: true,
+			}, nil
+		}
+		slog.Info("added permission rule", "chat_id", target, "rule", rule.String())
+		return &Response{
+			Text:   fmt.Sprintf("Allowing %s in %s.", rule, scope),
+			Silent: true,
+		}, nil
+
+	case action == "revoke" && rest != "":
+		rule, ok := c.find(chatID, rest)
+		if !ok {
+			return &Response{
+				Text:   fmt.Sprintf("No permission rule %s.", rest),
+				Silent: true,
+			}, nil
+		}
+		if _, err := c.store.Remove(rule); err != nil {
+			return nil, fmt.Errorf("saving permission rules: %w", err)
+		}
+		slog.Info("revoked permission rule", "chat_id", rule.ChatID, "rule", rule.String())
+		return &Response{
+			Text:   fmt.Sprintf("Revoked %s.", rule),
+			Silent: true,
+		}, nil
+	}
+
+	return &Response{
+		Text:   "Usage: /permissions [allow <rule> | global <rule> | revoke <n>]",
+		Silent: true,
+	}, nil
+}
+
+// find looks a rule up by its number in the list, or by its text
+// (preferring this chat's rule over a global one)
+func (c *PermissionsCommand) find(chatID int64, arg string) (permissions.Rule, bool) {
+	rules := c.store.Rules(chatID)
+	if n, err := strconv.Atoi(strings.TrimPrefix(arg, "#")); err == nil {
+		if n < 1 || n > len(rules) {
+			return permissions.Rule{}, false
+		}
+		return rules[n-1], true
+	}
+
+	want, err := permissions.ParseRule(arg)
+	if err != nil {
+		return permissions.Rule{}, false
+	}
+	for _, r := range rules {
+		if r.String() == want.String() {
+			return r, true
+		}
+	}
+	return permissions.Rule{}, false
+}
+
+// list formats the rules that apply to a chat
+func (c *PermissionsCommand) list(chatID int64) *Response {
+	rules := c.store.Rules(chatID)
+	if len(rules) == 0 {
+		return &Response{
+			Text:   "No permission rules. Tap Always on a permission prompt, or use /permissions allow <rule>.",
+			Silent: true,
+		}
+	}
+
+	lines := []string{"Permission rules:"}
+	for i, r := range rules {
+		line := fmt.Sprintf("%d. %s", i+1, r)
+		if r.ChatID == 0 {
+			line += " (all chats)"
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", "Use /permissions revoke <n> to remove one.")
+
+	return &Response{
+		Text:   strings.Join(lines, "\n"),
+		Silent: true,
+	}
+}
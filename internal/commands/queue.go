@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/aria/internal/claude"
+)
+
+// QueueCommand handles /queue - lists or drops messages waiting behind a running turn
+type QueueCommand struct {
+	manager *claude.ProcessManager
+}
+
+// NewQueueCommand creates a new queue command
+func NewQueueCommand(manager *claude.ProcessManager) *QueueCommand {
+	return &QueueCommand{manager: manager}
+}
+
+func (c *QueueCommand) Name() string {
+	return "queue"
+}
+
+func (c *QueueCommand) Execute(ctx context.Context, chatID int64, args string) (*Response, error) {
+	fields := strings.Fields(args)
+
+	// No args - list the queue
+	if len(fields) == 0 {
+		return c.list(chatID), nil
+	}
+
+	switch fields[0] {
+	case "clear":
+		count := c.manager.ClearQueue(chatID)
+		slog.Info("cleared queue", "chat_id", chatID, "count", count)
+		return &Response{
+			Text:   fmt.Sprintf("Dropped %d queued message(s).", count),
+			Silent: true,
+		}, nil
+
+	case "drop":
+		if len(fields) < 2 {
+			return &Response{
+				Text:   "Usage: /queue drop <id>",
+				Silent: true,
+			}, nil
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[1], "#"))
+		if err != nil {
+			return &Response{
+				Text:   fmt.Sprintf("Invalid queue id: %s", fields[1]),
+				Silent: true,
+			}, nil
+		}
+		if !c.manager.DropQueued(chatID, id) {
+			return &Response{
+				Text:   fmt.Sprintf("No queued message #%d.", id),
+				Silent: true,
+			}, nil
+		}
+		return &Response{
+			Text:   fmt.Sprintf("Dropped #%d.", id),
+			Silent: true,
+		}, nil
+	}
+
+	return &Response{
+		Text:   "Usage: /queue [drop <id> | clear]",
+		Silent: true,
+	}, nil
+}
+
+// list formats the pending messages for a chat
+func (c *QueueCommand) list(chatID int64) *Response {
+	queued := c.manager.Queue(chatID)
+	if len(queued) == 0 {
+		text := "Queue is empty."
+		if c.manager.Busy(chatID) {
+			text = "Queue is empty (a turn is running)."
+		}
+		return &Response{
+			Text:   text,
+			Silent: true,
+		}
+	}
+
+	lines := []string{"Queued messages:"}
+	for _, q := range queued {
+		text := q.Text
+		if len(text) > 60 {
+			text = text[:57] + "..."
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s", q.ID, text))
+	}
+	lines = append(lines, "", "Use /queue drop <id> or /queue clear.")
+
+	return &Response{
+		Text:   strings.Join(lines, "\n"),
+		Silent: true,
+	}
+}
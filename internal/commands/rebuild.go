@@ -11,22 +11,22 @@ import (
 	"syscall"
 
 	"github.com/codegangsta/aria/internal/claude"
-	"github.com/codegangsta/aria/internal/telegram"
+	"github.com/codegangsta/aria/internal/frontend"
 )
 
 // RebuildCommand handles /rebuild - recompiles and restarts ARIA
 type RebuildCommand struct {
 	manager        *claude.ProcessManager
-	bot            *telegram.Bot
+	fe             frontend.Frontend
 	sourceDir      string
 	executablePath string
 }
 
 // NewRebuildCommand creates a new rebuild command
-func NewRebuildCommand(manager *claude.ProcessManager, bot *telegram.Bot, sourceDir, executablePath string) *RebuildCommand {
+func NewRebuildCommand(manager *claude.ProcessManager, fe frontend.Frontend, sourceDir, executablePath string) *RebuildCommand {
 	return &RebuildCommand{
 		manager:        manager,
-		bot:            bot,
+		fe:             fe,
 		sourceDir:      sourceDir,
 		executablePath: executablePath,
 	}
@@ -43,7 +43,7 @@ func (c *RebuildCommand) Execute(ctx context.Context, chatID int64, args string)
 	go func() {
 		if err := c.rebuildAndRestart(); err != nil {
 			slog.Error("rebuild failed", "error", err)
-			c.bot.SendMessage(chatID, fmt.Sprintf("Rebuild failed: %v", err), false)
+			c.fe.SendMessage(chatID, fmt.Sprintf("Rebuild failed: %v", err), false)
 		}
 		// If we get here, exec failed or wasn't called
 	}()
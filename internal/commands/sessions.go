@@ -5,20 +5,20 @@ import (
 	"log/slog"
 
 	"github.com/codegangsta/aria/internal/claude"
-	"github.com/codegangsta/aria/internal/telegram"
+	"github.com/codegangsta/aria/internal/frontend"
 )
 
 // SessionsCommand handles /sessions - shows session picker
 type SessionsCommand struct {
 	discovery *claude.SessionDiscovery
-	bot       *telegram.Bot
+	fe        frontend.Frontend
 }
 
 // NewSessionsCommand creates a new sessions command
-func NewSessionsCommand(discovery *claude.SessionDiscovery, bot *telegram.Bot) *SessionsCommand {
+func NewSessionsCommand(discovery *claude.SessionDiscovery, fe frontend.Frontend) *SessionsCommand {
 	return &SessionsCommand{
 		discovery: discovery,
-		bot:       bot,
+		fe:        fe,
 	}
 }
 
@@ -46,9 +46,9 @@ func (c *SessionsCommand) Execute(ctx context.Context, chatID int64, args string
 	}
 
 	// Convert to display info
-	var displaySessions []telegram.SessionDisplayInfo
+	var displaySessions []frontend.SessionDisplayInfo
 	for _, s := range sessions {
-		displaySessions = append(displaySessions, telegram.SessionDisplayInfo{
+		displaySessions = append(displaySessions, frontend.SessionDisplayInfo{
 			ID:          s.ID,
 			ShortID:     s.ShortID,
 			ProjectName: s.ProjectName,
@@ -57,8 +57,8 @@ func (c *SessionsCommand) Execute(ctx context.Context, chatID int64, args string
 		})
 	}
 
-	keyboard := telegram.BuildSessionKeyboard(displaySessions)
-	if _, err := c.bot.SendQuestionKeyboard(chatID, "*Sessions*", keyboard); err != nil {
+	keyboard := frontend.BuildSessionKeyboard(displaySessions)
+	if _, err := c.fe.SendKeyboard(chatID, "**Sessions**", keyboard); err != nil {
 		slog.Error("failed to send session keyboard", "error", err)
 	}
 
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/codegangsta/aria/internal/claude"
+	"github.com/codegangsta/aria/internal/trackers"
+)
+
+// StopCommand handles /stop - interrupts the running turn but keeps the session
+type StopCommand struct {
+	manager    *claude.ProcessManager
+	trackerMgr *trackers.Manager
+}
+
+// NewStopCommand creates a new stop command
+func NewStopCommand(manager *claude.ProcessManager, trackerMgr *trackers.Manager) *StopCommand {
+	return &StopCommand{
+		manager:    manager,
+		trackerMgr: trackerMgr,
+	}
+}
+
+func (c *StopCommand) Name() string {
+	return "stop"
+}
+
+func (c *StopCommand) Execute(ctx context.Context, chatID int64, args string) (*Response, error) {
+	slog.Info("stop requested", "chat_id", chatID)
+
+	stopped, err := c.manager.Interrupt(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !stopped {
+		return &Response{
+			Text:   "Nothing is running.",
+			Silent: true,
+		}, nil
+	}
+
+	// Mark the pinned todo list as stopped; the turn itself drains to its result
+	c.trackerMgr.CancelProgress(chatID, "interrupted")
+
+	return &Response{
+		Text:   "Stopping...",
+		Silent: true,
+	}, nil
+}
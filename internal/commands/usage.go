@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/aria/internal/claude"
+)
+
+// UsageCommand handles /usage - shows token usage and cost for the chat
+type UsageCommand struct {
+	manager *claude.ProcessManager
+	store   *claude.UsageStore
+}
+
+// NewUsageCommand creates a new usage command
+func NewUsageCommand(manager *claude.ProcessManager, store *claude.UsageStore) *UsageCommand {
+	return &UsageCommand{
+		manager: manager,
+		store:   store,
+	}
+}
+
+func (c *UsageCommand) Name() string {
+	return "usage"
+}
+
+func (c *UsageCommand) Execute(ctx context.Context, chatID int64, args string) (*Response, error) {
+	slog.Info("showing usage", "chat_id", chatID)
+
+	today := claude.StartOfDay(time.Now())
+	weekStart := today.AddDate(0, 0, -6) // Last 7 days including today
+
+	lines := []string{
+		"**Usage**",
+		"Today: " + c.store.ChatTotals(chatID, today).String(),
+		"This week: " + c.store.ChatTotals(chatID, weekStart).String(),
+	}
+
+	if sessionID := c.manager.SessionID(chatID); sessionID != "" {
+		lines = append(lines, "This session: "+c.store.SessionTotals(sessionID).String())
+	}
+
+	// Per-session breakdown for the week
+	sessions := c.store.TopSessions(chatID, weekStart, 5)
+	if len(sessions) > 1 {
+		lines = append(lines, "", "**Sessions this week**")
+		for _, s := range sessions {
+			shortID := s.SessionID
+			if len(shortID) > 8 {
+				shortID = shortID[:8]
+			}
+			if shortID == "" {
+				shortID = "(none)"
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", shortID, s.Totals.String()))
+		}
+	}
+
+	return &Response{
+		Text:   strings.Join(lines, "\n"),
+		Silent: true,
+	}, nil
+}
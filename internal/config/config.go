@@ -2,30 +2,214 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // TelegramConfig holds Telegram-specific settings
 type TelegramConfig struct {
-	Token string `yaml:"token"` // Bot token from @BotFather
+	Token   string        `yaml:"token"`   // Bot token from @BotFather
+	APIURL  string        `yaml:"api_url"` // Bot API server, empty = https://api.telegram.org
+	Webhook WebhookConfig `yaml:"webhook"` // receive updates by webhook instead of long polling
+}
+
+// WebhookConfig holds Telegram webhook settings
+// Webhooks are used when URL is set; if setup fails Aria falls back to long polling
+type WebhookConfig struct {
+	URL         string `yaml:"url"`          // public HTTPS URL Telegram posts updates to
+	Listen      string `yaml:"listen"`       // local address to listen on (default ":8443")
+	Path        string `yaml:"path"`         // local path updates arrive on, empty = the URL's path
+	SecretToken string `yaml:"secret_token"` // checked on every request, empty = random per start
+	CertFile    string `yaml:"cert_file"`    // serve TLS with this certificate (and key_file)
+	KeyFile     string `yaml:"key_file"`
+	UploadCert  bool   `yaml:"upload_cert"` // send cert_file to Telegram, for self-signed certificates
+}
+
+// SlackConfig holds Slack-specific settings
+type SlackConfig struct {
+	BotToken  string   `yaml:"bot_token"` // xoxb- bot token
+	AppToken  string   `yaml:"app_token"` // xapp- app-level token with connections:write, for Socket Mode
+	Allowlist []string `yaml:"allowlist"` // Slack user IDs allowed to use the bot (e.g. U012AB3CD)
+	APIURL    string   `yaml:"api_url"`   // Web API base URL, empty = https://slack.com/api/
+}
+
+// Enabled reports whether the Slack frontend is configured
+func (s SlackConfig) Enabled() bool {
+	return s.BotToken != "" || s.AppToken != ""
+}
+
+// MatrixConfig holds Matrix-specific settings
+type MatrixConfig struct {
+	Homeserver  string   `yaml:"homeserver"`   // e.g. https://matrix.example.com
+	AccessToken string   `yaml:"access_token"` // access token of the bot's account
+	Allowlist   []string `yaml:"allowlist"`    // Matrix user IDs allowed to use the bot (e.g. @me:example.com)
+}
+
+// Enabled reports whether the Matrix frontend is configured
+func (m MatrixConfig) Enabled() bool {
+	return m.Homeserver != "" || m.AccessToken != ""
+}
+
+// TranscriptionConfig holds voice message transcription settings
+// Voice messages are transcribed with whisper.cpp unless command is set
+type TranscriptionConfig struct {
+	Command       []string `yaml:"command"`        // transcriber that prints the transcript, "{file}" = the audio file
+	WhisperBinary string   `yaml:"whisper_binary"` // whisper.cpp CLI, empty = "whisper-cli"
+	WhisperModel  string   `yaml:"whisper_model"`  // ggml model file, empty = ~/.config/aria/ggml-base.en.bin
+	Language      string   `yaml:"language"`       // spoken language for whisper (e.g. "de"), empty = the model's default
 }
 
 // ClaudeConfig holds Claude CLI settings
 type ClaudeConfig struct {
-	SkipPermissions bool `yaml:"skip_permissions"` // pass --dangerously-skip-permissions to Claude
+	SkipPermissions bool          `yaml:"skip_permissions"` // pass --dangerously-skip-permissions to Claude
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // close chat processes idle this long (e.g. "30m"), 0 = never
+	MaxProcesses    int           `yaml:"max_processes"`    // max live Claude processes, least recently used closed first, 0 = no cap
+	UsageFooter     bool          `yaml:"usage_footer"`     // append cost and token counts to final messages
+	StreamPartial   bool          `yaml:"stream_partial"`   // stream text into a live message as it's generated
+	DefaultModel    string        `yaml:"default_model"`    // model for chats without a /model choice, empty = CLI default
+	FallbackModel   string        `yaml:"fallback_model"`   // model to fall back to when the main model is overloaded
+	Models          []string      `yaml:"models"`           // models offered by /model
+
+	Defaults ChatOptions           `yaml:",inline"` // settings for every chat (allowed_tools, ...)
+	Chats    map[int64]ChatOptions `yaml:"chats"`   // per-chat overrides, keyed by chat ID
+}
+
+// ChatOptions holds claude settings that can be set globally and overridden per chat
+// Unset fields in a per-chat override inherit the global value
+type ChatOptions struct {
+	AllowedTools       []string `yaml:"allowed_tools"`        // --allowedTools, e.g. "Bash(git status:*)"
+	DisallowedTools    []string `yaml:"disallowed_tools"`     // --disallowedTools
+	AppendSystemPrompt string   `yaml:"append_system_prompt"` // --append-system-prompt
+	AddDirs            []string `yaml:"add_dirs"`             // --add-dir, extra directories tools may access
+	ExtraArgs          []string `yaml:"extra_args"`           // passed to claude verbatim
+	MessagePrefix      *string  `yaml:"message_prefix"`       // prepended to non-command messages, "" = none (default "/aria")
+}
+
+// DefaultMessagePrefix invokes the aria skill installed by `aria init`
+const DefaultMessagePrefix = "/aria"
+
+// Prefix returns the message prefix, falling back to DefaultMessagePrefix when unset
+func (o ChatOptions) Prefix() string {
+	if o.MessagePrefix == nil {
+		return DefaultMessagePrefix
+	}
+	return *o.MessagePrefix
+}
+
+// ForChat returns the global chat options with the chat's overrides applied
+func (c ClaudeConfig) ForChat(chatID int64) ChatOptions {
+	opts := c.Defaults
+	override, ok := c.Chats[chatID]
+	if !ok {
+		return opts
+	}
+	if override.AllowedTools != nil {
+		opts.AllowedTools = override.AllowedTools
+	}
+	if override.DisallowedTools != nil {
+		opts.DisallowedTools = override.DisallowedTools
+	}
+	if override.AppendSystemPrompt != "" {
+		opts.AppendSystemPrompt = override.AppendSystemPrompt
+	}
+	if override.AddDirs != nil {
+		opts.AddDirs = override.AddDirs
+	}
+	if override.ExtraArgs != nil {
+		opts.ExtraArgs = override.ExtraArgs
+	}
+	if override.MessagePrefix != nil {
+		opts.MessagePrefix = override.MessagePrefix
+	}
+	return opts
+}
+
+// DefaultModels are offered by /model when claude.models isn't set
+var DefaultModels = []string{"haiku", "sonnet", "opus"}
+
+// BudgetConfig holds daily spending limits in USD (0 = no limit)
+type BudgetConfig struct {
+	DailyUSD        float64           `yaml:"daily_usd"`          // limit across all chats
+	PerChatDailyUSD float64           `yaml:"per_chat_daily_usd"` // default limit for each chat
+	Chats           map[int64]float64 `yaml:"chats"`              // per-chat overrides, keyed by chat ID
+}
+
+// What happens to a permission prompt nobody answers in time
+const (
+	OnTimeoutDeny  = "deny"  // deny the tool call (default)
+	OnTimeoutAllow = "allow" // let the tool call run
+	OnTimeoutWait  = "wait"  // keep waiting for an answer
+)
+
+// DefaultPermissionTimeout is how long a permission prompt waits when
+// permissions.timeout isn't set
+const DefaultPermissionTimeout = 2 * time.Minute
+
+// PermissionsConfig holds permission prompt settings
+type PermissionsConfig struct {
+	Timeout   time.Duration     `yaml:"timeout"`    // how long a prompt waits for an answer, 0 = DefaultPermissionTimeout
+	OnTimeout string            `yaml:"on_timeout"` // deny, allow or wait, empty = deny
+	Tools     map[string]string `yaml:"tools"`      // per-tool on_timeout overrides, keyed by tool name
+}
+
+// TimeoutOrDefault returns the prompt timeout, falling back to DefaultPermissionTimeout
+func (p PermissionsConfig) TimeoutOrDefault() time.Duration {
+	if p.Timeout == 0 {
+		return DefaultPermissionTimeout
+	}
+	return p.Timeout
+}
+
+// OnTimeoutFor returns what happens when a tool's prompt times out
+func (p PermissionsConfig) OnTimeoutFor(toolName string) string {
+	if policy, ok := p.Tools[toolName]; ok {
+		return policy
+	}
+	if p.OnTimeout == "" {
+		return OnTimeoutDeny
+	}
+	return p.OnTimeout
+}
+
+// Waits reports whether any prompt can wait forever
+func (p PermissionsConfig) Waits() bool {
+	if p.OnTimeout == OnTimeoutWait {
+		return true
+	}
+	for _, policy := range p.Tools {
+		if policy == OnTimeoutWait {
+			return true
+		}
+	}
+	return false
+}
+
+// validOnTimeout reports whether s is an on_timeout policy
+func validOnTimeout(s string) bool {
+	return s == OnTimeoutDeny || s == OnTimeoutAllow || s == OnTimeoutWait
 }
 
 // Config holds the Aria configuration
 type Config struct {
-	Telegram  TelegramConfig `yaml:"telegram"`
-	Claude    ClaudeConfig   `yaml:"claude"`
-	Allowlist []int64        `yaml:"allowlist"` // Telegram user IDs allowed to use the bot
-	LogFile   string         `yaml:"log_file"`  // path to log file
-	Debug     bool           `yaml:"debug"`     // enable debug logging
+	Telegram      TelegramConfig      `yaml:"telegram"`
+	Slack         SlackConfig         `yaml:"slack"`
+	Matrix        MatrixConfig        `yaml:"matrix"`
+	Claude        ClaudeConfig        `yaml:"claude"`
+	Budget        BudgetConfig        `yaml:"budget"`
+	Permissions   PermissionsConfig   `yaml:"permissions"`
+	Transcription TranscriptionConfig `yaml:"transcription"`
+	Allowlist     []int64             `yaml:"allowlist"` // Telegram user IDs allowed to use the bot
+	LogFile       string              `yaml:"log_file"`  // path to log file
+	Debug         bool                `yaml:"debug"`     // enable debug logging
 }
 
+// secretTokenRegex matches the webhook secret tokens Telegram accepts
+var secretTokenRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 // Load reads and parses the config file from the given path
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -38,14 +222,80 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
-	if cfg.Telegram.Token == "" {
-		return nil, fmt.Errorf("telegram.token is required")
+	if cfg.Telegram.Token == "" && !cfg.Slack.Enabled() && !cfg.Matrix.Enabled() {
+		return nil, fmt.Errorf("telegram.token is required (or configure slack or matrix)")
 	}
 
-	if len(cfg.Allowlist) == 0 {
+	if cfg.Telegram.Token != "" && len(cfg.Allowlist) == 0 {
 		return nil, fmt.Errorf("allowlist cannot be empty")
 	}
 
+	if hook := cfg.Telegram.Webhook; hook.URL != "" {
+		if u, err := url.Parse(hook.URL); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("telegram.webhook.url must be an absolute URL")
+		}
+		if (hook.CertFile == "") != (hook.KeyFile == "") {
+			return nil, fmt.Errorf("telegram.webhook.cert_file and key_file must be set together")
+		}
+		if hook.UploadCert && hook.CertFile == "" {
+			return nil, fmt.Errorf("telegram.webhook.upload_cert needs cert_file")
+		}
+		if hook.SecretToken != "" && !secretTokenRegex.MatchString(hook.SecretToken) {
+			return nil, fmt.Errorf("telegram.webhook.secret_token must be 1-256 of A-Z, a-z, 0-9, _ and -")
+		}
+	}
+
+	if cfg.Slack.Enabled() {
+		if cfg.Slack.BotToken == "" || cfg.Slack.AppToken == "" {
+			return nil, fmt.Errorf("slack.bot_token and slack.app_token are both required")
+		}
+		if len(cfg.Slack.Allowlist) == 0 {
+			return nil, fmt.Errorf("slack.allowlist cannot be empty")
+		}
+	}
+
+	if cfg.Matrix.Enabled() {
+		if cfg.Matrix.Homeserver == "" || cfg.Matrix.AccessToken == "" {
+			return nil, fmt.Errorf("matrix.homeserver and matrix.access_token are both required")
+		}
+		if len(cfg.Matrix.Allowlist) == 0 {
+			return nil, fmt.Errorf("matrix.allowlist cannot be empty")
+		}
+	}
+
+	if cfg.Claude.IdleTimeout < 0 {
+		return nil, fmt.Errorf("claude.idle_timeout cannot be negative")
+	}
+
+	if cfg.Claude.MaxProcesses < 0 {
+		return nil, fmt.Errorf("claude.max_processes cannot be negative")
+	}
+
+	if len(cfg.Claude.Models) == 0 {
+		cfg.Claude.Models = DefaultModels
+	}
+
+	if cfg.Budget.DailyUSD < 0 || cfg.Budget.PerChatDailyUSD < 0 {
+		return nil, fmt.Errorf("budget limits cannot be negative")
+	}
+	for chatID, limit := range cfg.Budget.Chats {
+		if limit < 0 {
+			return nil, fmt.Errorf("budget.chats.%d cannot be negative", chatID)
+		}
+	}
+
+	if cfg.Permissions.Timeout < 0 {
+		return nil, fmt.Errorf("permissions.timeout cannot be negative")
+	}
+	if cfg.Permissions.OnTimeout != "" && !validOnTimeout(cfg.Permissions.OnTimeout) {
+		return nil, fmt.Errorf("permissions.on_timeout must be deny, allow or wait")
+	}
+	for tool, policy := range cfg.Permissions.Tools {
+		if !validOnTimeout(policy) {
+			return nil, fmt.Errorf("permissions.tools.%s must be deny, allow or wait", tool)
+		}
+	}
+
 	return &cfg, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -50,6 +51,37 @@ debug: true
 	}
 }
 
+func TestLoadIdlePolicy(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	content := `
+telegram:
+  token: "test-bot-token"
+allowlist:
+  - 123456789
+claude:
+  idle_timeout: "45m"
+  max_processes: 3
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Claude.IdleTimeout != 45*time.Minute {
+		t.Errorf("Claude.IdleTimeout = %v, want %v", cfg.Claude.IdleTimeout, 45*time.Minute)
+	}
+
+	if cfg.Claude.MaxProcesses != 3 {
+		t.Errorf("Claude.MaxProcesses = %d, want 3", cfg.Claude.MaxProcesses)
+	}
+}
+
 func TestLoadEmptyAllowlist(t *testing.T) {
 	dir := t.TempDir()
 	configPath := filepath.Join(dir, "config.yaml")
@@ -87,6 +119,143 @@ allowlist:
 	}
 }
 
+func TestLoadSlack(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"slack only", `
+slack:
+  bot_token: "xoxb-test"
+  app_token: "xapp-test"
+  allowlist: ["U012AB3CD"]
+`, false},
+		{"slack and telegram", `
+telegram:
+  token: "test-bot-token"
+allowlist: [123456789]
+slack:
+  bot_token: "xoxb-test"
+  app_token: "xapp-test"
+  allowlist: ["U012AB3CD"]
+`, false},
+		{"missing app token", `
+slack:
+  bot_token: "xoxb-test"
+  allowlist: ["U012AB3CD"]
+`, true},
+		{"empty slack allowlist", `
+slack:
+  bot_token: "xoxb-test"
+  app_token: "xapp-test"
+`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !cfg.Slack.Enabled() {
+				t.Error("Slack.Enabled() = false, want true")
+			}
+		})
+	}
+}
+
+func TestLoadMatrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"matrix only", `
+matrix:
+  homeserver: "https://matrix.example.com"
+  access_token: "syt_test"
+  allowlist: ["@me:example.com"]
+`, false},
+		{"missing access token", `
+matrix:
+  homeserver: "https://matrix.example.com"
+  allowlist: ["@me:example.com"]
+`, true},
+		{"empty matrix allowlist", `
+matrix:
+  homeserver: "https://matrix.example.com"
+  access_token: "syt_test"
+`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook string
+		wantErr bool
+	}{
+		{"url only", `
+    url: "https://aria.example.com/telegram"`, false},
+		{"self-signed", `
+    url: "https://203.0.113.1:8443/telegram"
+    cert_file: "cert.pem"
+    key_file: "key.pem"
+    upload_cert: true`, false},
+		{"relative url", `
+    url: "/telegram"`, true},
+		{"cert without key", `
+    url: "https://aria.example.com/telegram"
+    cert_file: "cert.pem"`, true},
+		{"upload without cert", `
+    url: "https://aria.example.com/telegram"
+    upload_cert: true`, true},
+		{"bad secret", `
+    url: "https://aria.example.com/telegram"
+    secret_token: "not allowed!"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+telegram:
+  token: "test-token"
+  webhook:` + tt.webhook + `
+allowlist: [123]
+`
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestLoadMissingFile(t *testing.T) {
 	_, err := Load("/nonexistent/config.yaml")
 	if err == nil {
@@ -118,3 +287,188 @@ func TestIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadModels(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	content := `
+telegram:
+  token: "test-bot-token"
+allowlist:
+  - 123456789
+claude:
+  default_model: "sonnet"
+  fallback_model: "haiku"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Claude.DefaultModel != "sonnet" {
+		t.Errorf("Claude.DefaultModel = %q, want %q", cfg.Claude.DefaultModel, "sonnet")
+	}
+
+	if cfg.Claude.FallbackModel != "haiku" {
+		t.Errorf("Claude.FallbackModel = %q, want %q", cfg.Claude.FallbackModel, "haiku")
+	}
+
+	if len(cfg.Claude.Models) != len(DefaultModels) {
+		t.Errorf("Claude.Models = %v, want %v", cfg.Claude.Models, DefaultModels)
+	}
+}
+
+func TestLoadPermissions(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	content := `
+telegram:
+  token: "test-bot-token"
+allowlist:
+  - 123456789
+permissions:
+  timeout: "10m"
+  on_timeout: "allow"
+  tools:
+    Bash: "wait"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := cfg.Permissions.TimeoutOrDefault(); got != 10*time.Minute {
+		t.Errorf("Permissions.TimeoutOrDefault() = %v, want %v", got, 10*time.Minute)
+	}
+	if got := cfg.Permissions.OnTimeoutFor("Read"); got != OnTimeoutAllow {
+		t.Errorf("OnTimeoutFor(Read) = %q, want %q", got, OnTimeoutAllow)
+	}
+	if got := cfg.Permissions.OnTimeoutFor("Bash"); got != OnTimeoutWait {
+		t.Errorf("OnTimeoutFor(Bash) = %q, want %q", got, OnTimeoutWait)
+	}
+	if !cfg.Permissions.Waits() {
+		t.Error("Permissions.Waits() = false, want true")
+	}
+
+	var defaults PermissionsConfig
+	if got := defaults.TimeoutOrDefault(); got != DefaultPermissionTimeout {
+		t.Errorf("default TimeoutOrDefault() = %v, want %v", got, DefaultPermissionTimeout)
+	}
+	if got := defaults.OnTimeoutFor("Bash"); got != OnTimeoutDeny {
+		t.Errorf("default OnTimeoutFor(Bash) = %q, want %q", got, OnTimeoutDeny)
+	}
+
+	for _, bad := range []string{
+		"permissions:\n  timeout: \"-1m\"\n",
+		"permissions:\n  on_timeout: \"ignore\"\n",
+		"permissions:\n  tools:\n    Bash: \"maybe\"\n",
+	} {
+		content := "telegram:\n  token: \"t\"\nallowlist:\n  - 1\n" + bad
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(configPath); err == nil {
+			t.Errorf("Load() with %q succeeded, want error", bad)
+		}
+	}
+}
+
+func TestClaudeConfigForChat(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	content := `
+telegram:
+  token: "test-bot-token"
+allowlist:
+  - 123456789
+claude:
+  allowed_tools: ["Read", "Bash(git status:*)"]
+  append_system_prompt: "Be brief."
+  add_dirs: ["/tmp/shared"]
+  chats:
+    42:
+      allowed_tools: []
+      extra_args: ["--max-turns", "5"]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	global := cfg.Claude.ForChat(1)
+	if len(global.AllowedTools) != 2 || global.AllowedTools[1] != "Bash(git status:*)" {
+		t.Errorf("ForChat(1).AllowedTools = %v, want [Read Bash(git status:*)]", global.AllowedTools)
+	}
+	if len(global.ExtraArgs) != 0 {
+		t.Errorf("ForChat(1).ExtraArgs = %v, want none", global.ExtraArgs)
+	}
+
+	chat := cfg.Claude.ForChat(42)
+	if len(chat.AllowedTools) != 0 {
+		t.Errorf("ForChat(42).AllowedTools = %v, want override to empty", chat.AllowedTools)
+	}
+	if chat.AppendSystemPrompt != "Be brief." {
+		t.Errorf("ForChat(42).AppendSystemPrompt = %q, want inherited %q", chat.AppendSystemPrompt, "Be brief.")
+	}
+	if len(chat.AddDirs) != 1 || chat.AddDirs[0] != "/tmp/shared" {
+		t.Errorf("ForChat(42).AddDirs = %v, want inherited [/tmp/shared]", chat.AddDirs)
+	}
+	if len(chat.ExtraArgs) != 2 {
+		t.Errorf("ForChat(42).ExtraArgs = %v, want [--max-turns 5]", chat.ExtraArgs)
+	}
+}
+
+func TestChatOptionsPrefix(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+
+	content := `
+telegram:
+  token: "test-bot-token"
+allowlist:
+  - 123456789
+claude:
+  chats:
+    42:
+      message_prefix: ""
+    43:
+      message_prefix: "/work"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		chatID int64
+		want   string
+	}{
+		{1, DefaultMessagePrefix},
+		{42, ""},
+		{43, "/work"},
+	}
+	for _, tt := range tests {
+		if got := cfg.Claude.ForChat(tt.chatID).Prefix(); got != tt.want {
+			t.Errorf("ForChat(%d).Prefix() = %q, want %q", tt.chatID, got, tt.want)
+		}
+	}
+}
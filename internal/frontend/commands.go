@@ -0,0 +1,56 @@
+package frontend
+
+// BuiltinCommands are Claude Code commands not exposed in the init event's slash_commands
+// Also includes ARIA-specific commands handled before Claude
+var BuiltinCommands = []string{
+	"clear",       // Clear conversation history
+	"compact",     // Compact conversation context
+	"help",        // Show help
+	"memory",      // Edit CLAUDE.md
+	"sessions",    // Switch between Claude sessions
+	"rebuild",     // Rebuild and restart ARIA
+	"exit",        // Exit for launchd restart
+	"cd",          // Change directory
+	"queue",       // Show or drop queued messages
+	"stop",        // Interrupt the running turn
+	"usage",       // Show token usage and cost
+	"model",       // Choose the Claude model
+	"permissions", // List and revoke permission rules
+}
+
+// CommandDescription returns a human-readable description for a command
+func CommandDescription(cmd string) string {
+	descriptions := map[string]string{
+		// Built-in commands
+		"clear":       "Clear conversation history",
+		"compact":     "Compact conversation context",
+		"help":        "Show available commands",
+		"memory":      "Edit CLAUDE.md memory file",
+		"exit":        "Restart ARIA via launchd",
+		"cd":          "Change working directory",
+		"queue":       "Show or drop queued messages",
+		"stop":        "Stop the current task",
+		"usage":       "Show token usage and cost",
+		"model":       "Choose the Claude model",
+		"permissions": "List and revoke permission rules",
+		// Skills
+		"commit":            "Stage and commit changes",
+		"calendar":          "View and create calendar events",
+		"mail":              "Read and manage email",
+		"gtd-daily-review":  "Morning GTD daily review",
+		"gtd-weekly-review": "Weekly GTD review",
+		"gtd-process-inbox": "Process Things 3 inbox",
+		"gtd-next-action":   "Get next action from Things 3",
+		"gtd-project":       "Work through a Things 3 project",
+		"gtd-clarify":       "Clarify today's tasks",
+		"things3":           "Things 3 task management",
+		"plan-to-project":   "Convert plan to Things 3 project",
+		"reflect":           "Reflect on session",
+		"browser":           "Browser automation",
+	}
+
+	if desc, ok := descriptions[cmd]; ok {
+		return desc
+	}
+	return "Claude skill"
+}
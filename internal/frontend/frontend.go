@@ -0,0 +1,122 @@
+// Package frontend defines the chat backend interface Aria runs against
+// Telegram is one implementation; the handlers, trackers and commands only
+// see a Frontend, so other chat services can be plugged in
+package frontend
+
+import (
+	"context"
+	"strings"
+)
+
+// maxReplyQuote caps how much of a replied-to message is quoted to Claude
+const maxReplyQuote = 2000
+
+// RespondFunc sends a markdown reply to the chat the message came from
+type RespondFunc func(text string, silent bool)
+
+// MessageHandler is called when a message is received from an allowed user
+// msgID is the frontend's ID for the user's message; text is the caption if
+// the message carries attachments. reply is the message it replies to, nil if none
+type MessageHandler func(ctx context.Context, chatID int64, userID int64, msgID int64, text string, attachments []Attachment, reply *Reply, respond RespondFunc)
+
+// Reply is the earlier message a user's message replies to
+type Reply struct {
+	MessageID int64  // frontend's ID for the replied-to message, 0 if unknown
+	Text      string // its text or caption, or just the part the user quoted
+	FromBot   bool
+}
+
+// Prompt prefixes text with the replied-to message as a quote, so Claude
+// knows what the user is responding to
+func (r *Reply) Prompt(text string) string {
+	quote := strings.TrimSpace(r.Text)
+	if quote == "" {
+		return text
+	}
+	if runes := []rune(quote); len(runes) > maxReplyQuote {
+		quote = string(runes[:maxReplyQuote]) + "…"
+	}
+
+	who := "my earlier message"
+	if r.FromBot {
+		who = "your earlier message"
+	}
+	var b strings.Builder
+	b.WriteString("Replying to " + who + ":\n")
+	for _, line := range strings.Split(quote, "\n") {
+		b.WriteString("> " + line + "\n")
+	}
+	b.WriteString("\n" + text)
+	return b.String()
+}
+
+// Attachment is a photo or file sent with a message
+type Attachment struct {
+	Name     string // file name, e.g. "screenshot.png"
+	MimeType string // e.g. "image/png", empty if unknown
+	Data     []byte
+}
+
+// imageTypes are the image formats Claude can see
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// IsImage reports whether the attachment is an image Claude can see
+func (a Attachment) IsImage() bool {
+	return imageTypes[a.MimeType]
+}
+
+// CallbackHandler is called when a keyboard button is pressed
+// Returns the text to show the user after the button press
+type CallbackHandler func(ctx context.Context, chatID int64, userID int64, data string) string
+
+// Frontend is a chat service Aria talks to users through
+// Message text is standard markdown (as Claude writes it); each frontend
+// converts it to its own format, falling back to plain text if that fails
+type Frontend interface {
+	// Start receives messages and button presses until ctx is cancelled
+	Start(ctx context.Context) error
+	SetHandler(h MessageHandler)
+	SetCallbackHandler(h CallbackHandler)
+
+	// SendMessage sends a message, silent=true without a notification sound
+	SendMessage(chatID int64, text string, silent bool) error
+	// SendNotification sends a silent message and returns its ID for later edits
+	SendNotification(chatID int64, text string) (int64, error)
+	// SendStatus sends a silent, subdued status message (tool progress) and returns its ID
+	SendStatus(chatID int64, text string) (int64, error)
+	// SendKeyboard sends a message with buttons and returns its ID
+	SendKeyboard(chatID int64, text string, keyboard Keyboard) (int64, error)
+	// SendAndPinMessage sends a silent message, pins it and returns its ID
+	SendAndPinMessage(chatID int64, text string) (int64, error)
+	// SendFile uploads a local file with a plain text caption, as a photo if
+	// it's an image the service shows inline
+	SendFile(chatID int64, path string, caption string) error
+
+	EditMessage(chatID int64, msgID int64, text string) error
+	// EditStatus replaces the text of a message sent with SendStatus
+	EditStatus(chatID int64, msgID int64, text string) error
+	DeleteMessage(chatID int64, msgID int64) error
+	PinMessage(chatID int64, msgID int64) error
+	UnpinMessage(chatID int64, msgID int64) error
+
+	// TypingLoop shows a typing indicator until the returned function is called
+	TypingLoop(chatID int64) func()
+	// RegisterCommands publishes Claude's slash commands (plus Aria's own) in the command menu
+	RegisterCommands(commands []string)
+}
+
+// Keyboard is a grid of buttons attached to a message
+type Keyboard struct {
+	Rows [][]Button
+}
+
+// Button is a keyboard button; Data is passed to the CallbackHandler when pressed
+type Button struct {
+	Text string
+	Data string
+}
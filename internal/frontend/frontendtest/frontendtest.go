@@ -0,0 +1,182 @@
+// Package frontendtest provides an in-memory frontend.Frontend for tests
+package frontendtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// Message is a message sent through the fake frontend
+type Message struct {
+	ID       int64
+	ChatID   int64
+	Text     string
+	Silent   bool
+	Status   bool // Sent with SendStatus
+	Keyboard *frontend.Keyboard
+	File     string // Path sent with SendFile, Text is its caption
+	Edits    int
+	Pinned   bool
+	Deleted  bool
+}
+
+// Frontend records everything sent to it
+// Sends to a chat listed in Fail return an error
+type Frontend struct {
+	Fail map[int64]bool
+
+	mu       sync.Mutex
+	messages []*Message
+	commands []string
+	typing   map[int64]int
+	nextID   int64
+}
+
+var _ frontend.Frontend = (*Frontend)(nil)
+
+// New creates an empty fake frontend
+func New() *Frontend {
+	return &Frontend{
+		Fail:   make(map[int64]bool),
+		typing: make(map[int64]int),
+	}
+}
+
+// Messages returns a copy of the messages sent to a chat, oldest first
+func (f *Frontend) Messages(chatID int64) []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var msgs []Message
+	for _, m := range f.messages {
+		if m.ChatID == chatID {
+			msgs = append(msgs, *m)
+		}
+	}
+	return msgs
+}
+
+// Commands returns the last registered command list
+func (f *Frontend) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands
+}
+
+// Typing returns how many typing loops are running in a chat
+func (f *Frontend) Typing(chatID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.typing[chatID]
+}
+
+// Start blocks until ctx is cancelled
+func (f *Frontend) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (f *Frontend) SetHandler(h frontend.MessageHandler) {}
+
+func (f *Frontend) SetCallbackHandler(h frontend.CallbackHandler) {}
+
+func (f *Frontend) SendMessage(chatID int64, text string, silent bool) error {
+	_, err := f.send(&Message{ChatID: chatID, Text: text, Silent: silent})
+	return err
+}
+
+func (f *Frontend) SendNotification(chatID int64, text string) (int64, error) {
+	return f.send(&Message{ChatID: chatID, Text: text, Silent: true})
+}
+
+func (f *Frontend) SendStatus(chatID int64, text string) (int64, error) {
+	return f.send(&Message{ChatID: chatID, Text: text, Silent: true, Status: true})
+}
+
+func (f *Frontend) SendKeyboard(chatID int64, text string, keyboard frontend.Keyboard) (int64, error) {
+	return f.send(&Message{ChatID: chatID, Text: text, Keyboard: &keyboard})
+}
+
+func (f *Frontend) SendAndPinMessage(chatID int64, text string) (int64, error) {
+	return f.send(&Message{ChatID: chatID, Text: text, Silent: true, Pinned: true})
+}
+
+func (f *Frontend) SendFile(chatID int64, path string, caption string) error {
+	_, err := f.send(&Message{ChatID: chatID, Text: caption, File: path})
+	return err
+}
+
+func (f *Frontend) EditMessage(chatID int64, msgID int64, text string) error {
+	return f.update(chatID, msgID, func(m *Message) {
+		m.Text = text
+		m.Edits++
+	})
+}
+
+func (f *Frontend) EditStatus(chatID int64, msgID int64, text string) error {
+	return f.EditMessage(chatID, msgID, text)
+}
+
+func (f *Frontend) DeleteMessage(chatID int64, msgID int64) error {
+	return f.update(chatID, msgID, func(m *Message) { m.Deleted = true })
+}
+
+func (f *Frontend) PinMessage(chatID int64, msgID int64) error {
+	return f.update(chatID, msgID, func(m *Message) { m.Pinned = true })
+}
+
+func (f *Frontend) UnpinMessage(chatID int64, msgID int64) error {
+	return f.update(chatID, msgID, func(m *Message) { m.Pinned = false })
+}
+
+func (f *Frontend) TypingLoop(chatID int64) func() {
+	f.mu.Lock()
+	f.typing[chatID]++
+	f.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			f.typing[chatID]--
+			f.mu.Unlock()
+		})
+	}
+}
+
+func (f *Frontend) RegisterCommands(commands []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = commands
+}
+
+// send stores a new message and returns its ID
+func (f *Frontend) send(m *Message) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Fail[m.ChatID] {
+		return 0, fmt.Errorf("chat %d: send failed", m.ChatID)
+	}
+	f.nextID++
+	m.ID = f.nextID
+	f.messages = append(f.messages, m)
+	return m.ID, nil
+}
+
+// update applies fn to a sent message
+func (f *Frontend) update(chatID int64, msgID int64, fn func(*Message)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, m := range f.messages {
+		if m.ChatID == chatID && m.ID == msgID && !m.Deleted {
+			fn(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("chat %d: message %d not found", chatID, msgID)
+}
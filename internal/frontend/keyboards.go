@@ -1,10 +1,10 @@
-package telegram
+package frontend
 
 import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/codegangsta/aria/internal/permissions"
 )
 
 // QuestionOption represents a single option in an AskUserQuestion
@@ -28,12 +28,12 @@ type AskUserQuestionInput struct {
 
 // CallbackData stores callback information for keyboard buttons
 type CallbackData struct {
-	Type        string `json:"t"`            // "q" for question, "o" for other, "s" for session
-	ToolID      string `json:"id,omitempty"` // Tool use ID to respond to
+	Type        string `json:"t"`            // "q" for question, "o" for other, "s" for session, "m" for model, "r" for reply
+	ToolID      string `json:"id,omitempty"` // Tool use ID (questions) or request ID (permissions) to respond to
 	QuestionIdx int    `json:"qi,omitempty"` // Which question (0-indexed)
 	OptionIdx   int    `json:"oi,omitempty"` // Which option selected (for answer type)
 	SessionID   string `json:"s,omitempty"`  // Session ID (for session switching)
-	Action      string `json:"a,omitempty"`  // Action: "r" resume, "f" fresh
+	Action      string `json:"a,omitempty"`  // Action: "r" resume, "f" fresh; for replies "s" switch, "h" here
 }
 
 // SessionDisplayInfo contains info needed to display a session in the keyboard
@@ -63,8 +63,8 @@ func ParseAskUserQuestion(input map[string]interface{}) (*AskUserQuestionInput,
 
 // BuildQuestionKeyboard creates an inline keyboard for a question
 // Returns the keyboard and a formatted question text
-func BuildQuestionKeyboard(toolID string, questionIdx int, q Question) (gotgbot.InlineKeyboardMarkup, string) {
-	var rows [][]gotgbot.InlineKeyboardButton
+func BuildQuestionKeyboard(toolID string, questionIdx int, q Question) (Keyboard, string) {
+	var rows [][]Button
 
 	// Add option buttons
 	for i, opt := range q.Options {
@@ -77,7 +77,7 @@ func BuildQuestionKeyboard(toolID string, questionIdx int, q Question) (gotgbot.
 
 		data, _ := json.Marshal(callbackData)
 
-		// Telegram callback_data has 64 byte limit, truncate tool ID if needed
+		// Keep button data within Telegram's 64 byte callback_data limit
 		dataStr := string(data)
 		if len(dataStr) > 64 {
 			// Use shorter tool ID
@@ -86,10 +86,10 @@ func BuildQuestionKeyboard(toolID string, questionIdx int, q Question) (gotgbot.
 			dataStr = string(data)
 		}
 
-		rows = append(rows, []gotgbot.InlineKeyboardButton{
+		rows = append(rows, []Button{
 			{
-				Text:         opt.Label,
-				CallbackData: dataStr,
+				Text: opt.Label,
+				Data: dataStr,
 			},
 		})
 	}
@@ -108,20 +108,17 @@ func BuildQuestionKeyboard(toolID string, questionIdx int, q Question) (gotgbot.
 		otherDataStr = string(otherDataBytes)
 	}
 
-	rows = append(rows, []gotgbot.InlineKeyboardButton{
+	rows = append(rows, []Button{
 		{
-			Text:         "Other...",
-			CallbackData: otherDataStr,
+			Text: "Other...",
+			Data: otherDataStr,
 		},
 	})
 
-	keyboard := gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: rows,
-	}
+	keyboard := Keyboard{Rows: rows}
 
-	// Format question text with header using MarkdownV2
-	// *text* is bold in MarkdownV2
-	text := fmt.Sprintf("*%s*\n%s", escapeMarkdownV2(q.Header), escapeMarkdownV2(q.Question))
+	// Format question text with a bold header
+	text := fmt.Sprintf("**%s**\n%s", q.Header, q.Question)
 
 	return keyboard, text
 }
@@ -142,40 +139,17 @@ type PermissionRequest struct {
 }
 
 // BuildPermissionKeyboard creates an inline keyboard for permission prompts
-// Returns the keyboard and a formatted message describing the permission request
-func BuildPermissionKeyboard(toolID string, toolName string, input map[string]interface{}) (gotgbot.InlineKeyboardMarkup, string) {
-	// Format the permission request message
-	var details string
-	switch toolName {
-	case "Write", "Edit":
-		if path, ok := input["file_path"].(string); ok {
-			details = fmt.Sprintf("File: %s", path)
-		}
-	case "Bash":
-		if cmd, ok := input["command"].(string); ok {
-			// Truncate long commands
-			if len(cmd) > 100 {
-				cmd = cmd[:97] + "..."
-			}
-			details = fmt.Sprintf("Command: %s", cmd)
-		}
-	default:
-		// Generic: show first few input keys
-		keys := make([]string, 0)
-		for k := range input {
-			keys = append(keys, k)
-			if len(keys) >= 3 {
-				break
-			}
-		}
-		if len(keys) > 0 {
-			details = fmt.Sprintf("Params: %v", keys)
-		}
-	}
-
-	text := fmt.Sprintf("*Permission Request*\nTool: %s", escapeMarkdownV2(toolName))
+// Returns the keyboard and a message previewing the call: the command, a diff
+// of an edit or the content of a write, and the working directory. A long
+// preview is cut short with a "Show more" button, unless expanded is set.
+// Commands and file paths get an "Edit" button to change them before allowing,
+// and allowAll adds a button that allows every pending request in the chat
+func BuildPermissionKeyboard(toolID string, toolName string, input map[string]interface{}, cwd string, expanded bool, allowAll bool) (Keyboard, string) {
+	details, truncated := permissionDetails(toolName, input, cwd, expanded)
+
+	text := fmt.Sprintf("**Permission Request**\nTool: %s", toolName)
 	if details != "" {
-		text += fmt.Sprintf("\n%s", escapeMarkdownV2(details))
+		text += fmt.Sprintf("\n%s", details)
 	}
 
 	// Create buttons: Allow, Allow Always, Deny
@@ -205,22 +179,63 @@ func BuildPermissionKeyboard(toolID string, toolName string, input map[string]in
 		return string(data)
 	}
 
-	keyboard := gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+	keyboard := Keyboard{
+		Rows: [][]Button{
 			{
-				{Text: "Allow", CallbackData: truncateCallback(&allowData)},
-				{Text: "Always", CallbackData: truncateCallback(&allowAlwaysData)},
-				{Text: "Deny", CallbackData: truncateCallback(&denyData)},
+				{Text: "Allow", Data: truncateCallback(&allowData)},
+				{Text: "Always", Data: truncateCallback(&allowAlwaysData)},
+				{Text: "Deny", Data: truncateCallback(&denyData)},
 			},
 		},
 	}
+	var extra []Button
+	if permissions.EditField(toolName) != "" {
+		editData := CallbackData{
+			Type:   "p",
+			ToolID: toolID,
+			Action: "e", // edit
+		}
+		extra = append(extra, Button{Text: "Edit", Data: truncateCallback(&editData)})
+	}
+	if truncated && !expanded {
+		moreData := CallbackData{
+			Type:   "p",
+			ToolID: toolID,
+			Action: "m", // show more
+		}
+		extra = append(extra, Button{Text: "Show more", Data: truncateCallback(&moreData)})
+	}
+	if len(extra) > 0 {
+		keyboard.Rows = append(keyboard.Rows, extra)
+	}
+	if allowAll {
+		allData := CallbackData{
+			Type:   "p",
+			ToolID: toolID,
+			Action: "all", // allow all pending
+		}
+		keyboard.Rows = append(keyboard.Rows, []Button{
+			{Text: "Allow all pending", Data: truncateCallback(&allData)},
+		})
+	}
 
 	return keyboard, text
 }
 
+// BuildEditKeyboard creates the Cancel button sent while the user is editing
+// a permission request's command or path
+func BuildEditKeyboard(toolID string) Keyboard {
+	cancelData, _ := json.Marshal(CallbackData{
+		Type:   "p",
+		ToolID: toolID,
+		Action: "c", // cancel edit
+	})
+	return Keyboard{Rows: [][]Button{{{Text: "Cancel", Data: string(cancelData)}}}}
+}
+
 // BuildSessionKeyboard creates an inline keyboard for session selection
-func BuildSessionKeyboard(sessions []SessionDisplayInfo) gotgbot.InlineKeyboardMarkup {
-	var rows [][]gotgbot.InlineKeyboardButton
+func BuildSessionKeyboard(sessions []SessionDisplayInfo) Keyboard {
+	var rows [][]Button
 
 	for _, s := range sessions {
 		// Format label: "project · summary · time"
@@ -237,10 +252,10 @@ func BuildSessionKeyboard(sessions []SessionDisplayInfo) gotgbot.InlineKeyboardM
 		}
 		data, _ := json.Marshal(callbackData)
 
-		rows = append(rows, []gotgbot.InlineKeyboardButton{
+		rows = append(rows, []Button{
 			{
-				Text:         label,
-				CallbackData: string(data),
+				Text: label,
+				Data: string(data),
 			},
 		})
 	}
@@ -252,14 +267,55 @@ func BuildSessionKeyboard(sessions []SessionDisplayInfo) gotgbot.InlineKeyboardM
 	}
 	freshDataBytes, _ := json.Marshal(freshData)
 
-	rows = append(rows, []gotgbot.InlineKeyboardButton{
+	rows = append(rows, []Button{
 		{
-			Text:         "Start Fresh",
-			CallbackData: string(freshDataBytes),
+			Text: "Start Fresh",
+			Data: string(freshDataBytes),
 		},
 	})
 
-	return gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: rows,
+	return Keyboard{Rows: rows}
+}
+
+// BuildReplyKeyboard asks whether to switch to the session a reply belongs to
+// before sending it, or send it in the current one
+func BuildReplyKeyboard() Keyboard {
+	switchData, _ := json.Marshal(CallbackData{Type: "r", Action: "s"})
+	hereData, _ := json.Marshal(CallbackData{Type: "r", Action: "h"})
+	return Keyboard{
+		Rows: [][]Button{
+			{
+				{Text: "Switch", Data: string(switchData)},
+				{Text: "Stay here", Data: string(hereData)},
+			},
+		},
 	}
 }
+
+// BuildModelKeyboard creates an inline keyboard for model selection
+// The current model is marked; OptionIdx indexes into models
+func BuildModelKeyboard(models []string, current string) Keyboard {
+	var rows [][]Button
+
+	for i, model := range models {
+		label := model
+		if model == current {
+			label = "● " + model
+		}
+
+		callbackData := CallbackData{
+			Type:      "m",
+			OptionIdx: i,
+		}
+		data, _ := json.Marshal(callbackData)
+
+		rows = append(rows, []Button{
+			{
+				Text: label,
+				Data: string(data),
+			},
+		})
+	}
+
+	return Keyboard{Rows: rows}
+}
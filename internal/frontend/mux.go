@@ -0,0 +1,188 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Route pairs a frontend with the chat IDs it owns
+// Owns == nil makes the frontend the default for chats no other route claims
+type Route struct {
+	Frontend Frontend
+	Owns     func(chatID int64) bool
+}
+
+// Mux runs several frontends as one, sending each chat's messages through
+// the frontend that owns its chat ID
+type Mux struct {
+	routes []Route
+}
+
+var _ Frontend = (*Mux)(nil)
+
+// NewMux creates a Mux over the given routes, checked in order
+func NewMux(routes ...Route) *Mux {
+	return &Mux{routes: routes}
+}
+
+// route returns the frontend that owns a chat
+func (m *Mux) route(chatID int64) (Frontend, error) {
+	var fallback Frontend
+	for _, r := range m.routes {
+		if r.Owns == nil {
+			if fallback == nil {
+				fallback = r.Frontend
+			}
+			continue
+		}
+		if r.Owns(chatID) {
+			return r.Frontend, nil
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("no frontend for chat %d", chatID)
+	}
+	return fallback, nil
+}
+
+// Start runs every frontend until ctx is cancelled or one of them fails
+func (m *Mux) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.routes))
+	for _, r := range m.routes {
+		wg.Add(1)
+		go func(fe Frontend) {
+			defer wg.Done()
+			if err := fe.Start(ctx); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(r.Frontend)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (m *Mux) SetHandler(h MessageHandler) {
+	for _, r := range m.routes {
+		r.Frontend.SetHandler(h)
+	}
+}
+
+func (m *Mux) SetCallbackHandler(h CallbackHandler) {
+	for _, r := range m.routes {
+		r.Frontend.SetCallbackHandler(h)
+	}
+}
+
+func (m *Mux) SendMessage(chatID int64, text string, silent bool) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.SendMessage(chatID, text, silent)
+}
+
+func (m *Mux) SendNotification(chatID int64, text string) (int64, error) {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return 0, err
+	}
+	return fe.SendNotification(chatID, text)
+}
+
+func (m *Mux) SendStatus(chatID int64, text string) (int64, error) {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return 0, err
+	}
+	return fe.SendStatus(chatID, text)
+}
+
+func (m *Mux) SendKeyboard(chatID int64, text string, keyboard Keyboard) (int64, error) {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return 0, err
+	}
+	return fe.SendKeyboard(chatID, text, keyboard)
+}
+
+func (m *Mux) SendAndPinMessage(chatID int64, text string) (int64, error) {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return 0, err
+	}
+	return fe.SendAndPinMessage(chatID, text)
+}
+
+func (m *Mux) SendFile(chatID int64, path string, caption string) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.SendFile(chatID, path, caption)
+}
+
+func (m *Mux) EditMessage(chatID int64, msgID int64, text string) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.EditMessage(chatID, msgID, text)
+}
+
+func (m *Mux) EditStatus(chatID int64, msgID int64, text string) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.EditStatus(chatID, msgID, text)
+}
+
+func (m *Mux) DeleteMessage(chatID int64, msgID int64) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.DeleteMessage(chatID, msgID)
+}
+
+func (m *Mux) PinMessage(chatID int64, msgID int64) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.PinMessage(chatID, msgID)
+}
+
+func (m *Mux) UnpinMessage(chatID int64, msgID int64) error {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return err
+	}
+	return fe.UnpinMessage(chatID, msgID)
+}
+
+func (m *Mux) TypingLoop(chatID int64) func() {
+	fe, err := m.route(chatID)
+	if err != nil {
+		return func() {}
+	}
+	return fe.TypingLoop(chatID)
+}
+
+func (m *Mux) RegisterCommands(commands []string) {
+	for _, r := range m.routes {
+		r.Frontend.RegisterCommands(commands)
+	}
+}
@@ -0,0 +1,328 @@
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Permission prompts show a short preview of what a tool will do; "Show more"
+// expands it up to maxPreviewChars, which keeps the whole message inside
+// Telegram's 4096 and Slack's 3000 character limits. Longer previews are sent
+// in parts of up to maxPreviewChars ahead of the prompt
+const (
+	previewLines    = 15
+	previewChars    = 800
+	maxPreviewChars = 2500
+)
+
+// diffContext is how many unchanged lines are kept around each change
+const diffContext = 3
+
+// maxDiffCells caps the LCS table; bigger edits are shown as a full replacement
+const maxDiffCells = 1 << 20
+
+// permissionDetails formats what a tool call will do, for a permission prompt
+// Returns the text and whether the preview was cut short
+func permissionDetails(toolName string, input map[string]interface{}, cwd string, expanded bool) (string, bool) {
+	lines, preview, lang := toolPreview(toolName, input, cwd)
+	preview, truncated := clip(preview, expanded)
+	if preview != "" {
+		lines = append(lines, codeBlock(lang, preview))
+	}
+	if truncated && expanded {
+		lines = append(lines, "(The full preview is above)")
+	}
+	return strings.Join(lines, "\n"), truncated
+}
+
+// PermissionPreview splits the full preview of a tool call into code blocks of
+// up to maxPreviewChars, for "Show more" to send ahead of the prompt
+// Returns nil if the preview fits in the expanded prompt
+func PermissionPreview(toolName string, input map[string]interface{}, cwd string) []string {
+	_, preview, lang := toolPreview(toolName, input, cwd)
+	if len(preview) <= maxPreviewChars {
+		return nil
+	}
+	var parts []string
+	for _, part := range splitPreview(preview, maxPreviewChars) {
+		parts = append(parts, codeBlock(lang, part))
+	}
+	return parts
+}
+
+// toolPreview returns the header lines of a permission prompt, then the
+// preview of what the tool call will do and its code block language
+func toolPreview(toolName string, input map[string]interface{}, cwd string) ([]string, string, string) {
+	var lines []string
+	if cwd != "" {
+		lines = append(lines, "Directory: "+cwd)
+	}
+
+	var preview, lang string
+	switch toolName {
+	case "Bash":
+		if desc, ok := input["description"].(string); ok && desc != "" {
+			lines = append(lines, "Description: "+oneLine(desc))
+		}
+		preview, _ = input["command"].(string)
+
+	case "Edit":
+		path, _ := input["file_path"].(string)
+		oldText, _ := input["old_string"].(string)
+		newText, _ := input["new_string"].(string)
+		file := "File: " + displayPath(path, cwd)
+		if all, _ := input["replace_all"].(bool); all {
+			file += " (every occurrence)"
+		}
+		lines = append(lines, file)
+		preview, lang = strings.Join(lineDiff(oldText, newText), "\n"), "diff"
+
+	case "MultiEdit":
+		path, _ := input["file_path"].(string)
+		lines = append(lines, "File: "+displayPath(path, cwd))
+		edits, _ := input["edits"].([]interface{})
+		var diff []string
+		for i, e := range edits {
+			edit, _ := e.(map[string]interface{})
+			oldText, _ := edit["old_string"].(string)
+			newText, _ := edit["new_string"].(string)
+			if i > 0 {
+				diff = append(diff, "@@")
+			}
+			diff = append(diff, lineDiff(oldText, newText)...)
+		}
+		preview, lang = strings.Join(diff, "\n"), "diff"
+
+	case "Write":
+		path, _ := input["file_path"].(string)
+		content, _ := input["content"].(string)
+		lines = append(lines, fmt.Sprintf("File: %s (%d lines)", displayPath(path, cwd), strings.Count(strings.TrimSuffix(content, "\n"), "\n")+1))
+		preview = content
+
+	default:
+		preview = formatInput(input)
+	}
+	return lines, strings.TrimSuffix(preview, "\n"), lang
+}
+
+// formatInput lists a tool's input as "key: value" lines, sorted by key
+func formatInput(input map[string]interface{}) string {
+	keys := make([]string, 0, len(input))
+	for k := range input {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		value, ok := input[k].(string)
+		if !ok {
+			data, _ := json.Marshal(input[k])
+			value = string(data)
+		}
+		lines = append(lines, k+": "+value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// clip shortens a preview to previewLines lines and previewChars characters,
+// and reports whether it cut anything. Expanded previews are kept whole up to
+// maxPreviewChars; past that they're sent in parts and clipped as usual
+func clip(s string, expanded bool) (string, bool) {
+	if expanded && len(s) <= maxPreviewChars {
+		return s, false
+	}
+	limit := previewChars
+
+	truncated := false
+	if lines := strings.Split(s, "\n"); len(lines) > previewLines {
+		s = strings.Join(lines[:previewLines], "\n")
+		truncated = true
+	}
+	if len(s) > limit {
+		s = strings.ToValidUTF8(s[:limit], "")
+		truncated = true
+	}
+	if truncated {
+		s += "\n…"
+	}
+	return s, truncated
+}
+
+// splitPreview splits s into parts of up to limit bytes, at line breaks
+// where it can and at character boundaries inside longer lines
+func splitPreview(s string, limit int) []string {
+	var parts []string
+	var part strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		if part.Len() > 0 && part.Len()+1+len(line) > limit {
+			parts = append(parts, part.String())
+			part.Reset()
+		}
+		for len(line) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			parts = append(parts, line[:cut])
+			line = line[cut:]
+		}
+		if part.Len() > 0 {
+			part.WriteByte('\n')
+		}
+		part.WriteString(line)
+	}
+	if part.Len() > 0 {
+		parts = append(parts, part.String())
+	}
+	return parts
+}
+
+// codeBlock fences text as a markdown code block
+// Backtick fences inside are broken up with a zero-width space so they
+// can't close the block early
+func codeBlock(lang, text string) string {
+	return "```" + lang + "\n" + strings.ReplaceAll(text, "```", "`\u200b``") + "\n```"
+}
+
+// displayPath shows a path relative to cwd when it's inside it
+func displayPath(path, cwd string) string {
+	if cwd == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// oneLine collapses whitespace and caps text at 200 characters
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 200 {
+		s = strings.ToValidUTF8(s[:197], "") + "..."
+	}
+	return s
+}
+
+// diffLine is one line of a diff; op is '-', '+' or ' '
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns a unified-style diff of two texts: lines prefixed with
+// "-", "+" or " ", with diffContext unchanged lines around each change and
+// "@@" where unchanged lines were skipped
+func lineDiff(oldText, newText string) []string {
+	a, b := splitLines(oldText), splitLines(newText)
+
+	// Only the middle, past the common prefix and suffix, needs the LCS
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var diff []diffLine
+	for _, l := range a[:pre] {
+		diff = append(diff, diffLine{' ', l})
+	}
+	diff = append(diff, lcsDiff(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		diff = append(diff, diffLine{' ', l})
+	}
+
+	// Keep the context around changes
+	keep := make([]bool, len(diff))
+	for i, l := range diff {
+		if l.op != ' ' {
+			for k := max(0, i-diffContext); k <= min(len(diff)-1, i+diffContext); k++ {
+				keep[k] = true
+			}
+		}
+	}
+
+	var out []string
+	skipped := false
+	for i, l := range diff {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out = append(out, "@@")
+			skipped = false
+		}
+		out = append(out, string(l.op)+l.text)
+	}
+	return out
+}
+
+// lcsDiff diffs two line slices by longest common subsequence
+func lcsDiff(a, b []string) []diffLine {
+	var diff []diffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			diff = append(diff, diffLine{'-', l})
+		}
+		for _, l := range b {
+			diff = append(diff, diffLine{'+', l})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{'-', a[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, diffLine{'+', b[j]})
+	}
+	return diff
+}
+
+// splitLines splits text into lines, without a trailing empty line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,130 @@
+package frontend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		old, new string
+		want     []string
+	}{
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: []string{" a", "-b", "+B", " c"},
+		},
+		{
+			name: "insertion",
+			old:  "a\nc",
+			new:  "a\nb\nc",
+			want: []string{" a", "+b", " c"},
+		},
+		{
+			name: "deletion",
+			old:  "a\nb",
+			new:  "",
+			want: []string{"-a", "-b"},
+		},
+		{
+			name: "distant context skipped",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10",
+			new:  "1\n2\n3\n4\n5\n6\n7\n8\n9\nten",
+			want: []string{"@@", " 7", " 8", " 9", "-10", "+ten"},
+		},
+		{
+			name: "two hunks",
+			old:  "x\n1\n2\n3\n4\n5\n6\n7\n8\ny",
+			new:  "X\n1\n2\n3\n4\n5\n6\n7\n8\nY",
+			want: []string{"-x", "+X", " 1", " 2", " 3", "@@", " 6", " 7", " 8", "-y", "+Y"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineDiff(tt.old, tt.new)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("lineDiff() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPermissionDetails(t *testing.T) {
+	cwd := "/home/me/project"
+
+	edit, truncated := permissionDetails("Edit", map[string]interface{}{
+		"file_path":  "/home/me/project/main.go",
+		"old_string": "x := 1",
+		"new_string": "x := 2",
+	}, cwd, false)
+	want := "Directory: /home/me/project\nFile: main.go\n```diff\n-x := 1\n+x := 2\n```"
+	if edit != want || truncated {
+		t.Errorf("Edit details = %q, %v; want %q", edit, truncated, want)
+	}
+
+	write, _ := permissionDetails("Write", map[string]interface{}{
+		"file_path": "/tmp/notes.md",
+		"content":   "# Notes\n```go\nfmt.Println()\n```\n",
+	}, cwd, false)
+	if !strings.Contains(write, "File: /tmp/notes.md (4 lines)") || strings.Count(write, "```") != 2 {
+		t.Errorf("Write details = %q, want the absolute path and one code block", write)
+	}
+
+	long := strings.Repeat("echo hello && ", 100) + "echo done"
+	short, truncated := permissionDetails("Bash", map[string]interface{}{"command": long}, "", false)
+	if !truncated || strings.Contains(short, "echo done") {
+		t.Errorf("long command wasn't cut short: %q", short)
+	}
+	full, truncated := permissionDetails("Bash", map[string]interface{}{"command": long}, "", true)
+	if truncated || !strings.Contains(full, "echo done") {
+		t.Errorf("expanded command = %q, %v; want all of it", full, truncated)
+	}
+
+	huge := strings.Repeat("echo hello && ", 300) + "echo done"
+	full, truncated = permissionDetails("Bash", map[string]interface{}{"command": huge}, "", true)
+	if !truncated || strings.Contains(full, "echo done") || !strings.Contains(full, "full preview is above") {
+		t.Errorf("expanded command past the limit = %q, %v; want it cut short", full, truncated)
+	}
+	parts := PermissionPreview("Bash", map[string]interface{}{"command": huge}, "")
+	var joined string
+	for _, part := range parts {
+		if len(part) > maxPreviewChars+len("```\n\n```") {
+			t.Errorf("preview part is %d bytes, want at most %d", len(part), maxPreviewChars)
+		}
+		joined += strings.TrimSuffix(strings.TrimPrefix(part, "```\n"), "\n```")
+	}
+	if len(parts) < 2 || joined != huge {
+		t.Errorf("PermissionPreview() = %d parts, want all of the command across several", len(parts))
+	}
+	if parts := PermissionPreview("Bash", map[string]interface{}{"command": long}, ""); parts != nil {
+		t.Errorf("PermissionPreview() = %q for a preview that fits in the prompt, want nil", parts)
+	}
+
+	other, _ := permissionDetails("WebFetch", map[string]interface{}{"url": "https://go.dev", "prompt": "summarize"}, "", false)
+	if other != "```\nprompt: summarize\nurl: https://go.dev\n```" {
+		t.Errorf("generic details = %q", other)
+	}
+}
+
+func TestSplitPreview(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		in    string
+		limit int
+		want  []string
+	}{
+		{"fits", "ab\ncd", 10, []string{"ab\ncd"}},
+		{"at line breaks", "ab\ncd\nef", 5, []string{"ab\ncd", "ef"}},
+		{"long line", "abcdefg\nh", 3, []string{"abc", "def", "g\nh"}},
+		{"multibyte", "aéé", 4, []string{"aé", "é"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitPreview(tt.in, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitPreview(%q, %d) = %q, want %q", tt.in, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
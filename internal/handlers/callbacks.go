@@ -1,10 +1,11 @@
 package handlers
 
 import (
+	"fmt"
 	"log/slog"
 
 	"github.com/codegangsta/aria/internal/claude"
-	"github.com/codegangsta/aria/internal/telegram"
+	"github.com/codegangsta/aria/internal/frontend"
 	"github.com/codegangsta/aria/internal/trackers"
 	"github.com/codegangsta/aria/internal/types"
 )
@@ -13,11 +14,12 @@ import (
 // This consolidates the duplicate callback logic from main message handler
 // and callback handler into a single reusable builder.
 type CallbackBuilder struct {
-	ChatID     int64
-	TrackerMgr *trackers.Manager
-	Bot        *telegram.Bot
-	SendFn     func(text string, silent bool)
-	Logger     *slog.Logger
+	ChatID      int64
+	TrackerMgr  *trackers.Manager
+	Frontend    frontend.Frontend
+	SendFn      func(text string, silent bool)
+	Logger      *slog.Logger
+	UsageFooter bool // Append the turn's cost and tokens to the final message
 }
 
 // Build creates ResponseCallbacks that route events to the appropriate handlers.
@@ -27,11 +29,28 @@ func (b *CallbackBuilder) Build() claude.ResponseCallbacks {
 		logger = slog.Default()
 	}
 
+	// Footer for the final message, filled in from the result event
+	var footer string
+
 	return claude.ResponseCallbacks{
 		OnMessage: func(text string, isFinal bool) {
 			// Flush and clear tool tracker before sending text to start new tool group
 			b.TrackerMgr.ToolTracker(b.ChatID).FlushAndClear()
 
+			if isFinal && footer != "" {
+				text += "\n\n" + footer
+			}
+
+			// Streamed blocks are finished in place, except the final message
+			// which is resent so it arrives with sound
+			if b.TrackerMgr.StreamingMessage(b.ChatID).Finish(text, !isFinal) {
+				logger.Debug("finished streamed response",
+					"chat_id", b.ChatID,
+					"text_length", len(text),
+				)
+				return
+			}
+
 			silent := !isFinal // Silent for intermediate messages, sound for final
 			b.SendFn(text, silent)
 
@@ -42,6 +61,15 @@ func (b *CallbackBuilder) Build() claude.ResponseCallbacks {
 			)
 		},
 
+		OnPartialText: func(text string) {
+			// Close the current tool group so streamed text appears below it
+			tools := b.TrackerMgr.ToolTracker(b.ChatID)
+			if tools.HasPendingTools() {
+				tools.FlushAndClear()
+			}
+			b.TrackerMgr.StreamingMessage(b.ChatID).Update(text)
+		},
+
 		OnTodoUpdate: func(todos []types.Todo) {
 			b.TrackerMgr.ProgressTracker(b.ChatID).Update(todos)
 			logger.Debug("todo update",
@@ -51,7 +79,7 @@ func (b *CallbackBuilder) Build() claude.ResponseCallbacks {
 		},
 
 		OnToolUse: func(tool types.ToolUse) {
-			// Handle AskUserQuestion specially - send inline keyboard
+			// Handle AskUserQuestion specially - send a keyboard
 			if tool.Name == "AskUserQuestion" {
 				b.handleAskUserQuestion(tool, logger)
 				return
@@ -85,12 +113,35 @@ func (b *CallbackBuilder) Build() claude.ResponseCallbacks {
 				"denials", denials,
 			)
 		},
+
+		OnResult: func(usage types.Usage) {
+			if b.UsageFooter {
+				footer = "— " + claude.FormatUsageFooter(usage)
+			}
+		},
+
+		OnBudgetWarning: func(warning string) {
+			// Not silent - the user should notice before the hard stop
+			if err := b.Frontend.SendMessage(b.ChatID, warning, false); err != nil {
+				logger.Warn("failed to send budget warning", "chat_id", b.ChatID, "error", err)
+			}
+		},
+
+		// Runs before the next queued turn starts, so it can't clear that turn's trackers
+		OnTurnEnd: b.ClearTrackers,
+
+		OnQueued: func(ahead int) {
+			// Let the user know the message is waiting behind a running turn
+			if err := b.Frontend.SendMessage(b.ChatID, fmt.Sprintf("Queued (%d ahead)", ahead), true); err != nil {
+				logger.Warn("failed to send queued notice", "chat_id", b.ChatID, "error", err)
+			}
+		},
 	}
 }
 
-// handleAskUserQuestion parses the tool input and sends an inline keyboard
+// handleAskUserQuestion parses the tool input and sends a keyboard
 func (b *CallbackBuilder) handleAskUserQuestion(tool types.ToolUse, logger *slog.Logger) {
-	parsed, err := telegram.ParseAskUserQuestion(tool.Input)
+	parsed, err := frontend.ParseAskUserQuestion(tool.Input)
 	if err != nil {
 		logger.Error("failed to parse AskUserQuestion", "error", err)
 		return
@@ -99,8 +150,8 @@ func (b *CallbackBuilder) handleAskUserQuestion(tool types.ToolUse, logger *slog
 	// Send keyboard for first question and store pending question
 	if len(parsed.Questions) > 0 {
 		q := parsed.Questions[0]
-		keyboard, text := telegram.BuildQuestionKeyboard(tool.ID, 0, q)
-		msgID, err := b.Bot.SendQuestionKeyboard(b.ChatID, text, keyboard)
+		keyboard, text := frontend.BuildQuestionKeyboard(tool.ID, 0, q)
+		msgID, err := b.Frontend.SendKeyboard(b.ChatID, text, keyboard)
 		if err != nil {
 			logger.Error("failed to send question keyboard",
 				"chat_id", b.ChatID,
@@ -126,9 +177,11 @@ func (b *CallbackBuilder) handleAskUserQuestion(tool types.ToolUse, logger *slog
 	)
 }
 
-// ClearTrackers clears both tool and progress trackers for a chat.
-// Should be called after a response is complete.
+// ClearTrackers clears the tool and progress trackers and any live
+// streaming message for a chat.
+// Called from OnTurnEnd once a response is complete.
 func (b *CallbackBuilder) ClearTrackers() {
 	b.TrackerMgr.ClearToolTracker(b.ChatID)
 	b.TrackerMgr.ClearProgressTracker(b.ChatID)
+	b.TrackerMgr.ClearStream(b.ChatID)
 }
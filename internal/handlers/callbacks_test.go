@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/aria/internal/claude"
+	"github.com/codegangsta/aria/internal/claude/claudetest"
+	"github.com/codegangsta/aria/internal/frontend/frontendtest"
+	"github.com/codegangsta/aria/internal/trackers"
+	"github.com/codegangsta/aria/internal/types"
+)
+
+const testChat = 42
+
+// envFakeClaude makes the test binary act as the claude CLI
+const envFakeClaude = "ARIA_TEST_FAKE_CLAUDE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envFakeClaude) == "1" {
+		claudetest.Main()
+	}
+	os.Exit(m.Run())
+}
+
+// newBuilder returns a CallbackBuilder wired to a fake frontend
+// Text passed to SendFn is recorded in sent
+func newBuilder(fe *frontendtest.Frontend, sent *[]string) *CallbackBuilder {
+	return &CallbackBuilder{
+		ChatID:     testChat,
+		TrackerMgr: trackers.NewManager(fe),
+		Frontend:   fe,
+		SendFn: func(text string, silent bool) {
+			*sent = append(*sent, text)
+		},
+	}
+}
+
+func TestOnMessageFinalFooter(t *testing.T) {
+	fe := frontendtest.New()
+	var sent []string
+	b := newBuilder(fe, &sent)
+	b.UsageFooter = true
+
+	cb := b.Build()
+	cb.OnResult(types.Usage{CostUSD: 0.5, InputTokens: 1000})
+	cb.OnMessage("done", true)
+
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	if want := "done\n\n— $0.50"; !strings.HasPrefix(sent[0], want) {
+		t.Errorf("final message = %q, want prefix %q", sent[0], want)
+	}
+}
+
+func TestOnPartialTextFinishesInPlace(t *testing.T) {
+	fe := frontendtest.New()
+	var sent []string
+	b := newBuilder(fe, &sent)
+
+	cb := b.Build()
+	cb.OnPartialText("thinking")
+	cb.OnMessage("thinking about it", false)
+
+	msgs := fe.Messages(testChat)
+	if len(msgs) != 1 || msgs[0].Text != "thinking about it" {
+		t.Fatalf("messages = %+v, want the streamed message edited to the full text", msgs)
+	}
+	if len(sent) != 0 {
+		t.Errorf("sent = %q, want nothing resent", sent)
+	}
+}
+
+func TestOnToolUseAskUserQuestion(t *testing.T) {
+	fe := frontendtest.New()
+	var sent []string
+	b := newBuilder(fe, &sent)
+
+	b.Build().OnToolUse(types.ToolUse{
+		ID:   "toolu_q",
+		Name: "AskUserQuestion",
+		Input: map[string]interface{}{
+			"questions": []interface{}{
+				map[string]interface{}{
+					"question": "Which color?",
+					"header":   "Color",
+					"options": []interface{}{
+						map[string]interface{}{"label": "Red"},
+						map[string]interface{}{"label": "Blue"},
+					},
+				},
+			},
+		},
+	})
+
+	msgs := fe.Messages(testChat)
+	if len(msgs) != 1 || msgs[0].Keyboard == nil {
+		t.Fatalf("messages = %+v, want one keyboard", msgs)
+	}
+	if want := "**Color**\nWhich color?"; msgs[0].Text != want {
+		t.Errorf("keyboard text = %q, want %q", msgs[0].Text, want)
+	}
+	var labels []string
+	for _, row := range msgs[0].Keyboard.Rows {
+		for _, button := range row {
+			labels = append(labels, button.Text)
+		}
+	}
+	if got := strings.Join(labels, ","); got != "Red,Blue,Other..." {
+		t.Errorf("buttons = %s, want Red,Blue,Other...", got)
+	}
+
+	pending := b.TrackerMgr.GetQuestion(testChat)
+	if pending == nil {
+		t.Fatal("no pending question stored")
+	}
+	if pending.ToolID != "toolu_q" || pending.MessageID != msgs[0].ID || len(pending.Questions) != 1 {
+		t.Errorf("pending = %+v, want toolu_q on message %d", pending, msgs[0].ID)
+	}
+}
+
+func TestOnToolUseSendFailure(t *testing.T) {
+	fe := frontendtest.New()
+	fe.Fail[testChat] = true
+	var sent []string
+	b := newBuilder(fe, &sent)
+
+	b.Build().OnToolUse(types.ToolUse{
+		ID:   "toolu_q",
+		Name: "AskUserQuestion",
+		Input: map[string]interface{}{
+			"questions": []interface{}{
+				map[string]interface{}{"question": "Which color?", "header": "Color"},
+			},
+		},
+	})
+
+	if pending := b.TrackerMgr.GetQuestion(testChat); pending != nil {
+		t.Errorf("pending = %+v, want none when the keyboard failed to send", pending)
+	}
+}
+
+func TestToolStatus(t *testing.T) {
+	fe := frontendtest.New()
+	var sent []string
+	b := newBuilder(fe, &sent)
+
+	cb := b.Build()
+	cb.OnToolUse(types.ToolUse{ID: "toolu_1", Name: "Bash", Input: map[string]interface{}{"command": "go test"}})
+	cb.OnToolResult(types.ToolResult{ToolID: "toolu_1"})
+
+	msgs := fe.Messages(testChat)
+	if len(msgs) != 1 || !msgs[0].Status {
+		t.Fatalf("messages = %+v, want one status message", msgs)
+	}
+	if want := "✓ Running `go test`"; msgs[0].Text != want {
+		t.Errorf("status = %q, want %q", msgs[0].Text, want)
+	}
+}
+
+func TestOnQueued(t *testing.T) {
+	fe := frontendtest.New()
+	var sent []string
+	b := newBuilder(fe, &sent)
+
+	b.Build().OnQueued(2)
+
+	msgs := fe.Messages(testChat)
+	if len(msgs) != 1 || msgs[0].Text != "Queued (2 ahead)" || !msgs[0].Silent {
+		t.Errorf("messages = %+v, want a silent queued notice", msgs)
+	}
+}
+
+func TestQueuedTurnKeepsTrackers(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.jsonl")
+	if err := os.WriteFile(script, []byte(`
+{"fake":"turn"}
+{"fake":"sleep","ms":200}
+{"fake":"reply","text":"one"}
+{"fake":"turn"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go test"}}]},"parent_tool_use_id":null,"session_id":"{{session_id}}"}
+{"fake":"sleep","ms":500}
+{"fake":"reply","text":"two"}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envFakeClaude, "1")
+	t.Setenv(claudetest.EnvScript, script)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := claude.NewManager(exe, false, true, slog.Default())
+	defer manager.Shutdown()
+
+	fe := frontendtest.New()
+	var sent1, sent2 []string
+	first := newBuilder(fe, &sent1)
+	second := newBuilder(fe, &sent2)
+	second.TrackerMgr = first.TrackerMgr
+
+	// The first turn takes a while to wrap up, which is when a queued turn
+	// started too early would lose its trackers
+	cb1 := first.Build()
+	cb1.OnTurnEnd = func() {
+		time.Sleep(100 * time.Millisecond)
+		first.ClearTrackers()
+	}
+	queued := make(chan struct{})
+	toolStarted := make(chan struct{})
+	cb2 := second.Build()
+	cb2.OnQueued = func(int) { close(queued) }
+	onToolUse := cb2.OnToolUse
+	cb2.OnToolUse = func(tool types.ToolUse) {
+		onToolUse(tool)
+		close(toolStarted)
+	}
+
+	done1 := make(chan error, 1)
+	go func() { done1 <- manager.Send(context.Background(), testChat, "one", nil, cb1) }()
+	for !manager.Busy(testChat) {
+		time.Sleep(time.Millisecond)
+	}
+	done2 := make(chan error, 1)
+	go func() { done2 <- manager.Send(context.Background(), testChat, "two", nil, cb2) }()
+
+	for _, ch := range []chan struct{}{queued, toolStarted} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("second turn never got going")
+		}
+	}
+	if err := <-done1; err != nil {
+		t.Fatal(err)
+	}
+	if !first.TrackerMgr.ToolTracker(testChat).HasPendingTools() {
+		t.Error("the first turn cleared the second turn's tool tracker")
+	}
+
+	if err := <-done2; err != nil {
+		t.Fatal(err)
+	}
+	if len(sent1) != 1 || sent1[0] != "one" || len(sent2) != 1 || sent2[0] != "two" {
+		t.Errorf("sent %q and %q, want one and two", sent1, sent2)
+	}
+	if first.TrackerMgr.ToolTracker(testChat).HasPendingTools() {
+		t.Error("tool tracker still pending after the second turn")
+	}
+}
@@ -0,0 +1,101 @@
+// Package inbox saves attachments sent to a chat under its working
+// directory, so Claude can read them with its own tools
+package inbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// Dir returns a chat's inbox, relative to the chat's working directory
+func Dir(chatID int64) string {
+	return filepath.Join(".aria", "inbox", strconv.FormatInt(chatID, 10))
+}
+
+// Save writes attachments into the chat's inbox under cwd (empty = the
+// current directory) and returns their paths relative to cwd
+// Files are prefixed with the time so repeated names don't collide
+func Save(cwd string, chatID int64, attachments []frontend.Attachment, now time.Time) ([]string, error) {
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	dir := Dir(chatID)
+	if err := os.MkdirAll(filepath.Join(cwd, dir), 0755); err != nil {
+		return nil, fmt.Errorf("creating inbox: %w", err)
+	}
+
+	paths := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		path, err := create(filepath.Join(cwd, dir), now.Format("20060102-150405-")+cleanName(a.Name), a.Data)
+		if err != nil {
+			return nil, fmt.Errorf("saving %s: %w", a.Name, err)
+		}
+		paths = append(paths, filepath.Join(dir, path))
+	}
+	return paths, nil
+}
+
+// create writes a new file in dir, numbering the name if it's taken
+// Returns the file's name
+func create(dir string, name string, data []byte) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return name, f.Close()
+	}
+}
+
+// cleanName makes a sent file name safe to use in the inbox
+// Directories are stripped and control characters dropped
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ' || r == 0x7f:
+			return -1
+		case r == '/' || r == '\\':
+			return '_'
+		}
+		return r
+	}, filepath.Base(name))
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+// Prompt is the message sent to Claude for attachments: the caption, then
+// where the files were saved
+func Prompt(caption string, paths []string) string {
+	var b strings.Builder
+	if caption != "" {
+		b.WriteString(caption)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Attached files (saved in the working directory):")
+	for _, p := range paths {
+		b.WriteString("\n- ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package inbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"notes.txt", "notes.txt"},
+		{"../x", "x"},
+		{"../../etc/passwd", "passwd"},
+		{"a/b", "b"},
+		{`a\b`, "a_b"},
+		{"..", "file"},
+		{".", "file"},
+		{"", "file"},
+		{"\x00\x1b\n", "file"},
+		{"re\tport\x7f.pdf", "report.pdf"},
+	} {
+		if got := cleanName(tt.in); got != tt.want {
+			t.Errorf("cleanName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for i, want := range []string{"notes.txt", "notes-1.txt", "notes-2.txt"} {
+		data := []byte{byte('a' + i)}
+		got, err := create(dir, "notes.txt", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("create #%d = %q, want %q", i+1, got, want)
+		}
+		if saved, _ := os.ReadFile(filepath.Join(dir, want)); string(saved) != string(data) {
+			t.Errorf("%s = %q, want %q", want, saved, data)
+		}
+	}
+
+	// Names without an extension are numbered at the end
+	for _, want := range []string{"Makefile", "Makefile-1"} {
+		if got, err := create(dir, "Makefile", nil); err != nil || got != want {
+			t.Errorf("create(Makefile) = %q, %v, want %q", got, err, want)
+		}
+	}
+}
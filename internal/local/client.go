@@ -0,0 +1,78 @@
+package local
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// Client is a terminal attached to a daemon chat
+type Client struct {
+	ChatID int64
+
+	conn    net.Conn
+	scanner *bufio.Scanner
+	enc     *json.Encoder
+}
+
+// Dial connects to the daemon's socket and attaches to a chat (0 = the local chat)
+func Dial(path string, chatID int64) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to aria (is it running?): %w", err)
+	}
+
+	c := &Client{
+		conn:    conn,
+		scanner: bufio.NewScanner(conn),
+		enc:     json.NewEncoder(conn),
+	}
+	c.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if err := c.enc.Encode(Message{Type: TypeAttach, ChatID: chatID}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	attached, err := c.Receive()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("attaching: %w", err)
+	}
+	if attached.Type != TypeAttached {
+		conn.Close()
+		return nil, fmt.Errorf("attaching: unexpected %q", attached.Type)
+	}
+	c.ChatID = attached.ChatID
+	return c, nil
+}
+
+// Send sends a message (or /command) to the chat
+func (c *Client) Send(text string) error {
+	return c.enc.Encode(Message{Type: TypeMessage, Text: text})
+}
+
+// Press presses a keyboard button
+func (c *Client) Press(button string) error {
+	return c.enc.Encode(Message{Type: TypePress, Data: button})
+}
+
+// Receive blocks until the daemon sends a message
+func (c *Client) Receive() (Message, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return Message{}, err
+		}
+		return Message{}, fmt.Errorf("aria closed the connection")
+	}
+	var msg Message
+	if err := json.Unmarshal(c.scanner.Bytes(), &msg); err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+// Close detaches from the chat
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
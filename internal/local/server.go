@@ -0,0 +1,362 @@
+// Package local is the terminal frontend: the daemon serves chats over a
+// Unix socket and `aria chat` attaches to them
+//
+// Messages are JSON lines. A client first sends an attach for a chat ID
+// (0 = the local chat) and then receives everything sent to that chat, so
+// attaching to a Telegram chat's ID continues that conversation from the
+// terminal until the client disconnects.
+package local
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// ChatID is the chat terminals attach to by default
+// Bit 60 keeps it clear of Telegram, Slack and Matrix chat IDs
+const ChatID = int64(1)<<60 | 1
+
+// Message types on the socket
+const (
+	TypeAttach   = "attach"   // client → server: Chat to attach to
+	TypeAttached = "attached" // server → client: ChatID attached
+	TypeMessage  = "message"  // both: Text sent to Claude, or a message from the daemon
+	TypePress    = "press"    // client → server: Data of a pressed button
+	TypeAnswer   = "answer"   // server → client: Text answering a press
+	TypeEdit     = "edit"     // server → client: new Text for message ID
+	TypeDelete   = "delete"   // server → client: message ID deleted
+	TypePin      = "pin"      // server → client: message ID pinned
+	TypeUnpin    = "unpin"    // server → client: message ID unpinned
+	TypeTyping   = "typing"   // server → client: On while Claude is working
+	TypeFile     = "file"     // server → client: file at path Data, with caption Text
+)
+
+// Message is one JSON line on the socket
+type Message struct {
+	Type     string             `json:"type"`
+	ChatID   int64              `json:"chat_id,omitempty"`
+	ID       int64              `json:"id,omitempty"`
+	Text     string             `json:"text,omitempty"`
+	Data     string             `json:"data,omitempty"`
+	Silent   bool               `json:"silent,omitempty"`
+	Status   bool               `json:"status,omitempty"` // subdued tool progress
+	Keyboard *frontend.Keyboard `json:"keyboard,omitempty"`
+	On       bool               `json:"on,omitempty"`
+}
+
+var _ frontend.Frontend = (*Server)(nil)
+
+// Server serves chats to terminals over a Unix socket
+// The socket is only accessible to the daemon's user, so there is no allowlist
+type Server struct {
+	path            string
+	handler         frontend.MessageHandler
+	callbackHandler frontend.CallbackHandler
+	logger          *slog.Logger
+
+	clients map[*client]bool
+	nextID  int64
+	mu      sync.Mutex
+}
+
+// client is an attached terminal
+type client struct {
+	conn   net.Conn
+	chatID int64
+	enc    *json.Encoder
+	mu     sync.Mutex // serializes writes
+}
+
+// send writes a message to the terminal
+func (c *client) send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(msg)
+}
+
+// New creates a terminal frontend listening at path once started
+func New(path string, logger *slog.Logger) *Server {
+	return &Server{
+		path:    path,
+		logger:  logger,
+		clients: make(map[*client]bool),
+	}
+}
+
+// Owns reports whether a chat is served here: the local chat, and any chat
+// a terminal is attached to
+func (s *Server) Owns(chatID int64) bool {
+	if chatID == ChatID {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		if c.chatID == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHandler sets the message handler function
+func (s *Server) SetHandler(h frontend.MessageHandler) {
+	s.handler = h
+}
+
+// SetCallbackHandler sets the button press handler function
+func (s *Server) SetCallbackHandler(h frontend.CallbackHandler) {
+	s.callbackHandler = h
+}
+
+// Start listens on the socket and blocks until ctx is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	// A socket that accepts connections belongs to a running daemon;
+	// one that doesn't is left over from a crash
+	if conn, err := net.Dial("unix", s.path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another aria is listening on %s", s.path)
+	}
+	os.Remove(s.path)
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating socket dir: %w", err)
+	}
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.path, err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("securing socket: %w", err)
+	}
+
+	s.logger.Info("chat socket listening", "path", s.path)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		s.mu.Lock()
+		for c := range s.clients {
+			c.conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				os.Remove(s.path)
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			s.logger.Warn("chat socket accept failed", "error", err)
+			continue
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve reads a terminal's attach, then its messages and button presses
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var attach Message
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &attach) != nil || attach.Type != TypeAttach {
+		s.logger.Warn("chat socket client didn't attach")
+		return
+	}
+	c := &client{conn: conn, chatID: attach.ChatID, enc: json.NewEncoder(conn)}
+	if c.chatID == 0 {
+		c.chatID = ChatID
+	}
+
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		s.logger.Info("terminal detached", "chat_id", c.chatID)
+	}()
+
+	s.logger.Info("terminal attached", "chat_id", c.chatID)
+	if err := c.send(Message{Type: TypeAttached, ChatID: c.chatID}); err != nil {
+		return
+	}
+
+	userID := int64(os.Getuid())
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			s.logger.Warn("bad chat socket message", "error", err)
+			continue
+		}
+
+		switch msg.Type {
+		case TypeMessage:
+			if s.handler == nil || msg.Text == "" {
+				continue
+			}
+			s.logger.Info("processing message",
+				"chat_id", c.chatID,
+				"text_length", len(msg.Text),
+			)
+			respond := func(text string, silent bool) {
+				if err := s.SendMessage(c.chatID, text, silent); err != nil {
+					s.logger.Error("failed to send message", "chat_id", c.chatID, "error", err)
+				}
+			}
+			// Call handler in the background (this blocks until Claude responds)
+			// Terminal messages can't be replied to, so they have no message ID
+			go s.handler(context.Background(), c.chatID, userID, 0, msg.Text, nil, nil, respond)
+
+		case TypePress:
+			if s.callbackHandler == nil {
+				continue
+			}
+			s.logger.Info("processing button press", "chat_id", c.chatID, "data", msg.Data)
+			go func(data string) {
+				answer := s.callbackHandler(context.Background(), c.chatID, userID, data)
+				c.send(Message{Type: TypeAnswer, Text: answer})
+			}(msg.Data)
+		}
+	}
+}
+
+// newID returns a new message ID
+func (s *Server) newID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return s.nextID
+}
+
+// broadcast sends a message to every terminal attached to a chat
+// Fails if none is attached, so trackers know the message went nowhere
+func (s *Server) broadcast(chatID int64, msg Message) error {
+	s.mu.Lock()
+	var targets []*client
+	for c := range s.clients {
+		if c.chatID == chatID {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(targets) == 0 {
+		return fmt.Errorf("no terminal attached to chat %d", chatID)
+	}
+	for _, c := range targets {
+		if err := c.send(msg); err != nil {
+			s.logger.Debug("failed to write to terminal", "chat_id", chatID, "error", err)
+		}
+	}
+	return nil
+}
+
+// post sends a new message and returns its ID
+func (s *Server) post(chatID int64, msg Message) (int64, error) {
+	msg.Type = TypeMessage
+	msg.ID = s.newID()
+	if err := s.broadcast(chatID, msg); err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
+
+// SendMessage sends a markdown message to the chat's terminals
+func (s *Server) SendMessage(chatID int64, text string, silent bool) error {
+	_, err := s.post(chatID, Message{Text: text, Silent: silent})
+	return err
+}
+
+// SendNotification sends a silent message and returns its ID for later edits
+func (s *Server) SendNotification(chatID int64, text string) (int64, error) {
+	return s.post(chatID, Message{Text: text, Silent: true})
+}
+
+// SendStatus sends a status message and returns its ID
+func (s *Server) SendStatus(chatID int64, text string) (int64, error) {
+	return s.post(chatID, Message{Text: text, Silent: true, Status: true})
+}
+
+// SendKeyboard sends a message with buttons and returns its ID
+func (s *Server) SendKeyboard(chatID int64, text string, keyboard frontend.Keyboard) (int64, error) {
+	return s.post(chatID, Message{Text: text, Keyboard: &keyboard})
+}
+
+// SendAndPinMessage sends a silent message and pins it
+func (s *Server) SendAndPinMessage(chatID int64, text string) (int64, error) {
+	msgID, err := s.SendNotification(chatID, text)
+	if err != nil {
+		return 0, err
+	}
+	s.PinMessage(chatID, msgID)
+	return msgID, nil
+}
+
+// SendFile points the chat's terminals at a file; they share the daemon's disk
+func (s *Server) SendFile(chatID int64, path string, caption string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return s.broadcast(chatID, Message{Type: TypeFile, ID: s.newID(), Text: caption, Data: abs})
+}
+
+// EditMessage replaces a message's text (and drops its buttons)
+func (s *Server) EditMessage(chatID int64, msgID int64, text string) error {
+	return s.broadcast(chatID, Message{Type: TypeEdit, ID: msgID, Text: text})
+}
+
+// EditStatus replaces a status message's text
+func (s *Server) EditStatus(chatID int64, msgID int64, text string) error {
+	return s.broadcast(chatID, Message{Type: TypeEdit, ID: msgID, Text: text, Status: true})
+}
+
+// DeleteMessage deletes a message
+func (s *Server) DeleteMessage(chatID int64, msgID int64) error {
+	return s.broadcast(chatID, Message{Type: TypeDelete, ID: msgID})
+}
+
+// PinMessage marks a message as pinned
+func (s *Server) PinMessage(chatID int64, msgID int64) error {
+	return s.broadcast(chatID, Message{Type: TypePin, ID: msgID})
+}
+
+// UnpinMessage marks a message as no longer pinned
+func (s *Server) UnpinMessage(chatID int64, msgID int64) error {
+	return s.broadcast(chatID, Message{Type: TypeUnpin, ID: msgID})
+}
+
+// TypingLoop tells the chat's terminals Claude is working until the returned function is called
+func (s *Server) TypingLoop(chatID int64) func() {
+	s.broadcast(chatID, Message{Type: TypeTyping, On: true})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.broadcast(chatID, Message{Type: TypeTyping})
+		})
+	}
+}
+
+// RegisterCommands is a no-op: terminals type commands directly
+func (s *Server) RegisterCommands(commands []string) {}
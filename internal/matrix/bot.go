@@ -0,0 +1,541 @@
+// Package matrix is the Matrix frontend, a client-server API bot for
+// self-hosted chat. Each room the bot is in becomes a chat
+//
+// Matrix has no inline keyboards, so buttons are listed as numbered options
+// and the bot seeds a reaction for each; reacting with one presses it.
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+var _ frontend.Frontend = (*Bot)(nil)
+
+// optionKeys are the reactions that stand in for keyboard buttons, in order
+var optionKeys = []string{
+	"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟",
+	"🇦", "🇧", "🇨", "🇩", "🇪", "🇫", "🇬", "🇭", "🇮", "🇯",
+}
+
+// syncRetryDelay is how long to wait after a failed /sync
+const syncRetryDelay = 5 * time.Second
+
+// Options configures the Matrix frontend
+type Options struct {
+	Homeserver  string   // e.g. https://matrix.example.com
+	AccessToken string   // access token of the bot's account
+	Allowlist   []string // Matrix user IDs allowed to use the bot
+	RoomsPath   string   // where chat ID mappings are saved, empty = memory only
+}
+
+// Bot is a Matrix bot account driven over the client-server API
+type Bot struct {
+	client          *client
+	allowlist       map[string]bool
+	rooms           *roomStore
+	events          *eventIDs
+	handler         frontend.MessageHandler
+	callbackHandler frontend.CallbackHandler
+	logger          *slog.Logger
+	userID          string
+
+	keyboards map[string]map[string]string // keyboard event ID -> reaction key -> button data
+	mu        sync.Mutex
+}
+
+// New creates a new Matrix frontend
+func New(opts Options, logger *slog.Logger) (*Bot, error) {
+	if opts.Homeserver == "" || opts.AccessToken == "" {
+		return nil, errors.New("matrix needs a homeserver and an access token")
+	}
+
+	rooms := newRoomStore(opts.RoomsPath)
+	if err := rooms.load(); err != nil {
+		return nil, err
+	}
+
+	allowMap := make(map[string]bool, len(opts.Allowlist))
+	for _, id := range opts.Allowlist {
+		allowMap[id] = true
+	}
+
+	return &Bot{
+		client:    newClient(opts.Homeserver, opts.AccessToken),
+		allowlist: allowMap,
+		rooms:     rooms,
+		events:    newEventIDs(),
+		logger:    logger,
+		keyboards: make(map[string]map[string]string),
+	}, nil
+}
+
+// SetHandler sets the message handler function
+func (b *Bot) SetHandler(h frontend.MessageHandler) {
+	b.handler = h
+}
+
+// SetCallbackHandler sets the reaction (button press) handler function
+func (b *Bot) SetCallbackHandler(h frontend.CallbackHandler) {
+	b.callbackHandler = h
+}
+
+// Start syncs with the homeserver and blocks until ctx is cancelled
+// Messages sent while Aria was down are skipped, like Telegram's dropped updates
+func (b *Bot) Start(ctx context.Context) error {
+	userID, err := b.client.whoami(ctx)
+	if err != nil {
+		return fmt.Errorf("matrix whoami: %w", err)
+	}
+	b.userID = userID
+
+	initial, err := b.client.sync(ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("matrix initial sync: %w", err)
+	}
+	b.handleInvites(ctx, initial)
+	since := initial.NextBatch
+
+	b.logger.Info("matrix bot started",
+		"user_id", b.userID,
+		"allowlist_count", len(b.allowlist),
+	)
+
+	for {
+		resp, err := b.client.sync(ctx, since, syncTimeout)
+		if ctx.Err() != nil {
+			b.logger.Info("matrix bot stopped")
+			return nil
+		}
+		if err != nil {
+			b.logger.Warn("matrix sync failed", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(syncRetryDelay):
+			}
+			continue
+		}
+		since = resp.NextBatch
+
+		b.handleInvites(ctx, resp)
+		for roomID, room := range resp.Rooms.Join {
+			for _, evt := range room.Timeline.Events {
+				b.handleEvent(roomID, evt)
+			}
+		}
+	}
+}
+
+// handleInvites joins rooms that allowed users invite the bot to
+func (b *Bot) handleInvites(ctx context.Context, resp *syncResponse) {
+	for roomID, invite := range resp.Rooms.Invite {
+		var inviter string
+		for _, evt := range invite.InviteState.Events {
+			if evt.Type == "m.room.member" && evt.StateKey != nil && *evt.StateKey == b.userID {
+				inviter = evt.Sender
+			}
+		}
+		if !b.allowlist[inviter] {
+			b.logger.Debug("ignoring invite from non-allowed user", "room", roomID, "inviter", inviter)
+			continue
+		}
+		if err := b.client.join(ctx, roomID); err != nil {
+			b.logger.Warn("failed to join room", "room", roomID, "error", err)
+			continue
+		}
+		b.logger.Info("joined room", "room", roomID, "inviter", inviter)
+	}
+}
+
+// handleEvent dispatches a timeline event
+// Handlers run in their own goroutine since they block until Claude responds
+func (b *Bot) handleEvent(roomID string, evt event) {
+	if evt.Sender == b.userID {
+		return
+	}
+	if !b.allowlist[evt.Sender] {
+		b.logger.Debug("ignoring event from non-allowed user",
+			"user", evt.Sender,
+			"room", roomID,
+			"type", evt.Type,
+		)
+		return
+	}
+
+	var content messageContent
+	if err := json.Unmarshal(evt.Content, &content); err != nil {
+		return
+	}
+
+	switch evt.Type {
+	case "m.room.message":
+		// Skip edits and anything that isn't plain text
+		if content.MsgType != "m.text" || (content.RelatesTo != nil && content.RelatesTo.RelType == "m.replace") {
+			return
+		}
+		go b.handleMessage(roomID, evt, stripReplyFallback(content.Body), b.replyTo(content))
+
+	case "m.reaction":
+		if content.RelatesTo == nil || content.RelatesTo.RelType != "m.annotation" {
+			return
+		}
+		go b.handleReaction(roomID, evt.Sender, content.RelatesTo.EventID, content.RelatesTo.Key)
+	}
+}
+
+// replyTo returns the message a reply quotes, nil if content isn't a reply
+// Message IDs don't survive restarts, so the replied-to ID is left unknown
+func (b *Bot) replyTo(content messageContent) *frontend.Reply {
+	if content.RelatesTo == nil || content.RelatesTo.InReplyTo == nil {
+		return nil
+	}
+	sender, text := replyFallback(content.Body)
+	return &frontend.Reply{Text: text, FromBot: sender == b.userID}
+}
+
+// handleMessage passes a text message to the message handler
+// "!cmd" is accepted for "/cmd", since most clients claim / for their own commands
+func (b *Bot) handleMessage(roomID string, evt event, text string, reply *frontend.Reply) {
+	if b.handler == nil || text == "" {
+		return
+	}
+	if strings.HasPrefix(text, "!") {
+		text = "/" + text[1:]
+	}
+
+	chatID, err := b.rooms.id(roomID)
+	if err != nil {
+		b.logger.Warn("failed to save matrix room", "error", err)
+	}
+
+	b.logger.Info("processing message",
+		"user", evt.Sender,
+		"chat_id", chatID,
+		"room", roomID,
+		"text_length", len(text),
+	)
+
+	respond := func(text string, silent bool) {
+		if err := b.SendMessage(chatID, text, silent); err != nil {
+			b.logger.Error("failed to send message",
+				"chat_id", chatID,
+				"error", err,
+			)
+		}
+	}
+
+	// Call handler (this blocks until Claude responds)
+	b.handler(context.Background(), chatID, userIDFor(evt.Sender), b.events.id(evt.EventID), text, nil, reply, respond)
+}
+
+// handleReaction presses the keyboard button a reaction stands for
+// The handler's answer is sent to the room as a notice
+func (b *Bot) handleReaction(roomID, user, eventID, key string) {
+	b.mu.Lock()
+	data, ok := b.keyboards[eventID][key]
+	b.mu.Unlock()
+	if !ok || b.callbackHandler == nil {
+		return
+	}
+
+	chatID, err := b.rooms.id(roomID)
+	if err != nil {
+		b.logger.Warn("failed to save matrix room", "error", err)
+	}
+
+	b.logger.Info("processing reaction",
+		"user", user,
+		"chat_id", chatID,
+		"data", data,
+	)
+
+	answer := b.callbackHandler(context.Background(), chatID, userIDFor(user), data)
+	if answer == "" {
+		return
+	}
+	if _, err := b.send(chatID, "m.notice", answer, FormatHTML(answer)); err != nil {
+		b.logger.Warn("failed to answer reaction", "error", err)
+	}
+}
+
+// send sends a message to a chat and returns its message ID
+// body is the plain text fallback for clients that don't render HTML
+func (b *Bot) send(chatID int64, msgType, body, formatted string) (int64, error) {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return 0, err
+	}
+
+	eventID, err := b.client.send(context.Background(), roomID, "m.room.message", messageContent{
+		MsgType:       msgType,
+		Body:          body,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: formatted,
+	})
+	if err != nil {
+		b.logger.Warn("failed to send message", "chat_id", chatID, "error", err)
+		return 0, err
+	}
+	return b.events.id(eventID), nil
+}
+
+// SendMessage sends a markdown message to a chat
+// Silent messages are sent as notices, which clients don't notify for
+func (b *Bot) SendMessage(chatID int64, text string, silent bool) error {
+	msgType := "m.text"
+	if silent {
+		msgType = "m.notice"
+	}
+	_, err := b.send(chatID, msgType, text, FormatHTML(text))
+	return err
+}
+
+// SendFile uploads a file to the media repository and sends it to the room,
+// as an image if it is one
+func (b *Bot) SendFile(chatID int64, path string, caption string) error {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	ctx := context.Background()
+	uri, err := b.client.upload(ctx, name, mimeType, data)
+	if err != nil {
+		b.logger.Warn("failed to upload file", "chat_id", chatID, "path", path, "error", err)
+		return err
+	}
+
+	content := messageContent{
+		MsgType: "m.file",
+		Body:    name,
+		URL:     uri,
+		Info:    &fileInfo{MimeType: mimeType, Size: len(data)},
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		content.MsgType = "m.image"
+	}
+	if caption != "" {
+		content.Body = caption
+		content.FileName = name
+	}
+	if _, err := b.client.send(ctx, roomID, "m.room.message", content); err != nil {
+		b.logger.Warn("failed to send file", "chat_id", chatID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// SendNotification sends a notice and returns its ID for later edits
+func (b *Bot) SendNotification(chatID int64, text string) (int64, error) {
+	return b.send(chatID, "m.notice", text, FormatHTML(text))
+}
+
+// SendStatus sends an italic notice and returns its ID
+func (b *Bot) SendStatus(chatID int64, text string) (int64, error) {
+	return b.send(chatID, "m.notice", text, formatStatus(text))
+}
+
+// SendKeyboard sends a message listing the buttons as numbered options and
+// reacts with each option's key so the user can tap one
+func (b *Bot) SendKeyboard(chatID int64, text string, keyboard frontend.Keyboard) (int64, error) {
+	options := make(map[string]string)
+	var lines []string
+	for _, row := range keyboard.Rows {
+		for _, button := range row {
+			if len(options) == len(optionKeys) {
+				b.logger.Warn("keyboard has more buttons than reactions", "chat_id", chatID)
+				break
+			}
+			key := optionKeys[len(options)]
+			options[key] = button.Data
+			lines = append(lines, key+" "+button.Text)
+		}
+	}
+
+	text = strings.TrimSpace(text) + "\n\n" + strings.Join(lines, "\n")
+	msgID, err := b.send(chatID, "m.text", text, FormatHTML(text))
+	if err != nil {
+		return 0, err
+	}
+
+	roomID, _ := b.rooms.room(chatID)
+	eventID, _ := b.events.event(msgID)
+	b.mu.Lock()
+	b.keyboards[eventID] = options
+	b.mu.Unlock()
+
+	for _, line := range lines {
+		key, _, _ := strings.Cut(line, " ")
+		_, err := b.client.send(context.Background(), roomID, "m.reaction", messageContent{
+			RelatesTo: &relation{RelType: "m.annotation", EventID: eventID, Key: key},
+		})
+		if err != nil {
+			b.logger.Warn("failed to add option reaction", "chat_id", chatID, "error", err)
+			break
+		}
+	}
+	return msgID, nil
+}
+
+// SendAndPinMessage sends a notice and pins it to the room
+func (b *Bot) SendAndPinMessage(chatID int64, text string) (int64, error) {
+	msgID, err := b.SendNotification(chatID, text)
+	if err != nil {
+		return 0, err
+	}
+
+	// Pin the message (ignore pin errors - the bot may lack power level)
+	if pinErr := b.PinMessage(chatID, msgID); pinErr != nil {
+		b.logger.Debug("could not pin message (power level?)", "error", pinErr)
+	}
+	return msgID, nil
+}
+
+// edit replaces a message's content with an m.replace edit
+// Editing a keyboard message retires its options
+func (b *Bot) edit(chatID int64, msgID int64, msgType, body, formatted string) error {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return err
+	}
+	eventID, err := b.events.event(msgID)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	delete(b.keyboards, eventID)
+	b.mu.Unlock()
+
+	newContent := &messageContent{
+		MsgType:       msgType,
+		Body:          body,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: formatted,
+	}
+	_, err = b.client.send(context.Background(), roomID, "m.room.message", messageContent{
+		MsgType:       msgType,
+		Body:          "* " + body,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: "* " + formatted,
+		RelatesTo:     &relation{RelType: "m.replace", EventID: eventID},
+		NewContent:    newContent,
+	})
+	if err != nil {
+		b.logger.Warn("failed to edit message", "chat_id", chatID, "msg_id", msgID, "error", err)
+	}
+	return err
+}
+
+// EditMessage replaces a message's text with new markdown
+func (b *Bot) EditMessage(chatID int64, msgID int64, text string) error {
+	return b.edit(chatID, msgID, "m.notice", text, FormatHTML(text))
+}
+
+// EditStatus edits a message sent with SendStatus, keeping it italic
+func (b *Bot) EditStatus(chatID int64, msgID int64, text string) error {
+	return b.edit(chatID, msgID, "m.notice", text, formatStatus(text))
+}
+
+// DeleteMessage redacts a message sent by the bot
+func (b *Bot) DeleteMessage(chatID int64, msgID int64) error {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return err
+	}
+	eventID, err := b.events.event(msgID)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	delete(b.keyboards, eventID)
+	b.mu.Unlock()
+
+	return b.client.redact(context.Background(), roomID, eventID)
+}
+
+// PinMessage adds a message to the room's pinned events
+func (b *Bot) PinMessage(chatID int64, msgID int64) error {
+	return b.updatePins(chatID, msgID, true)
+}
+
+// UnpinMessage removes a message from the room's pinned events
+func (b *Bot) UnpinMessage(chatID int64, msgID int64) error {
+	return b.updatePins(chatID, msgID, false)
+}
+
+// updatePins adds or removes an event in m.room.pinned_events
+func (b *Bot) updatePins(chatID int64, msgID int64, pin bool) error {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return err
+	}
+	eventID, err := b.events.event(msgID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pinned, err := b.client.pinnedEvents(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	pinned = slices.DeleteFunc(pinned, func(id string) bool { return id == eventID })
+	if pin {
+		pinned = append(pinned, eventID)
+	}
+	return b.client.setPinnedEvents(ctx, roomID, pinned)
+}
+
+// TypingLoop shows the bot as typing until the returned function is called
+// The notification is refreshed before the homeserver times it out
+func (b *Bot) TypingLoop(chatID int64) func() {
+	roomID, err := b.rooms.room(chatID)
+	if err != nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(20 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			b.client.typing(ctx, roomID, b.userID, true, 30*time.Second)
+			select {
+			case <-ctx.Done():
+				b.client.typing(context.Background(), roomID, b.userID, false, 0)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// RegisterCommands is a no-op: Matrix has no bot command menu
+// Commands are typed as "!cmd" (or "/cmd" where the client allows it)
+func (b *Bot) RegisterCommands(commands []string) {}
@@ -0,0 +1,256 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// syncTimeout is how long the homeserver holds a /sync open without events
+const syncTimeout = 30 * time.Second
+
+// client is a minimal Matrix client-server API client, just the endpoints
+// the bot needs
+type client struct {
+	homeserver  string
+	accessToken string
+	http        *http.Client
+	txnPrefix   string
+	txn         atomic.Int64
+}
+
+func newClient(homeserver, accessToken string) *client {
+	return &client{
+		homeserver:  strings.TrimSuffix(homeserver, "/"),
+		accessToken: accessToken,
+		http:        &http.Client{Timeout: syncTimeout + 30*time.Second},
+		txnPrefix:   fmt.Sprintf("aria%d", time.Now().UnixNano()),
+	}
+}
+
+// apiError is an error response from the homeserver
+type apiError struct {
+	Status  int
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("matrix %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+// event is a room event from /sync
+type event struct {
+	Type     string          `json:"type"`
+	Sender   string          `json:"sender"`
+	EventID  string          `json:"event_id"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+// relation is the m.relates_to of an edit, reaction or reply
+type relation struct {
+	RelType   string     `json:"rel_type,omitempty"`
+	EventID   string     `json:"event_id,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	InReplyTo *inReplyTo `json:"m.in_reply_to,omitempty"`
+}
+
+// inReplyTo marks a message as a reply to an earlier event
+type inReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+// messageContent is the content of an m.room.message or m.reaction event
+type messageContent struct {
+	MsgType       string          `json:"msgtype,omitempty"`
+	Body          string          `json:"body,omitempty"`
+	Format        string          `json:"format,omitempty"`
+	FormattedBody string          `json:"formatted_body,omitempty"`
+	RelatesTo     *relation       `json:"m.relates_to,omitempty"`
+	NewContent    *messageContent `json:"m.new_content,omitempty"`
+	Membership    string          `json:"membership,omitempty"` // m.room.member only
+	FileName      string          `json:"filename,omitempty"`   // m.image and m.file: Body is then the caption
+	URL           string          `json:"url,omitempty"`        // m.image and m.file: mxc:// content URI
+	Info          *fileInfo       `json:"info,omitempty"`
+}
+
+// fileInfo describes an uploaded file
+type fileInfo struct {
+	MimeType string `json:"mimetype,omitempty"`
+	Size     int    `json:"size"`
+}
+
+// syncResponse is the part of a /sync response the bot reads
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []event `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// do calls an endpoint under /_matrix/client/v3 and decodes the response into out
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.homeserver+"/_matrix/client/v3"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// whoami returns the user ID the access token belongs to
+func (c *client) whoami(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/account/whoami", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.UserID, nil
+}
+
+// sync long-polls for events after since ("" = initial sync)
+func (c *client) sync(ctx context.Context, since string, timeout time.Duration) (*syncResponse, error) {
+	query := url.Values{"timeout": {fmt.Sprint(timeout.Milliseconds())}}
+	if since != "" {
+		query.Set("since", since)
+	}
+	var resp syncResponse
+	if err := c.do(ctx, http.MethodGet, "/sync?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// join joins a room the bot was invited to
+func (c *client) join(ctx context.Context, roomID string) error {
+	return c.do(ctx, http.MethodPost, "/join/"+url.PathEscape(roomID), struct{}{}, nil)
+}
+
+// send sends a room event and returns its event ID
+func (c *client) send(ctx context.Context, roomID, eventType string, content interface{}) (string, error) {
+	path := fmt.Sprintf("/rooms/%s/send/%s/%s", url.PathEscape(roomID), eventType, c.nextTxn())
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.do(ctx, http.MethodPut, path, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// redact removes an event's content
+// upload stores a file in the homeserver's media repository and returns its mxc:// URI
+func (c *client) upload(ctx context.Context, name, contentType string, data []byte) (string, error) {
+	u := c.homeserver + "/_matrix/media/v3/upload?filename=" + url.QueryEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return "", apiErr
+	}
+	var out struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.ContentURI, nil
+}
+
+func (c *client) redact(ctx context.Context, roomID, eventID string) error {
+	path := fmt.Sprintf("/rooms/%s/redact/%s/%s", url.PathEscape(roomID), url.PathEscape(eventID), c.nextTxn())
+	return c.do(ctx, http.MethodPut, path, struct{}{}, nil)
+}
+
+// typing sets the bot's typing notification in a room
+func (c *client) typing(ctx context.Context, roomID, userID string, typing bool, timeout time.Duration) error {
+	body := map[string]interface{}{"typing": typing}
+	if typing {
+		body["timeout"] = timeout.Milliseconds()
+	}
+	path := fmt.Sprintf("/rooms/%s/typing/%s", url.PathEscape(roomID), url.PathEscape(userID))
+	return c.do(ctx, http.MethodPut, path, body, nil)
+}
+
+// pinnedEvents returns a room's pinned event IDs
+func (c *client) pinnedEvents(ctx context.Context, roomID string) ([]string, error) {
+	var resp struct {
+		Pinned []string `json:"pinned"`
+	}
+	err := c.do(ctx, http.MethodGet, "/rooms/"+url.PathEscape(roomID)+"/state/m.room.pinned_events", nil, &resp)
+	if apiErr, ok := err.(*apiError); ok && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	return resp.Pinned, err
+}
+
+// setPinnedEvents replaces a room's pinned event IDs
+func (c *client) setPinnedEvents(ctx context.Context, roomID string, pinned []string) error {
+	if pinned == nil {
+		pinned = []string{}
+	}
+	body := map[string]interface{}{"pinned": pinned}
+	return c.do(ctx, http.MethodPut, "/rooms/"+url.PathEscape(roomID)+"/state/m.room.pinned_events", body, nil)
+}
+
+// nextTxn returns a transaction ID unique to this process
+func (c *client) nextTxn() string {
+	return fmt.Sprintf("%s.%d", c.txnPrefix, c.txn.Add(1))
+}
@@ -0,0 +1,123 @@
+package matrix
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Regex patterns for markdown elements
+var (
+	codeBlockRegex     = regexp.MustCompile("(?s)```([a-zA-Z0-9_+-]*)\\n?(.*?)```")
+	inlineCodeRegex    = regexp.MustCompile("`([^`]+)`")
+	linkRegex          = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	boldRegex          = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	italicRegex        = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	strikethroughRegex = regexp.MustCompile(`~~(.+?)~~`)
+	headingRegex       = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// FormatHTML converts standard markdown to the HTML subset Matrix clients
+// render (org.matrix.custom.html)
+func FormatHTML(text string) string {
+	placeholders := make(map[string]string)
+	counter := 0
+
+	// protect swaps formatted output for a key so later steps leave it alone
+	protect := func(value string) string {
+		key := fmt.Sprintf("XPLACEHOLDERX%dX", counter)
+		counter++
+		placeholders[key] = value
+		return key
+	}
+
+	// Step 1: Escape HTML everywhere, code included
+	text = html.EscapeString(strings.TrimSpace(text))
+
+	// Step 2: Code blocks keep their language as a class for highlighting
+	text = codeBlockRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := codeBlockRegex.FindStringSubmatch(match)
+		code := strings.TrimSuffix(parts[2], "\n")
+		if parts[1] != "" {
+			return protect(fmt.Sprintf(`<pre><code class="language-%s">%s</code></pre>`, parts[1], code))
+		}
+		return protect("<pre><code>" + code + "</code></pre>")
+	})
+
+	// Step 3: Inline code
+	text = inlineCodeRegex.ReplaceAllStringFunc(text, func(match string) string {
+		return protect("<code>" + inlineCodeRegex.FindStringSubmatch(match)[1] + "</code>")
+	})
+
+	// Step 4: Links (the URL is already escaped for the attribute)
+	text = linkRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := linkRegex.FindStringSubmatch(match)
+		return protect(fmt.Sprintf(`<a href="%s">%s</a>`, parts[2], parts[1]))
+	})
+
+	// Step 5: **bold** and # headings
+	text = boldRegex.ReplaceAllString(text, "<strong>${1}</strong>")
+	text = headingRegex.ReplaceAllString(text, "<strong>${1}</strong>")
+
+	// Step 6: *italic* and ~~strike~~
+	text = italicRegex.ReplaceAllString(text, "<em>${1}</em>")
+	text = strikethroughRegex.ReplaceAllString(text, "<del>${1}</del>")
+
+	// Step 7: Line breaks outside code blocks (still placeholders here)
+	text = strings.ReplaceAll(text, "\n", "<br>")
+
+	// Step 8: Restore placeholders, repeating for nested ones (code inside bold)
+	for i := 0; i < 3; i++ {
+		prevText := text
+		for key, value := range placeholders {
+			text = strings.ReplaceAll(text, key, value)
+		}
+		if text == prevText {
+			break
+		}
+	}
+
+	return text
+}
+
+// formatStatus renders status text as italic HTML
+func formatStatus(text string) string {
+	return "<em>" + FormatHTML(text) + "</em>"
+}
+
+// stripReplyFallback removes the quoted "> <@user> ..." lines clients put
+// at the top of a reply's plain body
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
+
+// replyFallback returns the sender and text quoted at the top of a reply's
+// plain body, empty if it has no fallback
+func replyFallback(body string) (sender string, text string) {
+	var quoted []string
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, ">") {
+			break
+		}
+		quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "))
+	}
+	if len(quoted) == 0 {
+		return "", ""
+	}
+	if strings.HasPrefix(quoted[0], "<") {
+		if end := strings.Index(quoted[0], "> "); end > 0 {
+			sender = quoted[0][1:end]
+			quoted[0] = quoted[0][end+2:]
+		}
+	}
+	return sender, strings.TrimSpace(strings.Join(quoted, "\n"))
+}
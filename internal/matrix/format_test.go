@@ -0,0 +1,63 @@
+package matrix
+
+import "testing"
+
+func TestFormatHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "Hello! How are you?", "Hello! How are you?"},
+		{"bold", "This is **bold** text", "This is <strong>bold</strong> text"},
+		{"italic", "This is *italic* text", "This is <em>italic</em> text"},
+		{"strikethrough", "This is ~~deleted~~ text", "This is <del>deleted</del> text"},
+		{"heading", "# Title\nbody", "<strong>Title</strong><br>body"},
+		{"link", "See [docs](https://example.com/?a=1&b=2)", `See <a href="https://example.com/?a=1&amp;b=2">docs</a>`},
+		{"inline code", "Run `go **build**` now", "Run <code>go **build**</code> now"},
+		{"code block", "Example:\n```go\nfunc main() {\n\ta := *p\n}\n```", "Example:<br><pre><code class=\"language-go\">func main() {\n\ta := *p\n}</code></pre>"},
+		{"escapes", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"escapes in code", "`<div>`", "<code>&lt;div&gt;</code>"},
+		{"multiplication untouched", "2 * 3 * 4", "2 * 3 * 4"},
+		{"code inside bold", "**run `ls`**", "<strong>run <code>ls</code></strong>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatHTML(tt.input); got != tt.want {
+				t.Errorf("FormatHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripReplyFallback(t *testing.T) {
+	body := "> <@alice:example.com> earlier message\n> second line\n\nthe reply"
+	if got := stripReplyFallback(body); got != "the reply" {
+		t.Errorf("stripReplyFallback() = %q, want %q", got, "the reply")
+	}
+	if got := stripReplyFallback("no quote"); got != "no quote" {
+		t.Errorf("stripReplyFallback() = %q, want unchanged", got)
+	}
+}
+
+func TestReplyFallback(t *testing.T) {
+	sender, text := replyFallback("> <@aria:example.com> earlier message\n> second line\n\nthe reply")
+	if sender != "@aria:example.com" || text != "earlier message\nsecond line" {
+		t.Errorf("replyFallback() = %q, %q", sender, text)
+	}
+	if sender, text := replyFallback("no quote"); sender != "" || text != "" {
+		t.Errorf("replyFallback() = %q, %q, want empty", sender, text)
+	}
+}
+
+func TestChatIDs(t *testing.T) {
+	id := chatIDFor("!room:example.com")
+	if id <= 0 || !IsChatID(id) {
+		t.Errorf("chat ID %d is not a positive Matrix chat ID", id)
+	}
+	// Slack chat IDs set bit 62
+	if IsChatID(123456789) || IsChatID(-1001234567890) || IsChatID(int64(1)<<62|int64(1)<<61|5) {
+		t.Error("another frontend's chat ID is treated as a Matrix chat ID")
+	}
+}
@@ -0,0 +1,481 @@
+// Package matrixtest is a fake Matrix homeserver for end-to-end tests
+//
+// Point the bot at Server.URL (matrix.Options.Homeserver) and drive it with
+// Invite, SendText and React. The server keeps every message the bot sends,
+// edits, pins or redacts so tests can wait for and inspect them.
+package matrixtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotUserID is the user ID of the fake bot
+const BotUserID = "@aria:test"
+
+// longPollMax caps how long /sync waits, so the bot stops promptly
+const longPollMax = 500 * time.Millisecond
+
+// Message is an m.room.message in the fake server, sent by a user or the bot
+type Message struct {
+	EventID   string
+	RoomID    string
+	Sender    string
+	FromBot   bool
+	Text      string // body
+	HTML      string // formatted_body
+	Notice    bool   // msgtype m.notice
+	File      string // filename of an m.image or m.file
+	FileData  []byte // uploaded content of File
+	Image     bool   // msgtype m.image
+	Reactions []string
+	Edits     int
+	Pinned    bool
+	Deleted   bool
+}
+
+// Option returns the reaction key listed for an option label ("1️⃣ Allow"), or ""
+func (m Message) Option(label string) string {
+	for _, line := range strings.Split(m.Text, "\n") {
+		key, text, ok := strings.Cut(line, " ")
+		if ok && text == label && slices.Contains(m.Reactions, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+// Server is a fake homeserver
+type Server struct {
+	URL string
+
+	srv      *httptest.Server
+	mu       sync.Mutex
+	changed  chan struct{} // Closed and replaced whenever state changes
+	closed   chan struct{}
+	seq      int
+	timeline []syncItem // Every room event, in order; /sync tokens index into it
+	invites  map[string]string
+	joined   map[string]bool
+	messages []*Message
+	typing   map[string]bool
+	uploads  map[string][]byte // Uploaded media by mxc:// URI
+}
+
+// syncItem is an event waiting to be synced
+type syncItem struct {
+	roomID string
+	event  map[string]interface{}
+}
+
+// NewServer starts a fake homeserver
+func NewServer() *Server {
+	s := &Server{
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+		invites: make(map[string]string),
+		joined:  make(map[string]bool),
+		typing:  make(map[string]bool),
+		uploads: make(map[string][]byte),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close stops the server, releasing any pending syncs
+func (s *Server) Close() {
+	close(s.closed)
+	s.srv.Close()
+}
+
+// Invite invites the bot to a room on behalf of a user
+func (s *Server) Invite(roomID, user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invites[roomID] = user
+	s.notifyLocked()
+}
+
+// Joined reports whether the bot has joined a room
+func (s *Server) Joined(roomID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.joined[roomID]
+}
+
+// SendText sends a text message from a user and returns its event ID
+func (s *Server) SendText(roomID, user, text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessageLocked(roomID, user, map[string]interface{}{"msgtype": "m.text", "body": text})
+	return msg.EventID
+}
+
+// React reacts to a message on behalf of a user and returns the reaction's event ID
+func (s *Server) React(roomID, user, eventID, key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addEventLocked(roomID, user, "m.reaction", map[string]interface{}{
+		"m.relates_to": map[string]interface{}{"rel_type": "m.annotation", "event_id": eventID, "key": key},
+	})
+}
+
+// Messages returns a copy of every message in a room, oldest first
+func (s *Server) Messages(roomID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Message
+	for _, m := range s.messages {
+		if m.RoomID == roomID {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// Typing reports whether the bot is shown typing in a room
+func (s *Server) Typing(roomID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.typing[roomID]
+}
+
+// WaitFor waits until a live (not redacted) bot message in the room matches
+// Returns an error listing the room's messages on timeout
+func (s *Server) WaitFor(roomID string, timeout time.Duration, match func(Message) bool) (Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		for _, m := range s.messages {
+			if m.RoomID == roomID && m.FromBot && !m.Deleted && match(*m) {
+				found := *m
+				s.mu.Unlock()
+				return found, nil
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return Message{}, fmt.Errorf("timed out waiting for message; room has:\n%s", s.dump(roomID))
+		}
+	}
+}
+
+// WaitForText waits for a live bot message containing text
+func (s *Server) WaitForText(roomID string, timeout time.Duration, text string) (Message, error) {
+	return s.WaitFor(roomID, timeout, func(m Message) bool {
+		return strings.Contains(m.Text, text)
+	})
+}
+
+// dump formats a room's messages for failure output
+func (s *Server) dump(roomID string) string {
+	var b strings.Builder
+	for _, m := range s.Messages(roomID) {
+		var flags []string
+		if m.Deleted {
+			flags = append(flags, "redacted")
+		}
+		if m.Edits > 0 {
+			flags = append(flags, fmt.Sprintf("edited %d", m.Edits))
+		}
+		if m.Reactions != nil {
+			flags = append(flags, fmt.Sprintf("reactions %v", m.Reactions))
+		}
+		fmt.Fprintf(&b, "  %s %s %q %v\n", m.EventID, m.Sender, m.Text, flags)
+	}
+	return b.String()
+}
+
+// addEventLocked appends an event to the timeline (must hold lock)
+func (s *Server) addEventLocked(roomID, sender, eventType string, content map[string]interface{}) string {
+	s.seq++
+	eventID := fmt.Sprintf("$event%d", s.seq)
+	s.timeline = append(s.timeline, syncItem{roomID: roomID, event: map[string]interface{}{
+		"type":     eventType,
+		"sender":   sender,
+		"event_id": eventID,
+		"content":  content,
+	}})
+	s.notifyLocked()
+	return eventID
+}
+
+// addMessageLocked stores and syncs a new message (must hold lock)
+func (s *Server) addMessageLocked(roomID, sender string, content map[string]interface{}) *Message {
+	eventID := s.addEventLocked(roomID, sender, "m.room.message", content)
+	msg := &Message{
+		EventID: eventID,
+		RoomID:  roomID,
+		Sender:  sender,
+		FromBot: sender == BotUserID,
+	}
+	applyContent(msg, content)
+	if uri, ok := content["url"].(string); ok {
+		msg.FileData = s.uploads[uri]
+	}
+	s.messages = append(s.messages, msg)
+	return msg
+}
+
+// findLocked returns a message by event ID (must hold lock)
+func (s *Server) findLocked(eventID string) *Message {
+	for _, m := range s.messages {
+		if m.EventID == eventID {
+			return m
+		}
+	}
+	return nil
+}
+
+// notifyLocked wakes anyone waiting on a state change (must hold lock)
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// handle serves /_matrix/client/v3/... and media uploads
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_matrix/media/v3/upload" {
+		s.upload(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/_matrix/client/v3")
+	var parts []string
+	for _, p := range strings.Split(strings.Trim(path, "/"), "/") {
+		unescaped, _ := url.PathUnescape(p)
+		parts = append(parts, unescaped)
+	}
+
+	var body map[string]interface{}
+	if r.ContentLength != 0 {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	if parts[0] == "sync" {
+		s.sync(w, r.URL.Query().Get("since"), r.URL.Query().Get("timeout") != "0")
+		return
+	}
+
+	s.mu.Lock()
+	result, status := s.callLocked(r.Method, parts, body)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// upload stores a media upload and returns its mxc:// URI
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	uri := fmt.Sprintf("mxc://test/media%d", s.seq)
+	s.uploads[uri] = data
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"content_uri": uri})
+}
+
+// callLocked handles every endpoint except /sync (must hold lock)
+func (s *Server) callLocked(method string, parts []string, body map[string]interface{}) (interface{}, int) {
+	notFound := map[string]interface{}{"errcode": "M_NOT_FOUND", "error": "not found"}
+
+	switch {
+	case len(parts) == 2 && parts[0] == "account" && parts[1] == "whoami":
+		return map[string]interface{}{"user_id": BotUserID}, http.StatusOK
+
+	case len(parts) == 2 && parts[0] == "join":
+		delete(s.invites, parts[1])
+		s.joined[parts[1]] = true
+		s.notifyLocked()
+		return map[string]interface{}{"room_id": parts[1]}, http.StatusOK
+
+	case len(parts) < 3 || parts[0] != "rooms":
+		return notFound, http.StatusNotFound
+	}
+
+	roomID := parts[1]
+	switch parts[2] {
+	case "send":
+		if len(parts) != 5 {
+			return notFound, http.StatusNotFound
+		}
+		return s.sendLocked(roomID, parts[3], body)
+
+	case "redact":
+		msg := s.findLocked(parts[3])
+		if msg == nil || msg.Deleted {
+			return notFound, http.StatusNotFound
+		}
+		msg.Deleted = true
+		eventID := s.addEventLocked(roomID, BotUserID, "m.room.redaction", map[string]interface{}{"redacts": msg.EventID})
+		return map[string]interface{}{"event_id": eventID}, http.StatusOK
+
+	case "typing":
+		typing, _ := body["typing"].(bool)
+		s.typing[roomID] = typing
+		s.notifyLocked()
+		return map[string]interface{}{}, http.StatusOK
+
+	case "state":
+		if len(parts) != 4 || parts[3] != "m.room.pinned_events" {
+			return notFound, http.StatusNotFound
+		}
+		if method == http.MethodGet {
+			var pinned []string
+			for _, m := range s.messages {
+				if m.RoomID == roomID && m.Pinned {
+					pinned = append(pinned, m.EventID)
+				}
+			}
+			if pinned == nil {
+				return notFound, http.StatusNotFound
+			}
+			return map[string]interface{}{"pinned": pinned}, http.StatusOK
+		}
+		pinned, _ := body["pinned"].([]interface{})
+		for _, m := range s.messages {
+			if m.RoomID == roomID {
+				m.Pinned = slices.Contains(pinned, interface{}(m.EventID))
+			}
+		}
+		s.notifyLocked()
+		return map[string]interface{}{"event_id": fmt.Sprintf("$state%d", s.seq)}, http.StatusOK
+	}
+
+	return notFound, http.StatusNotFound
+}
+
+// sendLocked handles PUT /rooms/{room}/send/{type}/{txn} from the bot (must hold lock)
+func (s *Server) sendLocked(roomID, eventType string, content map[string]interface{}) (interface{}, int) {
+	relates, _ := content["m.relates_to"].(map[string]interface{})
+	relType, _ := relates["rel_type"].(string)
+	target, _ := relates["event_id"].(string)
+
+	switch {
+	case eventType == "m.reaction":
+		msg := s.findLocked(target)
+		if msg == nil {
+			return map[string]interface{}{"errcode": "M_NOT_FOUND", "error": "reaction target not found"}, http.StatusNotFound
+		}
+		key, _ := relates["key"].(string)
+		msg.Reactions = append(msg.Reactions, key)
+		return map[string]interface{}{"event_id": s.addEventLocked(roomID, BotUserID, eventType, content)}, http.StatusOK
+
+	case eventType == "m.room.message" && relType == "m.replace":
+		msg := s.findLocked(target)
+		if msg == nil || msg.Deleted {
+			return map[string]interface{}{"errcode": "M_NOT_FOUND", "error": "edit target not found"}, http.StatusNotFound
+		}
+		newContent, _ := content["m.new_content"].(map[string]interface{})
+		applyContent(msg, newContent)
+		msg.Edits++
+		return map[string]interface{}{"event_id": s.addEventLocked(roomID, BotUserID, eventType, content)}, http.StatusOK
+
+	case eventType == "m.room.message":
+		return map[string]interface{}{"event_id": s.addMessageLocked(roomID, BotUserID, content).EventID}, http.StatusOK
+	}
+
+	return map[string]interface{}{"errcode": "M_UNRECOGNIZED", "error": "event type not supported by matrixtest"}, http.StatusBadRequest
+}
+
+// sync returns the invites and timeline events after the since token,
+// long-polling unless this is an initial (timeout=0) sync
+// Pending invites ride along with the next response
+func (s *Server) sync(w http.ResponseWriter, since string, wait bool) {
+	from, _ := strconv.Atoi(since)
+	deadline := time.After(longPollMax)
+
+	for {
+		s.mu.Lock()
+		if len(s.timeline) > from || !wait {
+			resp := s.syncResponseLocked(from)
+			s.mu.Unlock()
+			writeJSON(w, resp)
+			return
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			wait = false
+		case <-s.closed:
+			wait = false
+		}
+	}
+}
+
+// syncResponseLocked builds a /sync response from a timeline position (must hold lock)
+func (s *Server) syncResponseLocked(from int) map[string]interface{} {
+	join := map[string]interface{}{}
+	events := map[string][]interface{}{}
+	for _, item := range s.timeline[min(from, len(s.timeline)):] {
+		events[item.roomID] = append(events[item.roomID], item.event)
+	}
+	for roomID, evts := range events {
+		join[roomID] = map[string]interface{}{"timeline": map[string]interface{}{"events": evts}}
+	}
+
+	invite := map[string]interface{}{}
+	for roomID, inviter := range s.invites {
+		invite[roomID] = map[string]interface{}{"invite_state": map[string]interface{}{"events": []interface{}{
+			map[string]interface{}{
+				"type":      "m.room.member",
+				"sender":    inviter,
+				"state_key": BotUserID,
+				"content":   map[string]interface{}{"membership": "invite"},
+			},
+		}}}
+	}
+
+	return map[string]interface{}{
+		"next_batch": strconv.Itoa(len(s.timeline)),
+		"rooms":      map[string]interface{}{"join": join, "invite": invite},
+	}
+}
+
+// applyContent copies a message event's content onto a message
+func applyContent(msg *Message, content map[string]interface{}) {
+	msg.Text, _ = content["body"].(string)
+	msg.HTML, _ = content["formatted_body"].(string)
+	msgType, _ := content["msgtype"].(string)
+	msg.Notice = msgType == "m.notice"
+	msg.Image = msgType == "m.image"
+	if msgType == "m.image" || msgType == "m.file" {
+		msg.File, _ = content["filename"].(string)
+		if msg.File == "" {
+			msg.File = msg.Text
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,153 @@
+package matrix
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chatIDBit marks Matrix chat IDs. Telegram's stay well within ±2^53 and
+// Slack's set bit 62, which Matrix IDs always leave clear
+const chatIDBit = int64(1) << 61
+
+// IsChatID reports whether a chat ID belongs to a Matrix room
+func IsChatID(chatID int64) bool {
+	return chatID > 0 && chatID&chatIDBit != 0 && chatID&(chatIDBit<<1) == 0
+}
+
+// chatIDFor derives a stable chat ID from a room ID
+func chatIDFor(roomID string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(roomID))
+	return int64(h.Sum64()&uint64(chatIDBit-1)) | chatIDBit
+}
+
+// userIDFor derives a stable numeric ID for a Matrix user (used in logs)
+func userIDFor(user string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(user))
+	return int64(h.Sum64() &^ (1 << 63))
+}
+
+// roomStore maps chat IDs back to room IDs
+// Mappings are saved to path so restart notices reach existing rooms
+type roomStore struct {
+	path  string
+	rooms map[int64]string
+	mu    sync.Mutex
+}
+
+// newRoomStore creates a room store saved at path ("" = memory only)
+func newRoomStore(path string) *roomStore {
+	return &roomStore{
+		path:  path,
+		rooms: make(map[int64]string),
+	}
+}
+
+// load reads saved mappings, a missing file is not an error
+func (s *roomStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading matrix rooms: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := yaml.Unmarshal(data, &s.rooms); err != nil {
+		return fmt.Errorf("parsing matrix rooms: %w", err)
+	}
+	return nil
+}
+
+// id returns the chat ID for a room, remembering it
+func (s *roomStore) id(roomID string) (int64, error) {
+	chatID := chatIDFor(roomID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[chatID]; ok {
+		return chatID, nil
+	}
+	s.rooms[chatID] = roomID
+	return chatID, s.saveLocked()
+}
+
+// room returns the room ID for a chat ID
+func (s *roomStore) room(chatID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	roomID, ok := s.rooms[chatID]
+	if !ok {
+		return "", fmt.Errorf("unknown matrix chat %d", chatID)
+	}
+	return roomID, nil
+}
+
+// saveLocked writes the mappings to disk (must hold lock)
+func (s *roomStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(s.rooms)
+	if err != nil {
+		return fmt.Errorf("encoding matrix rooms: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating matrix rooms dir: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("writing matrix rooms: %w", err)
+	}
+	return nil
+}
+
+// eventIDs maps Matrix event IDs to the int64 message IDs the frontend
+// interface uses. IDs are only meaningful for the life of the process
+type eventIDs struct {
+	ids    map[string]int64
+	events map[int64]string
+	next   int64
+	mu     sync.Mutex
+}
+
+func newEventIDs() *eventIDs {
+	return &eventIDs{
+		ids:    make(map[string]int64),
+		events: make(map[int64]string),
+	}
+}
+
+// id returns the message ID for an event, assigning one if needed
+func (e *eventIDs) id(eventID string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if id, ok := e.ids[eventID]; ok {
+		return id
+	}
+	e.next++
+	e.ids[eventID] = e.next
+	e.events[e.next] = eventID
+	return e.next
+}
+
+// event returns the event ID for a message ID
+func (e *eventIDs) event(msgID int64) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	eventID, ok := e.events[msgID]
+	if !ok {
+		return "", fmt.Errorf("unknown matrix message %d", msgID)
+	}
+	return eventID, nil
+}
@@ -97,6 +97,9 @@ func (m *BridgeManager) GetToolName() string {
 	return "mcp__aria__prompt_permission"
 }
 
+// SendFileToolName is the full MCP tool name of send_file, as Claude asks permission for it
+const SendFileToolName = "mcp__aria__send_file"
+
 // Cleanup removes all temp files
 func (m *BridgeManager) Cleanup() {
 	m.mu.Lock()
@@ -108,9 +111,10 @@ func (m *BridgeManager) Cleanup() {
 }
 
 // RunMCPServer runs the MCP server in stdio mode (called when aria is invoked with --mcp-server)
-func RunMCPServer(chatID int64, handler PermissionHandler, logger *slog.Logger) error {
+func RunMCPServer(chatID int64, handler PermissionHandler, sendFile SendFileHandler, logger *slog.Logger) error {
 	server := NewServer("aria", "1.0.0", logger)
 	server.SetPermissionHandler(handler)
+	server.SetSendFileHandler(sendFile)
 
 	ctx := context.Background()
 	return server.Serve(ctx, chatID, os.Stdin, os.Stdout)
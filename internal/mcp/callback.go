@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -29,14 +30,28 @@ type PermissionRequest struct {
 	Input    map[string]interface{} `json:"input"`
 }
 
+// SendFileRequest is the request sent from MCP subprocess to parent for send_file
+type SendFileRequest struct {
+	ChatID  int64  `json:"chat_id"`
+	Path    string `json:"path"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// SendFileResponse is the parent's reply to a SendFileRequest
+type SendFileResponse struct {
+	Path  string `json:"path,omitempty"` // Resolved path that was sent
+	Error string `json:"error,omitempty"`
+}
+
 // CallbackServer runs in the parent Aria process and receives permission requests
 type CallbackServer struct {
-	listener net.Listener
-	server   *http.Server
-	port     int
-	handler  func(ctx context.Context, req PermissionRequest) (*PermissionResponse, error)
-	logger   *slog.Logger
-	wg       sync.WaitGroup
+	listener        net.Listener
+	server          *http.Server
+	port            int
+	handler         func(ctx context.Context, req PermissionRequest) (*PermissionResponse, error)
+	sendFileHandler func(ctx context.Context, req SendFileRequest) (string, error)
+	logger          *slog.Logger
+	wg              sync.WaitGroup
 }
 
 // NewCallbackServer creates a callback server on a random port
@@ -57,16 +72,31 @@ func NewCallbackServer(logger *slog.Logger) (*CallbackServer, error) {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/permission", cs.handlePermission)
+	mux.HandleFunc("/send_file", cs.handleSendFile)
 
 	cs.server = &http.Server{
 		Handler:      mux,
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 120 * time.Second, // Long timeout for user interaction
+		WriteTimeout: 2*time.Minute + writeTimeoutMargin, // the default permission timeout
 	}
 
 	return cs, nil
 }
 
+// writeTimeoutMargin is added to the permission timeout so the response to a
+// timed out prompt can still be written
+const writeTimeoutMargin = 30 * time.Second
+
+// SetPermissionTimeout sizes the server's write timeout for permission
+// prompts that wait this long (0 = forever); call before Start
+func (cs *CallbackServer) SetPermissionTimeout(d time.Duration) {
+	if d == 0 {
+		cs.server.WriteTimeout = 0
+		return
+	}
+	cs.server.WriteTimeout = d + writeTimeoutMargin
+}
+
 // Start begins serving requests
 func (cs *CallbackServer) Start() {
 	cs.wg.Add(1)
@@ -97,6 +127,11 @@ func (cs *CallbackServer) SetHandler(h func(ctx context.Context, req PermissionR
 	cs.handler = h
 }
 
+// SetSendFileHandler sets the send_file request handler
+func (cs *CallbackServer) SetSendFileHandler(h func(ctx context.Context, req SendFileRequest) (string, error)) {
+	cs.sendFileHandler = h
+}
+
 func (cs *CallbackServer) handlePermission(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -146,6 +181,34 @@ func (cs *CallbackServer) handlePermission(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (cs *CallbackServer) handleSendFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SendFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		cs.logger.Error("failed to parse send file request", "error", err)
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	cs.logger.Info("send file request received", "chat_id", req.ChatID, "path", req.Path)
+
+	var resp SendFileResponse
+	if cs.sendFileHandler == nil {
+		resp.Error = "No handler configured"
+	} else if path, err := cs.sendFileHandler(r.Context(), req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Path = path
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // CallbackClient is used by the MCP subprocess to call the parent
 type CallbackClient struct {
 	port   int
@@ -176,9 +239,9 @@ func NewCallbackClientFromEnv() (*CallbackClient, error) {
 	return &CallbackClient{
 		port:   port,
 		chatID: chatID,
-		client: &http.Client{
-			Timeout: 120 * time.Second, // Long timeout for user interaction
-		},
+		// No timeout: the parent times out permission prompts as configured,
+		// and may be set to wait for an answer indefinitely
+		client: &http.Client{},
 	}, nil
 }
 
@@ -220,3 +283,42 @@ func (cc *CallbackClient) RequestPermission(ctx context.Context, toolName string
 
 	return &permResp, nil
 }
+
+// SendFile asks the parent to send a file to the chat and returns the resolved path
+func (cc *CallbackClient) SendFile(ctx context.Context, path, caption string) (string, error) {
+	body, err := json.Marshal(SendFileRequest{
+		ChatID:  cc.chatID,
+		Path:    path,
+		Caption: caption,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshaling request: %w", err)
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/send_file", cc.port)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := cc.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var sendResp SendFileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sendResp); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+	if sendResp.Error != "" {
+		return "", errors.New(sendResp.Error)
+	}
+	return sendResp.Path, nil
+}
@@ -1,5 +1,6 @@
 // Package mcp implements an MCP server for Aria
-// This allows Claude to call back into Aria for permission prompts
+// This allows Claude to call back into Aria for permission prompts and to send
+// files to the chat
 package mcp
 
 import (
@@ -21,11 +22,18 @@ type Server struct {
 
 	// Handler for permission prompts - set by Aria
 	permissionHandler PermissionHandler
+
+	// Handler for send_file - set by Aria
+	sendFileHandler SendFileHandler
 }
 
 // PermissionHandler is called when Claude needs permission for a tool
 type PermissionHandler func(ctx context.Context, chatID int64, toolName string, input map[string]interface{}) (*PermissionResponse, error)
 
+// SendFileHandler is called when Claude sends a file to the chat
+// It returns the path that was sent, resolved against the chat's directory
+type SendFileHandler func(ctx context.Context, chatID int64, path string, caption string) (string, error)
+
 // PermissionResponse is the response to a permission request
 type PermissionResponse struct {
 	Behavior     string                 `json:"behavior"` // "allow", "deny", "allow-always"
@@ -69,6 +77,28 @@ func NewServer(name, version string, logger *slog.Logger) *Server {
 		},
 	}
 
+	// Register the send file tool
+	s.tools["send_file"] = &Tool{
+		Name: "send_file",
+		Description: "Send a file from the working directory to the user's chat, such as a " +
+			"generated image, diagram, report or patch. Images are shown inline; other files " +
+			"are sent as documents. Paths are relative to the working directory and must stay inside it.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the file to send, relative to the working directory",
+				},
+				"caption": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional plain text caption shown with the file",
+				},
+			},
+			"required": []string{"path"},
+		},
+	}
+
 	return s
 }
 
@@ -77,6 +107,11 @@ func (s *Server) SetPermissionHandler(h PermissionHandler) {
 	s.permissionHandler = h
 }
 
+// SetSendFileHandler sets the handler for send_file
+func (s *Server) SetSendFileHandler(h SendFileHandler) {
+	s.sendFileHandler = h
+}
+
 // JSON-RPC types
 type jsonRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
@@ -117,6 +152,11 @@ func (s *Server) Serve(ctx context.Context, chatID int64, r io.Reader, w io.Writ
 		return err
 	}
 
+	// Tool calls run concurrently, so parallel permission prompts each reach
+	// the user instead of waiting for the one before to be answered
+	var calls sync.WaitGroup
+	defer calls.Wait()
+
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
@@ -137,6 +177,17 @@ func (s *Server) Serve(ctx context.Context, chatID int64, r io.Reader, w io.Writ
 
 		s.logger.Debug("mcp: received request", "method", req.Method, "id", req.ID)
 
+		if req.Method == "tools/call" {
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				if err := write(s.handleRequest(ctx, chatID, req)); err != nil {
+					s.logger.Error("mcp: failed to write response", "error", err)
+				}
+			}()
+			continue
+		}
+
 		resp := s.handleRequest(ctx, chatID, req)
 		if err := write(resp); err != nil {
 			s.logger.Error("mcp: failed to write response", "error", err)
@@ -220,6 +271,10 @@ func (s *Server) handleToolsCall(ctx context.Context, chatID int64, req jsonRPCR
 
 	s.logger.Info("mcp: tool call", "tool", params.Name, "chat_id", chatID)
 
+	if params.Name == "send_file" {
+		return s.handleSendFile(ctx, chatID, req, params.Arguments)
+	}
+
 	if params.Name != "prompt_permission" {
 		return jsonRPCResponse{
 			JSONRPC: "2.0",
@@ -280,3 +335,36 @@ func (s *Server) handleToolsCall(ctx context.Context, chatID int64, req jsonRPCR
 		},
 	}
 }
+
+// handleSendFile sends a file to the chat, reporting failures as tool errors
+// so Claude can correct the path
+func (s *Server) handleSendFile(ctx context.Context, chatID int64, req jsonRPCRequest, args map[string]interface{}) jsonRPCResponse {
+	result := func(text string, isError bool) jsonRPCResponse {
+		return jsonRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result: map[string]interface{}{
+				"content": []map[string]interface{}{
+					{"type": "text", "text": text},
+				},
+				"isError": isError,
+			},
+		}
+	}
+
+	path, _ := args["path"].(string)
+	caption, _ := args["caption"].(string)
+	if path == "" {
+		return result("path is required", true)
+	}
+	if s.sendFileHandler == nil {
+		return result("Sending files is not available", true)
+	}
+
+	sent, err := s.sendFileHandler(ctx, chatID, path, caption)
+	if err != nil {
+		s.logger.Warn("mcp: send file failed", "path", path, "error", err)
+		return result(fmt.Sprintf("Failed to send %s: %v", path, err), true)
+	}
+	return result("Sent "+sent+" to the chat", false)
+}
@@ -0,0 +1,370 @@
+// Package permissions stores tool permission rules, so tools the user has
+// approved run without asking again
+//
+// A rule is written the way Claude Code settings write them: a tool name,
+// optionally with a pattern for its input, e.g. Bash(git status*) or
+// Edit(/src/**). Rules belong to a chat or, with no chat, to every chat.
+package permissions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// subjectKeys is the input field a tool's pattern is matched against
+var subjectKeys = map[string]string{
+	"Bash":         "command",
+	"Read":         "file_path",
+	"Edit":         "file_path",
+	"MultiEdit":    "file_path",
+	"Write":        "file_path",
+	"NotebookEdit": "notebook_path",
+	"WebFetch":     "url",
+	"WebSearch":    "query",
+}
+
+// pathTools match their pattern against a file path
+var pathTools = map[string]bool{
+	"Read":         true,
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// shellOperators chain or redirect commands; a wildcard Bash rule never
+// matches a command containing one, so Bash(git status*) can't run
+// "git status; rm -rf ~"
+const shellOperators = ";&|`$<>\n"
+
+// Rule allows a tool, for any input or just inputs matching Pattern
+type Rule struct {
+	Tool    string    `yaml:"tool"`
+	Pattern string    `yaml:"pattern,omitempty"`
+	ChatID  int64     `yaml:"chat_id,omitempty"` // 0 = every chat
+	Created time.Time `yaml:"created"`
+}
+
+// ParseRule parses "Tool" or "Tool(pattern)"
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	tool, pattern, hasPattern := strings.Cut(s, "(")
+	if hasPattern {
+		if !strings.HasSuffix(pattern, ")") {
+			return Rule{}, fmt.Errorf("invalid rule %q: missing )", s)
+		}
+		pattern = strings.TrimSuffix(pattern, ")")
+		if pattern == "" {
+			return Rule{}, fmt.Errorf("invalid rule %q: empty pattern", s)
+		}
+	}
+	tool = strings.TrimSpace(tool)
+	if tool == "" || strings.ContainsAny(tool, " )") {
+		return Rule{}, fmt.Errorf("invalid rule %q: want Tool or Tool(pattern)", s)
+	}
+	return Rule{Tool: tool, Pattern: pattern}, nil
+}
+
+// String formats the rule as Tool or Tool(pattern)
+func (r Rule) String() string {
+	if r.Pattern == "" {
+		return r.Tool
+	}
+	return r.Tool + "(" + r.Pattern + ")"
+}
+
+// Matches reports whether the rule allows a tool call
+// cwd is the chat's working directory, which relative path patterns are
+// anchored to (empty = the current directory)
+func (r Rule) Matches(toolName string, input map[string]interface{}, cwd string) bool {
+	if !r.matchesTool(toolName) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+
+	subject, _ := input[subjectKeys[toolName]].(string)
+	if subject == "" {
+		return false
+	}
+
+	switch {
+	case pathTools[toolName]:
+		cwd = absCwd(cwd)
+		if !filepath.IsAbs(subject) {
+			subject = filepath.Join(cwd, subject)
+		}
+		return globRegexp(resolvePattern(r.Pattern, cwd), true).MatchString(filepath.Clean(subject))
+
+	case toolName == "Bash":
+		if r.Pattern == subject {
+			return true
+		}
+		if strings.ContainsAny(subject, shellOperators) {
+			return false
+		}
+		// "npm test:*" is Claude Code's prefix form
+		if prefix, ok := strings.CutSuffix(r.Pattern, ":*"); ok {
+			return subject == prefix || strings.HasPrefix(subject, prefix+" ")
+		}
+		return globRegexp(r.Pattern, false).MatchString(subject)
+	}
+
+	return globRegexp(r.Pattern, false).MatchString(subject)
+}
+
+// matchesTool reports whether the rule is for a tool; "mcp__server" covers
+// every tool of that MCP server
+func (r Rule) matchesTool(toolName string) bool {
+	if r.Tool == toolName {
+		return true
+	}
+	return strings.HasPrefix(r.Tool, "mcp__") && strings.Count(r.Tool, "__") == 1 &&
+		strings.HasPrefix(toolName, r.Tool+"__")
+}
+
+// Suggest returns the rule the "Always" button saves for a tool call: the
+// exact command or file, or the whole tool if it has no pattern subject
+func Suggest(toolName string, input map[string]interface{}, cwd string) Rule {
+	subject, _ := input[subjectKeys[toolName]].(string)
+	if subject == "" || toolName == "WebSearch" {
+		return Rule{Tool: toolName}
+	}
+	if !pathTools[toolName] {
+		return Rule{Tool: toolName, Pattern: subject}
+	}
+
+	// Files under the working directory are written relative to it, as
+	// "/src/main.go"; anything else is absolute, as "//etc/hosts"
+	cwd = absCwd(cwd)
+	if !filepath.IsAbs(subject) {
+		subject = filepath.Join(cwd, subject)
+	}
+	subject = filepath.Clean(subject)
+	if rel, err := filepath.Rel(cwd, subject); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return Rule{Tool: toolName, Pattern: "/" + filepath.ToSlash(rel)}
+	}
+	return Rule{Tool: toolName, Pattern: "/" + subject}
+}
+
+// EditField returns the input field the user can change before approving a
+// tool call: the Bash command or the file path ("" if neither)
+func EditField(toolName string) string {
+	if toolName == "Bash" || pathTools[toolName] {
+		return subjectKeys[toolName]
+	}
+	return ""
+}
+
+// EditInput returns a copy of a tool call's input with its EditField replaced
+// by value, once validated: a command can't be empty, and a path is made
+// absolute against cwd
+func EditInput(toolName string, input map[string]interface{}, value, cwd string) (map[string]interface{}, error) {
+	field := EditField(toolName)
+	if field == "" {
+		return nil, fmt.Errorf("%s calls can't be edited", toolName)
+	}
+
+	value = strings.TrimSpace(value)
+	if pathTools[toolName] {
+		switch {
+		case value == "":
+			return nil, fmt.Errorf("the path is empty")
+		case strings.ContainsAny(value, "\x00\n"):
+			return nil, fmt.Errorf("the path must be a single line")
+		}
+		if rest, ok := strings.CutPrefix(value, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("resolving ~: %w", err)
+			}
+			value = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(value) {
+			value = filepath.Join(absCwd(cwd), value)
+		}
+		value = filepath.Clean(value)
+	} else if value == "" {
+		return nil, fmt.Errorf("the command is empty")
+	}
+
+	updated := make(map[string]interface{}, len(input))
+	for k, v := range input {
+		updated[k] = v
+	}
+	updated[field] = value
+	return updated, nil
+}
+
+// resolvePattern makes a path pattern absolute, following Claude Code's
+// settings: "//abs" is absolute, "~/x" is under the home directory, and
+// "/x" and "x" are relative to the working directory
+func resolvePattern(pattern, cwd string) string {
+	switch {
+	case strings.HasPrefix(pattern, "//"):
+		return pattern[1:]
+	case strings.HasPrefix(pattern, "~/"):
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, pattern[2:])
+		}
+		return pattern
+	default:
+		return filepath.Join(cwd, pattern)
+	}
+}
+
+// absCwd returns cwd, or the current directory if it's empty
+func absCwd(cwd string) string {
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	return cwd
+}
+
+// globRegexp compiles a glob to an anchored regexp. In paths, * and ? stay
+// within a directory and ** crosses them; otherwise * matches anything
+func globRegexp(pattern string, path bool) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && path && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*' && path:
+			b.WriteString("[^/]*")
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?' && path:
+			b.WriteString("[^/]")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// persistedRules is the YAML file layout
+type persistedRules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Store holds the permission rules, saved as YAML
+type Store struct {
+	path  string
+	rules []Rule
+	mu    sync.RWMutex
+}
+
+// NewStore creates a rule store
+// path should be ~/.config/aria/permissions.yaml
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads the rules from disk
+func (s *Store) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading permissions file: %w", err)
+	}
+
+	var persisted persistedRules
+	if err := yaml.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("parsing permissions file: %w", err)
+	}
+	s.rules = persisted.Rules
+	return nil
+}
+
+// saveLocked writes the rules to disk (must hold lock)
+func (s *Store) saveLocked() error {
+	data, err := yaml.Marshal(&persistedRules{Rules: s.rules})
+	if err != nil {
+		return fmt.Errorf("marshaling permissions: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating permissions directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("writing permissions file: %w", err)
+	}
+	return nil
+}
+
+// Add saves a rule for a chat (0 = every chat)
+// Returns false if the same rule already exists
+func (s *Store) Add(chatID int64, r Rule) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ChatID = chatID
+	for _, existing := range s.rules {
+		if existing.ChatID == chatID && existing.String() == r.String() {
+			return false, nil
+		}
+	}
+	if r.Created.IsZero() {
+		r.Created = time.Now()
+	}
+	s.rules = append(s.rules, r)
+	return true, s.saveLocked()
+}
+
+// Remove deletes a rule, matched by chat and text
+// Returns false if there was no such rule
+func (s *Store) Remove(r Rule) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rules {
+		if existing.ChatID == r.ChatID && existing.String() == r.String() {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true, s.saveLocked()
+		}
+	}
+	return false, nil
+}
+
+// Rules returns the rules that apply to a chat: its own, then the global ones
+func (s *Store) Rules(chatID int64) []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var chat, global []Rule
+	for _, r := range s.rules {
+		switch r.ChatID {
+		case chatID:
+			chat = append(chat, r)
+		case 0:
+			global = append(global, r)
+		}
+	}
+	return append(chat, global...)
+}
+
+// Match returns the first rule that allows a tool call in a chat, or nil
+func (s *Store) Match(chatID int64, cwd string, toolName string, input map[string]interface{}) *Rule {
+	for _, r := range s.Rules(chatID) {
+		if r.Matches(toolName, input, cwd) {
+			return &r
+		}
+	}
+	return nil
+}
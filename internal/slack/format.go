@@ -0,0 +1,95 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regex patterns for markdown elements
+var (
+	codeBlockRegex     = regexp.MustCompile("(?s)```[a-zA-Z]*\\n?(.*?)```")
+	inlineCodeRegex    = regexp.MustCompile("`([^`]+)`")
+	linkRegex          = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	boldRegex          = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	italicRegex        = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	strikethroughRegex = regexp.MustCompile(`~~(.+?)~~`)
+	headingRegex       = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+)
+
+// escapeMrkdwn escapes the characters Slack treats as control sequences
+func escapeMrkdwn(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	text = strings.ReplaceAll(text, ">", "&gt;")
+	return text
+}
+
+// FormatMrkdwn converts standard markdown to Slack mrkdwn
+func FormatMrkdwn(text string) string {
+	placeholders := make(map[string]string)
+	counter := 0
+
+	// protect swaps formatted output for a key so later steps leave it alone
+	protect := func(value string) string {
+		key := fmt.Sprintf("XPLACEHOLDERX%dX", counter)
+		counter++
+		placeholders[key] = value
+		return key
+	}
+
+	// Step 1: Escape &, < and > everywhere, code included
+	text = escapeMrkdwn(text)
+
+	// Step 2: Code blocks lose their language tag, Slack doesn't highlight
+	text = codeBlockRegex.ReplaceAllStringFunc(text, func(match string) string {
+		code := codeBlockRegex.FindStringSubmatch(match)[1]
+		return protect("```\n" + strings.TrimSuffix(code, "\n") + "\n```")
+	})
+
+	// Step 3: Inline code is the same in both
+	text = inlineCodeRegex.ReplaceAllStringFunc(text, protect)
+
+	// Step 4: [text](url) becomes <url|text>
+	text = linkRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := linkRegex.FindStringSubmatch(match)
+		return protect(fmt.Sprintf("<%s|%s>", parts[2], parts[1]))
+	})
+
+	// Step 5: **bold** and # headings become *bold*
+	text = boldRegex.ReplaceAllStringFunc(text, func(match string) string {
+		return protect("*" + boldRegex.FindStringSubmatch(match)[1] + "*")
+	})
+	text = headingRegex.ReplaceAllStringFunc(text, func(match string) string {
+		return protect("*" + headingRegex.FindStringSubmatch(match)[1] + "*")
+	})
+
+	// Step 6: *italic* becomes _italic_, ~~strike~~ becomes ~strike~
+	text = italicRegex.ReplaceAllString(text, "_${1}_")
+	text = strikethroughRegex.ReplaceAllString(text, "~${1}~")
+
+	// Step 7: Restore placeholders, repeating for nested ones (code inside bold)
+	for i := 0; i < 3; i++ {
+		prevText := text
+		for key, value := range placeholders {
+			text = strings.ReplaceAll(text, key, value)
+		}
+		if text == prevText {
+			break
+		}
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// formatStatus renders status text as italic mrkdwn, one line at a time
+// (Slack italics don't span lines)
+func formatStatus(text string) string {
+	lines := strings.Split(FormatMrkdwn(text), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "_" + line + "_"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
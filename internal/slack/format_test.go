@@ -0,0 +1,66 @@
+package slack
+
+import "testing"
+
+func TestFormatMrkdwn(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "Hello! How are you?", "Hello! How are you?"},
+		{"bold", "This is **bold** text", "This is *bold* text"},
+		{"italic", "This is *italic* text", "This is _italic_ text"},
+		{"bold and italic", "**bold** and *italic*", "*bold* and _italic_"},
+		{"strikethrough", "This is ~~deleted~~ text", "This is ~deleted~ text"},
+		{"heading", "# Title\nbody", "*Title*\nbody"},
+		{"link", "See [docs](https://example.com)", "See <https://example.com|docs>"},
+		{"inline code", "Run `go **build**` now", "Run `go **build**` now"},
+		{"code block", "Example:\n```go\nfunc main() { a := *p }\n```", "Example:\n```\nfunc main() { a := *p }\n```"},
+		{"escapes", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"escapes in code", "`<div>`", "`&lt;div&gt;`"},
+		{"bullets untouched", "* one\n* two", "* one\n* two"},
+		{"multiplication untouched", "2 * 3 * 4", "2 * 3 * 4"},
+		{"code inside bold", "**run `ls`**", "*run `ls`*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatMrkdwn(tt.input); got != tt.want {
+				t.Errorf("FormatMrkdwn(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatStatus(t *testing.T) {
+	got := formatStatus("✓ Running `ls`\n◌ Reading main.go")
+	want := "_✓ Running `ls`_\n_◌ Reading main.go_"
+	if got != want {
+		t.Errorf("formatStatus() = %q, want %q", got, want)
+	}
+}
+
+func TestMessageIDRoundTrip(t *testing.T) {
+	for _, ts := range []string{"1700000000.000100", "1712345678.123456"} {
+		if got := idToTS(tsToID(ts)); got != ts {
+			t.Errorf("idToTS(tsToID(%q)) = %q", ts, got)
+		}
+	}
+}
+
+func TestChatIDs(t *testing.T) {
+	dm := chatIDFor(chatRef{Channel: "D123"})
+	thread := chatIDFor(chatRef{Channel: "D123", Thread: "1700000000.000100"})
+	if dm == thread {
+		t.Error("a DM and a thread in it share a chat ID")
+	}
+	for _, id := range []int64{dm, thread} {
+		if id <= 0 || !IsChatID(id) {
+			t.Errorf("chat ID %d is not a positive Slack chat ID", id)
+		}
+	}
+	if IsChatID(123456789) || IsChatID(-1001234567890) {
+		t.Error("Telegram chat IDs are treated as Slack chat IDs")
+	}
+}
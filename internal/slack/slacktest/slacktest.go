@@ -0,0 +1,584 @@
+// Package slacktest is a fake Slack Web API and Socket Mode server for
+// end-to-end tests
+//
+// Point the bot at APIURL() (slack.Options.APIURL) and drive it with
+// SendText, SlashCommand and PressButton, which are delivered as Socket Mode
+// envelopes. The server keeps every message the bot posts, edits, pins or
+// deletes so tests can wait for and inspect them.
+package slacktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// BotUserID is the user ID of the fake bot
+const BotUserID = "UBOT"
+
+// pingInterval is how often the socket pings the client, which reconnects
+// if it goes too long without one
+const pingInterval = time.Second
+
+// Message is a message in the fake server, sent by a user or the bot
+type Message struct {
+	TS       string // Unique, and increasing in the order messages were sent
+	Channel  string
+	ThreadTS string // Thread the message was posted in, "" for top level
+	User     string
+	FromBot  bool
+	Text     string
+	Buttons  [][]Button // Block Kit buttons, one row per actions block
+	File     string     // Name of a file the bot uploaded, Text is its comment
+	FileData []byte
+	Edits    int
+	Pinned   bool
+	Deleted  bool
+}
+
+// Button is a Block Kit button
+type Button struct {
+	Text     string
+	ActionID string
+	Value    string
+}
+
+// Button returns the first button with the given text, or nil
+func (m Message) Button(text string) *Button {
+	for _, row := range m.Buttons {
+		for _, b := range row {
+			if b.Text == text {
+				return &b
+			}
+		}
+	}
+	return nil
+}
+
+// Server is a fake Slack server
+type Server struct {
+	URL string
+
+	srv        *httptest.Server
+	upgrader   websocket.Upgrader
+	outbox     chan []byte // Envelopes waiting for the socket
+	mu         sync.Mutex
+	changed    chan struct{} // Closed and replaced whenever state changes
+	closed     chan struct{}
+	seq        int64
+	messages   []*Message
+	ephemerals []string
+	acks       map[string]json.RawMessage
+	uploads    map[string]upload // Files uploaded but not yet shared, by file ID
+}
+
+// upload is a file uploaded to an upload URL
+type upload struct {
+	name string
+	data []byte
+}
+
+// NewServer starts a fake Slack server
+func NewServer() *Server {
+	s := &Server{
+		outbox:  make(chan []byte, 100),
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+		acks:    make(map[string]json.RawMessage),
+		uploads: make(map[string]upload),
+	}
+	// The client sends Slack's origin, not ours
+	s.upgrader.CheckOrigin = func(*http.Request) bool { return true }
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+// APIURL returns the Web API base URL for slack.Options.APIURL
+func (s *Server) APIURL() string {
+	return s.URL + "/api/"
+}
+
+// Close stops the server, dropping the socket connection
+func (s *Server) Close() {
+	close(s.closed)
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// SendText delivers a message from a user and returns its timestamp
+// channelType is "im" for DMs and "channel" otherwise; thread may be empty
+func (s *Server) SendText(channel, channelType, user, text, thread string) string {
+	s.mu.Lock()
+	msg := s.addMessageLocked(channel, thread, false, text)
+	msg.User = user
+	event := map[string]interface{}{
+		"type":         "message",
+		"channel":      channel,
+		"channel_type": channelType,
+		"user":         user,
+		"text":         text,
+		"ts":           msg.TS,
+	}
+	if thread != "" {
+		event["thread_ts"] = thread
+	}
+	id := s.nextIDLocked("Ev")
+	s.mu.Unlock()
+
+	s.send("events_api", map[string]interface{}{
+		"type":       "event_callback",
+		"team_id":    "T1",
+		"api_app_id": "A1",
+		"event_id":   id,
+		"event_time": time.Now().Unix(),
+		"event":      event,
+	})
+	return msg.TS
+}
+
+// SlashCommand delivers a slash command and waits for the bot to acknowledge
+// it, returning the text of the acknowledgement ("" if it had none)
+func (s *Server) SlashCommand(channel, user, command, text string, timeout time.Duration) (string, error) {
+	// Slack sends every slash command field as a string
+	id := s.send("slash_commands", map[string]interface{}{
+		"command":               command,
+		"text":                  text,
+		"channel_id":            channel,
+		"user_id":               user,
+		"team_id":               "T1",
+		"is_enterprise_install": "false",
+	})
+
+	ack, err := s.waitAck(id, timeout)
+	if err != nil {
+		return "", err
+	}
+	var payload struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(ack, &payload)
+	return payload.Text, nil
+}
+
+// PressButton delivers a block_actions interaction for a button on a bot message
+func (s *Server) PressButton(user string, msg Message, button Button) {
+	message := map[string]interface{}{"ts": msg.TS}
+	if msg.ThreadTS != "" {
+		message["thread_ts"] = msg.ThreadTS
+	}
+	s.send("interactive", map[string]interface{}{
+		"type":    "block_actions",
+		"user":    map[string]interface{}{"id": user},
+		"channel": map[string]interface{}{"id": msg.Channel},
+		"message": message,
+		"actions": []map[string]interface{}{{
+			"type":      "button",
+			"block_id":  "actions",
+			"action_id": button.ActionID,
+			"value":     button.Value,
+			"text":      map[string]interface{}{"type": "plain_text", "text": button.Text},
+		}},
+	})
+}
+
+// Messages returns a copy of every message in a channel's thread, oldest first
+// thread "" is the channel's top level
+func (s *Server) Messages(channel, thread string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Message
+	for _, m := range s.messages {
+		if m.Channel == channel && m.ThreadTS == thread {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// Ephemerals returns the text of every chat.postEphemeral call
+func (s *Server) Ephemerals() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ephemerals...)
+}
+
+// WaitFor waits until a live (not deleted) bot message in the thread matches
+// Returns an error listing the thread's messages on timeout
+func (s *Server) WaitFor(channel, thread string, timeout time.Duration, match func(Message) bool) (Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		for _, m := range s.messages {
+			if m.Channel == channel && m.ThreadTS == thread && m.FromBot && !m.Deleted && match(*m) {
+				found := *m
+				s.mu.Unlock()
+				return found, nil
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return Message{}, fmt.Errorf("timed out waiting for message; thread has:\n%s", s.dump(channel, thread))
+		}
+	}
+}
+
+// WaitForText waits for a live bot message containing text
+func (s *Server) WaitForText(channel, thread string, timeout time.Duration, text string) (Message, error) {
+	return s.WaitFor(channel, thread, timeout, func(m Message) bool {
+		return strings.Contains(m.Text, text)
+	})
+}
+
+// dump formats a thread's messages for failure output
+func (s *Server) dump(channel, thread string) string {
+	var b strings.Builder
+	for _, m := range s.Messages(channel, thread) {
+		from := m.User
+		if m.FromBot {
+			from = "bot"
+		}
+		var flags []string
+		if m.Deleted {
+			flags = append(flags, "deleted")
+		}
+		if m.Edits > 0 {
+			flags = append(flags, fmt.Sprintf("edited %d", m.Edits))
+		}
+		if m.Buttons != nil {
+			flags = append(flags, fmt.Sprintf("buttons %v", m.Buttons))
+		}
+		fmt.Fprintf(&b, "  %s %s %q %v\n", m.TS, from, m.Text, flags)
+	}
+	return b.String()
+}
+
+// send queues a Socket Mode envelope and returns its envelope ID
+func (s *Server) send(kind string, payload interface{}) string {
+	s.mu.Lock()
+	id := s.nextIDLocked("env")
+	s.mu.Unlock()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"envelope_id": id,
+		"type":        kind,
+		"payload":     payload,
+	})
+	s.outbox <- data
+	return id
+}
+
+// waitAck waits for the bot to acknowledge an envelope
+func (s *Server) waitAck(id string, timeout time.Duration) (json.RawMessage, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		ack, ok := s.acks[id]
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return ack, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for ack of %s", id)
+		}
+	}
+}
+
+// nextIDLocked returns a unique ID with a prefix (must hold lock)
+func (s *Server) nextIDLocked(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%d", prefix, s.seq)
+}
+
+// addMessageLocked stores a new message (must hold lock)
+func (s *Server) addMessageLocked(channel, thread string, fromBot bool, text string) *Message {
+	s.seq++
+	msg := &Message{
+		TS:       fmt.Sprintf("1700000000.%06d", s.seq),
+		Channel:  channel,
+		ThreadTS: thread,
+		FromBot:  fromBot,
+		Text:     text,
+	}
+	s.messages = append(s.messages, msg)
+	s.notifyLocked()
+	return msg
+}
+
+// findLocked returns a message by channel and timestamp (must hold lock)
+func (s *Server) findLocked(channel, ts string) *Message {
+	for _, m := range s.messages {
+		if m.Channel == channel && m.TS == ts {
+			return m
+		}
+	}
+	return nil
+}
+
+// notifyLocked wakes anyone waiting on a state change (must hold lock)
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// handle serves /api/<method>, the /ws socket and /upload/<file ID>
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ws" {
+		s.serveSocket(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		s.serveUpload(w, r)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	r.ParseForm()
+	params := map[string]string{}
+	for k, v := range r.Form {
+		params[k] = v[0]
+	}
+
+	if method == "apps.connections.open" {
+		writeJSON(w, map[string]interface{}{
+			"ok":  true,
+			"url": "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+		})
+		return
+	}
+
+	s.mu.Lock()
+	result, err := s.callLocked(method, params)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": err.Error()})
+		return
+	}
+	result["ok"] = true
+	writeJSON(w, result)
+}
+
+// callLocked handles a Web API method (must hold lock)
+func (s *Server) callLocked(method string, params map[string]string) (map[string]interface{}, error) {
+	channel := params["channel"]
+
+	switch method {
+	case "auth.test":
+		return map[string]interface{}{
+			"user_id": BotUserID,
+			"user":    "aria",
+			"team_id": "T1",
+			"team":    "Test",
+			"bot_id":  "B1",
+		}, nil
+
+	case "chat.postMessage":
+		msg := s.addMessageLocked(channel, params["thread_ts"], true, params["text"])
+		msg.User = BotUserID
+		msg.Buttons = parseButtons(params["blocks"])
+		return map[string]interface{}{"channel": channel, "ts": msg.TS}, nil
+
+	case "chat.update":
+		msg := s.findLocked(channel, params["ts"])
+		if msg == nil || msg.Deleted {
+			return nil, fmt.Errorf("message_not_found")
+		}
+		msg.Text = params["text"]
+		msg.Buttons = parseButtons(params["blocks"])
+		msg.Edits++
+		s.notifyLocked()
+		return map[string]interface{}{"channel": channel, "ts": msg.TS, "text": msg.Text}, nil
+
+	case "chat.delete":
+		msg := s.findLocked(channel, params["ts"])
+		if msg == nil || msg.Deleted {
+			return nil, fmt.Errorf("message_not_found")
+		}
+		msg.Deleted = true
+		s.notifyLocked()
+		return map[string]interface{}{"channel": channel, "ts": msg.TS}, nil
+
+	case "chat.postEphemeral":
+		s.ephemerals = append(s.ephemerals, params["text"])
+		s.notifyLocked()
+		return map[string]interface{}{"message_ts": s.nextIDLocked("eph")}, nil
+
+	case "files.getUploadURLExternal":
+		fileID := s.nextIDLocked("F")
+		s.uploads[fileID] = upload{name: params["filename"]}
+		return map[string]interface{}{
+			"upload_url": s.URL + "/upload/" + fileID,
+			"file_id":    fileID,
+		}, nil
+
+	case "files.completeUploadExternal":
+		var files []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		}
+		json.Unmarshal([]byte(params["files"]), &files)
+		for _, f := range files {
+			up, ok := s.uploads[f.ID]
+			if !ok || up.data == nil {
+				return nil, fmt.Errorf("file_not_found")
+			}
+			delete(s.uploads, f.ID)
+			msg := s.addMessageLocked(params["channel_id"], params["thread_ts"], true, params["initial_comment"])
+			msg.User = BotUserID
+			msg.File = up.name
+			msg.FileData = up.data
+		}
+		return map[string]interface{}{"files": files}, nil
+
+	case "pins.add", "pins.remove":
+		msg := s.findLocked(channel, params["timestamp"])
+		if msg == nil {
+			return nil, fmt.Errorf("message_not_found")
+		}
+		msg.Pinned = method == "pins.add"
+		s.notifyLocked()
+		return map[string]interface{}{}, nil
+	}
+
+	return nil, fmt.Errorf("method %s not supported by slacktest", method)
+}
+
+// serveUpload stores a file posted to an upload URL
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	fileID := strings.TrimPrefix(r.URL.Path, "/upload/")
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, ok := s.uploads[fileID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	up.data = data
+	s.uploads[fileID] = up
+	fmt.Fprintf(w, "OK - %d", len(data))
+}
+
+// serveSocket says hello, then writes queued envelopes and pings until the
+// client disconnects or the server closes
+func (s *Server) serveSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	hello := `{"type":"hello","num_connections":1,"connection_info":{"app_id":"A1"}}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(hello)); err != nil {
+		return
+	}
+
+	// Read acks until the connection drops
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			var ack struct {
+				EnvelopeID string          `json:"envelope_id"`
+				Payload    json.RawMessage `json:"payload"`
+			}
+			if err := conn.ReadJSON(&ack); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.acks[ack.EnvelopeID] = ack.Payload
+			s.notifyLocked()
+			s.mu.Unlock()
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case data := <-s.outbox:
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				// Put it back for the next connection
+				s.outbox <- data
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// parseButtons extracts buttons from a blocks param
+func parseButtons(blocks string) [][]Button {
+	if blocks == "" {
+		return nil
+	}
+	var parsed []struct {
+		Type     string `json:"type"`
+		Elements []struct {
+			Type     string `json:"type"`
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+			Text     struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(blocks), &parsed); err != nil {
+		return nil
+	}
+
+	var rows [][]Button
+	for _, block := range parsed {
+		if block.Type != "actions" {
+			continue
+		}
+		var row []Button
+		for _, e := range block.Elements {
+			if e.Type == "button" {
+				row = append(row, Button{Text: e.Text.Text, ActionID: e.ActionID, Value: e.Value})
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -6,41 +6,37 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
-)
-
-// RespondFunc sends a markdown message (will be converted to HTML)
-type RespondFunc func(text string, silent bool)
 
-// ReplyHTMLFunc sends pre-formatted HTML as a reply to a specific message
-type ReplyHTMLFunc func(html string, replyToMsgID int64, silent bool)
-
-// MessageHandler is called when a message is received from an allowed user
-// msgID is the ID of the user's message (for replies)
-type MessageHandler func(ctx context.Context, chatID int64, userID int64, msgID int64, text string, respond RespondFunc, replyHTML ReplyHTMLFunc)
+	"github.com/codegangsta/aria/internal/frontend"
+	"github.com/codegangsta/aria/internal/transcribe"
+)
 
-// CallbackHandler is called when an inline keyboard button is pressed
-// Returns the text to show the user after button press
-type CallbackHandler func(ctx context.Context, chatID int64, userID int64, data string) string
+var _ frontend.Frontend = (*Bot)(nil)
 
-// Bot wraps the Telegram bot functionality
+// Bot wraps the Telegram bot functionality and implements frontend.Frontend
 type Bot struct {
 	bot                *gotgbot.Bot
 	updater            *ext.Updater
 	allowlist          map[int64]bool
-	handler            MessageHandler
-	callbackHandler    CallbackHandler
+	handler            frontend.MessageHandler
+	callbackHandler    frontend.CallbackHandler
 	logger             *slog.Logger
 	debug              bool
+	commandsMu         sync.Mutex // Held while registering, chats finish turns concurrently
 	commandsRegistered bool
+	webhook            Webhook
+	transcriber        transcribe.Transcriber
 }
 
 // New creates a new Telegram bot
-func New(token string, allowlist []int64, debug bool, logger *slog.Logger) (*Bot, error) {
+// apiURL points the bot at a different Bot API server (a local one, or a fake in tests), empty = Telegram's
+func New(token string, apiURL string, allowlist []int64, debug bool, logger *slog.Logger) (*Bot, error) {
 	// Create HTTP client with longer timeout for long-polling
 	httpClient := http.Client{
 		Timeout: 60 * time.Second,
@@ -49,6 +45,9 @@ func New(token string, allowlist []int64, debug bool, logger *slog.Logger) (*Bot
 	bot, err := gotgbot.NewBot(token, &gotgbot.BotOpts{
 		BotClient: &gotgbot.BaseBotClient{
 			Client: httpClient,
+			DefaultRequestOpts: &gotgbot.RequestOpts{
+				APIURL: apiURL,
+			},
 		},
 	})
 	if err != nil {
@@ -72,16 +71,17 @@ func New(token string, allowlist []int64, debug bool, logger *slog.Logger) (*Bot
 }
 
 // SetHandler sets the message handler function
-func (b *Bot) SetHandler(h MessageHandler) {
+func (b *Bot) SetHandler(h frontend.MessageHandler) {
 	b.handler = h
 }
 
 // SetCallbackHandler sets the callback query handler function
-func (b *Bot) SetCallbackHandler(h CallbackHandler) {
+func (b *Bot) SetCallbackHandler(h frontend.CallbackHandler) {
 	b.callbackHandler = h
 }
 
-// Start begins polling for updates and blocks until context is cancelled
+// Start begins receiving updates and blocks until context is cancelled
+// Updates arrive by webhook if one is set and starts, by long polling otherwise
 func (b *Bot) Start(ctx context.Context) error {
 	// Create updater and dispatcher
 	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
@@ -99,33 +99,50 @@ func (b *Bot) Start(ctx context.Context) error {
 	// Add callback query handler for inline keyboard buttons
 	dispatcher.AddHandler(handlers.NewCallback(nil, b.handleCallback))
 
-	// Start polling
-	err := b.updater.StartPolling(b.bot, &ext.PollingOpts{
-		DropPendingUpdates: true,
-		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
-			Timeout: 30,
-			AllowedUpdates: []string{
-				"message",
-				"callback_query",
-			},
-			RequestOpts: &gotgbot.RequestOpts{
-				Timeout: 60 * time.Second,
+	var server *http.Server
+	if b.webhook.URL != "" {
+		var err error
+		server, err = b.startWebhook()
+		if err != nil {
+			b.logger.Warn("telegram webhook failed, falling back to long polling", "error", err)
+		}
+	}
+
+	if server == nil {
+		// Start polling (this also deletes any webhook left from a previous run)
+		err := b.updater.StartPolling(b.bot, &ext.PollingOpts{
+			DropPendingUpdates: true,
+			GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
+				Timeout: 30,
+				AllowedUpdates: []string{
+					"message",
+					"callback_query",
+				},
+				RequestOpts: &gotgbot.RequestOpts{
+					Timeout: 60 * time.Second,
+				},
 			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("starting polling: %w", err)
+		})
+		if err != nil {
+			return fmt.Errorf("starting polling: %w", err)
+		}
 	}
 
 	b.logger.Info("telegram bot started",
 		"username", b.bot.Username,
 		"allowlist_count", len(b.allowlist),
+		"webhook", server != nil,
 	)
 
 	// Wait for context cancellation
 	<-ctx.Done()
 
-	// Stop polling gracefully
+	// Stop receiving updates gracefully
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+	}
 	b.updater.Stop()
 	b.logger.Info("telegram bot stopped")
 
@@ -135,7 +152,7 @@ func (b *Bot) Start(ctx context.Context) error {
 // handleMessage processes incoming messages
 func (b *Bot) handleMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
 	msg := ctx.EffectiveMessage
-	if msg == nil || msg.Text == "" {
+	if msg == nil || (msg.Text == "" && msg.Caption == "" && audioFile(msg) == "" && !hasAttachment(msg)) {
 		return nil
 	}
 
@@ -152,11 +169,31 @@ func (b *Bot) handleMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
+	text := msg.Text
+	var attachments []frontend.Attachment
+	switch {
+	case hasAttachment(msg):
+		text = msg.Caption
+		b.startTyping(chatID)
+		var err error
+		if attachments, err = b.attachments(msg); err != nil {
+			b.logger.Warn("attachment download failed", "chat_id", chatID, "error", err)
+			b.SendMessage(chatID, fmt.Sprintf("Couldn't download attachment: %v", err), false)
+			return nil
+		}
+	case text == "" && audioFile(msg) != "":
+		var ok bool
+		if text, ok = b.transcribeMessage(msg); !ok {
+			return nil
+		}
+	}
+
 	b.logger.Info("processing message",
 		"user_id", userID,
 		"chat_id", chatID,
 		"username", msg.From.Username,
-		"text_length", len(msg.Text),
+		"text_length", len(text),
+		"attachments", len(attachments),
 	)
 
 	// Call the handler if set
@@ -169,68 +206,42 @@ func (b *Bot) handleMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 		// respond converts markdown to MarkdownV2 before sending
 		respond := func(text string, silent bool) {
-			formatted := FormatMarkdownV2(text)
-			opts := &gotgbot.SendMessageOpts{
-				ParseMode:           "MarkdownV2",
-				DisableNotification: silent,
-			}
-			if _, err := bot.SendMessage(chatID, formatted, opts); err != nil {
-				// If MarkdownV2 parsing fails, fall back to plain text
-				b.logger.Warn("MarkdownV2 send failed, retrying plain",
-					"chat_id", chatID,
-					"error", err,
-					"formatted", formatted,
-				)
-				plainOpts := &gotgbot.SendMessageOpts{
-					DisableNotification: silent,
-				}
-				if _, err := bot.SendMessage(chatID, text, plainOpts); err != nil {
-					b.logger.Error("failed to send message",
-						"chat_id", chatID,
-						"error", err,
-					)
-				}
-			}
-		}
-
-		// replyMarkdown sends pre-formatted MarkdownV2 as a reply to a specific message
-		replyHTML := func(text string, replyToMsgID int64, silent bool) {
-			opts := &gotgbot.SendMessageOpts{
-				ParseMode:           "MarkdownV2",
-				DisableNotification: silent,
-				ReplyParameters: &gotgbot.ReplyParameters{
-					MessageId: replyToMsgID,
-				},
-			}
-			if _, err := bot.SendMessage(chatID, text, opts); err != nil {
-				b.logger.Warn("MarkdownV2 reply failed, retrying plain",
+			if err := b.SendMessage(chatID, text, silent); err != nil {
+				b.logger.Error("failed to send message",
 					"chat_id", chatID,
-					"reply_to", replyToMsgID,
 					"error", err,
 				)
-				// Fall back to plain text
-				plainOpts := &gotgbot.SendMessageOpts{
-					DisableNotification: silent,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMsgID,
-					},
-				}
-				if _, err := bot.SendMessage(chatID, text, plainOpts); err != nil {
-					b.logger.Error("failed to send reply",
-						"chat_id", chatID,
-						"error", err,
-					)
-				}
 			}
 		}
 
 		// Call handler (this blocks until Claude responds)
-		b.handler(msgCtx, chatID, userID, msg.MessageId, msg.Text, respond, replyHTML)
+		b.handler(msgCtx, chatID, userID, msg.MessageId, text, attachments, b.replyTo(msg), respond)
 	}
 
 	return nil
 }
 
+// replyTo returns the message msg replies to, nil if it isn't a reply
+// A partial quote the user selected is used instead of the whole message
+func (b *Bot) replyTo(msg *gotgbot.Message) *frontend.Reply {
+	replied := msg.ReplyToMessage
+	if replied == nil {
+		return nil
+	}
+	reply := &frontend.Reply{
+		MessageID: replied.MessageId,
+		Text:      replied.Text,
+		FromBot:   replied.From != nil && replied.From.Id == b.bot.Id,
+	}
+	if reply.Text == "" {
+		reply.Text = replied.Caption
+	}
+	if msg.Quote != nil && msg.Quote.Text != "" {
+		reply.Text = msg.Quote.Text
+	}
+	return reply
+}
+
 // handleCallback processes callback queries from inline keyboard buttons
 func (b *Bot) handleCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.CallbackQuery
@@ -282,50 +293,80 @@ func (b *Bot) startTyping(chatID int64) {
 // SendMessage sends a text message to a chat with MarkdownV2 formatting
 // silent=true disables notification sound
 func (b *Bot) SendMessage(chatID int64, text string, silent bool) error {
-	formatted := FormatMarkdownV2(text)
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:           "MarkdownV2",
+	_, err := b.sendMarkdown(chatID, FormatMarkdownV2(text), text, &gotgbot.SendMessageOpts{
 		DisableNotification: silent,
-	}
-	_, err := b.bot.SendMessage(chatID, formatted, opts)
-	if err != nil {
-		// Fall back to plain text if MarkdownV2 fails
-		b.logger.Warn("MarkdownV2 send failed, retrying plain", "error", err, "formatted", formatted)
-		plainOpts := &gotgbot.SendMessageOpts{
-			DisableNotification: silent,
-		}
-		_, err = b.bot.SendMessage(chatID, text, plainOpts)
-	}
+	})
 	return err
 }
 
-// SendMessageMarkdownV2 sends a pre-formatted MarkdownV2 message (no additional escaping)
-// Use this for text that's already escaped for MarkdownV2
-func (b *Bot) SendMessageMarkdownV2(chatID int64, text string, silent bool) error {
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:           "MarkdownV2",
-		DisableNotification: silent,
-	}
-	_, err := b.bot.SendMessage(chatID, text, opts)
+// SendNotification sends a silent message and returns the message ID
+// Used for messages that may be edited later (streamed text, progress)
+func (b *Bot) SendNotification(chatID int64, text string) (int64, error) {
+	return b.sendMarkdown(chatID, FormatMarkdownV2(text), text, &gotgbot.SendMessageOpts{
+		DisableNotification: true,
+	})
+}
+
+// SendStatus sends a silent italic status message and returns the message ID
+// Used for tool notifications that are edited as tools complete
+func (b *Bot) SendStatus(chatID int64, text string) (int64, error) {
+	return b.sendMarkdown(chatID, formatStatus(text), text, &gotgbot.SendMessageOpts{
+		DisableNotification: true,
+	})
+}
+
+// SendKeyboard sends a message with an inline keyboard and returns the message ID
+func (b *Bot) SendKeyboard(chatID int64, text string, keyboard frontend.Keyboard) (int64, error) {
+	return b.sendMarkdown(chatID, FormatMarkdownV2(text), text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: inlineKeyboard(keyboard),
+	})
+}
+
+// sendMarkdown sends pre-formatted MarkdownV2, falling back to the plain text
+// if Telegram rejects the formatting
+func (b *Bot) sendMarkdown(chatID int64, formatted string, plain string, opts *gotgbot.SendMessageOpts) (int64, error) {
+	plainOpts := *opts
+	opts.ParseMode = "MarkdownV2"
+	msg, err := b.bot.SendMessage(chatID, formatted, opts)
 	if err != nil {
-		b.logger.Warn("MarkdownV2 send failed", "error", err, "text", text)
+		b.logger.Warn("MarkdownV2 send failed, retrying plain", "chat_id", chatID, "error", err, "formatted", formatted)
+		msg, err = b.bot.SendMessage(chatID, plain, &plainOpts)
+		if err != nil {
+			b.logger.Warn("failed to send message", "chat_id", chatID, "error", err)
+			return 0, err
+		}
 	}
-	return err
+	return msg.MessageId, nil
 }
 
-// SendToolNotification sends a tool notification and returns the message ID
-// Used for tool call notifications that may be edited later
-func (b *Bot) SendToolNotification(chatID int64, text string) (int64, error) {
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:           "MarkdownV2",
-		DisableNotification: true, // Always silent for tool notifications
+// inlineKeyboard converts a frontend keyboard to Telegram's inline keyboard markup
+func inlineKeyboard(keyboard frontend.Keyboard) gotgbot.InlineKeyboardMarkup {
+	rows := make([][]gotgbot.InlineKeyboardButton, 0, len(keyboard.Rows))
+	for _, row := range keyboard.Rows {
+		buttons := make([]gotgbot.InlineKeyboardButton, 0, len(row))
+		for _, button := range row {
+			buttons = append(buttons, gotgbot.InlineKeyboardButton{
+				Text:         button.Text,
+				CallbackData: button.Data,
+			})
+		}
+		rows = append(rows, buttons)
 	}
-	msg, err := b.bot.SendMessage(chatID, text, opts)
-	if err != nil {
-		b.logger.Warn("failed to send tool notification", "error", err, "text", text)
-		return 0, err
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// formatStatus renders status text as italic MarkdownV2
+func formatStatus(text string) string {
+	return "_" + FormatMarkdownV2(text) + "_"
+}
+
+// formatQuote renders text as a MarkdownV2 blockquote, escaped verbatim
+func formatQuote(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = ">" + escapeMarkdownV2(line)
 	}
-	return msg.MessageId, nil
+	return strings.Join(lines, "\n")
 }
 
 // EditMessageMarkdownV2 edits an existing message with new MarkdownV2 content
@@ -344,6 +385,34 @@ func (b *Bot) EditMessageMarkdownV2(chatID int64, msgID int64, text string) erro
 	return err
 }
 
+// EditMessage edits an existing message, converting markdown to MarkdownV2
+// Falls back to plain text if MarkdownV2 parsing fails
+func (b *Bot) EditMessage(chatID int64, msgID int64, text string) error {
+	return b.editMarkdown(chatID, msgID, FormatMarkdownV2(text), text)
+}
+
+// EditStatus edits a message sent with SendStatus, keeping it italic
+func (b *Bot) EditStatus(chatID int64, msgID int64, text string) error {
+	return b.editMarkdown(chatID, msgID, formatStatus(text), text)
+}
+
+// editMarkdown edits a message with pre-formatted MarkdownV2, falling back to plain text
+func (b *Bot) editMarkdown(chatID int64, msgID int64, formatted string, plain string) error {
+	err := b.EditMessageMarkdownV2(chatID, msgID, formatted)
+	if err == nil {
+		return nil
+	}
+	// Re-rendering the same text isn't a formatting problem
+	if strings.Contains(err.Error(), "message is not modified") {
+		return err
+	}
+	_, _, err = b.bot.EditMessageText(plain, &gotgbot.EditMessageTextOpts{
+		ChatId:    chatID,
+		MessageId: msgID,
+	})
+	return err
+}
+
 // PinMessage pins a message in the chat (silently by default)
 func (b *Bot) PinMessage(chatID int64, msgID int64) error {
 	_, err := b.bot.PinChatMessage(chatID, msgID, &gotgbot.PinChatMessageOpts{
@@ -368,58 +437,17 @@ func (b *Bot) UnpinMessage(chatID int64, msgID int64) error {
 
 // SendAndPinMessage sends a message and pins it, returning the message ID
 func (b *Bot) SendAndPinMessage(chatID int64, text string) (int64, error) {
-	formatted := FormatMarkdownV2(text)
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:           "MarkdownV2",
-		DisableNotification: true,
-	}
-	msg, err := b.bot.SendMessage(chatID, formatted, opts)
+	msgID, err := b.SendNotification(chatID, text)
 	if err != nil {
-		b.logger.Warn("failed to send message for pinning", "error", err)
 		return 0, err
 	}
 
 	// Pin the message (ignore pin errors - might not have permission)
-	if pinErr := b.PinMessage(chatID, msg.MessageId); pinErr != nil {
+	if pinErr := b.PinMessage(chatID, msgID); pinErr != nil {
 		b.logger.Debug("could not pin message (permissions?)", "error", pinErr)
 	}
 
-	return msg.MessageId, nil
-}
-
-// SendQuestionKeyboard sends a question with inline keyboard options
-func (b *Bot) SendQuestionKeyboard(chatID int64, text string, keyboard gotgbot.InlineKeyboardMarkup) (int64, error) {
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:   "MarkdownV2",
-		ReplyMarkup: keyboard,
-	}
-	msg, err := b.bot.SendMessage(chatID, text, opts)
-	if err != nil {
-		b.logger.Error("failed to send question keyboard",
-			"chat_id", chatID,
-			"error", err,
-		)
-		return 0, err
-	}
-	return msg.MessageId, nil
-}
-
-// SendPermissionKeyboard sends a permission request with inline keyboard
-// Returns the message ID for later editing/deletion
-func (b *Bot) SendPermissionKeyboard(chatID int64, text string, keyboard gotgbot.InlineKeyboardMarkup) (int64, error) {
-	opts := &gotgbot.SendMessageOpts{
-		ParseMode:   "MarkdownV2",
-		ReplyMarkup: keyboard,
-	}
-	msg, err := b.bot.SendMessage(chatID, text, opts)
-	if err != nil {
-		b.logger.Error("failed to send permission keyboard",
-			"chat_id", chatID,
-			"error", err,
-		)
-		return 0, err
-	}
-	return msg.MessageId, nil
+	return msgID, nil
 }
 
 // DeleteMessage deletes a message by ID
@@ -453,28 +481,17 @@ func (b *Bot) TypingLoop(chatID int64) func() {
 	return cancel
 }
 
-// builtinCommands are Claude Code commands not exposed in the init event's slash_commands
-// Also includes ARIA-specific commands handled before Claude
-var builtinCommands = []string{
-	"clear",    // Clear conversation history
-	"compact",  // Compact conversation context
-	"help",     // Show help
-	"memory",   // Edit CLAUDE.md
-	"sessions", // Switch between Claude sessions
-	"rebuild",  // Rebuild and restart ARIA
-	"exit",     // Exit for launchd restart
-	"cd",       // Change directory
-}
-
 // RegisterCommands registers slash commands with Telegram's command menu
 // Only registers once per bot lifetime
 func (b *Bot) RegisterCommands(commands []string) {
+	b.commandsMu.Lock()
+	defer b.commandsMu.Unlock()
 	if b.commandsRegistered || len(commands) == 0 {
 		return
 	}
 
 	// Combine discovered commands with known built-in commands
-	allCommands := append(commands, builtinCommands...)
+	allCommands := append(commands, frontend.BuiltinCommands...)
 
 	// Build bot commands with descriptions
 	// Telegram commands must be lowercase, 1-32 chars, only a-z, 0-9, and underscores
@@ -495,7 +512,7 @@ func (b *Bot) RegisterCommands(commands []string) {
 
 		botCommands = append(botCommands, gotgbot.BotCommand{
 			Command:     telegramCmd,
-			Description: getCommandDescription(cmd),
+			Description: frontend.CommandDescription(cmd),
 		})
 	}
 
@@ -540,35 +557,3 @@ func isValidTelegramCommand(cmd string) bool {
 	}
 	return true
 }
-
-// getCommandDescription returns a human-readable description for a command
-func getCommandDescription(cmd string) string {
-	descriptions := map[string]string{
-		// Built-in commands
-		"clear":   "Clear conversation history",
-		"compact": "Compact conversation context",
-		"help":    "Show available commands",
-		"memory":  "Edit CLAUDE.md memory file",
-		"exit": "Restart ARIA via launchd",
-		"cd":   "Change working directory",
-		// Skills
-		"commit":            "Stage and commit changes",
-		"calendar":          "View and create calendar events",
-		"mail":              "Read and manage email",
-		"gtd-daily-review":  "Morning GTD daily review",
-		"gtd-weekly-review": "Weekly GTD review",
-		"gtd-process-inbox": "Process Things 3 inbox",
-		"gtd-next-action":   "Get next action from Things 3",
-		"gtd-project":       "Work through a Things 3 project",
-		"gtd-clarify":       "Clarify today's tasks",
-		"things3":           "Things 3 task management",
-		"plan-to-project":   "Convert plan to Things 3 project",
-		"reflect": "Reflect on session",
-		"browser": "Browser automation",
-	}
-
-	if desc, ok := descriptions[cmd]; ok {
-		return desc
-	}
-	return "Claude skill"
-}
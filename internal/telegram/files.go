@@ -0,0 +1,145 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// Bot API file size limits
+const (
+	maxFileSize   = 20 << 20 // download
+	maxUploadSize = 50 << 20 // upload as a document
+	maxPhotoSize  = 10 << 20 // upload as a photo
+)
+
+// photoTypes are the image formats Telegram shows as photos
+var photoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// attachmentTimeout bounds downloading a message's attachments
+const attachmentTimeout = 2 * time.Minute
+
+// hasAttachment reports whether a message carries a photo or document
+func hasAttachment(msg *gotgbot.Message) bool {
+	return len(msg.Photo) > 0 || msg.Document != nil
+}
+
+// attachments downloads a message's photo or document
+// Photos arrive in several sizes; the largest is used
+func (b *Bot) attachments(msg *gotgbot.Message) ([]frontend.Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), attachmentTimeout)
+	defer cancel()
+
+	var fileID, name, mimeType string
+	var size int64
+	switch {
+	case len(msg.Photo) > 0:
+		photo := msg.Photo[len(msg.Photo)-1]
+		fileID, size = photo.FileId, photo.FileSize
+		name = fmt.Sprintf("photo-%d.jpg", msg.MessageId)
+		mimeType = "image/jpeg"
+	case msg.Document != nil:
+		fileID, size = msg.Document.FileId, msg.Document.FileSize
+		name, mimeType = msg.Document.FileName, msg.Document.MimeType
+	default:
+		return nil, nil
+	}
+	if size > maxFileSize {
+		return nil, fmt.Errorf("file is over Telegram's 20 MB download limit")
+	}
+
+	data, filePath, err := b.fetchFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	return []frontend.Attachment{{Name: name, MimeType: mimeType, Data: data}}, nil
+}
+
+// SendFile uploads a file, as a photo if it's a small enough image and as
+// a document otherwise
+func (b *Bot) SendFile(chatID int64, path string, caption string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxUploadSize {
+		return fmt.Errorf("file is over Telegram's 50 MB upload limit")
+	}
+
+	name := filepath.Base(path)
+	if photoTypes[mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))] && info.Size() <= maxPhotoSize {
+		_, err = b.bot.SendPhoto(chatID, gotgbot.InputFileByReader(name, f), &gotgbot.SendPhotoOpts{
+			Caption: caption,
+		})
+	} else {
+		_, err = b.bot.SendDocument(chatID, gotgbot.InputFileByReader(name, f), &gotgbot.SendDocumentOpts{
+			Caption: caption,
+		})
+	}
+	if err != nil {
+		b.logger.Warn("failed to send file", "chat_id", chatID, "path", path, "error", err)
+	}
+	return err
+}
+
+// fetchFile downloads a file by ID and returns its contents and Telegram path
+func (b *Bot) fetchFile(ctx context.Context, fileID string) ([]byte, string, error) {
+	file, err := b.bot.GetFileWithContext(ctx, fileID, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("getting file: %w", err)
+	}
+	data, err := download(ctx, file.URL(b.bot, nil))
+	if err != nil {
+		return nil, "", fmt.Errorf("downloading file: %w", err)
+	}
+	return data, file.FilePath, nil
+}
+
+// download reads a URL's body
+func download(ctx context.Context, fileURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL holds the bot token, keep it out of chat replies
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+}
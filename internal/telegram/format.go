@@ -4,228 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-
-	"github.com/codegangsta/aria/internal/types"
 )
 
-// toolDisplayConfig defines how to display a specific tool
-type toolDisplayConfig struct {
-	Emoji  string
-	Format func(input map[string]interface{}) string
-	Verb   string // e.g., "Running", "Reading", "Editing"
-}
-
-// toolDisplays maps tool names to their display configuration
-var toolDisplays = map[string]toolDisplayConfig{
-	"Bash": {
-		Emoji: "🔧",
-		Verb:  "Running",
-		Format: func(input map[string]interface{}) string {
-			if cmd, ok := input["command"].(string); ok {
-				if len(cmd) > 60 {
-					cmd = cmd[:57] + "..."
-				}
-				return fmt.Sprintf("`%s`", escapeInlineCode(cmd))
-			}
-			return ""
-		},
-	},
-	"Read": {
-		Emoji: "📄",
-		Verb:  "Reading",
-		Format: func(input map[string]interface{}) string {
-			if path, ok := input["file_path"].(string); ok {
-				return escapeMarkdownV2(shortPath(path))
-			}
-			return ""
-		},
-	},
-	"Edit": {
-		Emoji: "✏️",
-		Verb:  "Editing",
-		Format: func(input map[string]interface{}) string {
-			if path, ok := input["file_path"].(string); ok {
-				return escapeMarkdownV2(shortPath(path))
-			}
-			return ""
-		},
-	},
-	"Write": {
-		Emoji: "📝",
-		Verb:  "Writing",
-		Format: func(input map[string]interface{}) string {
-			if path, ok := input["file_path"].(string); ok {
-				return escapeMarkdownV2(shortPath(path))
-			}
-			return ""
-		},
-	},
-	"Grep": {
-		Emoji: "🔍",
-		Verb:  "Searching",
-		Format: func(input map[string]interface{}) string {
-			if pattern, ok := input["pattern"].(string); ok {
-				if len(pattern) > 40 {
-					pattern = pattern[:37] + "..."
-				}
-				return fmt.Sprintf("`%s`", escapeInlineCode(pattern))
-			}
-			return ""
-		},
-	},
-	"Glob": {
-		Emoji: "📂",
-		Verb:  "Finding",
-		Format: func(input map[string]interface{}) string {
-			if pattern, ok := input["pattern"].(string); ok {
-				return fmt.Sprintf("`%s`", escapeInlineCode(pattern))
-			}
-			return ""
-		},
-	},
-	"Task": {
-		Emoji: "🤖",
-		Verb:  "Spawning",
-		Format: func(input map[string]interface{}) string {
-			if desc, ok := input["description"].(string); ok {
-				return escapeMarkdownV2(desc)
-			}
-			if agentType, ok := input["subagent_type"].(string); ok {
-				return escapeMarkdownV2(agentType) + " agent"
-			}
-			return "agent"
-		},
-	},
-	"WebFetch": {
-		Emoji: "🌐",
-		Verb:  "Fetching",
-		Format: func(input map[string]interface{}) string {
-			if url, ok := input["url"].(string); ok {
-				url = strings.TrimPrefix(url, "https://")
-				url = strings.TrimPrefix(url, "http://")
-				if idx := strings.Index(url, "/"); idx > 0 {
-					url = url[:idx]
-				}
-				return escapeMarkdownV2(url)
-			}
-			return ""
-		},
-	},
-	"WebSearch": {
-		Emoji: "🔎",
-		Verb:  "Searching",
-		Format: func(input map[string]interface{}) string {
-			if query, ok := input["query"].(string); ok {
-				if len(query) > 40 {
-					query = query[:37] + "..."
-				}
-				return fmt.Sprintf(`"%s"`, escapeMarkdownV2(query))
-			}
-			return ""
-		},
-	},
-}
-
-// MCP tool prefixes and their display configs
-var mcpToolDisplays = map[string]toolDisplayConfig{
-	"mcp__things__": {
-		Emoji: "✅",
-		Verb:  "Things",
-		Format: func(input map[string]interface{}) string {
-			if title, ok := input["title"].(string); ok {
-				if len(title) > 30 {
-					title = title[:27] + "..."
-				}
-				return escapeMarkdownV2(title)
-			}
-			if query, ok := input["query"].(string); ok {
-				return fmt.Sprintf(`"%s"`, escapeMarkdownV2(query))
-			}
-			return ""
-		},
-	},
-	"mcp__claude-in-chrome__": {
-		Emoji: "🌐",
-		Verb:  "Browser",
-		Format: func(input map[string]interface{}) string {
-			if url, ok := input["url"].(string); ok {
-				url = strings.TrimPrefix(url, "https://")
-				url = strings.TrimPrefix(url, "http://")
-				if idx := strings.Index(url, "/"); idx > 0 {
-					url = url[:idx]
-				}
-				return escapeMarkdownV2(url)
-			}
-			if action, ok := input["action"].(string); ok {
-				return escapeMarkdownV2(action)
-			}
-			return ""
-		},
-	},
-}
-
-// formatToolText creates the text content of a tool notification (no emoji, no italic wrapper)
-func formatToolText(tool types.ToolUse) string {
-	// Check for exact tool match first
-	if cfg, ok := toolDisplays[tool.Name]; ok {
-		detail := ""
-		if cfg.Format != nil {
-			detail = cfg.Format(tool.Input)
-		}
-		if detail != "" {
-			return fmt.Sprintf("%s %s", escapeMarkdownV2(cfg.Verb), detail)
-		}
-		return escapeMarkdownV2(cfg.Verb)
-	}
-
-	// Check for MCP tool prefixes
-	for prefix, cfg := range mcpToolDisplays {
-		if strings.HasPrefix(tool.Name, prefix) {
-			operation := strings.TrimPrefix(tool.Name, prefix)
-			operation = strings.ReplaceAll(operation, "_", " ")
-
-			detail := ""
-			if cfg.Format != nil {
-				detail = cfg.Format(tool.Input)
-			}
-			if detail != "" {
-				return fmt.Sprintf("%s: %s %s", escapeMarkdownV2(cfg.Verb), escapeMarkdownV2(operation), detail)
-			}
-			return fmt.Sprintf("%s: %s", escapeMarkdownV2(cfg.Verb), escapeMarkdownV2(operation))
-		}
-	}
-
-	// Fallback for unknown tools
-	return escapeMarkdownV2(tool.Name)
-}
-
-// FormatToolNotification creates a Telegram-friendly display of a tool call in progress
-// Returns italic text with ◌ prefix for subtle, compact appearance
-func FormatToolNotification(tool types.ToolUse) string {
-	content := formatToolText(tool)
-	return "_◌ " + content + "_"
-}
-
-// FormatToolNotificationSuccess creates a completed tool notification with ✓
-func FormatToolNotificationSuccess(tool types.ToolUse) string {
-	content := formatToolText(tool)
-	return "_✓ " + content + "_"
-}
-
-// FormatToolNotificationFailure creates a failed tool notification with ✗
-func FormatToolNotificationFailure(tool types.ToolUse) string {
-	content := formatToolText(tool)
-	return "_✗ " + content + "_"
-}
-
-// shortPath returns just the filename from a path
-func shortPath(path string) string {
-	if idx := strings.LastIndex(path, "/"); idx >= 0 {
-		return path[idx+1:]
-	}
-	return path
-}
-
 // MarkdownV2 special characters that need escaping
 const markdownV2SpecialChars = `_*[]()~` + "`" + `>#+-=|{}.!`
 
@@ -131,3 +131,23 @@ func TestEscapeMarkdownV2(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"buy milk", ">buy milk"},
+		{"**not bold** 1.5", ">\\*\\*not bold\\*\\* 1\\.5"},
+		{"two\nlines", ">two\n>lines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := formatQuote(tt.input)
+			if got != tt.expected {
+				t.Errorf("formatQuote(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
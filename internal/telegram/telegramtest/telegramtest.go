@@ -0,0 +1,711 @@
+// Package telegramtest is a fake Telegram Bot API server for end-to-end tests
+//
+// Point the bot at Server.URL (telegram.New's apiURL) and drive it with
+// SendText and PressButton. The server keeps every message the bot sends,
+// edits, pins or deletes so tests can wait for and inspect them.
+//
+// Updates are served by getUpdates until the bot sets a webhook; from then
+// on they are POSTed to the webhook with its secret token, like Telegram.
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotID is the user ID of the fake bot
+const BotID = 1
+
+// longPollMax caps how long getUpdates waits, so the bot stops promptly
+const longPollMax = 500 * time.Millisecond
+
+// Message is a message in the fake server, sent by a user or the bot
+type Message struct {
+	ID        int64
+	ChatID    int64
+	FromBot   bool
+	Text      string
+	ParseMode string
+	Silent    bool       // disable_notification
+	ReplyTo   int64      // Message this replies to, 0 if none
+	Buttons   [][]Button // Inline keyboard, nil if none
+	File      string     // Name of a file the bot sent with sendPhoto or sendDocument, Text is its caption
+	FileData  []byte
+	Photo     bool // Sent with sendPhoto
+	Edits     int
+	Pinned    bool
+	Deleted   bool
+}
+
+// Button is an inline keyboard button
+type Button struct {
+	Text string
+	Data string
+}
+
+// Button returns the first button with the given text, or nil
+func (m Message) Button(text string) *Button {
+	for _, row := range m.Buttons {
+		for _, b := range row {
+			if b.Text == text {
+				return &b
+			}
+		}
+	}
+	return nil
+}
+
+// file is a file users sent, downloadable through getFile
+type file struct {
+	path string // file_path, e.g. "voice/file3.oga"
+	data []byte
+}
+
+// upload is a file the bot uploaded with a multipart request
+type upload struct {
+	name string
+	data []byte
+}
+
+// Server is a fake Bot API server
+type Server struct {
+	URL string
+
+	srv      *httptest.Server
+	mu       sync.Mutex
+	changed  chan struct{} // Closed and replaced whenever state changes
+	closed   chan struct{}
+	updates  []map[string]interface{}
+	updateID int64
+	msgID    int64
+	messages []*Message
+	commands []string
+	answers  []string
+	files    map[string]file // Files users sent, by file ID
+
+	webhookURL    string
+	webhookSecret string
+	delivering    bool // a goroutine is POSTing updates to the webhook
+}
+
+// NewServer starts a fake Bot API server
+func NewServer() *Server {
+	s := &Server{
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+		files:   make(map[string]file),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close stops the server, releasing any pending long polls
+func (s *Server) Close() {
+	close(s.closed)
+	s.srv.Close()
+}
+
+// SendText delivers a text message from a user and returns its message ID
+func (s *Server) SendText(chatID int64, userID int64, text string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessageLocked(chatID, false, text)
+	s.queueLocked("message", map[string]interface{}{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"chat":       chatJSON(chatID),
+		"from":       userJSON(userID),
+		"text":       text,
+	})
+	return msg.ID
+}
+
+// SendReply delivers a text message replying to an earlier message in the
+// chat and returns its message ID
+func (s *Server) SendReply(chatID int64, userID int64, replyTo int64, text string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"date": time.Now().Unix(),
+		"chat": chatJSON(chatID),
+		"from": userJSON(userID),
+		"text": text,
+	}
+	if replied := s.findLocked(chatID, replyTo); replied != nil {
+		repliedJSON := messageJSON(replied)
+		if !replied.FromBot {
+			repliedJSON["from"] = userJSON(userID)
+		}
+		payload["reply_to_message"] = repliedJSON
+	}
+	msg := s.addMessageLocked(chatID, false, text)
+	msg.ReplyTo = replyTo
+	payload["message_id"] = msg.ID
+	s.queueLocked("message", payload)
+	return msg.ID
+}
+
+// SendVoice delivers a voice note from a user and returns its message ID
+// The bot can download audio through getFile
+func (s *Server) SendVoice(chatID int64, userID int64, audio []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessageLocked(chatID, false, "")
+	fileID := s.addFileLocked(msg.ID, "voice/", ".oga", audio)
+	s.queueLocked("message", map[string]interface{}{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"chat":       chatJSON(chatID),
+		"from":       userJSON(userID),
+		"voice": map[string]interface{}{
+			"file_id":        fileID,
+			"file_unique_id": fileID,
+			"duration":       1,
+			"mime_type":      "audio/ogg",
+		},
+	})
+	return msg.ID
+}
+
+// SendPhoto delivers a photo with a caption from a user and returns its message ID
+func (s *Server) SendPhoto(chatID int64, userID int64, jpeg []byte, caption string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessageLocked(chatID, false, caption)
+	fileID := s.addFileLocked(msg.ID, "photos/", ".jpg", jpeg)
+	size := func(width int) map[string]interface{} {
+		return map[string]interface{}{
+			"file_id":        fmt.Sprintf("%s-%d", fileID, width),
+			"file_unique_id": fmt.Sprintf("%s-%d", fileID, width),
+			"width":          width,
+			"height":         width,
+		}
+	}
+	// Only the largest size is downloadable
+	large := size(1280)
+	large["file_id"] = fileID
+	s.queueLocked("message", map[string]interface{}{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"chat":       chatJSON(chatID),
+		"from":       userJSON(userID),
+		"caption":    caption,
+		"photo":      []interface{}{size(90), size(320), large},
+	})
+	return msg.ID
+}
+
+// SendDocument delivers a file with a caption from a user and returns its message ID
+func (s *Server) SendDocument(chatID int64, userID int64, name string, mimeType string, data []byte, caption string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessageLocked(chatID, false, caption)
+	fileID := s.addFileLocked(msg.ID, "documents/", filepath.Ext(name), data)
+	s.queueLocked("message", map[string]interface{}{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"chat":       chatJSON(chatID),
+		"from":       userJSON(userID),
+		"caption":    caption,
+		"document": map[string]interface{}{
+			"file_id":        fileID,
+			"file_unique_id": fileID,
+			"file_name":      name,
+			"mime_type":      mimeType,
+			"file_size":      len(data),
+		},
+	})
+	return msg.ID
+}
+
+// PressButton delivers a callback query for a button on a bot message
+func (s *Server) PressButton(chatID int64, userID int64, msgID int64, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queueLocked("callback_query", map[string]interface{}{
+		"id":            strconv.FormatInt(s.updateID+1, 10),
+		"from":          userJSON(userID),
+		"chat_instance": strconv.FormatInt(chatID, 10),
+		"data":          data,
+		"message": map[string]interface{}{
+			"message_id": msgID,
+			"date":       time.Now().Unix(),
+			"chat":       chatJSON(chatID),
+		},
+	})
+}
+
+// Messages returns a copy of every message in a chat, oldest first
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Message
+	for _, m := range s.messages {
+		if m.ChatID == chatID {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// Commands returns the commands from the last setMyCommands call
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// CallbackAnswers returns the text of every answerCallbackQuery call
+func (s *Server) CallbackAnswers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.answers...)
+}
+
+// Webhook returns the webhook URL and secret token the bot set, empty if it polls
+func (s *Server) Webhook() (url string, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.webhookURL, s.webhookSecret
+}
+
+// WaitFor waits until a live (not deleted) bot message in the chat matches
+// Returns an error listing the chat's messages on timeout
+func (s *Server) WaitFor(chatID int64, timeout time.Duration, match func(Message) bool) (Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		for _, m := range s.messages {
+			if m.ChatID == chatID && m.FromBot && !m.Deleted && match(*m) {
+				found := *m
+				s.mu.Unlock()
+				return found, nil
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return Message{}, fmt.Errorf("timed out waiting for message; chat has:\n%s", s.dump(chatID))
+		}
+	}
+}
+
+// WaitForText waits for a live bot message containing text
+func (s *Server) WaitForText(chatID int64, timeout time.Duration, text string) (Message, error) {
+	return s.WaitFor(chatID, timeout, func(m Message) bool {
+		return strings.Contains(m.Text, text)
+	})
+}
+
+// dump formats a chat's messages for failure output
+func (s *Server) dump(chatID int64) string {
+	var b strings.Builder
+	for _, m := range s.Messages(chatID) {
+		from := "user"
+		if m.FromBot {
+			from = "bot"
+		}
+		var flags []string
+		if m.Deleted {
+			flags = append(flags, "deleted")
+		}
+		if m.Edits > 0 {
+			flags = append(flags, fmt.Sprintf("edited %d", m.Edits))
+		}
+		if m.File != "" {
+			flags = append(flags, "file "+m.File)
+		}
+		if m.Buttons != nil {
+			flags = append(flags, fmt.Sprintf("buttons %v", m.Buttons))
+		}
+		fmt.Fprintf(&b, "  #%d %s %q %v\n", m.ID, from, m.Text, flags)
+	}
+	return b.String()
+}
+
+// addMessageLocked stores a new message (must hold lock)
+func (s *Server) addMessageLocked(chatID int64, fromBot bool, text string) *Message {
+	s.msgID++
+	msg := &Message{ID: s.msgID, ChatID: chatID, FromBot: fromBot, Text: text}
+	s.messages = append(s.messages, msg)
+	s.notifyLocked()
+	return msg
+}
+
+// addFileLocked stores a file sent with a message and returns its ID (must hold lock)
+func (s *Server) addFileLocked(msgID int64, dir string, ext string, data []byte) string {
+	fileID := fmt.Sprintf("file%d", msgID)
+	s.files[fileID] = file{path: dir + fileID + ext, data: data}
+	return fileID
+}
+
+// findLocked returns a message by chat and ID (must hold lock)
+func (s *Server) findLocked(chatID int64, msgID int64) *Message {
+	for _, m := range s.messages {
+		if m.ChatID == chatID && m.ID == msgID {
+			return m
+		}
+	}
+	return nil
+}
+
+// queueLocked adds an update for getUpdates (must hold lock)
+func (s *Server) queueLocked(kind string, payload map[string]interface{}) {
+	s.updateID++
+	s.updates = append(s.updates, map[string]interface{}{
+		"update_id": s.updateID,
+		kind:        payload,
+	})
+	s.notifyLocked()
+}
+
+// notifyLocked wakes anyone waiting on a state change (must hold lock)
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// handle serves /bot<token>/<method> and /file/bot<token>/<path>
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		s.serveFile(w, r)
+		return
+	}
+
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	params := map[string]string{}
+	uploads := map[string]upload{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(32 << 20); err == nil {
+			for k, v := range r.MultipartForm.Value {
+				params[k] = v[0]
+			}
+			for k, v := range r.MultipartForm.File {
+				if f, err := v[0].Open(); err == nil {
+					data, _ := io.ReadAll(f)
+					f.Close()
+					uploads[k] = upload{name: v[0].Filename, data: data}
+				}
+			}
+		}
+	} else if r.ContentLength != 0 {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+
+	if method == "getUpdates" {
+		s.mu.Lock()
+		webhook := s.webhookURL
+		s.mu.Unlock()
+		if webhook != "" {
+			writeJSON(w, map[string]interface{}{"ok": false, "error_code": 409, "description": "Conflict: can't use getUpdates method while webhook is active"})
+			return
+		}
+		s.getUpdates(w, params)
+		return
+	}
+
+	s.mu.Lock()
+	result, err := s.callLocked(method, params, uploads)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: " + err.Error()})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"ok": true, "result": result})
+}
+
+// callLocked handles every method except getUpdates (must hold lock)
+func (s *Server) callLocked(method string, params map[string]string, uploads map[string]upload) (interface{}, error) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	msgID, _ := strconv.ParseInt(params["message_id"], 10, 64)
+
+	switch method {
+	case "getMe":
+		return map[string]interface{}{
+			"id":         BotID,
+			"is_bot":     true,
+			"first_name": "Aria",
+			"username":   "aria_test_bot",
+		}, nil
+
+	case "sendChatAction":
+		return true, nil
+
+	case "setWebhook":
+		s.webhookURL = params["url"]
+		s.webhookSecret = params["secret_token"]
+		if !s.delivering {
+			s.delivering = true
+			go s.deliver()
+		}
+		s.notifyLocked()
+		return true, nil
+
+	case "deleteWebhook":
+		s.webhookURL = ""
+		s.webhookSecret = ""
+		s.notifyLocked()
+		return true, nil
+
+	case "sendMessage":
+		msg := s.addMessageLocked(chatID, true, params["text"])
+		msg.ParseMode = params["parse_mode"]
+		msg.Silent = params["disable_notification"] == "true"
+		msg.Buttons = parseKeyboard(params["reply_markup"])
+		if reply := params["reply_parameters"]; reply != "" {
+			var rp struct {
+				MessageID int64 `json:"message_id"`
+			}
+			json.Unmarshal([]byte(reply), &rp)
+			msg.ReplyTo = rp.MessageID
+		}
+		return messageJSON(msg), nil
+
+	case "sendPhoto", "sendDocument":
+		field := "document"
+		if method == "sendPhoto" {
+			field = "photo"
+		}
+		up, ok := uploads[field]
+		if !ok {
+			return nil, fmt.Errorf("%s must be uploaded", field)
+		}
+		msg := s.addMessageLocked(chatID, true, params["caption"])
+		msg.File = up.name
+		msg.FileData = up.data
+		msg.Photo = method == "sendPhoto"
+		return messageJSON(msg), nil
+
+	case "editMessageText":
+		msg := s.findLocked(chatID, msgID)
+		if msg == nil || msg.Deleted {
+			return nil, fmt.Errorf("message to edit not found")
+		}
+		if msg.Text == params["text"] {
+			return nil, fmt.Errorf("message is not modified")
+		}
+		msg.Text = params["text"]
+		msg.ParseMode = params["parse_mode"]
+		msg.Buttons = parseKeyboard(params["reply_markup"])
+		msg.Edits++
+		s.notifyLocked()
+		return messageJSON(msg), nil
+
+	case "deleteMessage":
+		msg := s.findLocked(chatID, msgID)
+		if msg == nil || msg.Deleted {
+			return nil, fmt.Errorf("message to delete not found")
+		}
+		msg.Deleted = true
+		s.notifyLocked()
+		return true, nil
+
+	case "pinChatMessage", "unpinChatMessage":
+		msg := s.findLocked(chatID, msgID)
+		if msg == nil {
+			return nil, fmt.Errorf("message to pin not found")
+		}
+		msg.Pinned = method == "pinChatMessage"
+		s.notifyLocked()
+		return true, nil
+
+	case "setMyCommands":
+		var commands []struct {
+			Command string `json:"command"`
+		}
+		json.Unmarshal([]byte(params["commands"]), &commands)
+		s.commands = s.commands[:0]
+		for _, c := range commands {
+			s.commands = append(s.commands, c.Command)
+		}
+		s.notifyLocked()
+		return true, nil
+
+	case "getFile":
+		fileID := params["file_id"]
+		f, ok := s.files[fileID]
+		if !ok {
+			return nil, fmt.Errorf("wrong file_id specified")
+		}
+		return map[string]interface{}{
+			"file_id":        fileID,
+			"file_unique_id": fileID,
+			"file_size":      len(f.data),
+			"file_path":      f.path,
+		}, nil
+
+	case "answerCallbackQuery":
+		s.answers = append(s.answers, params["text"])
+		s.notifyLocked()
+		return true, nil
+	}
+
+	return nil, fmt.Errorf("method %s not supported by telegramtest", method)
+}
+
+// serveFile serves a file's contents by the path from getFile
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		if strings.HasSuffix(r.URL.Path, "/"+f.path) {
+			w.Write(f.data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// getUpdates long-polls for updates after the offset
+func (s *Server) getUpdates(w http.ResponseWriter, params map[string]string) {
+	offset, _ := strconv.ParseInt(params["offset"], 10, 64)
+	deadline := time.After(longPollMax)
+
+	for {
+		s.mu.Lock()
+		// Updates before the offset are confirmed and can be dropped
+		for len(s.updates) > 0 && s.updates[0]["update_id"].(int64) < offset {
+			s.updates = s.updates[1:]
+		}
+		if len(s.updates) > 0 {
+			pending := append([]map[string]interface{}(nil), s.updates...)
+			s.mu.Unlock()
+			writeJSON(w, map[string]interface{}{"ok": true, "result": pending})
+			return
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeJSON(w, map[string]interface{}{"ok": true, "result": []interface{}{}})
+			return
+		case <-s.closed:
+			writeJSON(w, map[string]interface{}{"ok": true, "result": []interface{}{}})
+			return
+		}
+	}
+}
+
+// deliver POSTs queued updates to the webhook, oldest first, until the
+// webhook is deleted or the server closes. Rejected updates are retried
+func (s *Server) deliver() {
+	for {
+		s.mu.Lock()
+		if s.webhookURL == "" {
+			s.delivering = false
+			s.mu.Unlock()
+			return
+		}
+		if len(s.updates) == 0 {
+			changed := s.changed
+			s.mu.Unlock()
+			select {
+			case <-changed:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+		update := s.updates[0]
+		webhook, secret := s.webhookURL, s.webhookSecret
+		s.mu.Unlock()
+
+		body, _ := json.Marshal(update)
+		req, _ := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if err == nil && resp.StatusCode/100 == 2 {
+			s.mu.Lock()
+			if len(s.updates) > 0 && s.updates[0]["update_id"] == update["update_id"] {
+				s.updates = s.updates[1:]
+			}
+			s.mu.Unlock()
+			continue
+		}
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// parseKeyboard extracts inline keyboard buttons from a reply_markup param
+func parseKeyboard(markup string) [][]Button {
+	if markup == "" {
+		return nil
+	}
+	var parsed struct {
+		InlineKeyboard [][]struct {
+			Text         string `json:"text"`
+			CallbackData string `json:"callback_data"`
+		} `json:"inline_keyboard"`
+	}
+	if json.Unmarshal([]byte(markup), &parsed) != nil || len(parsed.InlineKeyboard) == 0 {
+		return nil
+	}
+
+	rows := make([][]Button, 0, len(parsed.InlineKeyboard))
+	for _, row := range parsed.InlineKeyboard {
+		buttons := make([]Button, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, Button{Text: b.Text, Data: b.CallbackData})
+		}
+		rows = append(rows, buttons)
+	}
+	return rows
+}
+
+func messageJSON(m *Message) map[string]interface{} {
+	return map[string]interface{}{
+		"message_id": m.ID,
+		"date":       time.Now().Unix(),
+		"chat":       chatJSON(m.ChatID),
+		"from":       userJSON(BotID),
+		"text":       m.Text,
+	}
+}
+
+func chatJSON(chatID int64) map[string]interface{} {
+	return map[string]interface{}{"id": chatID, "type": "private"}
+}
+
+func userJSON(userID int64) map[string]interface{} {
+	return map[string]interface{}{"id": userID, "is_bot": userID == BotID, "first_name": "Test"}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
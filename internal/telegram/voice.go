@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	"github.com/codegangsta/aria/internal/transcribe"
+)
+
+// transcribeTimeout bounds downloading and transcribing one voice message
+const transcribeTimeout = 5 * time.Minute
+
+// SetTranscriber enables voice and audio messages, transcribed by t
+func (b *Bot) SetTranscriber(t transcribe.Transcriber) {
+	b.transcriber = t
+}
+
+// audioFile returns the file ID of a voice note or audio file, empty if none
+func audioFile(msg *gotgbot.Message) string {
+	switch {
+	case msg.Voice != nil:
+		return msg.Voice.FileId
+	case msg.Audio != nil:
+		return msg.Audio.FileId
+	}
+	return ""
+}
+
+// transcribeMessage downloads and transcribes a voice message and quotes the
+// transcript back to the chat. Failures are reported to the chat and return false
+func (b *Bot) transcribeMessage(msg *gotgbot.Message) (string, bool) {
+	chatID := msg.Chat.Id
+	if b.transcriber == nil {
+		b.SendMessage(chatID, "Voice messages aren't enabled.", false)
+		return "", false
+	}
+
+	b.startTyping(chatID)
+	ctx, cancel := context.WithTimeout(context.Background(), transcribeTimeout)
+	defer cancel()
+
+	text, err := b.transcribe(ctx, audioFile(msg))
+	if err != nil {
+		b.logger.Warn("transcription failed", "chat_id", chatID, "error", err)
+		b.SendMessage(chatID, fmt.Sprintf("Couldn't transcribe voice message: %v", err), false)
+		return "", false
+	}
+	if text == "" {
+		b.SendMessage(chatID, "Couldn't hear anything in that voice message.", false)
+		return "", false
+	}
+
+	b.logger.Info("transcribed voice message", "chat_id", chatID, "text_length", len(text))
+	b.sendMarkdown(chatID, formatQuote("🎤 "+text), "🎤 "+text, &gotgbot.SendMessageOpts{
+		DisableNotification: true,
+		ReplyParameters:     &gotgbot.ReplyParameters{MessageId: msg.MessageId},
+	})
+	return text, true
+}
+
+// transcribe downloads a file to a temp dir and runs the transcriber on it
+func (b *Bot) transcribe(ctx context.Context, fileID string) (string, error) {
+	data, filePath, err := b.fetchFile(ctx, fileID)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "aria-voice-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audio"+filepath.Ext(filePath))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return b.transcriber.Transcribe(ctx, path)
+}
@@ -0,0 +1,130 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// defaultWebhookListen is where the webhook receiver listens if not configured
+const defaultWebhookListen = ":8443"
+
+// Webhook configures receiving updates by webhook instead of long polling
+type Webhook struct {
+	URL         string // public URL Telegram posts updates to
+	Listen      string // local address, empty = ":8443"
+	Path        string // local path updates arrive on, empty = URL's path
+	SecretToken string // expected in X-Telegram-Bot-Api-Secret-Token, empty = random
+	CertFile    string // serve TLS with this certificate and KeyFile
+	KeyFile     string
+	UploadCert  bool // send CertFile to Telegram, for self-signed certificates
+}
+
+// SetWebhook makes Start receive updates by webhook, falling back to long
+// polling if the webhook can't be set up
+func (b *Bot) SetWebhook(w Webhook) {
+	b.webhook = w
+}
+
+// startWebhook listens for updates, points Telegram at the webhook and serves
+// it in the background. On error nothing is left listening
+func (b *Bot) startWebhook() (*http.Server, error) {
+	hook := b.webhook
+
+	path := hook.Path
+	if path == "" {
+		u, err := url.Parse(hook.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing webhook url: %w", err)
+		}
+		path = u.Path
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("webhook needs a path, in the url or as path")
+	}
+
+	listen := hook.Listen
+	if listen == "" {
+		listen = defaultWebhookListen
+	}
+
+	secret := hook.SecretToken
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("generating secret token: %w", err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	var tlsConfig *tls.Config
+	if hook.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(hook.CertFile, hook.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading webhook certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listen, err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	opts := &gotgbot.SetWebhookOpts{
+		AllowedUpdates: []string{
+			"message",
+			"callback_query",
+		},
+		DropPendingUpdates: true,
+		SecretToken:        secret,
+	}
+	if hook.UploadCert {
+		f, err := os.Open(hook.CertFile)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("opening webhook certificate: %w", err)
+		}
+		defer f.Close()
+		opts.Certificate = gotgbot.InputFileByReader(filepath.Base(hook.CertFile), f)
+	}
+
+	if _, err := b.bot.SetWebhook(hook.URL, opts); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("setting webhook: %w", err)
+	}
+
+	if err := b.updater.AddWebhook(b.bot, path, &ext.AddWebhookOpts{SecretToken: secret}); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("adding webhook: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           b.updater.GetHandlerFunc("/"),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			b.logger.Error("telegram webhook server failed", "error", err)
+		}
+	}()
+
+	b.logger.Info("telegram webhook listening", "listen", listen, "path", "/"+path, "tls", tlsConfig != nil)
+	return server, nil
+}
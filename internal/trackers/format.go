@@ -0,0 +1,213 @@
+package trackers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codegangsta/aria/internal/types"
+)
+
+// toolDisplayConfig defines how to display a specific tool
+type toolDisplayConfig struct {
+	Emoji  string
+	Format func(input map[string]interface{}) string
+	Verb   string // e.g., "Running", "Reading", "Editing"
+}
+
+// toolDisplays maps tool names to their display configuration
+var toolDisplays = map[string]toolDisplayConfig{
+	"Bash": {
+		Emoji: "🔧",
+		Verb:  "Running",
+		Format: func(input map[string]interface{}) string {
+			if cmd, ok := input["command"].(string); ok {
+				if len(cmd) > 60 {
+					cmd = cmd[:57] + "..."
+				}
+				return inlineCode(cmd)
+			}
+			return ""
+		},
+	},
+	"Read": {
+		Emoji: "📄",
+		Verb:  "Reading",
+		Format: func(input map[string]interface{}) string {
+			if path, ok := input["file_path"].(string); ok {
+				return shortPath(path)
+			}
+			return ""
+		},
+	},
+	"Edit": {
+		Emoji: "✏️",
+		Verb:  "Editing",
+		Format: func(input map[string]interface{}) string {
+			if path, ok := input["file_path"].(string); ok {
+				return shortPath(path)
+			}
+			return ""
+		},
+	},
+	"Write": {
+		Emoji: "📝",
+		Verb:  "Writing",
+		Format: func(input map[string]interface{}) string {
+			if path, ok := input["file_path"].(string); ok {
+				return shortPath(path)
+			}
+			return ""
+		},
+	},
+	"Grep": {
+		Emoji: "🔍",
+		Verb:  "Searching",
+		Format: func(input map[string]interface{}) string {
+			if pattern, ok := input["pattern"].(string); ok {
+				if len(pattern) > 40 {
+					pattern = pattern[:37] + "..."
+				}
+				return inlineCode(pattern)
+			}
+			return ""
+		},
+	},
+	"Glob": {
+		Emoji: "📂",
+		Verb:  "Finding",
+		Format: func(input map[string]interface{}) string {
+			if pattern, ok := input["pattern"].(string); ok {
+				return inlineCode(pattern)
+			}
+			return ""
+		},
+	},
+	"Task": {
+		Emoji: "🤖",
+		Verb:  "Spawning",
+		Format: func(input map[string]interface{}) string {
+			if desc, ok := input["description"].(string); ok {
+				return desc
+			}
+			if agentType, ok := input["subagent_type"].(string); ok {
+				return agentType + " agent"
+			}
+			return "agent"
+		},
+	},
+	"WebFetch": {
+		Emoji: "🌐",
+		Verb:  "Fetching",
+		Format: func(input map[string]interface{}) string {
+			if url, ok := input["url"].(string); ok {
+				url = strings.TrimPrefix(url, "https://")
+				url = strings.TrimPrefix(url, "http://")
+				if idx := strings.Index(url, "/"); idx > 0 {
+					url = url[:idx]
+				}
+				return url
+			}
+			return ""
+		},
+	},
+	"WebSearch": {
+		Emoji: "🔎",
+		Verb:  "Searching",
+		Format: func(input map[string]interface{}) string {
+			if query, ok := input["query"].(string); ok {
+				if len(query) > 40 {
+					query = query[:37] + "..."
+				}
+				return fmt.Sprintf(`"%s"`, query)
+			}
+			return ""
+		},
+	},
+}
+
+// MCP tool prefixes and their display configs
+var mcpToolDisplays = map[string]toolDisplayConfig{
+	"mcp__things__": {
+		Emoji: "✅",
+		Verb:  "Things",
+		Format: func(input map[string]interface{}) string {
+			if title, ok := input["title"].(string); ok {
+				if len(title) > 30 {
+					title = title[:27] + "..."
+				}
+				return title
+			}
+			if query, ok := input["query"].(string); ok {
+				return fmt.Sprintf(`"%s"`, query)
+			}
+			return ""
+		},
+	},
+	"mcp__claude-in-chrome__": {
+		Emoji: "🌐",
+		Verb:  "Browser",
+		Format: func(input map[string]interface{}) string {
+			if url, ok := input["url"].(string); ok {
+				url = strings.TrimPrefix(url, "https://")
+				url = strings.TrimPrefix(url, "http://")
+				if idx := strings.Index(url, "/"); idx > 0 {
+					url = url[:idx]
+				}
+				return url
+			}
+			if action, ok := input["action"].(string); ok {
+				return action
+			}
+			return ""
+		},
+	},
+}
+
+// formatToolText creates the markdown text of a tool notification (no status prefix)
+func formatToolText(tool types.ToolUse) string {
+	// Check for exact tool match first
+	if cfg, ok := toolDisplays[tool.Name]; ok {
+		detail := ""
+		if cfg.Format != nil {
+			detail = cfg.Format(tool.Input)
+		}
+		if detail != "" {
+			return fmt.Sprintf("%s %s", cfg.Verb, detail)
+		}
+		return cfg.Verb
+	}
+
+	// Check for MCP tool prefixes
+	for prefix, cfg := range mcpToolDisplays {
+		if strings.HasPrefix(tool.Name, prefix) {
+			operation := strings.TrimPrefix(tool.Name, prefix)
+			operation = strings.ReplaceAll(operation, "_", " ")
+
+			detail := ""
+			if cfg.Format != nil {
+				detail = cfg.Format(tool.Input)
+			}
+			if detail != "" {
+				return fmt.Sprintf("%s: %s %s", cfg.Verb, operation, detail)
+			}
+			return fmt.Sprintf("%s: %s", cfg.Verb, operation)
+		}
+	}
+
+	// Fallback for unknown tools
+	return tool.Name
+}
+
+// shortPath returns just the filename from a path
+func shortPath(path string) string {
+	if idx := strings.LastIndex(path, "/"); idx >= 0 {
+		return path[idx+1:]
+	}
+	return path
+}
+
+// inlineCode wraps text in a markdown code span
+// Backticks can't be escaped inside a span, so they're swapped for quotes
+func inlineCode(text string) string {
+	return "`" + strings.ReplaceAll(text, "`", "'") + "`"
+}
@@ -2,26 +2,32 @@
 package trackers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"sync"
 
-	"github.com/codegangsta/aria/internal/telegram"
+	"github.com/codegangsta/aria/internal/claude"
+	"github.com/codegangsta/aria/internal/frontend"
 )
 
 // PendingQuestion stores context for an AskUserQuestion waiting for user input
 type PendingQuestion struct {
 	ToolID     string
-	Questions  []telegram.Question
+	Questions  []frontend.Question
 	CurrentIdx int      // Which question we're on (0-indexed)
 	Answers    []string // Collected answers so far
-	MessageID  int64    // Telegram message ID for the keyboard (for deletion)
+	MessageID  int64    // Frontend message ID for the keyboard (for deletion)
 }
 
 // PendingPermission stores context for a permission request waiting for user input
+// Once added it's replaced rather than modified, so it can be read without a lock
 type PendingPermission struct {
-	ToolID    string                         // Tool ID for the permission prompt tool call
+	ToolID    string                         // Request ID, carried in the prompt's callback data
 	ToolName  string                         // Name of the tool requesting permission
 	Input     map[string]interface{}         // Input for the tool
-	MessageID int64                          // Telegram message ID for the keyboard
+	Cwd       string                         // Chat's working directory, shown in the prompt
+	MessageID int64                          // Frontend message ID for the keyboard
+	Editing   bool                           // Waiting for the user to send an edited command or path
 	Response  chan *PermissionResult         // Channel to send the result back
 }
 
@@ -32,25 +38,37 @@ type PermissionResult struct {
 	Message      string                 // For deny responses
 }
 
+// PendingReply holds a reply to another session's message while the user
+// picks which session to send it to
+type PendingReply struct {
+	Text          string         // Prompt to send, with the quoted message
+	Images        []claude.Image // Inline images from the message's attachments
+	SessionID     string         // Session the replied-to message belongs to
+	MessageID     int64          // Frontend message ID for the keyboard
+	UserMessageID int64          // The user's reply, recorded in the message index once sent
+}
+
 // ChatTrackers holds all trackers for a single chat
 type ChatTrackers struct {
-	Tool       *telegram.ToolStatusTracker
-	Progress   *telegram.ProgressTracker
-	Question   *PendingQuestion
-	Permission *PendingPermission
+	Tool        *ToolStatusTracker
+	Progress    *ProgressTracker
+	Stream      *StreamingMessage
+	Question    *PendingQuestion
+	Permissions []*PendingPermission // Oldest first
+	Reply       *PendingReply
 }
 
 // Manager manages all tracker types for all chats
 type Manager struct {
-	bot      *telegram.Bot
+	fe       frontend.Frontend
 	chats    map[int64]*ChatTrackers
 	mu       sync.RWMutex
 }
 
 // NewManager creates a new tracker manager
-func NewManager(bot *telegram.Bot) *Manager {
+func NewManager(fe frontend.Frontend) *Manager {
 	return &Manager{
-		bot:   bot,
+		fe:    fe,
 		chats: make(map[int64]*ChatTrackers),
 	}
 }
@@ -66,30 +84,42 @@ func (m *Manager) getOrCreate(chatID int64) *ChatTrackers {
 }
 
 // ToolTracker gets or creates the tool status tracker for a chat
-func (m *Manager) ToolTracker(chatID int64) *telegram.ToolStatusTracker {
+func (m *Manager) ToolTracker(chatID int64) *ToolStatusTracker {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	ct := m.getOrCreate(chatID)
 	if ct.Tool == nil {
-		ct.Tool = telegram.NewToolStatusTracker(m.bot, chatID)
+		ct.Tool = NewToolStatusTracker(m.fe, chatID)
 		ct.Tool.Start()
 	}
 	return ct.Tool
 }
 
 // ProgressTracker gets or creates the progress tracker for a chat
-func (m *Manager) ProgressTracker(chatID int64) *telegram.ProgressTracker {
+func (m *Manager) ProgressTracker(chatID int64) *ProgressTracker {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	ct := m.getOrCreate(chatID)
 	if ct.Progress == nil {
-		ct.Progress = telegram.NewProgressTracker(m.bot, chatID)
+		ct.Progress = NewProgressTracker(m.fe, chatID)
 	}
 	return ct.Progress
 }
 
+// StreamingMessage gets or creates the live streaming message for a chat
+func (m *Manager) StreamingMessage(chatID int64) *StreamingMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ct := m.getOrCreate(chatID)
+	if ct.Stream == nil {
+		ct.Stream = NewStreamingMessage(m.fe, chatID)
+	}
+	return ct.Stream
+}
+
 // GetQuestion gets the pending question for a chat (nil if none)
 func (m *Manager) GetQuestion(chatID int64) *PendingQuestion {
 	m.mu.RLock()
@@ -143,40 +173,236 @@ func (m *Manager) ClearProgressTracker(chatID int64) {
 	}
 }
 
+// ClearStream stops any live streaming message for a chat
+func (m *Manager) ClearStream(chatID int64) {
+	m.mu.RLock()
+	ct := m.chats[chatID]
+	m.mu.RUnlock()
+
+	if ct != nil && ct.Stream != nil {
+		ct.Stream.Clear()
+	}
+}
+
+// CancelProgress marks the chat's progress message as stopped (no-op if none)
+func (m *Manager) CancelProgress(chatID int64, reason string) {
+	m.mu.RLock()
+	ct := m.chats[chatID]
+	m.mu.RUnlock()
+
+	if ct != nil && ct.Progress != nil {
+		ct.Progress.Cancel(reason)
+	}
+}
+
+// Waiting reports whether a chat has a question or permission prompt
+// waiting on the user
+func (m *Manager) Waiting(chatID int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ct, ok := m.chats[chatID]
+	return ok && (ct.Question != nil || len(ct.Permissions) > 0)
+}
+
 // ClearAll clears all trackers for a chat
 func (m *Manager) ClearAll(chatID int64) {
 	m.ClearToolTracker(chatID)
 	m.ClearProgressTracker(chatID)
+	m.ClearStream(chatID)
 	m.ClearQuestion(chatID)
-	m.ClearPermission(chatID)
+	m.ClearPermissions(chatID)
+	m.TakeReply(chatID)
 }
 
-// GetPermission gets the pending permission for a chat (nil if none)
-func (m *Manager) GetPermission(chatID int64) *PendingPermission {
+// AddPermission adds a pending permission for a chat and returns its
+// request ID, which is also set as p.ToolID
+func (m *Manager) AddPermission(chatID int64, p *PendingPermission) string {
+	var b [4]byte
+	rand.Read(b[:])
+	p.ToolID = hex.EncodeToString(b[:])
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ct := m.getOrCreate(chatID)
+	ct.Permissions = append(ct.Permissions, p)
+	return p.ToolID
+}
+
+// GetPermission gets a pending permission by request ID (nil if none)
+func (m *Manager) GetPermission(chatID int64, id string) *PendingPermission {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, p := m.findPermission(chatID, id)
+	return p
+}
+
+// Permissions returns a chat's pending permissions, oldest first
+func (m *Manager) Permissions(chatID int64) []*PendingPermission {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	if ct, ok := m.chats[chatID]; ok {
-		return ct.Permission
+		return append([]*PendingPermission(nil), ct.Permissions...)
 	}
 	return nil
 }
 
-// SetPermission sets the pending permission for a chat
-func (m *Manager) SetPermission(chatID int64, p *PendingPermission) {
+// SetPermissionMessage records the message ID of a pending permission's
+// first prompt. Returns false if the prompt was answered or replaced (by
+// "Show more") while it was being sent, and should be deleted
+func (m *Manager) SetPermissionMessage(chatID int64, id string, msgID int64) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	ct := m.getOrCreate(chatID)
-	ct.Permission = p
+	if i, p := m.findPermission(chatID, id); p != nil && p.MessageID == 0 {
+		updated := *p
+		updated.MessageID = msgID
+		m.chats[chatID].Permissions[i] = &updated
+		return true
+	}
+	return false
 }
 
-// ClearPermission clears the pending permission for a chat
-func (m *Manager) ClearPermission(chatID int64) {
+// ReplacePermissionMessage records a new prompt for a pending permission and
+// returns the previous prompt's ID (0 if it's still being sent). Returns
+// false if the permission is no longer pending
+func (m *Manager) ReplacePermissionMessage(chatID int64, id string, msgID int64) (int64, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if i, p := m.findPermission(chatID, id); p != nil {
+		updated := *p
+		updated.MessageID = msgID
+		m.chats[chatID].Permissions[i] = &updated
+		return p.MessageID, true
+	}
+	return 0, false
+}
+
+// findPermission finds a pending permission by request ID (must hold lock)
+func (m *Manager) findPermission(chatID int64, id string) (int, *PendingPermission) {
 	if ct, ok := m.chats[chatID]; ok {
-		ct.Permission = nil
+		for i, p := range ct.Permissions {
+			if p.ToolID == id {
+				return i, p
+			}
+		}
+	}
+	return -1, nil
+}
+
+// EditPermission marks a pending permission as waiting for an edited command
+// or path, in place of any other the chat was editing
+func (m *Manager) EditPermission(chatID int64, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ct, ok := m.chats[chatID]; ok {
+		for i, p := range ct.Permissions {
+			if p.Editing != (p.ToolID == id) {
+				edited := *p
+				edited.Editing = p.ToolID == id
+				ct.Permissions[i] = &edited
+			}
+		}
+	}
+}
+
+// StopEditing ends editing of a pending permission
+// Returns false if it wasn't being edited
+func (m *Manager) StopEditing(chatID int64, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, p := m.findPermission(chatID, id); p != nil && p.Editing {
+		edited := *p
+		edited.Editing = false
+		m.chats[chatID].Permissions[i] = &edited
+		return true
+	}
+	return false
+}
+
+// SetPermissionInput replaces a pending permission's input with an edited one
+// and ends editing, so the prompt can be re-sent with it. Returns the updated
+// permission, or nil if it's no longer pending
+func (m *Manager) SetPermissionInput(chatID int64, id string, input map[string]interface{}) *PendingPermission {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, p := m.findPermission(chatID, id); p != nil {
+		edited := *p
+		edited.Input = input
+		edited.Editing = false
+		m.chats[chatID].Permissions[i] = &edited
+		return &edited
+	}
+	return nil
+}
+
+// EditingPermission returns the pending permission waiting for an edited
+// command or path (nil if none)
+func (m *Manager) EditingPermission(chatID int64) *PendingPermission {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if ct, ok := m.chats[chatID]; ok {
+		for _, p := range ct.Permissions {
+			if p.Editing {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// TakePermission removes a pending permission by request ID and returns it
+// as it was last set (nil if it's no longer pending, e.g. already answered)
+func (m *Manager) TakePermission(chatID int64, id string) *PendingPermission {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, p := m.findPermission(chatID, id)
+	if p != nil {
+		ct := m.chats[chatID]
+		ct.Permissions = append(ct.Permissions[:i], ct.Permissions[i+1:]...)
+	}
+	return p
+}
+
+// ClearPermissions clears all pending permissions for a chat
+func (m *Manager) ClearPermissions(chatID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ct, ok := m.chats[chatID]; ok {
+		ct.Permissions = nil
+	}
+}
+
+// SetReply sets the pending reply for a chat, replacing any earlier one
+func (m *Manager) SetReply(chatID int64, r *PendingReply) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ct := m.getOrCreate(chatID)
+	ct.Reply = r
+}
+
+// TakeReply returns and clears the pending reply for a chat (nil if none),
+// so a double press can't send it twice
+func (m *Manager) TakeReply(chatID int64) *PendingReply {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ct, ok := m.chats[chatID]
+	if !ok {
+		return nil
 	}
+	r := ct.Reply
+	ct.Reply = nil
+	return r
 }
@@ -1,16 +1,17 @@
-package telegram
+package trackers
 
 import (
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/codegangsta/aria/internal/frontend"
 	"github.com/codegangsta/aria/internal/types"
 )
 
 // ProgressTracker manages a pinned progress message for todo items
 type ProgressTracker struct {
-	bot       *Bot
+	fe        frontend.Frontend
 	chatID    int64
 	messageID int64 // pinned message ID (0 if none)
 	todos     []types.Todo
@@ -23,9 +24,9 @@ type ProgressTracker struct {
 }
 
 // NewProgressTracker creates a new progress tracker for a chat
-func NewProgressTracker(bot *Bot, chatID int64) *ProgressTracker {
+func NewProgressTracker(fe frontend.Frontend, chatID int64) *ProgressTracker {
 	return &ProgressTracker{
-		bot:         bot,
+		fe:          fe,
 		chatID:      chatID,
 		debounceDur: 150 * time.Millisecond, // Debounce rapid updates
 	}
@@ -80,15 +81,15 @@ func (p *ProgressTracker) flushLocked() {
 
 	if p.messageID == 0 {
 		// First update - send and pin
-		msgID, err := p.bot.SendAndPinMessage(p.chatID, text)
+		msgID, err := p.fe.SendAndPinMessage(p.chatID, text)
 		if err != nil {
 			// Fallback: just send without pinning
-			msgID, _ = p.bot.SendToolNotification(p.chatID, FormatMarkdownV2(text))
+			msgID, _ = p.fe.SendNotification(p.chatID, text)
 		}
 		p.messageID = msgID
 	} else {
 		// Update existing message
-		p.bot.EditMessageMarkdownV2(p.chatID, p.messageID, FormatMarkdownV2(text))
+		p.fe.EditMessage(p.chatID, p.messageID, text)
 	}
 }
 
@@ -101,10 +102,10 @@ func (p *ProgressTracker) completeLocked() {
 	// Update to show completion
 	total := len(p.todos)
 	text := fmt.Sprintf("● Done (%d/%d)", total, total)
-	p.bot.EditMessageMarkdownV2(p.chatID, p.messageID, FormatMarkdownV2(text))
+	p.fe.EditMessage(p.chatID, p.messageID, text)
 
 	// Unpin
-	p.bot.UnpinMessage(p.chatID, p.messageID)
+	p.fe.UnpinMessage(p.chatID, p.messageID)
 	p.messageID = 0
 }
 
@@ -122,7 +123,7 @@ func (p *ProgressTracker) Clear() {
 
 	// Unpin if we have a message
 	if p.messageID != 0 {
-		p.bot.UnpinMessage(p.chatID, p.messageID)
+		p.fe.UnpinMessage(p.chatID, p.messageID)
 		p.messageID = 0
 	}
 }
@@ -140,8 +141,8 @@ func (p *ProgressTracker) Cancel(reason string) {
 	if reason != "" {
 		text += ": " + reason
 	}
-	p.bot.EditMessageMarkdownV2(p.chatID, p.messageID, FormatMarkdownV2(text))
-	p.bot.UnpinMessage(p.chatID, p.messageID)
+	p.fe.EditMessage(p.chatID, p.messageID, text)
+	p.fe.UnpinMessage(p.chatID, p.messageID)
 	p.messageID = 0
 }
 
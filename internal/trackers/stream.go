@@ -0,0 +1,166 @@
+package trackers
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codegangsta/aria/internal/frontend"
+)
+
+// streamCursor is appended to the live message while text is still arriving
+const streamCursor = " ▍"
+
+// streamMaxLen caps the live message below Telegram's 4096 character limit,
+// leaving room for MarkdownV2 escaping
+const streamMaxLen = 3500
+
+// StreamingMessage progressively edits a single message as assistant text
+// streams in, throttling edits to stay within Telegram's rate limits
+type StreamingMessage struct {
+	fe       frontend.Frontend
+	chatID   int64
+	msgID    int64  // 0 if no message sent yet
+	text     string // Latest text received
+	rendered string // Text currently shown in the message
+	lastEdit time.Time
+	timer    *time.Timer
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+// NewStreamingMessage creates a new streaming message for a chat
+func NewStreamingMessage(fe frontend.Frontend, chatID int64) *StreamingMessage {
+	return &StreamingMessage{
+		fe:       fe,
+		chatID:   chatID,
+		interval: time.Second, // Telegram allows roughly one edit per second per chat
+	}
+}
+
+// Update sets the text streamed so far, sending or editing the live message
+// Edits are throttled; the latest text is always rendered eventually
+func (s *StreamingMessage) Update(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text = text
+
+	if s.timer != nil {
+		// An edit is already scheduled and will pick up the latest text
+		return
+	}
+
+	wait := s.interval - time.Since(s.lastEdit)
+	if wait <= 0 {
+		s.renderLocked()
+		return
+	}
+
+	s.timer = time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.timer = nil
+		s.renderLocked()
+	})
+}
+
+// renderLocked sends or edits the live message with the latest text (must hold lock)
+func (s *StreamingMessage) renderLocked() {
+	if s.text == "" {
+		return
+	}
+
+	display := s.displayLocked(true)
+	if display == s.rendered {
+		return
+	}
+	s.lastEdit = time.Now()
+
+	if s.msgID == 0 {
+		msgID, err := s.fe.SendNotification(s.chatID, display)
+		if err != nil {
+			return
+		}
+		s.msgID = msgID
+	} else if err := s.fe.EditMessage(s.chatID, s.msgID, display); err != nil {
+		return
+	}
+	s.rendered = display
+}
+
+// Finish completes the current block with its full text
+// keep=true edits the live message in place with the final text; keep=false
+// deletes it so the caller can send the text as a fresh message (e.g. with sound)
+// Returns true if the text was delivered by editing the live message
+func (s *StreamingMessage) Finish(text string, keep bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgID := s.msgID
+	s.resetLocked()
+
+	if msgID == 0 {
+		return false
+	}
+
+	if keep && len(text) <= streamMaxLen {
+		if err := s.fe.EditMessage(s.chatID, msgID, text); err == nil {
+			return true
+		}
+	}
+
+	// Send the text fresh instead - don't leave a stale partial copy behind
+	s.fe.DeleteMessage(s.chatID, msgID)
+	return false
+}
+
+// Clear stops streaming, leaving any live message without the cursor
+// Used when a turn ends without finishing the block (errors, interrupts)
+func (s *StreamingMessage) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.msgID != 0 && s.text != "" {
+		s.fe.EditMessage(s.chatID, s.msgID, s.displayLocked(false))
+	}
+	s.resetLocked()
+}
+
+// displayLocked returns the text to show in the live message (must hold lock)
+func (s *StreamingMessage) displayLocked(cursor bool) string {
+	display := s.text
+	if len(display) > streamMaxLen {
+		// Show the tail - the full text arrives with the finished message
+		start := len(display) - streamMaxLen
+		for start < len(display) && !utf8.RuneStart(display[start]) {
+			start++
+		}
+		display = "…" + display[start:]
+	}
+	if cursor {
+		display += streamCursor
+	}
+	return closeOpenFence(display)
+}
+
+// resetLocked forgets the current block (must hold lock)
+func (s *StreamingMessage) resetLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.msgID = 0
+	s.text = ""
+	s.rendered = ""
+}
+
+// closeOpenFence closes an unterminated code fence so partial text still
+// formats as MarkdownV2 mid-block
+func closeOpenFence(text string) string {
+	if strings.Count(text, "```")%2 == 1 {
+		return text + "\n```"
+	}
+	return text
+}
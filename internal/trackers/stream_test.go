@@ -0,0 +1,137 @@
+package trackers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/aria/internal/frontend/frontendtest"
+)
+
+const testChat = 42
+
+// newTestStream returns a streaming message on a fake frontend, throttled to interval
+func newTestStream(interval time.Duration) (*StreamingMessage, *frontendtest.Frontend) {
+	fe := frontendtest.New()
+	s := NewStreamingMessage(fe, testChat)
+	s.interval = interval
+	return s, fe
+}
+
+// onlyMessage returns the one message sent to the test chat
+func onlyMessage(t *testing.T, fe *frontendtest.Frontend) frontendtest.Message {
+	t.Helper()
+	msgs := fe.Messages(testChat)
+	if len(msgs) != 1 {
+		t.Fatalf("sent %d messages, want 1: %+v", len(msgs), msgs)
+	}
+	return msgs[0]
+}
+
+func TestStreamingMessageThrottle(t *testing.T) {
+	s, fe := newTestStream(100 * time.Millisecond)
+
+	s.Update("Hel")
+	if msg := onlyMessage(t, fe); msg.Text != "Hel"+streamCursor || msg.Edits != 0 {
+		t.Fatalf("first update = %+v, want it sent right away", msg)
+	}
+
+	// Updates inside the interval are folded into one later edit
+	s.Update("Hello")
+	s.Update("Hello, wor")
+	if msg := onlyMessage(t, fe); msg.Edits != 0 {
+		t.Fatalf("edited %d times within the interval, want 0", msg.Edits)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for onlyMessage(t, fe).Edits == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the throttled edit never happened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if msg := onlyMessage(t, fe); msg.Text != "Hello, wor"+streamCursor || msg.Edits != 1 {
+		t.Errorf("after the interval = %+v, want one edit with the latest text", msg)
+	}
+}
+
+func TestStreamingMessageFinish(t *testing.T) {
+	// Intermediate blocks are finished in place
+	s, fe := newTestStream(50 * time.Millisecond)
+	s.Update("Looking")
+	s.Update("Looking at it") // Scheduled, dropped by Finish
+	if !s.Finish("Looking at it now.", true) {
+		t.Fatal("Finish(keep) = false, want the live message edited")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if msg := onlyMessage(t, fe); msg.Text != "Looking at it now." || msg.Edits != 1 || msg.Deleted {
+		t.Errorf("finished message = %+v, want the full text without the cursor", msg)
+	}
+
+	// The next block starts a new message
+	s.Update("Next")
+	if msgs := fe.Messages(testChat); len(msgs) != 2 || msgs[1].Text != "Next"+streamCursor {
+		t.Errorf("messages = %+v, want the next block in a new message", msgs)
+	}
+
+	// The final message is deleted so the caller can send it with sound
+	if s.Finish("Next and last.", false) {
+		t.Error("Finish(!keep) = true, want the text left to the caller")
+	}
+	if msgs := fe.Messages(testChat); !msgs[1].Deleted {
+		t.Errorf("live message = %+v, want it deleted", msgs[1])
+	}
+
+	// Nothing streamed, nothing to finish
+	if s.Finish("unstreamed", true) {
+		t.Error("Finish() without a live message = true")
+	}
+}
+
+func TestStreamingMessageFinishTooLong(t *testing.T) {
+	s, fe := newTestStream(time.Hour)
+	s.Update("Start")
+
+	if s.Finish(strings.Repeat("x", streamMaxLen+1), true) {
+		t.Error("Finish(keep) with an overlong text = true, want it sent fresh")
+	}
+	if msg := onlyMessage(t, fe); !msg.Deleted {
+		t.Errorf("live message = %+v, want it deleted", msg)
+	}
+}
+
+func TestStreamingMessageClear(t *testing.T) {
+	s, fe := newTestStream(time.Hour)
+	s.Update("Partial")
+	s.Update("Partial answer") // Scheduled, dropped by Clear
+
+	s.Clear()
+	if msg := onlyMessage(t, fe); msg.Text != "Partial answer" || msg.Deleted {
+		t.Errorf("cleared message = %+v, want the latest text without the cursor", msg)
+	}
+
+	// Clearing again, or with nothing streamed, sends nothing
+	s.Clear()
+	if msg := onlyMessage(t, fe); msg.Edits != 1 {
+		t.Errorf("edited %d times, want 1", msg.Edits)
+	}
+}
+
+func TestStreamingMessageDisplay(t *testing.T) {
+	s, fe := newTestStream(time.Hour)
+
+	// An open code fence is closed so the partial text still formats
+	s.Update("Run:\n```sh\ngo te")
+	if msg := onlyMessage(t, fe); msg.Text != "Run:\n```sh\ngo te"+streamCursor+"\n```" {
+		t.Errorf("text = %q, want the fence closed after the cursor", msg.Text)
+	}
+
+	// Long text shows its tail
+	s, fe = newTestStream(time.Hour)
+	s.Update(strings.Repeat("a", streamMaxLen) + "tail")
+	text := onlyMessage(t, fe).Text
+	if !strings.HasPrefix(text, "…") || !strings.HasSuffix(text, "tail"+streamCursor) || len(text) > streamMaxLen+len("…")+len(streamCursor) {
+		t.Errorf("long text = %q…, want the tail after an ellipsis", text[:20])
+	}
+}
@@ -1,10 +1,11 @@
-package telegram
+package trackers
 
 import (
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/codegangsta/aria/internal/frontend"
 	"github.com/codegangsta/aria/internal/types"
 )
 
@@ -31,7 +32,7 @@ type ToolStatusTracker struct {
 	msgID    int64 // 0 if no message sent yet
 	tools    []TrackedTool
 	mu       sync.Mutex
-	bot      *Bot
+	fe       frontend.Frontend
 	dirty    bool
 	updateCh chan struct{}
 	doneCh   chan struct{}
@@ -39,10 +40,10 @@ type ToolStatusTracker struct {
 }
 
 // NewToolStatusTracker creates a new tracker for a chat
-func NewToolStatusTracker(bot *Bot, chatID int64) *ToolStatusTracker {
+func NewToolStatusTracker(fe frontend.Frontend, chatID int64) *ToolStatusTracker {
 	t := &ToolStatusTracker{
 		chatID:   chatID,
-		bot:      bot,
+		fe:       fe,
 		tools:    make([]TrackedTool, 0),
 		updateCh: make(chan struct{}, 1),
 		doneCh:   make(chan struct{}),
@@ -195,7 +196,7 @@ func (t *ToolStatusTracker) render() {
 	if msgID == 0 {
 		// Send new message - keep lock to prevent race where two renders
 		// both see msgID=0 and both send new messages
-		newMsgID, err := t.bot.SendToolNotification(t.chatID, content)
+		newMsgID, err := t.fe.SendStatus(t.chatID, content)
 		if err == nil {
 			t.msgID = newMsgID
 		}
@@ -203,7 +204,7 @@ func (t *ToolStatusTracker) render() {
 	} else {
 		// Edit existing message - safe to release lock first
 		t.mu.Unlock()
-		t.bot.EditMessageMarkdownV2(t.chatID, msgID, content)
+		t.fe.EditStatus(t.chatID, msgID, content)
 	}
 }
 
@@ -226,6 +227,5 @@ func (t *ToolStatusTracker) buildContent() string {
 		lines = append(lines, prefix+" "+text)
 	}
 
-	// Wrap entire block in italic
-	return "_" + strings.Join(lines, "\n") + "_"
+	return strings.Join(lines, "\n")
 }
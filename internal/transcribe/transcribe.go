@@ -0,0 +1,102 @@
+// Package transcribe turns voice messages into text for Claude
+//
+// Whisper runs a local whisper.cpp binary and is the default; Command runs
+// any other transcriber that prints the transcript to stdout.
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Transcriber turns an audio file into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, path string) (string, error)
+}
+
+// FilePlaceholder is replaced by the audio file's path in Command args
+const FilePlaceholder = "{file}"
+
+// Command transcribes by running a command that prints the transcript
+type Command struct {
+	Args []string // program and arguments, FilePlaceholder marks the audio file
+}
+
+// Transcribe runs the command on the audio file
+func (c Command) Transcribe(ctx context.Context, path string) (string, error) {
+	if len(c.Args) == 0 {
+		return "", fmt.Errorf("no transcription command configured")
+	}
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.ReplaceAll(arg, FilePlaceholder, path)
+	}
+	out, err := run(ctx, args[0], args[1:]...)
+	if err != nil {
+		return "", err
+	}
+	return clean(out), nil
+}
+
+// Whisper transcribes with a local whisper.cpp binary
+// Audio is converted to the 16kHz mono WAV whisper.cpp expects with ffmpeg
+type Whisper struct {
+	Binary   string // whisper.cpp CLI, e.g. "whisper-cli"
+	Model    string // ggml model file, e.g. ggml-base.en.bin
+	Language string // spoken language, empty = the model's default
+	FFmpeg   string // ffmpeg binary, empty = "ffmpeg"
+}
+
+// Transcribe converts the audio file to WAV and runs whisper.cpp on it
+func (w Whisper) Transcribe(ctx context.Context, path string) (string, error) {
+	ffmpeg := w.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+
+	dir, err := os.MkdirTemp("", "aria-whisper-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	wav := filepath.Join(dir, "audio.wav")
+	if _, err := run(ctx, ffmpeg, "-nostdin", "-loglevel", "error", "-i", path, "-ar", "16000", "-ac", "1", wav); err != nil {
+		return "", fmt.Errorf("converting audio: %w", err)
+	}
+
+	args := []string{"-m", w.Model, "-f", wav, "--no-timestamps", "--no-prints"}
+	if w.Language != "" {
+		args = append(args, "-l", w.Language)
+	}
+	out, err := run(ctx, w.Binary, args...)
+	if err != nil {
+		return "", err
+	}
+	return clean(out), nil
+}
+
+// run runs a command and returns its stdout, with stderr in the error
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", filepath.Base(name), err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	return stdout.String(), nil
+}
+
+// clean joins a transcript's lines (whisper.cpp prints one per segment)
+func clean(out string) string {
+	return strings.Join(strings.Fields(out), " ")
+}
@@ -20,3 +20,14 @@ type ToolResult struct {
 	ToolID  string
 	IsError bool
 }
+
+// Usage represents token usage and cost reported by Claude for a turn
+type Usage struct {
+	InputTokens              int
+	OutputTokens             int
+	CacheCreationInputTokens int
+	CacheReadInputTokens     int
+	CostUSD                  float64
+	DurationMs               int64
+	NumTurns                 int
+}